@@ -38,6 +38,12 @@ func WithSpecialProxy(specialProxy string) Addition {
 	}
 }
 
+func WithHTTPRequest(request *C.HTTPRequest) Addition {
+	return func(metadata *C.Metadata) {
+		metadata.HTTP = request
+	}
+}
+
 func WithDstAddr(addr net.Addr) Addition {
 	return func(metadata *C.Metadata) {
 		_ = metadata.SetRemoteAddr(addr)
@@ -25,6 +25,9 @@ type Base struct {
 	rmark  int
 	id     string
 	prefer C.DNSPrefer
+	dscp   int
+	ttl    int
+	pool   *connPool
 }
 
 // Name implements C.ProxyAdapter
@@ -102,10 +105,14 @@ func (b *Base) IsL3Protocol(metadata *C.Metadata) bool {
 
 // MarshalJSON implements C.ProxyAdapter
 func (b *Base) MarshalJSON() ([]byte, error) {
-	return json.Marshal(map[string]string{
+	mapping := map[string]any{
 		"type": b.Type().String(),
 		"id":   b.Id(),
-	})
+	}
+	if b.pool != nil {
+		mapping["conn-pool"] = b.pool.Stats()
+	}
+	return json.Marshal(mapping)
 }
 
 // Addr implements C.ProxyAdapter
@@ -128,6 +135,14 @@ func (b *Base) DialOptions(opts ...dialer.Option) []dialer.Option {
 		opts = append(opts, dialer.WithRoutingMark(b.rmark))
 	}
 
+	if b.dscp != 0 {
+		opts = append(opts, dialer.WithDSCP(b.dscp))
+	}
+
+	if b.ttl != 0 {
+		opts = append(opts, dialer.WithTTL(b.ttl))
+	}
+
 	switch b.prefer {
 	case C.IPv4Only:
 		opts = append(opts, dialer.WithOnlySingleStack(true))
@@ -158,6 +173,22 @@ type BasicOption struct {
 	RoutingMark int    `proxy:"routing-mark,omitempty" group:"routing-mark,omitempty"`
 	IPVersion   string `proxy:"ip-version,omitempty" group:"ip-version,omitempty"`
 	DialerProxy string `proxy:"dialer-proxy,omitempty"` // don't apply this option into groups, but can set a group name in a proxy
+	DSCP        int    `proxy:"dscp,omitempty"`
+	InheritDSCP bool   `proxy:"inherit-dscp,omitempty"`
+	TTL         int    `proxy:"ttl,omitempty"`
+}
+
+// Check validates the values of the options
+func (b BasicOption) Check() error {
+	return dialer.CheckSocketMark(b.dscp(), b.TTL)
+}
+
+// dscp returns the DSCP of the outgoing packets, inherit-dscp takes precedence over dscp
+func (b BasicOption) dscp() int {
+	if b.InheritDSCP {
+		return dialer.DSCPInherit
+	}
+	return b.DSCP
 }
 
 type BaseOption struct {
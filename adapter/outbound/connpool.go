@@ -0,0 +1,208 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	C "github.com/metacubex/mihomo/constant"
+	"github.com/metacubex/mihomo/log"
+)
+
+const (
+	defaultConnPoolIdleTimeout = 15 * time.Second
+	// connPoolWarmDuration is how long the pool keeps replenishing after the last use
+	connPoolWarmDuration = 5 * time.Minute
+)
+
+var errConnPoolNetwork = errors.New("conn-pool only supports the tcp network with tls")
+
+type ConnPoolOptions struct {
+	Size        int `proxy:"size,omitempty"`
+	IdleTimeout int `proxy:"idle-timeout,omitempty"`
+}
+
+// Build returns nil if the pool is disabled
+func (o ConnPoolOptions) Build(name string, dial func(ctx context.Context) (net.Conn, error)) *connPool {
+	if o.Size <= 0 {
+		return nil
+	}
+	idleTimeout := time.Duration(o.IdleTimeout) * time.Second
+	if idleTimeout <= 0 {
+		idleTimeout = defaultConnPoolIdleTimeout
+	}
+	return &connPool{
+		name:        name,
+		size:        o.Size,
+		idleTimeout: idleTimeout,
+		dial:        dial,
+		done:        make(chan struct{}),
+	}
+}
+
+type idleConn struct {
+	conn  net.Conn
+	since time.Time
+}
+
+// connPool keeps pre-handshaked transport connections of a proxy, it starts filling on
+// the first Get and stops after connPoolWarmDuration without any Get
+type connPool struct {
+	name        string
+	size        int
+	idleTimeout time.Duration
+	dial        func(ctx context.Context) (net.Conn, error)
+
+	mutex    sync.Mutex
+	idle     []idleConn
+	dialing  int
+	lastUsed time.Time
+	running  bool
+	closed   bool
+	done     chan struct{}
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// Get returns an idle connection or nil if there is none, the pool is replenished in the background
+func (p *connPool) Get() net.Conn {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		return nil
+	}
+	p.lastUsed = time.Now()
+	var conn net.Conn
+	for len(p.idle) > 0 {
+		ic := p.idle[0]
+		p.idle = p.idle[1:]
+		if time.Since(ic.since) < p.idleTimeout {
+			conn = ic.conn
+			break
+		}
+		_ = ic.conn.Close()
+	}
+
+	if conn != nil {
+		p.hits.Add(1)
+	} else {
+		p.misses.Add(1)
+	}
+
+	if !p.running {
+		p.running = true
+		go p.loop()
+	}
+	p.fillLocked()
+	return conn
+}
+
+func (p *connPool) fillLocked() {
+	for len(p.idle)+p.dialing < p.size {
+		p.dialing++
+		go p.dialOne()
+	}
+}
+
+func (p *connPool) dialOne() {
+	ctx, cancel := context.WithTimeout(context.Background(), C.DefaultTLSTimeout)
+	defer cancel()
+	conn, err := p.dial(ctx)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.dialing--
+	if err != nil {
+		// retry in the next tick of loop
+		log.Debugln("[ConnPool](%s) pre-connect failed: %s", p.name, err)
+		return
+	}
+	if !p.running {
+		_ = conn.Close()
+		return
+	}
+	p.idle = append(p.idle, idleConn{conn: conn, since: time.Now()})
+}
+
+// loop evicts expired connections and replenishes the pool until it is not used for a while
+func (p *connPool) loop() {
+	interval := p.idleTimeout / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !p.tick() {
+				return
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *connPool) tick() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return false
+	}
+
+	idle := p.idle[:0]
+	for _, ic := range p.idle {
+		if time.Since(ic.since) < p.idleTimeout {
+			idle = append(idle, ic)
+		} else {
+			_ = ic.conn.Close()
+		}
+	}
+	p.idle = idle
+
+	if time.Since(p.lastUsed) > connPoolWarmDuration {
+		p.closeLocked()
+		return false
+	}
+	p.fillLocked()
+	return true
+}
+
+// Close stops the pool and closes the idle connections, it is called when the proxy is removed
+func (p *connPool) Close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.done)
+	p.closeLocked()
+}
+
+func (p *connPool) closeLocked() {
+	p.running = false
+	for _, ic := range p.idle {
+		_ = ic.conn.Close()
+	}
+	p.idle = nil
+}
+
+// Stats is shown in the proxy JSON
+func (p *connPool) Stats() map[string]any {
+	p.mutex.Lock()
+	idle := len(p.idle)
+	p.mutex.Unlock()
+	return map[string]any{
+		"size":   p.size,
+		"idle":   idle,
+		"hits":   p.hits.Load(),
+		"misses": p.misses.Load(),
+	}
+}
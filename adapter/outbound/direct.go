@@ -14,12 +14,15 @@ import (
 
 type Direct struct {
 	*Base
-	loopBack *loopback.Detector
+	loopBack   *loopback.Detector
+	sourcePool *dialer.SourcePool
 }
 
 type DirectOption struct {
 	BasicOption
-	Name string `proxy:"name"`
+	Name                  string   `proxy:"name"`
+	SourceAddresses       []string `proxy:"source-addresses,omitempty"`
+	SourceAddressStrategy string   `proxy:"source-address-strategy,omitempty"`
 }
 
 // DialContext implements C.ProxyAdapter
@@ -28,6 +31,9 @@ func (d *Direct) DialContext(ctx context.Context, metadata *C.Metadata, opts ...
 		return nil, err
 	}
 	opts = append(opts, dialer.WithResolver(resolver.DefaultResolver))
+	if d.sourcePool != nil {
+		opts = append(opts, dialer.WithSourcePool(d.sourcePool))
+	}
 	c, err := dialer.DialContext(ctx, "tcp", metadata.RemoteAddress(), d.Base.DialOptions(opts...)...)
 	if err != nil {
 		return nil, err
@@ -49,6 +55,9 @@ func (d *Direct) ListenPacketContext(ctx context.Context, metadata *C.Metadata,
 		}
 		metadata.DstIP = ip
 	}
+	if d.sourcePool != nil {
+		opts = append(opts, dialer.WithSourcePool(d.sourcePool))
+	}
 	pc, err := dialer.NewDialer(d.Base.DialOptions(opts...)...).ListenPacket(ctx, "udp", "", netip.AddrPortFrom(metadata.DstIP, metadata.DstPort))
 	if err != nil {
 		return nil, err
@@ -56,7 +65,15 @@ func (d *Direct) ListenPacketContext(ctx context.Context, metadata *C.Metadata,
 	return d.loopBack.NewPacketConn(newPacketConn(pc, d)), nil
 }
 
-func NewDirectWithOption(option DirectOption) *Direct {
+func NewDirectWithOption(option DirectOption) (*Direct, error) {
+	var sourcePool *dialer.SourcePool
+	if len(option.SourceAddresses) != 0 {
+		var err error
+		sourcePool, err = dialer.NewSourcePool(option.SourceAddresses, option.SourceAddressStrategy)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return &Direct{
 		Base: &Base{
 			name:   option.Name,
@@ -66,10 +83,13 @@ func NewDirectWithOption(option DirectOption) *Direct {
 			mpTcp:  option.MPTCP,
 			iface:  option.Interface,
 			rmark:  option.RoutingMark,
+			dscp:   option.dscp(),
+			ttl:    option.TTL,
 			prefer: C.NewDNSPrefer(option.IPVersion),
 		},
-		loopBack: loopback.NewDetector(),
-	}
+		loopBack:   loopback.NewDetector(),
+		sourcePool: sourcePool,
+	}, nil
 }
 
 func NewDirect() *Direct {
@@ -153,6 +153,8 @@ func NewDnsWithOption(option DnsOption) *Dns {
 			mpTcp:  option.MPTCP,
 			iface:  option.Interface,
 			rmark:  option.RoutingMark,
+			dscp:   option.dscp(),
+			ttl:    option.TTL,
 			prefer: C.NewDNSPrefer(option.IPVersion),
 		},
 	}
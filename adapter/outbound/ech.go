@@ -0,0 +1,33 @@
+package outbound
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/metacubex/mihomo/component/ech"
+)
+
+type ECHOptions struct {
+	Enable          bool   `proxy:"enable,omitempty"`
+	Config          string `proxy:"config,omitempty"`
+	QueryServerName string `proxy:"query-server-name,omitempty"`
+	Fallback        bool   `proxy:"fallback,omitempty"`
+}
+
+func (o ECHOptions) Parse() (*ech.Config, error) {
+	if !o.Enable {
+		return nil, nil
+	}
+	config := &ech.Config{
+		QueryServerName: o.QueryServerName,
+		Fallback:        o.Fallback,
+	}
+	if o.Config != "" {
+		list, err := base64.StdEncoding.DecodeString(o.Config)
+		if err != nil {
+			return nil, fmt.Errorf("decode ech config list failed: %w", err)
+		}
+		config.ConfigList = list
+	}
+	return config, nil
+}
@@ -16,6 +16,7 @@ import (
 	N "github.com/metacubex/mihomo/common/net"
 	"github.com/metacubex/mihomo/component/ca"
 	"github.com/metacubex/mihomo/component/dialer"
+	"github.com/metacubex/mihomo/component/ech"
 	"github.com/metacubex/mihomo/component/proxydialer"
 	C "github.com/metacubex/mihomo/constant"
 )
@@ -25,6 +26,7 @@ type Http struct {
 	user      string
 	pass      string
 	tlsConfig *tls.Config
+	echConfig *ech.Config
 	option    *HttpOption
 }
 
@@ -39,17 +41,28 @@ type HttpOption struct {
 	SNI            string            `proxy:"sni,omitempty"`
 	SkipCertVerify bool              `proxy:"skip-cert-verify,omitempty"`
 	Fingerprint    string            `proxy:"fingerprint,omitempty"`
+	Certificate    string            `proxy:"certificate,omitempty"`
+	PrivateKey     string            `proxy:"private-key,omitempty"`
+	ECHOpts        ECHOptions        `proxy:"ech-opts,omitempty"`
 	Headers        map[string]string `proxy:"headers,omitempty"`
 }
 
 // StreamConnContext implements C.ProxyAdapter
 func (h *Http) StreamConnContext(ctx context.Context, c net.Conn, metadata *C.Metadata) (net.Conn, error) {
 	if h.tlsConfig != nil {
-		cc := tls.Client(c, h.tlsConfig)
-		err := cc.HandshakeContext(ctx)
-		c = cc
-		if err != nil {
-			return nil, fmt.Errorf("%s connect error: %w", h.addr, err)
+		if h.echConfig != nil {
+			cc, err := h.echConfig.ClientHandshake(ctx, c, h.tlsConfig)
+			if err != nil {
+				return nil, fmt.Errorf("%s connect error: %w", h.addr, err)
+			}
+			c = cc
+		} else {
+			cc := tls.Client(c, h.tlsConfig)
+			err := cc.HandshakeContext(ctx)
+			c = cc
+			if err != nil {
+				return nil, fmt.Errorf("%s connect error: %w", h.addr, err)
+			}
 		}
 	}
 
@@ -152,19 +165,30 @@ func (h *Http) shakeHand(metadata *C.Metadata, rw io.ReadWriter) error {
 
 func NewHttp(option HttpOption) (*Http, error) {
 	var tlsConfig *tls.Config
+	var echConfig *ech.Config
 	if option.TLS {
 		sni := option.Server
 		if option.SNI != "" {
 			sni = option.SNI
 		}
-		var err error
+		certificates, err := ca.LoadClientCertificate(option.Certificate, option.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+
 		tlsConfig, err = ca.GetSpecifiedFingerprintTLSConfig(&tls.Config{
 			InsecureSkipVerify: option.SkipCertVerify,
 			ServerName:         sni,
+			Certificates:       certificates,
 		}, option.Fingerprint)
 		if err != nil {
 			return nil, err
 		}
+
+		echConfig, err = option.ECHOpts.Parse()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return &Http{
@@ -176,11 +200,14 @@ func NewHttp(option HttpOption) (*Http, error) {
 			mpTcp:  option.MPTCP,
 			iface:  option.Interface,
 			rmark:  option.RoutingMark,
+			dscp:   option.dscp(),
+			ttl:    option.TTL,
 			prefer: C.NewDNSPrefer(option.IPVersion),
 		},
 		user:      option.UserName,
 		pass:      option.Password,
 		tlsConfig: tlsConfig,
+		echConfig: echConfig,
 		option:    &option,
 	}, nil
 }
@@ -19,6 +19,7 @@ import (
 	"github.com/metacubex/mihomo/component/proxydialer"
 	C "github.com/metacubex/mihomo/constant"
 	"github.com/metacubex/mihomo/log"
+	congestionRegistry "github.com/metacubex/mihomo/transport/congestion"
 	hyCongestion "github.com/metacubex/mihomo/transport/hysteria/congestion"
 	"github.com/metacubex/mihomo/transport/hysteria/core"
 	"github.com/metacubex/mihomo/transport/hysteria/obfs"
@@ -109,6 +110,9 @@ type HysteriaOption struct {
 	DisableMTUDiscovery bool     `proxy:"disable-mtu-discovery,omitempty"`
 	FastOpen            bool     `proxy:"fast-open,omitempty"`
 	HopInterval         int      `proxy:"hop-interval,omitempty"`
+
+	CongestionController string `proxy:"congestion-controller,omitempty"`
+	CWND                 int    `proxy:"cwnd,omitempty"`
 }
 
 func (c *HysteriaOption) Speed() (uint64, uint64, error) {
@@ -210,9 +214,25 @@ func NewHysteria(option HysteriaOption) (*Hysteria, error) {
 	if option.DownSpeed != 0 {
 		down = uint64(option.DownSpeed * mbpsToBps)
 	}
+	if option.CongestionController == "" {
+		option.CongestionController = "brutal"
+	}
+	if err := congestionRegistry.Check(option.CongestionController, congestionRegistry.Options{BrutalRate: up}); err != nil {
+		return nil, fmt.Errorf("hysteria %s: %w", addr, err)
+	}
 	client, err := core.NewClient(
-		addr, ports, option.Protocol, auth, tlsConfig, quicConfig, clientTransport, up, down, func(refBPS uint64) congestion.CongestionControl {
-			return hyCongestion.NewBrutalSender(congestion.ByteCount(refBPS))
+		addr, ports, option.Protocol, auth, tlsConfig, quicConfig, clientTransport, up, down, func(qs quic.Connection, refBPS uint64) congestion.CongestionControl {
+			// brutal sends at the rate negotiated with the server
+			cc, err := congestionRegistry.New(qs, option.CongestionController, congestionRegistry.Options{
+				CWND:       option.CWND,
+				BrutalRate: refBPS,
+				Tag:        option.Name,
+			})
+			if err != nil {
+				log.Warnln("[Hysteria](%s) %s, fallback to brutal", option.Name, err)
+				return hyCongestion.NewBrutalSender(congestion.ByteCount(refBPS))
+			}
+			return cc
 		}, obfuscator, hopInterval, option.FastOpen,
 	)
 	if err != nil {
@@ -227,6 +247,8 @@ func NewHysteria(option HysteriaOption) (*Hysteria, error) {
 			tfo:    option.FastOpen,
 			iface:  option.Interface,
 			rmark:  option.RoutingMark,
+			dscp:   option.dscp(),
+			ttl:    option.TTL,
 			prefer: C.NewDNSPrefer(option.IPVersion),
 		},
 		option: &option,
@@ -14,11 +14,14 @@ import (
 	"github.com/metacubex/mihomo/common/utils"
 	"github.com/metacubex/mihomo/component/ca"
 	"github.com/metacubex/mihomo/component/dialer"
+	"github.com/metacubex/mihomo/component/ech"
 	"github.com/metacubex/mihomo/component/proxydialer"
 	C "github.com/metacubex/mihomo/constant"
 	"github.com/metacubex/mihomo/log"
+	"github.com/metacubex/mihomo/transport/congestion"
 	tuicCommon "github.com/metacubex/mihomo/transport/tuic/common"
 
+	"github.com/metacubex/quic-go"
 	"github.com/metacubex/sing-quic/hysteria2"
 
 	M "github.com/sagernet/sing/common/metadata"
@@ -26,7 +29,52 @@ import (
 )
 
 func init() {
-	hysteria2.SetCongestionController = tuicCommon.SetCongestionController
+	hysteria2.SetCongestionController = setHysteria2CongestionController
+}
+
+type hysteria2CongestionOption struct {
+	name    string
+	options congestion.Options
+}
+
+func setHysteria2CongestionController(quicConn quic.Connection, cc string, cwnd int) {
+	options := congestion.Options{CWND: cwnd}
+	if addr, ok := quicConn.LocalAddr().(*hysteria2CongestionAddr); ok {
+		cc, options = addr.option.name, addr.option.options
+	}
+	tuicCommon.SetCongestionControllerWithOptions(quicConn, cc, options)
+}
+
+// hysteria2CongestionDialer wraps the packet conns to carry the congestion controller of
+// the outbound, since the hook of sing-quic is global and only gets the quic connection,
+// whose LocalAddr is the one of the packet conn
+type hysteria2CongestionDialer struct {
+	proxydialer.SingDialer
+	option hysteria2CongestionOption
+}
+
+func (d *hysteria2CongestionDialer) ListenPacket(ctx context.Context, destination M.Socksaddr) (net.PacketConn, error) {
+	pc, err := d.SingDialer.ListenPacket(ctx, destination)
+	if err != nil {
+		return nil, err
+	}
+	return &hysteria2CongestionConn{PacketConn: pc, option: d.option}, nil
+}
+
+// hysteria2CongestionConn hides the optional interfaces of the udp socket, so quic-go
+// reads it without the oob optimizations, as with salamander
+type hysteria2CongestionConn struct {
+	net.PacketConn
+	option hysteria2CongestionOption
+}
+
+func (c *hysteria2CongestionConn) LocalAddr() net.Addr {
+	return &hysteria2CongestionAddr{Addr: c.PacketConn.LocalAddr(), option: c.option}
+}
+
+type hysteria2CongestionAddr struct {
+	net.Addr
+	option hysteria2CongestionOption
 }
 
 const minHopInterval = 5
@@ -35,38 +83,47 @@ const defaultHopInterval = 30
 type Hysteria2 struct {
 	*Base
 
-	option *Hysteria2Option
-	client *hysteria2.Client
-	dialer proxydialer.SingDialer
+	option    *Hysteria2Option
+	client    *hysteria2.Client
+	dialer    proxydialer.SingDialer
+	echConfig *ech.Config
 }
 
+// hysteria2DialKey marks the contexts of the dials, see NewHysteria2
+type hysteria2DialKey struct{}
+
 type Hysteria2Option struct {
 	BasicOption
-	Name           string   `proxy:"name"`
-	Server         string   `proxy:"server"`
-	Port           int      `proxy:"port,omitempty"`
-	Ports          string   `proxy:"ports,omitempty"`
-	HopInterval    int      `proxy:"hop-interval,omitempty"`
-	Up             string   `proxy:"up,omitempty"`
-	Down           string   `proxy:"down,omitempty"`
-	Password       string   `proxy:"password,omitempty"`
-	Obfs           string   `proxy:"obfs,omitempty"`
-	ObfsPassword   string   `proxy:"obfs-password,omitempty"`
-	SNI            string   `proxy:"sni,omitempty"`
-	SkipCertVerify bool     `proxy:"skip-cert-verify,omitempty"`
-	Fingerprint    string   `proxy:"fingerprint,omitempty"`
-	ALPN           []string `proxy:"alpn,omitempty"`
-	CustomCA       string   `proxy:"ca,omitempty"`
-	CustomCAString string   `proxy:"ca-str,omitempty"`
-	CWND           int      `proxy:"cwnd,omitempty"`
-	UdpMTU         int      `proxy:"udp-mtu,omitempty"`
+	Name           string     `proxy:"name"`
+	Server         string     `proxy:"server"`
+	Port           int        `proxy:"port,omitempty"`
+	Ports          string     `proxy:"ports,omitempty"`
+	HopInterval    int        `proxy:"hop-interval,omitempty"`
+	Up             string     `proxy:"up,omitempty"`
+	Down           string     `proxy:"down,omitempty"`
+	Password       string     `proxy:"password,omitempty"`
+	Obfs           string     `proxy:"obfs,omitempty"`
+	ObfsPassword   string     `proxy:"obfs-password,omitempty"`
+	SNI            string     `proxy:"sni,omitempty"`
+	SkipCertVerify bool       `proxy:"skip-cert-verify,omitempty"`
+	Fingerprint    string     `proxy:"fingerprint,omitempty"`
+	ALPN           []string   `proxy:"alpn,omitempty"`
+	CustomCA       string     `proxy:"ca,omitempty"`
+	CustomCAString string     `proxy:"ca-str,omitempty"`
+	ECHOpts        ECHOptions `proxy:"ech-opts,omitempty"`
+	CWND           int        `proxy:"cwnd,omitempty"`
+	UdpMTU         int        `proxy:"udp-mtu,omitempty"`
+
+	// used when the server asks for auto bandwidth or up is not set, otherwise brutal is always used
+	CongestionController string `proxy:"congestion-controller,omitempty"`
 }
 
 func (h *Hysteria2) DialContext(ctx context.Context, metadata *C.Metadata, opts ...dialer.Option) (_ C.Conn, err error) {
 	options := h.Base.DialOptions(opts...)
 	h.dialer.SetDialer(dialer.NewDialer(options...))
-	c, err := h.client.DialConn(ctx, M.ParseSocksaddrHostPort(metadata.String(), metadata.DstPort))
+	c, err := h.client.DialConn(context.WithValue(ctx, hysteria2DialKey{}, struct{}{}), M.ParseSocksaddrHostPort(metadata.String(), metadata.DstPort))
 	if err != nil {
+		h.handleECHError(err)
 		return nil, err
 	}
 	return NewConn(CN.NewRefConn(c, h), h), nil
@@ -75,8 +132,9 @@ func (h *Hysteria2) DialContext(ctx context.Context, metadata *C.Metadata, opts
 func (h *Hysteria2) ListenPacketContext(ctx context.Context, metadata *C.Metadata, opts ...dialer.Option) (_ C.PacketConn, err error) {
 	options := h.Base.DialOptions(opts...)
 	h.dialer.SetDialer(dialer.NewDialer(options...))
-	pc, err := h.client.ListenPacket(ctx)
+	pc, err := h.client.ListenPacket(context.WithValue(ctx, hysteria2DialKey{}, struct{}{}))
 	if err != nil {
+		h.handleECHError(err)
 		return nil, err
 	}
 	if pc == nil {
@@ -85,6 +143,13 @@ func (h *Hysteria2) ListenPacketContext(ctx context.Context, metadata *C.Metadat
 	return newPacketConn(CN.NewRefPacketConn(CN.NewThreadSafePacketConn(pc), h), h), nil
 }
 
+// handleECHError records the retry configs when the server rejected ECH
+func (h *Hysteria2) handleECHError(err error) {
+	if h.echConfig != nil {
+		h.echConfig.HandleError(err)
+	}
+}
+
 func closeHysteria2(h *Hysteria2) {
 	if h.client != nil {
 		_ = h.client.CloseWithError(errors.New("proxy removed"))
@@ -134,6 +199,20 @@ func NewHysteria2(option Hysteria2Option) (*Hysteria2, error) {
 	}
 
 	singDialer := proxydialer.NewByNameSingDialer(option.DialerProxy, dialer.NewDialer())
+	if option.CongestionController != "" {
+		congestionOption := hysteria2CongestionOption{
+			name: option.CongestionController,
+			options: congestion.Options{
+				CWND:       option.CWND,
+				BrutalRate: StringToBps(option.Up),
+				Tag:        option.Name,
+			},
+		}
+		if err := congestion.Check(congestionOption.name, congestionOption.options); err != nil {
+			return nil, fmt.Errorf("hysteria2 %s: %w", addr, err)
+		}
+		singDialer = &hysteria2CongestionDialer{SingDialer: singDialer, option: congestionOption}
+	}
 
 	clientOptions := hysteria2.ClientOptions{
 		Context:            context.TODO(),
@@ -180,6 +259,27 @@ func NewHysteria2(option Hysteria2Option) (*Hysteria2, error) {
 		return nil, errors.New("invalid port")
 	}
 
+	echConfig, err := option.ECHOpts.Parse()
+	if err != nil {
+		return nil, err
+	}
+	if echConfig != nil {
+		// sing-quic keeps tlsConfig and only clones it when offering a new connection,
+		// right after calling ServerAddress under its connection lock, so the ECH of each
+		// dial is prepared on a private copy and copied there. The calls of the hop loop
+		// aren't dials and don't carry hysteria2DialKey.
+		baseConfig := tlsConfig.Clone()
+		serverAddress := clientOptions.ServerAddress
+		clientOptions.ServerAddress = func(ctx context.Context) (*net.UDPAddr, error) {
+			if ctx.Value(hysteria2DialKey{}) != nil {
+				if err := echConfig.ClientHandleCopy(ctx, tlsConfig, baseConfig); err != nil {
+					return nil, err
+				}
+			}
+			return serverAddress(ctx)
+		}
+	}
+
 	client, err := hysteria2.NewClient(clientOptions)
 	if err != nil {
 		return nil, err
@@ -193,11 +293,14 @@ func NewHysteria2(option Hysteria2Option) (*Hysteria2, error) {
 			udp:    true,
 			iface:  option.Interface,
 			rmark:  option.RoutingMark,
+			dscp:   option.dscp(),
+			ttl:    option.TTL,
 			prefer: C.NewDNSPrefer(option.IPVersion),
 		},
-		option: &option,
-		client: client,
-		dialer: singDialer,
+		option:    &option,
+		client:    client,
+		dialer:    singDialer,
+		echConfig: echConfig,
 	}
 	runtime.SetFinalizer(outbound, closeHysteria2)
 
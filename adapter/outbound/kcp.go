@@ -0,0 +1,64 @@
+package outbound
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	C "github.com/metacubex/mihomo/constant"
+	"github.com/metacubex/mihomo/transport/kcp"
+)
+
+type KCPOptions struct {
+	MTU              uint32 `proxy:"mtu,omitempty"`
+	TTI              uint32 `proxy:"tti,omitempty"`
+	UplinkCapacity   uint32 `proxy:"uplink-capacity,omitempty"`
+	DownlinkCapacity uint32 `proxy:"downlink-capacity,omitempty"`
+	Congestion       bool   `proxy:"congestion,omitempty"`
+	WriteBufferSize  uint32 `proxy:"write-buffer-size,omitempty"`
+	HeaderType       string `proxy:"header-type,omitempty"`
+	Seed             string `proxy:"seed,omitempty"`
+}
+
+func (o KCPOptions) Build() (*kcp.Config, error) {
+	if o.MTU != 0 && (o.MTU < 576 || o.MTU > 1460) {
+		return nil, fmt.Errorf("invalid kcp mtu: %d", o.MTU)
+	}
+	if o.TTI != 0 && (o.TTI < 10 || o.TTI > 100) {
+		return nil, fmt.Errorf("invalid kcp tti: %d", o.TTI)
+	}
+	if _, err := kcp.NewHeader(o.HeaderType); err != nil {
+		return nil, err
+	}
+	return &kcp.Config{
+		MTU:              o.MTU,
+		TTI:              o.TTI,
+		UplinkCapacity:   o.UplinkCapacity,
+		DownlinkCapacity: o.DownlinkCapacity,
+		Congestion:       o.Congestion,
+		WriteBufferSize:  o.WriteBufferSize,
+		HeaderType:       o.HeaderType,
+		Seed:             o.Seed,
+	}, nil
+}
+
+// dialStream dials addr by tcp, or starts a mKCP session on a new udp socket when kcpConfig is set
+func dialStream(ctx context.Context, dialer C.Dialer, addr string, prefer C.DNSPrefer, kcpConfig *kcp.Config) (net.Conn, error) {
+	if kcpConfig == nil {
+		return dialer.DialContext(ctx, "tcp", addr)
+	}
+	udpAddr, err := resolveUDPAddrWithPrefer(ctx, "udp", addr, prefer)
+	if err != nil {
+		return nil, err
+	}
+	pc, err := dialer.ListenPacket(ctx, "udp", "", udpAddr.AddrPort())
+	if err != nil {
+		return nil, err
+	}
+	c, err := kcp.NewConn(pc, udpAddr, kcpConfig)
+	if err != nil {
+		_ = pc.Close()
+		return nil, err
+	}
+	return c, nil
+}
@@ -322,6 +322,8 @@ func NewShadowSocks(option ShadowSocksOption) (*ShadowSocks, error) {
 			mpTcp:  option.MPTCP,
 			iface:  option.Interface,
 			rmark:  option.RoutingMark,
+			dscp:   option.dscp(),
+			ttl:    option.TTL,
 			prefer: C.NewDNSPrefer(option.IPVersion),
 		},
 		method: method,
@@ -184,6 +184,8 @@ func NewShadowSocksR(option ShadowSocksROption) (*ShadowSocksR, error) {
 			mpTcp:  option.MPTCP,
 			iface:  option.Interface,
 			rmark:  option.RoutingMark,
+			dscp:   option.dscp(),
+			ttl:    option.TTL,
 			prefer: C.NewDNSPrefer(option.IPVersion),
 		},
 		option:   &option,
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -11,14 +12,18 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	N "github.com/metacubex/mihomo/common/net"
 	"github.com/metacubex/mihomo/component/dialer"
 	"github.com/metacubex/mihomo/component/proxydialer"
 	C "github.com/metacubex/mihomo/constant"
+	"github.com/metacubex/mihomo/log"
 
 	"github.com/zhangyunhao116/fastrand"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 type Ssh struct {
@@ -39,6 +44,25 @@ type SshOption struct {
 	PrivateKeyPassphrase string   `proxy:"private-key-passphrase,omitempty"`
 	HostKey              []string `proxy:"host-key,omitempty"`
 	HostKeyAlgorithms    []string `proxy:"host-key-algorithms,omitempty"`
+	KnownHosts           string   `proxy:"known-hosts,omitempty"`
+
+	KeepAliveInterval int                 `proxy:"keep-alive-interval,omitempty"`
+	KeepAliveMaxCount int                 `proxy:"keep-alive-max-count,omitempty"`
+	PoolSize          int                 `proxy:"pool-size,omitempty"`
+	JumpHosts         []SshJumpHostOption `proxy:"jump-hosts,omitempty"`
+}
+
+// SshJumpHostOption is a ProxyJump hop, the jump hosts are connected in order before the server
+type SshJumpHostOption struct {
+	Server               string   `proxy:"server"`
+	Port                 int      `proxy:"port"`
+	UserName             string   `proxy:"username"`
+	Password             string   `proxy:"password,omitempty"`
+	PrivateKey           string   `proxy:"private-key,omitempty"`
+	PrivateKeyPassphrase string   `proxy:"private-key-passphrase,omitempty"`
+	HostKey              []string `proxy:"host-key,omitempty"`
+	HostKeyAlgorithms    []string `proxy:"host-key-algorithms,omitempty"`
+	KnownHosts           string   `proxy:"known-hosts,omitempty"`
 }
 
 func (s *Ssh) DialContext(ctx context.Context, metadata *C.Metadata, opts ...dialer.Option) (_ C.Conn, err error) {
@@ -49,7 +73,7 @@ func (s *Ssh) DialContext(ctx context.Context, metadata *C.Metadata, opts ...dia
 			return nil, err
 		}
 	}
-	client, err := s.client.connect(ctx, cDialer, s.addr)
+	client, err := s.client.connect(ctx, cDialer)
 	if err != nil {
 		return nil, err
 	}
@@ -61,18 +85,43 @@ func (s *Ssh) DialContext(ctx context.Context, metadata *C.Metadata, opts ...dia
 	return NewConn(N.NewRefConn(c, s), s), nil
 }
 
-type sshClient struct {
+type sshHop struct {
+	addr   string
 	config *ssh.ClientConfig
+}
+
+type sshSession struct {
+	mutex  sync.Mutex
 	client *ssh.Client
-	cMutex sync.Mutex
 }
 
-func (s *sshClient) connect(ctx context.Context, cDialer C.Dialer, addr string) (client *ssh.Client, err error) {
-	s.cMutex.Lock()
-	defer s.cMutex.Unlock()
+func (s *sshSession) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	if s.client != nil {
-		return s.client, nil
+		return s.client.Close()
+	}
+	return nil
+}
+
+type sshClient struct {
+	hops              []sshHop // jump hosts and then the server
+	keepAliveInterval time.Duration
+	keepAliveMaxCount int
+	sessions          []*sshSession
+	index             atomic.Uint32
+}
+
+// connect returns the ssh.Client of the next session in the pool, the session connects on demand
+func (s *sshClient) connect(ctx context.Context, cDialer C.Dialer) (client *ssh.Client, err error) {
+	session := s.sessions[s.index.Add(1)%uint32(len(s.sessions))]
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	if session.client != nil {
+		return session.client, nil
 	}
+
+	addr := s.hops[0].addr
 	c, err := cDialer.DialContext(ctx, "tcp", addr)
 	if err != nil {
 		return nil, err
@@ -88,47 +137,120 @@ func (s *sshClient) connect(ctx context.Context, cDialer C.Dialer, addr string)
 		defer done(&err)
 	}
 
-	clientConn, chans, reqs, err := ssh.NewClientConn(c, addr, s.config)
-	if err != nil {
-		return nil, err
+	var jumps []*ssh.Client
+	defer func() {
+		if err != nil {
+			for _, jump := range jumps {
+				_ = jump.Close()
+			}
+		}
+	}()
+
+	for i, hop := range s.hops {
+		if i > 0 {
+			// the previous hop is closed by the deferred cleanup if the jump fails
+			jumps = append(jumps, client)
+			c, err = client.DialContext(ctx, "tcp", hop.addr)
+			if err != nil {
+				return nil, fmt.Errorf("jump from %s to %s: %w", addr, hop.addr, err)
+			}
+			addr = hop.addr
+		}
+		clientConn, chans, reqs, err := ssh.NewClientConn(c, addr, hop.config)
+		if err != nil {
+			_ = c.Close()
+			return nil, fmt.Errorf("%s: %w", addr, err)
+		}
+		client = ssh.NewClient(clientConn, chans, reqs)
 	}
-	client = ssh.NewClient(clientConn, chans, reqs)
 
-	s.client = client
+	session.client = client
 
+	done := make(chan struct{})
 	go func() {
 		_ = client.Wait() // wait shutdown
+		close(done)
 		_ = client.Close()
-		s.cMutex.Lock()
-		defer s.cMutex.Unlock()
-		if s.client == client {
-			s.client = nil
+		for _, jump := range jumps {
+			_ = jump.Close()
+		}
+		session.mutex.Lock()
+		defer session.mutex.Unlock()
+		if session.client == client {
+			session.client = nil
 		}
 	}()
+	if s.keepAliveInterval > 0 {
+		go s.keepAlive(client, addr, done)
+	}
 
 	return client, nil
 }
 
+// keepAlive sends keepalive requests like ServerAliveInterval of OpenSSH,
+// the session is closed after keepAliveMaxCount requests without response
+func (s *sshClient) keepAlive(client *ssh.Client, addr string, done <-chan struct{}) {
+	ticker := time.NewTicker(s.keepAliveInterval)
+	defer ticker.Stop()
+	missed := 0
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		result := make(chan error, 1)
+		go func() {
+			// any reply, even a failure one, means the session is alive
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			result <- err
+		}()
+
+		timer := time.NewTimer(s.keepAliveInterval)
+		select {
+		case err := <-result:
+			timer.Stop()
+			if err != nil {
+				missed = s.keepAliveMaxCount
+			} else {
+				missed = 0
+			}
+		case <-timer.C:
+			missed++
+		case <-done:
+			timer.Stop()
+			return
+		}
+
+		if missed >= s.keepAliveMaxCount {
+			log.Warnln("[SSH] %s keepalive timeout, close the session", addr)
+			_ = client.Close()
+			return
+		}
+	}
+}
+
 func (s *sshClient) Close() error {
-	s.cMutex.Lock()
-	defer s.cMutex.Unlock()
-	if s.client != nil {
-		return s.client.Close()
+	var errs []error
+	for _, session := range s.sessions {
+		if err := session.Close(); err != nil {
+			errs = append(errs, err)
+		}
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
 func closeSsh(s *Ssh) {
 	_ = s.client.Close()
 }
 
-func NewSsh(option SshOption) (*Ssh, error) {
-	addr := net.JoinHostPort(option.Server, strconv.Itoa(option.Port))
-
+func (option SshJumpHostOption) clientConfig(version string) (*ssh.ClientConfig, error) {
 	config := ssh.ClientConfig{
 		User:              option.UserName,
 		HostKeyCallback:   ssh.InsecureIgnoreHostKey(),
 		HostKeyAlgorithms: option.HostKeyAlgorithms,
+		ClientVersion:     version,
 	}
 
 	if option.PrivateKey != "" {
@@ -159,6 +281,7 @@ func NewSsh(option SshOption) (*Ssh, error) {
 		config.Auth = append(config.Auth, ssh.Password(option.Password))
 	}
 
+	var callbacks []ssh.HostKeyCallback
 	if len(option.HostKey) != 0 {
 		keys := make([]ssh.PublicKey, len(option.HostKey))
 		for i, hostKey := range option.HostKey {
@@ -168,7 +291,7 @@ func NewSsh(option SshOption) (*Ssh, error) {
 			}
 			keys[i] = key
 		}
-		config.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		callbacks = append(callbacks, func(hostname string, remote net.Addr, key ssh.PublicKey) error {
 			serverKey := key.Marshal()
 			for _, hostKey := range keys {
 				if bytes.Equal(serverKey, hostKey.Marshal()) {
@@ -176,16 +299,81 @@ func NewSsh(option SshOption) (*Ssh, error) {
 				}
 			}
 			return fmt.Errorf("host key mismatch, server send :%s %s", key.Type(), base64.StdEncoding.EncodeToString(serverKey))
+		})
+	}
+	if option.KnownHosts != "" {
+		callback, err := knownhosts.New(C.Path.Resolve(option.KnownHosts))
+		if err != nil {
+			return nil, fmt.Errorf("load known hosts: %w", err)
+		}
+		callbacks = append(callbacks, callback)
+	}
+	if len(callbacks) != 0 {
+		// the host key is accepted by either the inline host keys or the known_hosts file
+		config.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) (err error) {
+			for _, callback := range callbacks {
+				if err = callback(hostname, remote, key); err == nil {
+					return nil
+				}
+			}
+			return err
 		}
 	}
 
+	return &config, nil
+}
+
+func NewSsh(option SshOption) (*Ssh, error) {
+	addr := net.JoinHostPort(option.Server, strconv.Itoa(option.Port))
+
 	version := "SSH-2.0-OpenSSH_"
 	if fastrand.Intn(2) == 0 {
 		version += "7." + strconv.Itoa(fastrand.Intn(10))
 	} else {
 		version += "8." + strconv.Itoa(fastrand.Intn(9))
 	}
-	config.ClientVersion = version
+
+	client := &sshClient{
+		keepAliveInterval: time.Duration(option.KeepAliveInterval) * time.Second,
+		keepAliveMaxCount: option.KeepAliveMaxCount,
+	}
+	if client.keepAliveMaxCount <= 0 {
+		client.keepAliveMaxCount = 3
+	}
+
+	poolSize := option.PoolSize
+	if poolSize <= 0 {
+		poolSize = 1
+	}
+	client.sessions = make([]*sshSession, poolSize)
+	for i := range client.sessions {
+		client.sessions[i] = &sshSession{}
+	}
+
+	hosts := append(append([]SshJumpHostOption{}, option.JumpHosts...), SshJumpHostOption{
+		Server:               option.Server,
+		Port:                 option.Port,
+		UserName:             option.UserName,
+		Password:             option.Password,
+		PrivateKey:           option.PrivateKey,
+		PrivateKeyPassphrase: option.PrivateKeyPassphrase,
+		HostKey:              option.HostKey,
+		HostKeyAlgorithms:    option.HostKeyAlgorithms,
+		KnownHosts:           option.KnownHosts,
+	})
+	for i, host := range hosts {
+		config, err := host.clientConfig(version)
+		if err != nil {
+			if i < len(option.JumpHosts) {
+				return nil, fmt.Errorf("jump host %d: %w", i, err)
+			}
+			return nil, err
+		}
+		client.hops = append(client.hops, sshHop{
+			addr:   net.JoinHostPort(host.Server, strconv.Itoa(host.Port)),
+			config: config,
+		})
+	}
 
 	outbound := &Ssh{
 		Base: &Base{
@@ -195,12 +383,12 @@ func NewSsh(option SshOption) (*Ssh, error) {
 			udp:    false,
 			iface:  option.Interface,
 			rmark:  option.RoutingMark,
+			dscp:   option.dscp(),
+			ttl:    option.TTL,
 			prefer: C.NewDNSPrefer(option.IPVersion),
 		},
 		option: &option,
-		client: &sshClient{
-			config: &config,
-		},
+		client: client,
 	}
 	runtime.SetFinalizer(outbound, closeSsh)
 
@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"runtime"
 	"strconv"
 
 	N "github.com/metacubex/mihomo/common/net"
 	"github.com/metacubex/mihomo/component/ca"
 	"github.com/metacubex/mihomo/component/dialer"
+	"github.com/metacubex/mihomo/component/ech"
 	"github.com/metacubex/mihomo/component/proxydialer"
 	tlsC "github.com/metacubex/mihomo/component/tls"
 	C "github.com/metacubex/mihomo/constant"
@@ -29,24 +31,29 @@ type Trojan struct {
 	transport    *gun.TransportWrap
 
 	realityConfig *tlsC.RealityConfig
+	echConfig     *ech.Config
 }
 
 type TrojanOption struct {
 	BasicOption
-	Name              string         `proxy:"name"`
-	Server            string         `proxy:"server"`
-	Port              int            `proxy:"port"`
-	Password          string         `proxy:"password"`
-	ALPN              []string       `proxy:"alpn,omitempty"`
-	SNI               string         `proxy:"sni,omitempty"`
-	SkipCertVerify    bool           `proxy:"skip-cert-verify,omitempty"`
-	Fingerprint       string         `proxy:"fingerprint,omitempty"`
-	UDP               bool           `proxy:"udp,omitempty"`
-	Network           string         `proxy:"network,omitempty"`
-	RealityOpts       RealityOptions `proxy:"reality-opts,omitempty"`
-	GrpcOpts          GrpcOptions    `proxy:"grpc-opts,omitempty"`
-	WSOpts            WSOptions      `proxy:"ws-opts,omitempty"`
-	ClientFingerprint string         `proxy:"client-fingerprint,omitempty"`
+	Name              string          `proxy:"name"`
+	Server            string          `proxy:"server"`
+	Port              int             `proxy:"port"`
+	Password          string          `proxy:"password"`
+	ALPN              []string        `proxy:"alpn,omitempty"`
+	SNI               string          `proxy:"sni,omitempty"`
+	SkipCertVerify    bool            `proxy:"skip-cert-verify,omitempty"`
+	Fingerprint       string          `proxy:"fingerprint,omitempty"`
+	Certificate       string          `proxy:"certificate,omitempty"`
+	PrivateKey        string          `proxy:"private-key,omitempty"`
+	UDP               bool            `proxy:"udp,omitempty"`
+	Network           string          `proxy:"network,omitempty"`
+	RealityOpts       RealityOptions  `proxy:"reality-opts,omitempty"`
+	ECHOpts           ECHOptions      `proxy:"ech-opts,omitempty"`
+	GrpcOpts          GrpcOptions     `proxy:"grpc-opts,omitempty"`
+	WSOpts            WSOptions       `proxy:"ws-opts,omitempty"`
+	ClientFingerprint string          `proxy:"client-fingerprint,omitempty"`
+	ConnPool          ConnPoolOptions `proxy:"conn-pool,omitempty"`
 }
 
 func (t *Trojan) plainStream(ctx context.Context, c net.Conn) (net.Conn, error) {
@@ -86,7 +93,7 @@ func (t *Trojan) StreamConnContext(ctx context.Context, c net.Conn, metadata *C.
 	}
 
 	if t.transport != nil {
-		c, err = gun.StreamGunWithConn(c, t.gunTLSConfig, t.gunConfig, t.realityConfig)
+		c, err = gun.StreamGunWithConn(c, t.gunTLSConfig, t.gunConfig, t.realityConfig, t.echConfig)
 	} else {
 		c, err = t.plainStream(ctx, c)
 	}
@@ -103,8 +110,41 @@ func (t *Trojan) StreamConnContext(ctx context.Context, c net.Conn, metadata *C.
 	return c, err
 }
 
+// dialTLS dials a tls connection without the trojan header for the conn pool
+func (t *Trojan) dialTLS(ctx context.Context) (_ net.Conn, err error) {
+	var cDialer C.Dialer = dialer.NewDialer(t.Base.DialOptions()...)
+	if len(t.option.DialerProxy) > 0 {
+		cDialer, err = proxydialer.NewByName(t.option.DialerProxy, cDialer)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c, err := cDialer.DialContext(ctx, "tcp", t.addr)
+	if err != nil {
+		return nil, fmt.Errorf("%s connect error: %w", t.addr, err)
+	}
+	N.TCPKeepAlive(c)
+
+	defer func(c net.Conn) {
+		safeConnClose(c, err)
+	}(c)
+
+	return t.instance.StreamConn(ctx, c)
+}
+
 // DialContext implements C.ProxyAdapter
 func (t *Trojan) DialContext(ctx context.Context, metadata *C.Metadata, opts ...dialer.Option) (_ C.Conn, err error) {
+	// pre-warmed tls connection
+	if t.pool != nil && len(opts) == 0 {
+		if c := t.pool.Get(); c != nil {
+			if err = t.instance.WriteHeader(c, trojan.CommandTCP, serializesSocksAddr(metadata)); err != nil {
+				c.Close()
+				return nil, err
+			}
+
+			return NewConn(c, t), nil
+		}
+	}
 	// gun transport
 	if t.transport != nil && len(opts) == 0 {
 		c, err := gun.StreamGunWithTransport(t.transport, t.gunConfig)
@@ -218,6 +258,10 @@ func (t *Trojan) SupportUOT() bool {
 	return true
 }
 
+func closeTrojan(t *Trojan) {
+	t.pool.Close()
+}
+
 func NewTrojan(option TrojanOption) (*Trojan, error) {
 	addr := net.JoinHostPort(option.Server, strconv.Itoa(option.Port))
 
@@ -244,6 +288,8 @@ func NewTrojan(option TrojanOption) (*Trojan, error) {
 			mpTcp:  option.MPTCP,
 			iface:  option.Interface,
 			rmark:  option.RoutingMark,
+			dscp:   option.dscp(),
+			ttl:    option.TTL,
 			prefer: C.NewDNSPrefer(option.IPVersion),
 		},
 		instance: trojan.New(tOption),
@@ -251,12 +297,32 @@ func NewTrojan(option TrojanOption) (*Trojan, error) {
 	}
 
 	var err error
+	tOption.Certificates, err = ca.LoadClientCertificate(option.Certificate, option.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
 	t.realityConfig, err = option.RealityOpts.Parse()
 	if err != nil {
 		return nil, err
 	}
 	tOption.Reality = t.realityConfig
 
+	t.echConfig, err = option.ECHOpts.Parse()
+	if err != nil {
+		return nil, err
+	}
+	tOption.ECH = t.echConfig
+
+	if option.ConnPool.Size > 0 {
+		if option.Network != "" && option.Network != "tcp" {
+			return nil, errConnPoolNetwork
+		}
+		// the pool goroutines stop after connPoolWarmDuration without use, then closeTrojan can run
+		t.pool = option.ConnPool.Build(t.name, t.dialTLS)
+		runtime.SetFinalizer(t, closeTrojan)
+	}
+
 	if option.Network == "grpc" {
 		dialFn := func(network, addr string) (net.Conn, error) {
 			var err error
@@ -269,7 +335,7 @@ func NewTrojan(option TrojanOption) (*Trojan, error) {
 			}
 			c, err := cDialer.DialContext(context.Background(), "tcp", t.addr)
 			if err != nil {
-				return nil, fmt.Errorf("%s connect error: %s", t.addr, err.Error())
+				return nil, fmt.Errorf("%s connect error: %w", t.addr, err)
 			}
 			N.TCPKeepAlive(c)
 			return c, nil
@@ -280,6 +346,7 @@ func NewTrojan(option TrojanOption) (*Trojan, error) {
 			MinVersion:         tls.VersionTLS12,
 			InsecureSkipVerify: tOption.SkipCertVerify,
 			ServerName:         tOption.ServerName,
+			Certificates:       tOption.Certificates,
 		}
 
 		var err error
@@ -288,7 +355,7 @@ func NewTrojan(option TrojanOption) (*Trojan, error) {
 			return nil, err
 		}
 
-		t.transport = gun.NewHTTP2Client(dialFn, tlsConfig, tOption.ClientFingerprint, t.realityConfig)
+		t.transport = gun.NewHTTP2Client(dialFn, tlsConfig, tOption.ClientFingerprint, t.realityConfig, t.echConfig)
 
 		t.gunTLSConfig = tlsConfig
 		t.gunConfig = &gun.Config{
@@ -15,6 +15,7 @@ import (
 	"github.com/metacubex/mihomo/component/proxydialer"
 	"github.com/metacubex/mihomo/component/resolver"
 	C "github.com/metacubex/mihomo/constant"
+	"github.com/metacubex/mihomo/transport/congestion"
 	"github.com/metacubex/mihomo/transport/tuic"
 
 	"github.com/gofrs/uuid/v5"
@@ -50,6 +51,7 @@ type TuicOption struct {
 	FastOpen             bool   `proxy:"fast-open,omitempty"`
 	MaxOpenStreams       int    `proxy:"max-open-streams,omitempty"`
 	CWND                 int    `proxy:"cwnd,omitempty"`
+	BrutalUp             string `proxy:"brutal-up,omitempty"`
 	SkipCertVerify       bool   `proxy:"skip-cert-verify,omitempty"`
 	Fingerprint          string `proxy:"fingerprint,omitempty"`
 	CustomCA             string `proxy:"ca,omitempty"`
@@ -60,6 +62,8 @@ type TuicOption struct {
 	MaxDatagramFrameSize int    `proxy:"max-datagram-frame-size,omitempty"`
 	SNI                  string `proxy:"sni,omitempty"`
 
+	ECHOpts ECHOptions `proxy:"ech-opts,omitempty"`
+
 	UDPOverStream        bool `proxy:"udp-over-stream,omitempty"`
 	UDPOverStreamVersion int  `proxy:"udp-over-stream-version,omitempty"`
 }
@@ -170,6 +174,11 @@ func NewTuic(option TuicOption) (*Tuic, error) {
 		tlsConfig.NextProtos = []string{"h3"}
 	}
 
+	echConfig, err := option.ECHOpts.Parse()
+	if err != nil {
+		return nil, err
+	}
+
 	if option.RequestTimeout == 0 {
 		option.RequestTimeout = 8000
 	}
@@ -195,6 +204,11 @@ func NewTuic(option TuicOption) (*Tuic, error) {
 		option.CWND = 32
 	}
 
+	brutalRate := StringToBps(option.BrutalUp)
+	if err := congestion.Check(option.CongestionController, congestion.Options{BrutalRate: brutalRate}); err != nil {
+		return nil, fmt.Errorf("tuic %s: %w", addr, err)
+	}
+
 	packetOverHead := tuic.PacketOverHeadV4
 	if len(option.Token) == 0 {
 		packetOverHead = tuic.PacketOverHeadV5
@@ -258,6 +272,8 @@ func NewTuic(option TuicOption) (*Tuic, error) {
 			tfo:    option.FastOpen,
 			iface:  option.Interface,
 			rmark:  option.RoutingMark,
+			dscp:   option.dscp(),
+			ttl:    option.TTL,
 			prefer: C.NewDNSPrefer(option.IPVersion),
 		},
 		option: &option,
@@ -278,6 +294,7 @@ func NewTuic(option TuicOption) (*Tuic, error) {
 		tkn := tuic.GenTKN(option.Token)
 		clientOption := &tuic.ClientOptionV4{
 			TlsConfig:             tlsConfig,
+			EchConfig:             echConfig,
 			QuicConfig:            quicConfig,
 			Token:                 tkn,
 			UdpRelayMode:          udpRelayMode,
@@ -288,6 +305,8 @@ func NewTuic(option TuicOption) (*Tuic, error) {
 			FastOpen:              option.FastOpen,
 			MaxOpenStreams:        clientMaxOpenStreams,
 			CWND:                  option.CWND,
+			BrutalRate:            brutalRate,
+			Tag:                   option.Name,
 		}
 
 		t.client = tuic.NewPoolClientV4(clientOption)
@@ -298,6 +317,7 @@ func NewTuic(option TuicOption) (*Tuic, error) {
 		}
 		clientOption := &tuic.ClientOptionV5{
 			TlsConfig:             tlsConfig,
+			EchConfig:             echConfig,
 			QuicConfig:            quicConfig,
 			Uuid:                  uuid.FromStringOrNil(option.UUID),
 			Password:              option.Password,
@@ -307,6 +327,8 @@ func NewTuic(option TuicOption) (*Tuic, error) {
 			MaxUdpRelayPacketSize: maxUdpRelayPacketSize,
 			MaxOpenStreams:        clientMaxOpenStreams,
 			CWND:                  option.CWND,
+			BrutalRate:            brutalRate,
+			Tag:                   option.Name,
 		}
 
 		t.client = tuic.NewPoolClientV5(clientOption)
@@ -9,6 +9,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"runtime"
 	"strconv"
 	"sync"
 
@@ -17,13 +18,16 @@ import (
 	"github.com/metacubex/mihomo/common/utils"
 	"github.com/metacubex/mihomo/component/ca"
 	"github.com/metacubex/mihomo/component/dialer"
+	"github.com/metacubex/mihomo/component/ech"
 	"github.com/metacubex/mihomo/component/proxydialer"
 	"github.com/metacubex/mihomo/component/resolver"
 	tlsC "github.com/metacubex/mihomo/component/tls"
 	C "github.com/metacubex/mihomo/constant"
 	"github.com/metacubex/mihomo/log"
 	"github.com/metacubex/mihomo/transport/gun"
+	"github.com/metacubex/mihomo/transport/kcp"
 	"github.com/metacubex/mihomo/transport/socks5"
+	"github.com/metacubex/mihomo/transport/splithttp"
 	"github.com/metacubex/mihomo/transport/vless"
 	"github.com/metacubex/mihomo/transport/vmess"
 
@@ -47,7 +51,17 @@ type Vless struct {
 	gunConfig    *gun.Config
 	transport    *gun.TransportWrap
 
+	// for kcp
+	kcpConfig *kcp.Config
+
+	// for xhttp
+	xhttpDialer *xhttpDialer
+	xhttpConfig *splithttp.Config
+	xhttpClient *splithttp.Client
+
 	realityConfig *tlsC.RealityConfig
+	echConfig     *ech.Config
+	certificates  []tls.Certificate
 }
 
 type VlessOption struct {
@@ -65,14 +79,20 @@ type VlessOption struct {
 	PacketEncoding    string            `proxy:"packet-encoding,omitempty"`
 	Network           string            `proxy:"network,omitempty"`
 	RealityOpts       RealityOptions    `proxy:"reality-opts,omitempty"`
+	ECHOpts           ECHOptions        `proxy:"ech-opts,omitempty"`
 	HTTPOpts          HTTPOptions       `proxy:"http-opts,omitempty"`
 	HTTP2Opts         HTTP2Options      `proxy:"h2-opts,omitempty"`
 	GrpcOpts          GrpcOptions       `proxy:"grpc-opts,omitempty"`
+	XHTTPOpts         XHTTPOptions      `proxy:"xhttp-opts,omitempty"`
+	KCPOpts           KCPOptions        `proxy:"kcp-opts,omitempty"`
+	ConnPool          ConnPoolOptions   `proxy:"conn-pool,omitempty"`
 	WSOpts            WSOptions         `proxy:"ws-opts,omitempty"`
 	WSPath            string            `proxy:"ws-path,omitempty"`
 	WSHeaders         map[string]string `proxy:"ws-headers,omitempty"`
 	SkipCertVerify    bool              `proxy:"skip-cert-verify,omitempty"`
 	Fingerprint       string            `proxy:"fingerprint,omitempty"`
+	Certificate       string            `proxy:"certificate,omitempty"`
+	PrivateKey        string            `proxy:"private-key,omitempty"`
 	ServerName        string            `proxy:"servername,omitempty"`
 	ClientFingerprint string            `proxy:"client-fingerprint,omitempty"`
 }
@@ -106,11 +126,13 @@ func (v *Vless) StreamConnContext(ctx context.Context, c net.Conn, metadata *C.M
 		}
 		if v.option.TLS {
 			wsOpts.TLS = true
+			wsOpts.ECHConfig = v.echConfig
 			tlsConfig := &tls.Config{
 				MinVersion:         tls.VersionTLS12,
 				ServerName:         host,
 				InsecureSkipVerify: v.option.SkipCertVerify,
 				NextProtos:         []string{"http/1.1"},
+				Certificates:       v.certificates,
 			}
 
 			wsOpts.TLSConfig, err = ca.GetSpecifiedFingerprintTLSConfig(tlsConfig, v.option.Fingerprint)
@@ -159,7 +181,9 @@ func (v *Vless) StreamConnContext(ctx context.Context, c net.Conn, metadata *C.M
 
 		c, err = vmess.StreamH2Conn(c, h2Opts)
 	case "grpc":
-		c, err = gun.StreamGunWithConn(c, v.gunTLSConfig, v.gunConfig, v.realityConfig)
+		c, err = gun.StreamGunWithConn(c, v.gunTLSConfig, v.gunConfig, v.realityConfig, v.echConfig)
+	case "xhttp":
+		c, err = v.xhttpDialer.StreamConn(ctx, c, v.xhttpConfig)
 	default:
 		// default tcp network
 		// handle TLS
@@ -211,6 +235,8 @@ func (v *Vless) streamTLSConn(ctx context.Context, conn net.Conn, isH2 bool) (ne
 			FingerPrint:       v.option.Fingerprint,
 			ClientFingerprint: v.option.ClientFingerprint,
 			Reality:           v.realityConfig,
+			ECH:               v.echConfig,
+			Certificates:      v.certificates,
 			NextProtos:        v.option.ALPN,
 		}
 
@@ -228,8 +254,45 @@ func (v *Vless) streamTLSConn(ctx context.Context, conn net.Conn, isH2 bool) (ne
 	return conn, nil
 }
 
+// dialTLS dials a tls connection without the vless header for the conn pool
+func (v *Vless) dialTLS(ctx context.Context) (_ net.Conn, err error) {
+	var cDialer C.Dialer = dialer.NewDialer(v.Base.DialOptions()...)
+	if len(v.option.DialerProxy) > 0 {
+		cDialer, err = proxydialer.NewByName(v.option.DialerProxy, cDialer)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c, err := cDialer.DialContext(ctx, "tcp", v.addr)
+	if err != nil {
+		return nil, fmt.Errorf("%s connect error: %w", v.addr, err)
+	}
+	N.TCPKeepAlive(c)
+
+	defer func(c net.Conn) {
+		safeConnClose(c, err)
+	}(c)
+
+	return v.streamTLSConn(ctx, c, false)
+}
+
 // DialContext implements C.ProxyAdapter
 func (v *Vless) DialContext(ctx context.Context, metadata *C.Metadata, opts ...dialer.Option) (_ C.Conn, err error) {
+	// pre-warmed tls connection
+	if v.pool != nil && len(opts) == 0 {
+		if c := v.pool.Get(); c != nil {
+			defer func(c net.Conn) {
+				safeConnClose(c, err)
+			}(c)
+
+			c, err = v.streamConn(c, metadata)
+			if err != nil {
+				return nil, err
+			}
+
+			return NewConn(c, v), nil
+		}
+	}
 	// gun transport
 	if v.transport != nil && len(opts) == 0 {
 		c, err := gun.StreamGunWithTransport(v.transport, v.gunConfig)
@@ -247,6 +310,23 @@ func (v *Vless) DialContext(ctx context.Context, metadata *C.Metadata, opts ...d
 
 		return NewConn(c, v), nil
 	}
+	// xhttp transport
+	if v.xhttpClient != nil && len(opts) == 0 {
+		c, err := splithttp.StreamConn(v.xhttpClient, v.xhttpConfig)
+		if err != nil {
+			return nil, err
+		}
+		defer func(c net.Conn) {
+			safeConnClose(c, err)
+		}(c)
+
+		c, err = v.streamConn(c, metadata)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewConn(c, v), nil
+	}
 	return v.DialContextWithDialer(ctx, dialer.NewDialer(v.Base.DialOptions(opts...)...), metadata)
 }
 
@@ -258,9 +338,24 @@ func (v *Vless) DialContextWithDialer(ctx context.Context, dialer C.Dialer, meta
 			return nil, err
 		}
 	}
-	c, err := dialer.DialContext(ctx, "tcp", v.addr)
+	if v.xhttpDialer != nil {
+		c, err := v.xhttpDialer.StreamConnWithDialer(dialer, v.xhttpConfig)
+		if err != nil {
+			return nil, err
+		}
+		defer func(c net.Conn) {
+			safeConnClose(c, err)
+		}(c)
+
+		c, err = v.streamConn(c, metadata)
+		if err != nil {
+			return nil, fmt.Errorf("%s connect error: %w", v.addr, err)
+		}
+		return NewConn(c, v), err
+	}
+	c, err := dialStream(ctx, dialer, v.addr, v.prefer, v.kcpConfig)
 	if err != nil {
-		return nil, fmt.Errorf("%s connect error: %s", v.addr, err.Error())
+		return nil, fmt.Errorf("%s connect error: %w", v.addr, err)
 	}
 	N.TCPKeepAlive(c)
 	defer func(c net.Conn) {
@@ -269,7 +364,7 @@ func (v *Vless) DialContextWithDialer(ctx context.Context, dialer C.Dialer, meta
 
 	c, err = v.StreamConnContext(ctx, c, metadata)
 	if err != nil {
-		return nil, fmt.Errorf("%s connect error: %s", v.addr, err.Error())
+		return nil, fmt.Errorf("%s connect error: %w", v.addr, err)
 	}
 	return NewConn(c, v), err
 }
@@ -302,6 +397,23 @@ func (v *Vless) ListenPacketContext(ctx context.Context, metadata *C.Metadata, o
 
 		return v.ListenPacketOnStreamConn(ctx, c, metadata)
 	}
+	// xhttp transport
+	if v.xhttpClient != nil && len(opts) == 0 {
+		c, err = splithttp.StreamConn(v.xhttpClient, v.xhttpConfig)
+		if err != nil {
+			return nil, err
+		}
+		defer func(c net.Conn) {
+			safeConnClose(c, err)
+		}(c)
+
+		c, err = v.streamConn(c, metadata)
+		if err != nil {
+			return nil, fmt.Errorf("new vless client error: %v", err)
+		}
+
+		return v.ListenPacketOnStreamConn(ctx, c, metadata)
+	}
 	return v.ListenPacketWithDialer(ctx, dialer.NewDialer(v.Base.DialOptions(opts...)...), metadata)
 }
 
@@ -323,9 +435,26 @@ func (v *Vless) ListenPacketWithDialer(ctx context.Context, dialer C.Dialer, met
 		metadata.DstIP = ip
 	}
 
-	c, err := dialer.DialContext(ctx, "tcp", v.addr)
+	if v.xhttpDialer != nil {
+		c, err := v.xhttpDialer.StreamConnWithDialer(dialer, v.xhttpConfig)
+		if err != nil {
+			return nil, err
+		}
+		defer func(c net.Conn) {
+			safeConnClose(c, err)
+		}(c)
+
+		c, err = v.streamConn(c, metadata)
+		if err != nil {
+			return nil, fmt.Errorf("new vless client error: %v", err)
+		}
+
+		return v.ListenPacketOnStreamConn(ctx, c, metadata)
+	}
+
+	c, err := dialStream(ctx, dialer, v.addr, v.prefer, v.kcpConfig)
 	if err != nil {
-		return nil, fmt.Errorf("%s connect error: %s", v.addr, err.Error())
+		return nil, fmt.Errorf("%s connect error: %w", v.addr, err)
 	}
 	N.TCPKeepAlive(c)
 	defer func(c net.Conn) {
@@ -501,6 +630,10 @@ func (c *vlessPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
 	return length, c.rAddr, nil
 }
 
+func closeVless(v *Vless) {
+	v.pool.Close()
+}
+
 func NewVless(option VlessOption) (*Vless, error) {
 	var addons *vless.Addons
 	if option.Network != "ws" && len(option.Flow) >= 16 {
@@ -547,6 +680,8 @@ func NewVless(option VlessOption) (*Vless, error) {
 			mpTcp:  option.MPTCP,
 			iface:  option.Interface,
 			rmark:  option.RoutingMark,
+			dscp:   option.dscp(),
+			ttl:    option.TTL,
 			prefer: C.NewDNSPrefer(option.IPVersion),
 		},
 		client: client,
@@ -558,6 +693,16 @@ func NewVless(option VlessOption) (*Vless, error) {
 		return nil, err
 	}
 
+	v.echConfig, err = v.option.ECHOpts.Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	v.certificates, err = ca.LoadClientCertificate(v.option.Certificate, v.option.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
 	switch option.Network {
 	case "h2":
 		if len(option.HTTP2Opts.Host) == 0 {
@@ -575,7 +720,7 @@ func NewVless(option VlessOption) (*Vless, error) {
 			}
 			c, err := cDialer.DialContext(context.Background(), "tcp", v.addr)
 			if err != nil {
-				return nil, fmt.Errorf("%s connect error: %s", v.addr, err.Error())
+				return nil, fmt.Errorf("%s connect error: %w", v.addr, err)
 			}
 			N.TCPKeepAlive(c)
 			return c, nil
@@ -594,6 +739,7 @@ func NewVless(option VlessOption) (*Vless, error) {
 			tlsConfig = ca.GetGlobalTLSConfig(&tls.Config{
 				InsecureSkipVerify: v.option.SkipCertVerify,
 				ServerName:         v.option.ServerName,
+				Certificates:       v.certificates,
 			})
 			if option.ServerName == "" {
 				host, _, _ := net.SplitHostPort(v.addr)
@@ -604,7 +750,49 @@ func NewVless(option VlessOption) (*Vless, error) {
 		v.gunTLSConfig = tlsConfig
 		v.gunConfig = gunConfig
 
-		v.transport = gun.NewHTTP2Client(dialFn, tlsConfig, v.option.ClientFingerprint, v.realityConfig)
+		v.transport = gun.NewHTTP2Client(dialFn, tlsConfig, v.option.ClientFingerprint, v.realityConfig, v.echConfig)
+	case "kcp":
+		v.kcpConfig, err = v.option.KCPOpts.Build()
+		if err != nil {
+			return nil, err
+		}
+	case "xhttp":
+		host, _, _ := net.SplitHostPort(v.addr)
+		if v.option.ServerName != "" {
+			host = v.option.ServerName
+		}
+		v.xhttpConfig = v.option.XHTTPOpts.Build(host)
+		v.xhttpDialer = &xhttpDialer{
+			base:      v.Base,
+			version:   xhttpVersion(v.option.TLS, v.option.ALPN),
+			streamTLS: v.streamTLSConn,
+		}
+		if v.xhttpDialer.version == C.HTTPVersion3 {
+			v.xhttpDialer.h3TLSConfig, err = newXHTTPH3TLSConfig(host, v.option.SkipCertVerify, v.option.Fingerprint, v.certificates)
+			if err != nil {
+				return nil, err
+			}
+		}
+		v.xhttpClient = v.xhttpDialer.NewClient(func() (C.Dialer, error) {
+			var cDialer C.Dialer = dialer.NewDialer(v.Base.DialOptions()...)
+			if len(v.option.DialerProxy) > 0 {
+				return proxydialer.NewByName(v.option.DialerProxy, cDialer)
+			}
+			return cDialer, nil
+		})
+	}
+
+	if option.ConnPool.Size > 0 {
+		if !option.TLS || (option.Network != "" && option.Network != "tcp") {
+			return nil, errConnPoolNetwork
+		}
+		// the pool dials in the background, so the fingerprint is fixed here instead of in dialTLS
+		if tlsC.HaveGlobalFingerprint() && len(v.option.ClientFingerprint) == 0 {
+			v.option.ClientFingerprint = tlsC.GetGlobalFingerprint()
+		}
+		// the pool goroutines stop after connPoolWarmDuration without use, then closeVless can run
+		v.pool = option.ConnPool.Build(v.name, v.dialTLS)
+		runtime.SetFinalizer(v, closeVless)
 	}
 
 	return v, nil
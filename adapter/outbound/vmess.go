@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
@@ -15,12 +16,15 @@ import (
 	"github.com/metacubex/mihomo/common/utils"
 	"github.com/metacubex/mihomo/component/ca"
 	"github.com/metacubex/mihomo/component/dialer"
+	"github.com/metacubex/mihomo/component/ech"
 	"github.com/metacubex/mihomo/component/proxydialer"
 	"github.com/metacubex/mihomo/component/resolver"
 	tlsC "github.com/metacubex/mihomo/component/tls"
 	C "github.com/metacubex/mihomo/constant"
 	"github.com/metacubex/mihomo/ntp"
 	"github.com/metacubex/mihomo/transport/gun"
+	"github.com/metacubex/mihomo/transport/kcp"
+	"github.com/metacubex/mihomo/transport/splithttp"
 	mihomoVMess "github.com/metacubex/mihomo/transport/vmess"
 
 	vmess "github.com/metacubex/sing-vmess"
@@ -40,7 +44,17 @@ type Vmess struct {
 	gunConfig    *gun.Config
 	transport    *gun.TransportWrap
 
+	// for kcp
+	kcpConfig *kcp.Config
+
+	// for xhttp
+	xhttpDialer *xhttpDialer
+	xhttpConfig *splithttp.Config
+	xhttpClient *splithttp.Client
+
 	realityConfig *tlsC.RealityConfig
+	echConfig     *ech.Config
+	certificates  []tls.Certificate
 }
 
 type VmessOption struct {
@@ -57,11 +71,16 @@ type VmessOption struct {
 	ALPN                []string       `proxy:"alpn,omitempty"`
 	SkipCertVerify      bool           `proxy:"skip-cert-verify,omitempty"`
 	Fingerprint         string         `proxy:"fingerprint,omitempty"`
+	Certificate         string         `proxy:"certificate,omitempty"`
+	PrivateKey          string         `proxy:"private-key,omitempty"`
 	ServerName          string         `proxy:"servername,omitempty"`
 	RealityOpts         RealityOptions `proxy:"reality-opts,omitempty"`
+	ECHOpts             ECHOptions     `proxy:"ech-opts,omitempty"`
 	HTTPOpts            HTTPOptions    `proxy:"http-opts,omitempty"`
 	HTTP2Opts           HTTP2Options   `proxy:"h2-opts,omitempty"`
 	GrpcOpts            GrpcOptions    `proxy:"grpc-opts,omitempty"`
+	XHTTPOpts           XHTTPOptions   `proxy:"xhttp-opts,omitempty"`
+	KCPOpts             KCPOptions     `proxy:"kcp-opts,omitempty"`
 	WSOpts              WSOptions      `proxy:"ws-opts,omitempty"`
 	PacketAddr          bool           `proxy:"packet-addr,omitempty"`
 	XUDP                bool           `proxy:"xudp,omitempty"`
@@ -69,6 +88,8 @@ type VmessOption struct {
 	GlobalPadding       bool           `proxy:"global-padding,omitempty"`
 	AuthenticatedLength bool           `proxy:"authenticated-length,omitempty"`
 	ClientFingerprint   string         `proxy:"client-fingerprint,omitempty"`
+
+	ConnPool ConnPoolOptions `proxy:"conn-pool,omitempty"`
 }
 
 type HTTPOptions struct {
@@ -126,10 +147,12 @@ func (v *Vmess) StreamConnContext(ctx context.Context, c net.Conn, metadata *C.M
 
 		if v.option.TLS {
 			wsOpts.TLS = true
+			wsOpts.ECHConfig = v.echConfig
 			tlsConfig := &tls.Config{
 				ServerName:         host,
 				InsecureSkipVerify: v.option.SkipCertVerify,
 				NextProtos:         []string{"http/1.1"},
+				Certificates:       v.certificates,
 			}
 
 			wsOpts.TLSConfig, err = ca.GetSpecifiedFingerprintTLSConfig(tlsConfig, v.option.Fingerprint)
@@ -153,6 +176,8 @@ func (v *Vmess) StreamConnContext(ctx context.Context, c net.Conn, metadata *C.M
 				SkipCertVerify:    v.option.SkipCertVerify,
 				ClientFingerprint: v.option.ClientFingerprint,
 				Reality:           v.realityConfig,
+				ECH:               v.echConfig,
+				Certificates:      v.certificates,
 				NextProtos:        v.option.ALPN,
 			}
 
@@ -182,6 +207,8 @@ func (v *Vmess) StreamConnContext(ctx context.Context, c net.Conn, metadata *C.M
 			NextProtos:        []string{"h2"},
 			ClientFingerprint: v.option.ClientFingerprint,
 			Reality:           v.realityConfig,
+			ECH:               v.echConfig,
+			Certificates:      v.certificates,
 		}
 
 		if v.option.ServerName != "" {
@@ -200,7 +227,9 @@ func (v *Vmess) StreamConnContext(ctx context.Context, c net.Conn, metadata *C.M
 
 		c, err = mihomoVMess.StreamH2Conn(c, h2Opts)
 	case "grpc":
-		c, err = gun.StreamGunWithConn(c, v.gunTLSConfig, v.gunConfig, v.realityConfig)
+		c, err = gun.StreamGunWithConn(c, v.gunTLSConfig, v.gunConfig, v.realityConfig, v.echConfig)
+	case "xhttp":
+		c, err = v.xhttpDialer.StreamConn(ctx, c, v.xhttpConfig)
 	default:
 		// handle TLS
 		if v.option.TLS {
@@ -210,6 +239,8 @@ func (v *Vmess) StreamConnContext(ctx context.Context, c net.Conn, metadata *C.M
 				SkipCertVerify:    v.option.SkipCertVerify,
 				ClientFingerprint: v.option.ClientFingerprint,
 				Reality:           v.realityConfig,
+				ECH:               v.echConfig,
+				Certificates:      v.certificates,
 				NextProtos:        v.option.ALPN,
 			}
 
@@ -227,6 +258,34 @@ func (v *Vmess) StreamConnContext(ctx context.Context, c net.Conn, metadata *C.M
 	return v.streamConn(c, metadata)
 }
 
+func (v *Vmess) streamTLSConn(ctx context.Context, conn net.Conn, isH2 bool) (net.Conn, error) {
+	if v.option.TLS {
+		host, _, _ := net.SplitHostPort(v.addr)
+		tlsOpts := &mihomoVMess.TLSConfig{
+			Host:              host,
+			SkipCertVerify:    v.option.SkipCertVerify,
+			FingerPrint:       v.option.Fingerprint,
+			ClientFingerprint: v.option.ClientFingerprint,
+			Reality:           v.realityConfig,
+			ECH:               v.echConfig,
+			Certificates:      v.certificates,
+			NextProtos:        v.option.ALPN,
+		}
+
+		if isH2 {
+			tlsOpts.NextProtos = []string{"h2"}
+		}
+
+		if v.option.ServerName != "" {
+			tlsOpts.Host = v.option.ServerName
+		}
+
+		return mihomoVMess.StreamTLSConn(ctx, conn, tlsOpts)
+	}
+
+	return conn, nil
+}
+
 func (v *Vmess) streamConn(c net.Conn, metadata *C.Metadata) (conn net.Conn, err error) {
 	if metadata.NetWork == C.UDP {
 		if v.option.XUDP {
@@ -276,8 +335,45 @@ func (v *Vmess) streamConn(c net.Conn, metadata *C.Metadata) (conn net.Conn, err
 	return
 }
 
+// dialTLS dials a tls connection without the vmess header for the conn pool
+func (v *Vmess) dialTLS(ctx context.Context) (_ net.Conn, err error) {
+	var cDialer C.Dialer = dialer.NewDialer(v.Base.DialOptions()...)
+	if len(v.option.DialerProxy) > 0 {
+		cDialer, err = proxydialer.NewByName(v.option.DialerProxy, cDialer)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c, err := cDialer.DialContext(ctx, "tcp", v.addr)
+	if err != nil {
+		return nil, fmt.Errorf("%s connect error: %w", v.addr, err)
+	}
+	N.TCPKeepAlive(c)
+
+	defer func(c net.Conn) {
+		safeConnClose(c, err)
+	}(c)
+
+	return v.streamTLSConn(ctx, c, false)
+}
+
 // DialContext implements C.ProxyAdapter
 func (v *Vmess) DialContext(ctx context.Context, metadata *C.Metadata, opts ...dialer.Option) (_ C.Conn, err error) {
+	// pre-warmed tls connection
+	if v.pool != nil && len(opts) == 0 {
+		if c := v.pool.Get(); c != nil {
+			defer func(c net.Conn) {
+				safeConnClose(c, err)
+			}(c)
+
+			c, err = v.streamConn(c, metadata)
+			if err != nil {
+				return nil, err
+			}
+
+			return NewConn(c, v), nil
+		}
+	}
 	// gun transport
 	if v.transport != nil && len(opts) == 0 {
 		c, err := gun.StreamGunWithTransport(v.transport, v.gunConfig)
@@ -295,6 +391,23 @@ func (v *Vmess) DialContext(ctx context.Context, metadata *C.Metadata, opts ...d
 
 		return NewConn(c, v), nil
 	}
+	// xhttp transport
+	if v.xhttpClient != nil && len(opts) == 0 {
+		c, err := splithttp.StreamConn(v.xhttpClient, v.xhttpConfig)
+		if err != nil {
+			return nil, err
+		}
+		defer func(c net.Conn) {
+			safeConnClose(c, err)
+		}(c)
+
+		c, err = v.streamConn(c, metadata)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewConn(c, v), nil
+	}
 	return v.DialContextWithDialer(ctx, dialer.NewDialer(v.Base.DialOptions(opts...)...), metadata)
 }
 
@@ -306,9 +419,21 @@ func (v *Vmess) DialContextWithDialer(ctx context.Context, dialer C.Dialer, meta
 			return nil, err
 		}
 	}
-	c, err := dialer.DialContext(ctx, "tcp", v.addr)
+	if v.xhttpDialer != nil {
+		c, err := v.xhttpDialer.StreamConnWithDialer(dialer, v.xhttpConfig)
+		if err != nil {
+			return nil, err
+		}
+		defer func(c net.Conn) {
+			safeConnClose(c, err)
+		}(c)
+
+		c, err = v.streamConn(c, metadata)
+		return NewConn(c, v), err
+	}
+	c, err := dialStream(ctx, dialer, v.addr, v.prefer, v.kcpConfig)
 	if err != nil {
-		return nil, fmt.Errorf("%s connect error: %s", v.addr, err.Error())
+		return nil, fmt.Errorf("%s connect error: %w", v.addr, err)
 	}
 	N.TCPKeepAlive(c)
 	defer func(c net.Conn) {
@@ -346,6 +471,22 @@ func (v *Vmess) ListenPacketContext(ctx context.Context, metadata *C.Metadata, o
 		}
 		return v.ListenPacketOnStreamConn(ctx, c, metadata)
 	}
+	// xhttp transport
+	if v.xhttpClient != nil && len(opts) == 0 {
+		c, err = splithttp.StreamConn(v.xhttpClient, v.xhttpConfig)
+		if err != nil {
+			return nil, err
+		}
+		defer func(c net.Conn) {
+			safeConnClose(c, err)
+		}(c)
+
+		c, err = v.streamConn(c, metadata)
+		if err != nil {
+			return nil, fmt.Errorf("new vmess client error: %v", err)
+		}
+		return v.ListenPacketOnStreamConn(ctx, c, metadata)
+	}
 	return v.ListenPacketWithDialer(ctx, dialer.NewDialer(v.Base.DialOptions(opts...)...), metadata)
 }
 
@@ -367,9 +508,25 @@ func (v *Vmess) ListenPacketWithDialer(ctx context.Context, dialer C.Dialer, met
 		metadata.DstIP = ip
 	}
 
-	c, err := dialer.DialContext(ctx, "tcp", v.addr)
+	if v.xhttpDialer != nil {
+		c, err := v.xhttpDialer.StreamConnWithDialer(dialer, v.xhttpConfig)
+		if err != nil {
+			return nil, err
+		}
+		defer func(c net.Conn) {
+			safeConnClose(c, err)
+		}(c)
+
+		c, err = v.streamConn(c, metadata)
+		if err != nil {
+			return nil, fmt.Errorf("new vmess client error: %v", err)
+		}
+		return v.ListenPacketOnStreamConn(ctx, c, metadata)
+	}
+
+	c, err := dialStream(ctx, dialer, v.addr, v.prefer, v.kcpConfig)
 	if err != nil {
-		return nil, fmt.Errorf("%s connect error: %s", v.addr, err.Error())
+		return nil, fmt.Errorf("%s connect error: %w", v.addr, err)
 	}
 	N.TCPKeepAlive(c)
 	defer func(c net.Conn) {
@@ -410,6 +567,10 @@ func (v *Vmess) SupportUOT() bool {
 	return true
 }
 
+func closeVmess(v *Vmess) {
+	v.pool.Close()
+}
+
 func NewVmess(option VmessOption) (*Vmess, error) {
 	security := strings.ToLower(option.Cipher)
 	var options []vmess.ClientOption
@@ -446,12 +607,24 @@ func NewVmess(option VmessOption) (*Vmess, error) {
 			mpTcp:  option.MPTCP,
 			iface:  option.Interface,
 			rmark:  option.RoutingMark,
+			dscp:   option.dscp(),
+			ttl:    option.TTL,
 			prefer: C.NewDNSPrefer(option.IPVersion),
 		},
 		client: client,
 		option: &option,
 	}
 
+	v.echConfig, err = v.option.ECHOpts.Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	v.certificates, err = ca.LoadClientCertificate(v.option.Certificate, v.option.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
 	switch option.Network {
 	case "h2":
 		if len(option.HTTP2Opts.Host) == 0 {
@@ -469,7 +642,7 @@ func NewVmess(option VmessOption) (*Vmess, error) {
 			}
 			c, err := cDialer.DialContext(context.Background(), "tcp", v.addr)
 			if err != nil {
-				return nil, fmt.Errorf("%s connect error: %s", v.addr, err.Error())
+				return nil, fmt.Errorf("%s connect error: %w", v.addr, err)
 			}
 			N.TCPKeepAlive(c)
 			return c, nil
@@ -488,6 +661,7 @@ func NewVmess(option VmessOption) (*Vmess, error) {
 			tlsConfig = ca.GetGlobalTLSConfig(&tls.Config{
 				InsecureSkipVerify: v.option.SkipCertVerify,
 				ServerName:         v.option.ServerName,
+				Certificates:       v.certificates,
 			})
 			if option.ServerName == "" {
 				host, _, _ := net.SplitHostPort(v.addr)
@@ -498,7 +672,36 @@ func NewVmess(option VmessOption) (*Vmess, error) {
 		v.gunTLSConfig = tlsConfig
 		v.gunConfig = gunConfig
 
-		v.transport = gun.NewHTTP2Client(dialFn, tlsConfig, v.option.ClientFingerprint, v.realityConfig)
+		v.transport = gun.NewHTTP2Client(dialFn, tlsConfig, v.option.ClientFingerprint, v.realityConfig, v.echConfig)
+	case "kcp":
+		v.kcpConfig, err = v.option.KCPOpts.Build()
+		if err != nil {
+			return nil, err
+		}
+	case "xhttp":
+		host, _, _ := net.SplitHostPort(v.addr)
+		if v.option.ServerName != "" {
+			host = v.option.ServerName
+		}
+		v.xhttpConfig = v.option.XHTTPOpts.Build(host)
+		v.xhttpDialer = &xhttpDialer{
+			base:      v.Base,
+			version:   xhttpVersion(v.option.TLS, v.option.ALPN),
+			streamTLS: v.streamTLSConn,
+		}
+		if v.xhttpDialer.version == C.HTTPVersion3 {
+			v.xhttpDialer.h3TLSConfig, err = newXHTTPH3TLSConfig(host, v.option.SkipCertVerify, v.option.Fingerprint, v.certificates)
+			if err != nil {
+				return nil, err
+			}
+		}
+		v.xhttpClient = v.xhttpDialer.NewClient(func() (C.Dialer, error) {
+			var cDialer C.Dialer = dialer.NewDialer(v.Base.DialOptions()...)
+			if len(v.option.DialerProxy) > 0 {
+				return proxydialer.NewByName(v.option.DialerProxy, cDialer)
+			}
+			return cDialer, nil
+		})
 	}
 
 	v.realityConfig, err = v.option.RealityOpts.Parse()
@@ -506,6 +709,19 @@ func NewVmess(option VmessOption) (*Vmess, error) {
 		return nil, err
 	}
 
+	if option.ConnPool.Size > 0 {
+		if !option.TLS || (option.Network != "" && option.Network != "tcp") {
+			return nil, errConnPoolNetwork
+		}
+		// the pool dials in the background, so the fingerprint is fixed here instead of in dialTLS
+		if tlsC.HaveGlobalFingerprint() && len(v.option.ClientFingerprint) == 0 {
+			v.option.ClientFingerprint = tlsC.GetGlobalFingerprint()
+		}
+		// the pool goroutines stop after connPoolWarmDuration without use, then closeVmess can run
+		v.pool = option.ConnPool.Build(v.name, v.dialTLS)
+		runtime.SetFinalizer(v, closeVmess)
+	}
+
 	return v, nil
 }
 
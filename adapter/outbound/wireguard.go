@@ -22,6 +22,7 @@ import (
 	C "github.com/metacubex/mihomo/constant"
 	"github.com/metacubex/mihomo/dns"
 	"github.com/metacubex/mihomo/log"
+	"github.com/metacubex/mihomo/transport/amneziawg"
 
 	wireguard "github.com/metacubex/sing-wireguard"
 
@@ -29,6 +30,7 @@ import (
 	"github.com/sagernet/sing/common/debug"
 	E "github.com/sagernet/sing/common/exceptions"
 	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
 	"github.com/sagernet/wireguard-go/device"
 )
 
@@ -67,6 +69,20 @@ type WireGuardOption struct {
 
 	RemoteDnsResolve bool     `proxy:"remote-dns-resolve,omitempty"`
 	Dns              []string `proxy:"dns,omitempty"`
+
+	AmneziaWGOption *AmneziaWGOption `proxy:"amnezia-wg-option,omitempty"`
+}
+
+type AmneziaWGOption struct {
+	JC   int    `proxy:"jc,omitempty"`
+	JMin int    `proxy:"jmin,omitempty"`
+	JMax int    `proxy:"jmax,omitempty"`
+	S1   int    `proxy:"s1,omitempty"`
+	S2   int    `proxy:"s2,omitempty"`
+	H1   uint32 `proxy:"h1,omitempty"`
+	H2   uint32 `proxy:"h2,omitempty"`
+	H3   uint32 `proxy:"h3,omitempty"`
+	H4   uint32 `proxy:"h4,omitempty"`
 }
 
 type WireGuardPeerOption struct {
@@ -102,6 +118,28 @@ func (d wgNetDialer) DialContext(ctx context.Context, network, address string) (
 	return d.tunDevice.DialContext(ctx, network, M.ParseSocksaddr(address).Unwrap())
 }
 
+// amneziaWGDialer applies the AmneziaWG obfuscation to the udp conn of the bind
+type amneziaWGDialer struct {
+	N.Dialer
+	config *amneziawg.Config
+}
+
+func (d amneziaWGDialer) DialContext(ctx context.Context, network string, destination M.Socksaddr) (net.Conn, error) {
+	c, err := d.Dialer.DialContext(ctx, network, destination)
+	if err != nil {
+		return nil, err
+	}
+	return amneziawg.NewConn(c, d.config), nil
+}
+
+func (d amneziaWGDialer) ListenPacket(ctx context.Context, destination M.Socksaddr) (net.PacketConn, error) {
+	pc, err := d.Dialer.ListenPacket(ctx, destination)
+	if err != nil {
+		return nil, err
+	}
+	return amneziawg.NewPacketConn(pc, d.config), nil
+}
+
 func (option WireGuardPeerOption) Addr() M.Socksaddr {
 	return M.ParseSocksaddrHostPort(option.Server, uint16(option.Port))
 }
@@ -143,6 +181,8 @@ func NewWireGuard(option WireGuardOption) (*WireGuard, error) {
 			udp:    option.UDP,
 			iface:  option.Interface,
 			rmark:  option.RoutingMark,
+			dscp:   option.dscp(),
+			ttl:    option.TTL,
 			prefer: C.NewDNSPrefer(option.IPVersion),
 		},
 		dialer: proxydialer.NewSlowDownSingDialer(proxydialer.NewByNameSingDialer(option.DialerProxy, dialer.NewDialer()), slowdown.New()),
@@ -165,7 +205,33 @@ func NewWireGuard(option WireGuardOption) (*WireGuard, error) {
 			outbound.connectAddr = option.Addr()
 		}
 	}
-	outbound.bind = wireguard.NewClientBind(context.Background(), wgSingErrorHandler{outbound.Name()}, outbound.dialer, isConnect, outbound.connectAddr.AddrPort(), reserved)
+	var bindDialer N.Dialer = outbound.dialer
+	if option.AmneziaWGOption != nil {
+		if len(option.Reserved) > 0 {
+			return nil, E.New("reserved can not be used with amnezia-wg-option")
+		}
+		for i := range option.Peers {
+			if len(option.Peers[i].Reserved) > 0 {
+				return nil, E.New("reserved for peer ", i, " can not be used with amnezia-wg-option")
+			}
+		}
+		awgConfig := &amneziawg.Config{
+			JunkPacketCount:            option.AmneziaWGOption.JC,
+			JunkPacketMinSize:          option.AmneziaWGOption.JMin,
+			JunkPacketMaxSize:          option.AmneziaWGOption.JMax,
+			InitPacketJunkSize:         option.AmneziaWGOption.S1,
+			ResponsePacketJunkSize:     option.AmneziaWGOption.S2,
+			InitPacketMagicHeader:      option.AmneziaWGOption.H1,
+			ResponsePacketMagicHeader:  option.AmneziaWGOption.H2,
+			UnderloadPacketMagicHeader: option.AmneziaWGOption.H3,
+			TransportPacketMagicHeader: option.AmneziaWGOption.H4,
+		}
+		if err := awgConfig.Check(); err != nil {
+			return nil, err
+		}
+		bindDialer = amneziaWGDialer{Dialer: outbound.dialer, config: awgConfig}
+	}
+	outbound.bind = wireguard.NewClientBind(context.Background(), wgSingErrorHandler{outbound.Name()}, bindDialer, isConnect, outbound.connectAddr.AddrPort(), reserved)
 
 	var err error
 	outbound.localPrefixes, err = option.Prefixes()
@@ -0,0 +1,149 @@
+package outbound
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+
+	N "github.com/metacubex/mihomo/common/net"
+	"github.com/metacubex/mihomo/component/ca"
+	C "github.com/metacubex/mihomo/constant"
+	"github.com/metacubex/mihomo/transport/splithttp"
+
+	"github.com/metacubex/quic-go"
+)
+
+type XHTTPOptions struct {
+	Path                 string            `proxy:"path,omitempty"`
+	Host                 string            `proxy:"host,omitempty"`
+	Headers              map[string]string `proxy:"headers,omitempty"`
+	MaxUploadSize        int               `proxy:"max-upload-size,omitempty"`
+	MaxConcurrentUploads int               `proxy:"max-concurrent-uploads,omitempty"`
+}
+
+func (o XHTTPOptions) Build(host string) *splithttp.Config {
+	cfg := &splithttp.Config{
+		Host:                 o.Host,
+		Path:                 o.Path,
+		Headers:              http.Header{},
+		MaxUploadSize:        o.MaxUploadSize,
+		MaxConcurrentUploads: o.MaxConcurrentUploads,
+	}
+	if cfg.Host == "" {
+		cfg.Host = host
+	}
+	for key, value := range o.Headers {
+		cfg.Headers.Set(key, value)
+	}
+	return cfg
+}
+
+// xhttpVersion follows Xray-core: HTTP/1.1 without TLS or with alpn [http/1.1],
+// HTTP/3 with alpn [h3], otherwise HTTP/2
+func xhttpVersion(tls bool, alpn []string) C.HTTPVersion {
+	if !tls {
+		return C.HTTPVersion11
+	}
+	if len(alpn) == 1 {
+		switch C.HTTPVersion(alpn[0]) {
+		case C.HTTPVersion11:
+			return C.HTTPVersion11
+		case C.HTTPVersion3:
+			return C.HTTPVersion3
+		}
+	}
+	return C.HTTPVersion2
+}
+
+type xhttpDialer struct {
+	base    *Base
+	version C.HTTPVersion
+	// streamTLS handshakes TLS on the tcp connection, nothing to do for plain HTTP
+	streamTLS func(ctx context.Context, conn net.Conn, isH2 bool) (net.Conn, error)
+	// h3TLSConfig is used by HTTP/3 since uTLS, REALITY and ECH are not available on QUIC
+	h3TLSConfig *tls.Config
+}
+
+func newXHTTPH3TLSConfig(serverName string, skipCertVerify bool, fingerprint string, certificates []tls.Certificate) (*tls.Config, error) {
+	return ca.GetSpecifiedFingerprintTLSConfig(&tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: skipCertVerify,
+		Certificates:       certificates,
+		MinVersion:         tls.VersionTLS13,
+	}, fingerprint)
+}
+
+// NewClient returns a client dialing by getDialer, which is called for every new connection
+func (d *xhttpDialer) NewClient(getDialer func() (C.Dialer, error)) *splithttp.Client {
+	if d.version == C.HTTPVersion3 {
+		return splithttp.NewHTTP3Client(func(ctx context.Context, tlsConfig *tls.Config, quicConfig *quic.Config) (quic.EarlyConnection, error) {
+			cDialer, err := getDialer()
+			if err != nil {
+				return nil, err
+			}
+			udpAddr, err := resolveUDPAddrWithPrefer(ctx, "udp", d.base.addr, d.base.prefer)
+			if err != nil {
+				return nil, err
+			}
+			pc, err := cDialer.ListenPacket(ctx, "udp", "", udpAddr.AddrPort())
+			if err != nil {
+				return nil, fmt.Errorf("%s connect error: %w", d.base.addr, err)
+			}
+			transport := quic.Transport{Conn: pc}
+			transport.SetCreatedConn(true) // auto close conn
+			transport.SetSingleUse(true)   // auto close transport
+			conn, err := transport.DialEarly(ctx, udpAddr, tlsConfig, quicConfig)
+			if err != nil {
+				_ = pc.Close()
+				return nil, err
+			}
+			return conn, nil
+		}, d.h3TLSConfig)
+	}
+
+	isH2 := d.version == C.HTTPVersion2
+	dialFn := func(ctx context.Context) (net.Conn, error) {
+		cDialer, err := getDialer()
+		if err != nil {
+			return nil, err
+		}
+		c, err := cDialer.DialContext(ctx, "tcp", d.base.addr)
+		if err != nil {
+			return nil, fmt.Errorf("%s connect error: %w", d.base.addr, err)
+		}
+		N.TCPKeepAlive(c)
+		conn, err := d.streamTLS(ctx, c, isH2)
+		if err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+	if isH2 {
+		return splithttp.NewHTTP2Client(dialFn)
+	}
+	return splithttp.NewHTTP1Client(dialFn)
+}
+
+// StreamConn runs a session on the already dialed connection, only available for HTTP/2
+func (d *xhttpDialer) StreamConn(ctx context.Context, c net.Conn, cfg *splithttp.Config) (net.Conn, error) {
+	if d.version != C.HTTPVersion2 {
+		return nil, splithttp.ErrSingleConnHTTP
+	}
+	c, err := d.streamTLS(ctx, c, true)
+	if err != nil {
+		return nil, err
+	}
+	client := splithttp.NewHTTP2ClientWithConn(c)
+	client.SetSingleUse(true)
+	return splithttp.StreamConn(client, cfg)
+}
+
+// StreamConnWithDialer runs a session on a new client which is closed with the session
+func (d *xhttpDialer) StreamConnWithDialer(dialer C.Dialer, cfg *splithttp.Config) (net.Conn, error) {
+	client := d.NewClient(func() (C.Dialer, error) { return dialer, nil })
+	client.SetSingleUse(true)
+	return splithttp.StreamConn(client, cfg)
+}
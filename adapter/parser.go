@@ -17,6 +17,14 @@ func ParseProxy(mapping map[string]any) (C.Proxy, error) {
 		return nil, fmt.Errorf("missing type")
 	}
 
+	basicOption := &outbound.BasicOption{}
+	if err := decoder.Decode(mapping, basicOption); err != nil {
+		return nil, err
+	}
+	if err := basicOption.Check(); err != nil {
+		return nil, err
+	}
+
 	var (
 		proxy C.ProxyAdapter
 		err   error
@@ -119,7 +127,7 @@ func ParseProxy(mapping map[string]any) (C.Proxy, error) {
 		if err != nil {
 			break
 		}
-		proxy = outbound.NewDirectWithOption(*directOption)
+		proxy, err = outbound.NewDirectWithOption(*directOption)
 	case "dns":
 		dnsOptions := &outbound.DnsOption{}
 		err = decoder.Decode(mapping, dnsOptions)
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
 	"strconv"
@@ -14,7 +15,23 @@ import (
 
 // ConvertsV2Ray convert V2Ray subscribe proxies data to mihomo proxies config
 func ConvertsV2Ray(buf []byte) ([]map[string]any, error) {
+	proxies, _, err := ConvertsV2RayWithSkipped(buf)
+	return proxies, err
+}
+
+// Skipped is a line of the subscription which is not converted
+type Skipped struct {
+	Line   string
+	Reason error
+}
+
+// ConvertsV2RayWithSkipped is ConvertsV2Ray which reports the skipped lines as well
+func ConvertsV2RayWithSkipped(buf []byte) ([]map[string]any, []Skipped, error) {
 	data := DecodeBase64(buf)
+	var skipped []Skipped
+	skip := func(line string, err error) {
+		skipped = append(skipped, Skipped{Line: line, Reason: err})
+	}
 
 	arr := strings.Split(string(data), "\n")
 
@@ -29,6 +46,7 @@ func ConvertsV2Ray(buf []byte) ([]map[string]any, error) {
 
 		scheme, body, found := strings.Cut(line, "://")
 		if !found {
+			skip(line, errors.New("missing scheme"))
 			continue
 		}
 
@@ -37,6 +55,7 @@ func ConvertsV2Ray(buf []byte) ([]map[string]any, error) {
 		case "hysteria":
 			urlHysteria, err := url.Parse(line)
 			if err != nil {
+				skip(line, err)
 				continue
 			}
 
@@ -72,6 +91,7 @@ func ConvertsV2Ray(buf []byte) ([]map[string]any, error) {
 		case "hysteria2", "hy2":
 			urlHysteria2, err := url.Parse(line)
 			if err != nil {
+				skip(line, err)
 				continue
 			}
 
@@ -111,6 +131,7 @@ func ConvertsV2Ray(buf []byte) ([]map[string]any, error) {
 			//   2. Remove `allow_insecure` field
 			urlTUIC, err := url.Parse(line)
 			if err != nil {
+				skip(line, err)
 				continue
 			}
 			query := urlTUIC.Query()
@@ -149,6 +170,7 @@ func ConvertsV2Ray(buf []byte) ([]map[string]any, error) {
 		case "trojan":
 			urlTrojan, err := url.Parse(line)
 			if err != nil {
+				skip(line, err)
 				continue
 			}
 
@@ -206,6 +228,7 @@ func ConvertsV2Ray(buf []byte) ([]map[string]any, error) {
 		case "vless":
 			urlVLess, err := url.Parse(line)
 			if err != nil {
+				skip(line, err)
 				continue
 			}
 			query := urlVLess.Query()
@@ -213,6 +236,7 @@ func ConvertsV2Ray(buf []byte) ([]map[string]any, error) {
 			err = handleVShareLink(names, urlVLess, scheme, vless)
 			if err != nil {
 				log.Warnln("error:%s line:%s", err.Error(), line)
+				skip(line, err)
 				continue
 			}
 			if flow := query.Get("flow"); flow != "" {
@@ -228,6 +252,7 @@ func ConvertsV2Ray(buf []byte) ([]map[string]any, error) {
 				// Xray VMessAEAD share link
 				urlVMess, err := url.Parse(line)
 				if err != nil {
+					skip(line, err)
 					continue
 				}
 				query := urlVMess.Query()
@@ -235,6 +260,7 @@ func ConvertsV2Ray(buf []byte) ([]map[string]any, error) {
 				err = handleVShareLink(names, urlVMess, scheme, vmess)
 				if err != nil {
 					log.Warnln("error:%s line:%s", err.Error(), line)
+					skip(line, err)
 					continue
 				}
 				vmess["alterId"] = 0
@@ -250,10 +276,12 @@ func ConvertsV2Ray(buf []byte) ([]map[string]any, error) {
 			values := make(map[string]any, 20)
 
 			if jsonDc.Decode(&values) != nil {
+				skip(line, errors.New("invalid vmess json"))
 				continue
 			}
 			tempName, ok := values["ps"].(string)
 			if !ok {
+				skip(line, errors.New("missing vmess ps"))
 				continue
 			}
 			name := uniqueName(names, tempName)
@@ -377,6 +405,7 @@ func ConvertsV2Ray(buf []byte) ([]map[string]any, error) {
 		case "ss":
 			urlSS, err := url.Parse(line)
 			if err != nil {
+				skip(line, err)
 				continue
 			}
 
@@ -386,11 +415,13 @@ func ConvertsV2Ray(buf []byte) ([]map[string]any, error) {
 			if port == "" {
 				dcBuf, err := encRaw.DecodeString(urlSS.Host)
 				if err != nil {
+					skip(line, err)
 					continue
 				}
 
 				urlSS, err = url.Parse("ss://" + string(dcBuf))
 				if err != nil {
+					skip(line, err)
 					continue
 				}
 			}
@@ -408,6 +439,7 @@ func ConvertsV2Ray(buf []byte) ([]map[string]any, error) {
 				}
 				cipher, password, found = strings.Cut(string(dcBuf), ":")
 				if !found {
+					skip(line, errors.New("invalid ss user info"))
 					continue
 				}
 				err = VerifyMethod(cipher, password)
@@ -456,6 +488,7 @@ func ConvertsV2Ray(buf []byte) ([]map[string]any, error) {
 		case "ssr":
 			dcBuf, err := encRaw.DecodeString(body)
 			if err != nil {
+				skip(line, err)
 				continue
 			}
 
@@ -463,12 +496,14 @@ func ConvertsV2Ray(buf []byte) ([]map[string]any, error) {
 
 			before, after, ok := strings.Cut(string(dcBuf), "/?")
 			if !ok {
+				skip(line, errors.New("missing ssr params"))
 				continue
 			}
 
 			beforeArr := strings.Split(before, ":")
 
 			if len(beforeArr) != 6 {
+				skip(line, errors.New("invalid ssr host"))
 				continue
 			}
 
@@ -481,6 +516,7 @@ func ConvertsV2Ray(buf []byte) ([]map[string]any, error) {
 
 			query, err := url.ParseQuery(urlSafe(after))
 			if err != nil {
+				skip(line, err)
 				continue
 			}
 
@@ -511,14 +547,17 @@ func ConvertsV2Ray(buf []byte) ([]map[string]any, error) {
 			}
 
 			proxies = append(proxies, ssr)
+
+		default:
+			skip(line, fmt.Errorf("unsupported scheme %s", scheme))
 		}
 	}
 
 	if len(proxies) == 0 {
-		return nil, fmt.Errorf("convert v2ray subscribe error: format invalid")
+		return nil, skipped, fmt.Errorf("convert v2ray subscribe error: format invalid")
 	}
 
-	return proxies, nil
+	return proxies, skipped, nil
 }
 
 func uniqueName(names map[string]int, name string) string {
@@ -1,6 +1,7 @@
 package convert
 
 import (
+	"encoding/base64"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -33,3 +34,29 @@ func TestConvertsV2Ray_normal(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, expected, proxies)
 }
+
+func TestConvertsV2Ray_skipped(t *testing.T) {
+	buf := "trojan://password@example.com:443#ok\n" +
+		"foo://bar\n" +
+		"not a link\n" +
+		"vless://uuid@:443#nohost\n" +
+		"vmess://b0ae6f9c-1b2e-4c55-9d0e-2f1c0c3a5b7d@example.com:443?encryption=auto&type=tcp#aead\n" +
+		"vmess://" + base64.StdEncoding.EncodeToString([]byte(`{"ps":`)) + "\n" +
+		"vmess://" + base64.StdEncoding.EncodeToString([]byte(`{"add":"example.com","port":"443"}`)) + "\n"
+
+	proxies, skipped, err := ConvertsV2RayWithSkipped([]byte(buf))
+
+	assert.Nil(t, err)
+	if assert.Len(t, proxies, 2) {
+		assert.Equal(t, "aead", proxies[1]["name"])
+		assert.Equal(t, "auto", proxies[1]["cipher"])
+	}
+	if assert.Len(t, skipped, 5) {
+		assert.Equal(t, "foo://bar", skipped[0].Line)
+		assert.EqualError(t, skipped[0].Reason, "unsupported scheme foo")
+		assert.EqualError(t, skipped[1].Reason, "missing scheme")
+		assert.EqualError(t, skipped[2].Reason, "url.Hostname() is empty")
+		assert.EqualError(t, skipped[3].Reason, "invalid vmess json")
+		assert.EqualError(t, skipped[4].Reason, "missing vmess ps")
+	}
+}
@@ -47,5 +47,26 @@ var Pipe = deadline.Pipe
 func Relay(leftConn, rightConn net.Conn) {
 	defer runtime.KeepAlive(leftConn)
 	defer runtime.KeepAlive(rightConn)
+	// bufio.Copy writes the cached bytes to the unwrapped destination, out of sight of
+	// the counters such as the statistic tracker, so they are written through first
+	if writeCached(rightConn, leftConn) != nil || writeCached(leftConn, rightConn) != nil {
+		_ = leftConn.Close()
+		_ = rightConn.Close()
+		return
+	}
 	_ = bufio.CopyConn(context.TODO(), leftConn, rightConn)
 }
+
+func writeCached(dst, src net.Conn) error {
+	cached, ok := src.(network.CachedReader)
+	if !ok {
+		return nil
+	}
+	buffer := cached.ReadCached()
+	if buffer == nil {
+		return nil
+	}
+	defer buffer.Release()
+	_, err := dst.Write(buffer.Bytes())
+	return err
+}
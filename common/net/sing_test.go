@@ -0,0 +1,69 @@
+package net
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countConn struct {
+	net.Conn
+	written atomic.Int64
+}
+
+func (c *countConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.written.Add(int64(n))
+	return n, err
+}
+
+func (c *countConn) UnwrapWriter() (io.Writer, []CountFunc) {
+	return c.Conn, []CountFunc{func(n int64) { c.written.Add(n) }}
+}
+
+func tcpPair(t *testing.T) (net.Conn, net.Conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	client, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	server, err := l.Accept()
+	require.NoError(t, err)
+	return client, server
+}
+
+func TestRelayCountsCached(t *testing.T) {
+	client, inbound := tcpPair(t)
+	outbound, target := tcpPair(t)
+	defer client.Close()
+	defer target.Close()
+
+	upload := make([]byte, 1<<20)
+	_, err := client.Write(upload[:16])
+	require.NoError(t, err)
+	left := NewBufferedConn(inbound)
+	_, err = left.Peek(16) // e.g. by the sniffers
+	require.NoError(t, err)
+
+	right := &countConn{Conn: outbound}
+	done := make(chan struct{})
+	go func() {
+		Relay(left, right)
+		close(done)
+	}()
+
+	_, err = client.Write(upload[16:])
+	require.NoError(t, err)
+	_ = client.(*net.TCPConn).CloseWrite()
+	received, err := io.ReadAll(target)
+	require.NoError(t, err)
+	assert.Len(t, received, len(upload))
+	_ = target.Close()
+	<-done
+
+	assert.Equal(t, int64(len(upload)), right.written.Load())
+}
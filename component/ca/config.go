@@ -14,6 +14,7 @@ import (
 	"strings"
 	"sync"
 
+	N "github.com/metacubex/mihomo/common/net"
 	C "github.com/metacubex/mihomo/constant"
 )
 
@@ -157,3 +158,18 @@ func GetGlobalTLSConfig(tlsConfig *tls.Config) *tls.Config {
 	tlsConfig, _ = GetTLSConfig(tlsConfig, "", "", "")
 	return tlsConfig
 }
+
+// LoadClientCertificate load the certificate for mutual TLS, certificate and privateKey can be PEM content or file path
+func LoadClientCertificate(certificate string, privateKey string) ([]tls.Certificate, error) {
+	if certificate == "" && privateKey == "" {
+		return nil, nil
+	}
+	if certificate == "" || privateKey == "" {
+		return nil, errors.New("certificate and private-key must be set together")
+	}
+	cert, err := N.ParseCert(certificate, privateKey, C.Path)
+	if err != nil {
+		return nil, fmt.Errorf("load client certificate error: %w", err)
+	}
+	return []tls.Certificate{cert}, nil
+}
@@ -0,0 +1,339 @@
+// Package capture records the plaintext payload of the flows in the tunnel into pcapng,
+// the packets are synthesized from the payload, every flow is an interface with its metadata in the comment.
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	C "github.com/metacubex/mihomo/constant"
+
+	"github.com/metacubex/gopacket"
+	"github.com/metacubex/gopacket/layers"
+	"github.com/metacubex/gopacket/pcapgo"
+)
+
+const (
+	DefaultDuration = 60 * time.Second
+	DefaultMaxSize  = 16 * 1024 * 1024
+
+	maxDuration = time.Hour
+	maxSize     = 1024 * 1024 * 1024
+
+	// queueSize is the number of the packets waiting to be written
+	queueSize = 1024
+)
+
+var (
+	ErrLimitReached = errors.New("capture limit reached")
+
+	capturesMutex sync.RWMutex
+	captures      []*Capture
+	active        atomic.Bool
+)
+
+// Filter selects the flows to capture, the empty fields match all flows
+type Filter struct {
+	Host    string // the domain and its subdomains, or an ip
+	Rule    string // the type or the payload of the matched rule, e.g. DOMAIN-SUFFIX
+	Process string // the name or the path of the process
+	Inbound string // the name or the type of the inbound, e.g. tun
+	Network string // tcp or udp
+}
+
+type Options struct {
+	Filter
+	Duration time.Duration // 0 uses DefaultDuration
+	MaxSize  int64         // the limit of the output in bytes, 0 uses DefaultMaxSize
+	SnapLen  int           // the limit of the captured payload of each packet, 0 is unlimited
+}
+
+// Capture writes the packets of the matched flows until it is closed or a limit is reached,
+// the packets are queued and written by its own goroutine, so a slow reader of the output
+// never blocks the flows, the packets are dropped instead when the queue is full
+type Capture struct {
+	options Options
+
+	mutex  sync.Mutex
+	queue  chan queuedBlock
+	flows  int
+	closed bool
+	err    error
+
+	writer  *pcapgo.NgWriter
+	counter *countWriter
+	dropped atomic.Uint64
+
+	done  chan struct{}
+	timer *time.Timer
+}
+
+// queuedBlock is an interface of a flow or a packet
+type queuedBlock struct {
+	intf *pcapgo.NgInterface
+	ci   gopacket.CaptureInfo
+	data []byte
+}
+
+type countWriter struct {
+	io.Writer
+	n int64
+}
+
+func (w *countWriter) Write(b []byte) (n int, err error) {
+	n, err = w.Writer.Write(b)
+	w.n += int64(n)
+	return
+}
+
+// Start begins to capture the new flows matching options into w, w is flushed whenever
+// the queued packets are written
+func Start(w io.Writer, options Options) (*Capture, error) {
+	if options.Duration <= 0 {
+		options.Duration = DefaultDuration
+	}
+	if options.Duration > maxDuration {
+		return nil, fmt.Errorf("capture duration %s exceeds %s", options.Duration, maxDuration)
+	}
+	if options.MaxSize <= 0 {
+		options.MaxSize = DefaultMaxSize
+	}
+	if options.MaxSize > maxSize {
+		return nil, fmt.Errorf("capture size %d exceeds %d", options.MaxSize, maxSize)
+	}
+	switch strings.ToLower(options.Network) {
+	case "", "tcp", "udp":
+	default:
+		return nil, fmt.Errorf("unsupported capture network: %s", options.Network)
+	}
+
+	counter := &countWriter{Writer: w}
+	intf := pcapgo.DefaultNgInterface
+	intf.Name = "mihomo"
+	intf.Comment = "filter: " + options.Filter.String()
+	intf.LinkType = layers.LinkTypeRaw
+	writerOptions := pcapgo.DefaultNgWriterOptions
+	writerOptions.SectionInfo.Application = C.Name + " " + C.Version
+	writer, err := pcapgo.NewNgWriterInterface(counter, intf, writerOptions)
+	if err != nil {
+		return nil, err
+	}
+	if err = writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	c := &Capture{
+		options: options,
+		queue:   make(chan queuedBlock, queueSize),
+		writer:  writer,
+		counter: counter,
+		done:    make(chan struct{}),
+	}
+	capturesMutex.Lock()
+	captures = append(captures, c)
+	active.Store(true)
+	capturesMutex.Unlock()
+
+	c.timer = time.AfterFunc(options.Duration, func() {
+		c.stop(nil)
+	})
+	go c.loop()
+	return c, nil
+}
+
+// Done is closed after the capture stops and the queued packets are written
+func (c *Capture) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the reason of the stop, nil if it is closed or the duration is reached
+func (c *Capture) Err() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.err
+}
+
+// Dropped returns the number of the packets dropped since the queue was full
+func (c *Capture) Dropped() uint64 {
+	return c.dropped.Load()
+}
+
+// Close stops the capture, the flows are no longer written
+func (c *Capture) Close() error {
+	c.stop(nil)
+	return nil
+}
+
+func (c *Capture) stop(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.err = err
+	close(c.queue)
+}
+
+// loop writes the queued blocks until the queue is closed by stop
+func (c *Capture) loop() {
+	defer c.cleanup()
+	var err error
+	for block := range c.queue {
+		if err != nil {
+			continue
+		}
+		if err = c.write(block); err == nil && len(c.queue) == 0 {
+			err = c.writer.Flush()
+		}
+		if err != nil {
+			c.stop(err)
+		}
+	}
+	if err != nil {
+		return
+	}
+	if dropped := c.dropped.Load(); dropped > 0 {
+		_ = c.writer.WriteInterfaceStats(0, pcapgo.NgInterfaceStatistics{
+			LastUpdate:      time.Now(),
+			PacketsReceived: pcapgo.NgNoValue64,
+			PacketsDropped:  dropped,
+		})
+	}
+	_ = c.writer.Flush()
+}
+
+func (c *Capture) write(block queuedBlock) error {
+	if block.intf != nil {
+		_, err := c.writer.AddInterface(*block.intf)
+		return err
+	}
+	if c.counter.n+int64(len(block.data)) > c.options.MaxSize {
+		return ErrLimitReached
+	}
+	return c.writer.WritePacket(block.ci, block.data)
+}
+
+func (c *Capture) cleanup() {
+	c.timer.Stop()
+	capturesMutex.Lock()
+	for i, capture := range captures {
+		if capture == c {
+			captures = append(captures[:i], captures[i+1:]...)
+			break
+		}
+	}
+	active.Store(len(captures) > 0)
+	capturesMutex.Unlock()
+	close(c.done)
+}
+
+// enqueue queues block without blocking, it reports whether block is queued
+func (c *Capture) enqueue(block queuedBlock) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return false
+	}
+	select {
+	case c.queue <- block:
+		return true
+	default:
+		c.dropped.Add(1)
+		return false
+	}
+}
+
+// addFlow adds an interface for the flow, it returns -1 if the capture is stopped or
+// the interface is dropped, the packets of the flow are not captured then
+func (c *Capture) addFlow(comment string) int {
+	intf := pcapgo.DefaultNgInterface
+	intf.Comment = comment
+	intf.LinkType = layers.LinkTypeRaw
+
+	// the interfaces are numbered in the order they are written, so the id is taken
+	// with the block queued under the lock
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return -1
+	}
+	intf.Name = fmt.Sprintf("flow%d", c.flows+1)
+	select {
+	case c.queue <- queuedBlock{intf: &intf}:
+		c.flows++
+		return c.flows
+	default:
+		c.dropped.Add(1)
+		return -1
+	}
+}
+
+func (c *Capture) writePacket(intf int, data []byte, length int) {
+	c.enqueue(queuedBlock{
+		ci: gopacket.CaptureInfo{
+			Timestamp:      time.Now(),
+			CaptureLength:  len(data),
+			Length:         length,
+			InterfaceIndex: intf,
+		},
+		data: data,
+	})
+}
+
+func (f Filter) String() string {
+	var fields []string
+	for _, field := range []struct{ key, value string }{
+		{"host", f.Host},
+		{"rule", f.Rule},
+		{"process", f.Process},
+		{"inbound", f.Inbound},
+		{"network", f.Network},
+	} {
+		if field.value != "" {
+			fields = append(fields, field.key+"="+field.value)
+		}
+	}
+	if len(fields) == 0 {
+		return "all"
+	}
+	return strings.Join(fields, " ")
+}
+
+// Match reports whether the flow of metadata matched by rule is selected
+func (f Filter) Match(metadata *C.Metadata, rule C.Rule) bool {
+	if f.Network != "" && !strings.EqualFold(f.Network, metadata.NetWork.String()) {
+		return false
+	}
+	if f.Host != "" {
+		if ip, err := netip.ParseAddr(f.Host); err == nil {
+			if metadata.DstIP.Unmap() != ip.Unmap() {
+				return false
+			}
+		} else {
+			host := strings.ToLower(metadata.Host)
+			domain := strings.ToLower(strings.TrimPrefix(f.Host, "."))
+			if host != domain && !strings.HasSuffix(host, "."+domain) {
+				return false
+			}
+		}
+	}
+	if f.Rule != "" {
+		if rule == nil || !strings.EqualFold(f.Rule, rule.RuleType().String()) && f.Rule != rule.Payload() {
+			return false
+		}
+	}
+	if f.Process != "" && f.Process != metadata.Process && f.Process != metadata.ProcessPath {
+		return false
+	}
+	if f.Inbound != "" && f.Inbound != metadata.InName && !strings.EqualFold(f.Inbound, metadata.Type.String()) {
+		return false
+	}
+	return true
+}
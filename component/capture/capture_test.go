@@ -0,0 +1,159 @@
+package capture
+
+import (
+	"bytes"
+	"io"
+	"net/netip"
+	"testing"
+
+	C "github.com/metacubex/mihomo/constant"
+
+	"github.com/metacubex/gopacket"
+	"github.com/metacubex/gopacket/layers"
+	"github.com/metacubex/gopacket/pcapgo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter(t *testing.T) {
+	metadata := &C.Metadata{NetWork: C.TCP, Type: C.TUN, Host: "www.example.com", InName: "tun-in"}
+	assert.True(t, Filter{}.Match(metadata, nil))
+	assert.True(t, Filter{Host: "example.com", Network: "TCP", Inbound: "tun"}.Match(metadata, nil))
+	assert.True(t, Filter{Inbound: "tun-in"}.Match(metadata, nil))
+	assert.False(t, Filter{Host: "ample.com"}.Match(metadata, nil))
+	assert.False(t, Filter{Network: "udp"}.Match(metadata, nil))
+	assert.False(t, Filter{Rule: "MATCH"}.Match(metadata, nil))
+}
+
+func TestCapture(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c, err := Start(buf, Options{Filter: Filter{Host: "example.com"}})
+	require.NoError(t, err)
+
+	assert.Nil(t, NewFlow(&C.Metadata{NetWork: C.TCP, Host: "example.org"}, nil, nil))
+	tcp := NewFlow(&C.Metadata{
+		NetWork: C.TCP,
+		SrcIP:   netip.MustParseAddr("10.0.0.1"),
+		SrcPort: 40000,
+		DstIP:   netip.MustParseAddr("2001:db8::1"),
+		DstPort: 443,
+		Host:    "example.com",
+	}, nil, C.Chain{"DIRECT"})
+	require.NotNil(t, tcp)
+	tcp.WriteTCP(true, []byte("request"))
+	tcp.WriteTCP(false, []byte("response"))
+	tcp.CloseTCP()
+
+	udp := NewFlow(&C.Metadata{
+		NetWork: C.UDP,
+		SrcIP:   netip.MustParseAddr("10.0.0.1"),
+		SrcPort: 40001,
+		Host:    "example.com",
+	}, nil, nil)
+	require.NotNil(t, udp)
+	udp.WriteUDP(true, netip.MustParseAddrPort("198.51.100.1:53"), []byte("query"))
+	require.NoError(t, c.Close())
+	<-c.Done()
+	udp.WriteUDP(false, netip.MustParseAddrPort("198.51.100.1:53"), []byte("ignored"))
+
+	reader, err := pcapgo.NewNgReader(buf, pcapgo.DefaultNgReaderOptions)
+	require.NoError(t, err)
+	var payloads []string
+	var interfaces []int
+	for {
+		data, ci, err := reader.ReadPacketData()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		payload := decodePayload(t, data)
+		if len(payload) > 0 {
+			payloads = append(payloads, string(payload))
+		}
+		interfaces = append(interfaces, ci.InterfaceIndex)
+	}
+	assert.Equal(t, []string{"request", "response", "query"}, payloads)
+	assert.Len(t, interfaces, 9) // 3 handshake, 2 data, 3 close and 1 udp
+	assert.Equal(t, 3, reader.NInterfaces())
+	intf, err := reader.Interface(1)
+	require.NoError(t, err)
+	assert.Contains(t, intf.Comment, "host=example.com")
+	assert.Contains(t, intf.Comment, "chains=DIRECT")
+}
+
+// slowWriter blocks the writes after blocking is set until release is closed
+type slowWriter struct {
+	bytes.Buffer
+	blocking bool
+	release  chan struct{}
+}
+
+func (w *slowWriter) Write(b []byte) (int, error) {
+	if w.blocking {
+		<-w.release
+	}
+	return w.Buffer.Write(b)
+}
+
+func TestCaptureDrop(t *testing.T) {
+	w := &slowWriter{release: make(chan struct{})}
+	c, err := Start(w, Options{})
+	require.NoError(t, err)
+	w.blocking = true
+
+	udp := NewFlow(&C.Metadata{
+		NetWork: C.UDP,
+		SrcIP:   netip.MustParseAddr("10.0.0.1"),
+		SrcPort: 40002,
+	}, nil, nil)
+	require.NotNil(t, udp)
+	total := queueSize * 2
+	for i := 0; i < total; i++ {
+		udp.WriteUDP(true, netip.MustParseAddrPort("198.51.100.1:53"), []byte("query"))
+	}
+	dropped := int(c.Dropped())
+	assert.NotZero(t, dropped, "the packets are dropped instead of blocking the flow")
+
+	close(w.release)
+	require.NoError(t, c.Close())
+	<-c.Done()
+
+	reader, err := pcapgo.NewNgReader(&w.Buffer, pcapgo.DefaultNgReaderOptions)
+	require.NoError(t, err)
+	packets := 0
+	for {
+		_, _, err := reader.ReadPacketData()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		packets++
+	}
+	assert.Equal(t, total-dropped, packets)
+}
+
+// decodePayload decodes the layers manually, the decoders of them are not registered in this fork of gopacket
+func decodePayload(t *testing.T, data []byte) []byte {
+	var protocol layers.IPProtocol
+	if data[0]>>4 == 4 {
+		var ip layers.IPv4
+		require.NoError(t, ip.DecodeFromBytes(data, gopacket.NilDecodeFeedback))
+		protocol, data = ip.Protocol, ip.Payload
+	} else {
+		var ip layers.IPv6
+		require.NoError(t, ip.DecodeFromBytes(data, gopacket.NilDecodeFeedback))
+		protocol, data = ip.NextHeader, ip.Payload
+	}
+	switch protocol {
+	case layers.IPProtocolTCP:
+		var tcp layers.TCP
+		require.NoError(t, tcp.DecodeFromBytes(data, gopacket.NilDecodeFeedback))
+		return tcp.Payload
+	case layers.IPProtocolUDP:
+		var udp layers.UDP
+		require.NoError(t, udp.DecodeFromBytes(data, gopacket.NilDecodeFeedback))
+		return udp.Payload
+	}
+	t.Fatalf("unexpected protocol %d", protocol)
+	return nil
+}
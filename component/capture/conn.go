@@ -0,0 +1,35 @@
+package capture
+
+import "net"
+
+type conn struct {
+	net.Conn
+	flow *Flow
+}
+
+// WrapConn records the payload of the outbound conn of a tcp flow, it only exposes
+// the methods of net.Conn, so the relay falls back to copy the payload through it
+func WrapConn(c net.Conn, flow *Flow) net.Conn {
+	return &conn{Conn: c, flow: flow}
+}
+
+func (c *conn) Read(b []byte) (n int, err error) {
+	n, err = c.Conn.Read(b)
+	if n > 0 {
+		c.flow.WriteTCP(false, b[:n])
+	}
+	return
+}
+
+func (c *conn) Write(b []byte) (n int, err error) {
+	n, err = c.Conn.Write(b)
+	if n > 0 {
+		c.flow.WriteTCP(true, b[:n])
+	}
+	return
+}
+
+func (c *conn) Close() error {
+	c.flow.CloseTCP()
+	return c.Conn.Close()
+}
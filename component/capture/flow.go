@@ -0,0 +1,223 @@
+package capture
+
+import (
+	"fmt"
+	"net/netip"
+	"sync"
+
+	C "github.com/metacubex/mihomo/constant"
+
+	"github.com/metacubex/gopacket"
+	"github.com/metacubex/gopacket/layers"
+)
+
+// the payload of a synthesized tcp segment, it keeps the packets in the limit of ipv4
+const maxSegmentSize = 16384
+
+type flowCapture struct {
+	capture *Capture
+	intf    int
+}
+
+// Flow synthesizes the packets of a tcp connection or an udp session for the captures
+type Flow struct {
+	captures []flowCapture
+	network  C.NetWork
+	client   netip.AddrPort
+	server   netip.AddrPort
+
+	mutex     sync.Mutex
+	clientSeq uint32
+	serverSeq uint32
+	closed    bool
+}
+
+// NewFlow returns the flow for the captures selecting metadata, it returns nil if there is no such capture,
+// chains is the outbound of the flow written into the comment
+func NewFlow(metadata *C.Metadata, rule C.Rule, chains C.Chain) *Flow {
+	if !active.Load() {
+		return nil
+	}
+	capturesMutex.RLock()
+	var matched []*Capture
+	for _, c := range captures {
+		if c.options.Match(metadata, rule) {
+			matched = append(matched, c)
+		}
+	}
+	capturesMutex.RUnlock()
+	if len(matched) == 0 {
+		return nil
+	}
+
+	comment := flowComment(metadata, rule, chains)
+	f := &Flow{
+		network: metadata.NetWork,
+		client:  metadata.SourceAddrPort(),
+		server:  metadata.AddrPort(),
+	}
+	if !f.client.Addr().IsValid() {
+		f.client = netip.AddrPortFrom(netip.IPv4Unspecified(), f.client.Port())
+	}
+	if !f.server.Addr().IsValid() {
+		f.server = netip.AddrPortFrom(netip.IPv4Unspecified(), f.server.Port())
+	}
+	for _, c := range matched {
+		if intf := c.addFlow(comment); intf >= 0 {
+			f.captures = append(f.captures, flowCapture{capture: c, intf: intf})
+		}
+	}
+	if len(f.captures) == 0 {
+		return nil
+	}
+
+	if f.network == C.TCP {
+		f.mutex.Lock()
+		f.writeTCP(true, layers.TCP{SYN: true}, nil)
+		f.writeTCP(false, layers.TCP{SYN: true, ACK: true}, nil)
+		f.writeTCP(true, layers.TCP{ACK: true}, nil)
+		f.mutex.Unlock()
+	}
+	return f
+}
+
+func flowComment(metadata *C.Metadata, rule C.Rule, chains C.Chain) string {
+	comment := fmt.Sprintf("%s %s --> %s", metadata.NetWork, metadata.SourceDetail(), metadata.RemoteAddress())
+	if metadata.Host != "" {
+		comment += " host=" + metadata.Host
+	}
+	if rule != nil {
+		comment += fmt.Sprintf(" rule=%s(%s)", rule.RuleType(), rule.Payload())
+	}
+	if len(chains) > 0 {
+		comment += " chains=" + chains.String()
+	}
+	if metadata.InName != "" {
+		comment += fmt.Sprintf(" inbound=%s(%s)", metadata.InName, metadata.Type)
+	} else {
+		comment += " inbound=" + metadata.Type.String()
+	}
+	return comment
+}
+
+// WriteTCP records the payload sent by the client if uplink, otherwise the one sent by the server
+func (f *Flow) WriteTCP(uplink bool, payload []byte) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.closed {
+		return
+	}
+	for len(payload) > 0 {
+		n := len(payload)
+		if n > maxSegmentSize {
+			n = maxSegmentSize
+		}
+		f.writeTCP(uplink, layers.TCP{ACK: true, PSH: true}, payload[:n])
+		payload = payload[n:]
+	}
+}
+
+// CloseTCP records the FIN of both sides
+func (f *Flow) CloseTCP() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.closed {
+		return
+	}
+	f.closed = true
+	f.writeTCP(true, layers.TCP{FIN: true, ACK: true}, nil)
+	f.writeTCP(false, layers.TCP{FIN: true, ACK: true}, nil)
+	f.writeTCP(true, layers.TCP{ACK: true}, nil)
+}
+
+// writeTCP writes a segment and advances the sequence numbers with the lock held
+func (f *Flow) writeTCP(uplink bool, tcp layers.TCP, payload []byte) {
+	src, dst := f.client, f.server
+	seq, ack := &f.clientSeq, &f.serverSeq // the next sequence numbers, the initial ones are 0
+	if !uplink {
+		src, dst = dst, src
+		seq, ack = ack, seq
+	}
+	tcp.SrcPort = layers.TCPPort(src.Port())
+	tcp.DstPort = layers.TCPPort(dst.Port())
+	tcp.Window = 65535
+	tcp.Seq = *seq
+	if tcp.ACK {
+		tcp.Ack = *ack
+	}
+	*seq += uint32(len(payload))
+	if tcp.SYN || tcp.FIN {
+		*seq++
+	}
+	f.write(src, dst, &tcp, payload)
+}
+
+// WriteUDP records a datagram sent by the client to remote if uplink, otherwise the one from remote
+func (f *Flow) WriteUDP(uplink bool, remote netip.AddrPort, payload []byte) {
+	if !remote.Addr().IsValid() {
+		return
+	}
+	src, dst := f.client, remote
+	if !uplink {
+		src, dst = dst, src
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.write(src, dst, &layers.UDP{
+		SrcPort: layers.UDPPort(src.Port()),
+		DstPort: layers.UDPPort(dst.Port()),
+	}, payload)
+}
+
+type transportLayer interface {
+	gopacket.SerializableLayer
+	SetNetworkLayerForChecksum(l gopacket.NetworkLayer) error
+}
+
+// write serializes the packet, the addresses are mapped into ipv6 if the families are different
+func (f *Flow) write(src, dst netip.AddrPort, transport transportLayer, payload []byte) {
+	protocol := layers.IPProtocolTCP
+	if _, ok := transport.(*layers.UDP); ok {
+		protocol = layers.IPProtocolUDP
+	}
+	srcAddr, dstAddr := src.Addr().Unmap(), dst.Addr().Unmap()
+
+	var network interface {
+		gopacket.NetworkLayer
+		gopacket.SerializableLayer
+	}
+	if srcAddr.Is4() && dstAddr.Is4() {
+		network = &layers.IPv4{
+			Version:  4,
+			TTL:      64,
+			Protocol: protocol,
+			SrcIP:    srcAddr.AsSlice(),
+			DstIP:    dstAddr.AsSlice(),
+		}
+	} else {
+		srcIP, dstIP := srcAddr.As16(), dstAddr.As16()
+		network = &layers.IPv6{
+			Version:    6,
+			HopLimit:   64,
+			NextHeader: protocol,
+			SrcIP:      srcIP[:],
+			DstIP:      dstIP[:],
+		}
+	}
+	_ = transport.SetNetworkLayerForChecksum(network)
+
+	buffer := gopacket.NewSerializeBuffer()
+	err := gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true},
+		network, transport, gopacket.Payload(payload))
+	if err != nil {
+		return
+	}
+	data := buffer.Bytes()
+	for _, fc := range f.captures {
+		packet := data
+		if snapLen := fc.capture.options.SnapLen; snapLen > 0 && len(packet) > snapLen {
+			packet = packet[:snapLen]
+		}
+		fc.capture.writePacket(fc.intf, packet, len(data))
+	}
+}
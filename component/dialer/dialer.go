@@ -34,9 +34,15 @@ var (
 )
 
 func applyOptions(options ...Option) *option {
+	return applyContextOptions(context.Background(), options...)
+}
+
+// applyContextOptions applies the options saved by WithContextOptions after the others
+func applyContextOptions(ctx context.Context, options ...Option) *option {
 	opt := &option{
 		interfaceName: DefaultInterface.Load(),
 		routingMark:   int(DefaultRoutingMark.Load()),
+		sourcePool:    DefaultSourcePool.Load(),
 	}
 
 	for _, o := range DefaultOptions {
@@ -47,11 +53,15 @@ func applyOptions(options ...Option) *option {
 		o(opt)
 	}
 
+	for _, o := range contextOptions(ctx) {
+		o(opt)
+	}
+
 	return opt
 }
 
 func DialContext(ctx context.Context, network, address string, options ...Option) (net.Conn, error) {
-	opt := applyOptions(options...)
+	opt := applyContextOptions(ctx, options...)
 
 	if opt.network == 4 || opt.network == 6 {
 		if strings.Contains(network, "tcp") {
@@ -83,7 +93,7 @@ func ListenPacket(ctx context.Context, network, address string, rAddrPort netip.
 		return listenPacketHooked(ctx, network, address)
 	}
 
-	cfg := applyOptions(options...)
+	cfg := applyContextOptions(ctx, options...)
 
 	lc := &net.ListenConfig{}
 	if cfg.interfaceName != "" {
@@ -97,12 +107,18 @@ func ListenPacket(ctx context.Context, network, address string, rAddrPort netip.
 		}
 		address = addr
 	}
+	if cfg.sourcePool != nil {
+		address = cfg.sourcePool.bindToListenAddress(ctx, address, rAddrPort)
+	}
 	if cfg.addrReuse {
 		addrReuseToListenConfig(lc)
 	}
 	if cfg.routingMark != 0 {
 		bindMarkToListenConfig(cfg.routingMark, lc, network, address)
 	}
+	if cfg.needSocketMark() {
+		bindSocketMarkToListenConfig(ctx, cfg, lc)
+	}
 
 	return lc.ListenPacket(ctx, network, address)
 }
@@ -158,9 +174,15 @@ func dialContext(ctx context.Context, network string, destination netip.Addr, po
 			return nil, err
 		}
 	}
+	if opt.sourcePool != nil {
+		opt.sourcePool.bindToDialer(ctx, dialer, network, destination)
+	}
 	if opt.routingMark != 0 {
 		bindMarkToDialer(opt.routingMark, dialer, network, destination)
 	}
+	if opt.needSocketMark() {
+		bindSocketMarkToDialer(ctx, opt, dialer)
+	}
 	if opt.mpTcp {
 		setMultiPathTCP(dialer)
 	}
@@ -29,6 +29,9 @@ type option struct {
 	mpTcp         bool
 	resolver      resolver.Resolver
 	netDialer     NetDialer
+	sourcePool    *SourcePool
+	dscp          int
+	ttl           int
 }
 
 type Option func(opt *option)
@@ -103,6 +106,26 @@ func WithNetDialer(netDialer NetDialer) Option {
 	}
 }
 
+func WithSourcePool(pool *SourcePool) Option {
+	return func(opt *option) {
+		opt.sourcePool = pool
+	}
+}
+
+// WithDSCP sets the DSCP of outgoing packets, 0 keeps the system default and DSCPInherit uses the inbound one
+func WithDSCP(dscp int) Option {
+	return func(opt *option) {
+		opt.dscp = dscp
+	}
+}
+
+// WithTTL sets the TTL (hop limit for IPv6) of outgoing packets, 0 keeps the system default
+func WithTTL(ttl int) Option {
+	return func(opt *option) {
+		opt.ttl = ttl
+	}
+}
+
 func WithOption(o option) Option {
 	return func(opt *option) {
 		*opt = o
@@ -0,0 +1,148 @@
+package dialer
+
+import (
+	"context"
+	"fmt"
+	"hash/maphash"
+	"net"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+
+	atomic2 "github.com/metacubex/mihomo/common/atomic"
+)
+
+const (
+	SourceRoundRobin        = "round-robin"
+	SourceConsistentHashing = "consistent-hashing" // by the destination address
+	SourceStickySessions    = "sticky-sessions"    // by the source address of the client
+
+	maxSourcePoolSize = 4096
+)
+
+// DefaultSourcePool is used by the dialers without WithSourcePool, nil means not to bind
+var DefaultSourcePool = atomic2.NewTypedValue[*SourcePool](nil)
+
+// SourcePool picks the local address to bind for outgoing connections
+type SourcePool struct {
+	addrs4   []netip.Addr
+	addrs6   []netip.Addr
+	strategy string
+	seed     maphash.Seed
+	index    atomic.Uint32
+}
+
+// NewSourcePool parses addresses and prefixes, e.g. "203.0.113.8/29"
+func NewSourcePool(addresses []string, strategy string) (*SourcePool, error) {
+	switch strategy {
+	case "":
+		strategy = SourceRoundRobin
+	case SourceRoundRobin, SourceConsistentHashing, SourceStickySessions:
+	default:
+		return nil, fmt.Errorf("unsupported source address strategy: %s", strategy)
+	}
+	p := &SourcePool{strategy: strategy, seed: maphash.MakeSeed()}
+	for _, address := range addresses {
+		var prefix netip.Prefix
+		var err error
+		if strings.Contains(address, "/") {
+			prefix, err = netip.ParsePrefix(address)
+		} else {
+			var addr netip.Addr
+			addr, err = netip.ParseAddr(address)
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid source address %s: %w", address, err)
+		}
+		prefix = prefix.Masked()
+		for addr := prefix.Addr(); prefix.Contains(addr); addr = addr.Next() {
+			if len(p.addrs4)+len(p.addrs6) >= maxSourcePoolSize {
+				return nil, fmt.Errorf("too many source addresses, the limit is %d", maxSourcePoolSize)
+			}
+			if addr.Unmap().Is4() {
+				p.addrs4 = append(p.addrs4, addr.Unmap())
+			} else {
+				p.addrs6 = append(p.addrs6, addr)
+			}
+		}
+	}
+	if len(p.addrs4) == 0 && len(p.addrs6) == 0 {
+		return nil, fmt.Errorf("source address pool is empty")
+	}
+	return p, nil
+}
+
+// Pick returns an address of the same family as destination, it is invalid
+// when the pool has no address of the family
+func (p *SourcePool) Pick(destination netip.Addr, client netip.Addr) netip.Addr {
+	addrs := p.addrs4
+	if destination.IsValid() && !destination.Unmap().Is4() {
+		addrs = p.addrs6
+	}
+	if len(addrs) == 0 {
+		return netip.Addr{}
+	}
+
+	var key uint64
+	switch p.strategy {
+	case SourceConsistentHashing:
+		key = p.hash(destination.Unmap())
+	case SourceStickySessions:
+		if client.IsValid() {
+			key = p.hash(client.Unmap())
+			break
+		}
+		fallthrough // the client is unknown, e.g. health checks
+	default:
+		key = uint64(p.index.Add(1))
+	}
+	return addrs[key%uint64(len(addrs))]
+}
+
+func (p *SourcePool) hash(addr netip.Addr) uint64 {
+	b := addr.As16()
+	return maphash.Bytes(p.seed, b[:])
+}
+
+func (p *SourcePool) bindToDialer(ctx context.Context, dialer *net.Dialer, network string, destination netip.Addr) {
+	if !destination.Unmap().IsGlobalUnicast() {
+		return
+	}
+	addr := p.Pick(destination, clientAddrFromContext(ctx))
+	if !addr.IsValid() {
+		return
+	}
+	if strings.HasPrefix(network, "udp") {
+		dialer.LocalAddr = &net.UDPAddr{IP: addr.AsSlice()}
+	} else {
+		dialer.LocalAddr = &net.TCPAddr{IP: addr.AsSlice()}
+	}
+}
+
+func (p *SourcePool) bindToListenAddress(ctx context.Context, address string, rAddrPort netip.AddrPort) string {
+	if rAddrPort.Addr().IsValid() && !rAddrPort.Addr().Unmap().IsGlobalUnicast() {
+		return address
+	}
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		port = "0"
+	}
+	addr := p.Pick(rAddrPort.Addr(), clientAddrFromContext(ctx))
+	if !addr.IsValid() {
+		return address
+	}
+	return net.JoinHostPort(addr.String(), port)
+}
+
+type clientAddrKey struct{}
+
+// WithClientAddr saves the source address of the client in ctx for the sticky-sessions strategy
+func WithClientAddr(ctx context.Context, addr netip.Addr) context.Context {
+	return context.WithValue(ctx, clientAddrKey{}, addr)
+}
+
+func clientAddrFromContext(ctx context.Context) netip.Addr {
+	addr, _ := ctx.Value(clientAddrKey{}).(netip.Addr)
+	return addr
+}
@@ -0,0 +1,55 @@
+package dialer
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourcePool(t *testing.T) {
+	_, err := NewSourcePool([]string{"203.0.113.8/29"}, "random")
+	assert.Error(t, err)
+	_, err = NewSourcePool([]string{"2001:db8::/64"}, "")
+	assert.Error(t, err)
+
+	pool, err := NewSourcePool([]string{"203.0.113.8/29", "2001:db8::1"}, SourceRoundRobin)
+	require.NoError(t, err)
+	dst4 := netip.MustParseAddr("198.51.100.1")
+	dst6 := netip.MustParseAddr("2001:db8:1::1")
+	seen := map[netip.Addr]bool{}
+	for i := 0; i < 8; i++ {
+		addr := pool.Pick(dst4, netip.Addr{})
+		assert.True(t, netip.MustParsePrefix("203.0.113.8/29").Contains(addr))
+		seen[addr] = true
+	}
+	assert.Len(t, seen, 8)
+	assert.Equal(t, netip.MustParseAddr("2001:db8::1"), pool.Pick(dst6, netip.Addr{}))
+
+	pool, err = NewSourcePool([]string{"203.0.113.8/29"}, SourceConsistentHashing)
+	require.NoError(t, err)
+	assert.Equal(t, pool.Pick(dst4, netip.Addr{}), pool.Pick(dst4, netip.MustParseAddr("10.0.0.1")))
+	assert.False(t, pool.Pick(dst6, netip.Addr{}).IsValid())
+
+	pool, err = NewSourcePool([]string{"203.0.113.8/29"}, SourceStickySessions)
+	require.NoError(t, err)
+	client := netip.MustParseAddr("10.0.0.1")
+	assert.Equal(t, pool.Pick(dst4, client), pool.Pick(netip.MustParseAddr("198.51.100.2"), client))
+}
+
+func TestSourcePoolBind(t *testing.T) {
+	pool, err := NewSourcePool([]string{"127.0.0.1"}, "")
+	require.NoError(t, err)
+
+	dialer := &net.Dialer{}
+	pool.bindToDialer(context.Background(), dialer, "tcp", netip.MustParseAddr("127.0.0.1"))
+	assert.Nil(t, dialer.LocalAddr, "loopback destinations are not bound")
+	pool.bindToDialer(context.Background(), dialer, "tcp", netip.MustParseAddr("198.51.100.1"))
+	assert.Equal(t, "127.0.0.1:0", dialer.LocalAddr.String())
+
+	assert.Equal(t, "127.0.0.1:0", pool.bindToListenAddress(context.Background(), "", netip.AddrPort{}))
+	assert.Equal(t, ":0", pool.bindToListenAddress(context.Background(), ":0", netip.MustParseAddrPort("127.0.0.1:53")))
+}
@@ -0,0 +1,75 @@
+package dialer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// DSCPInherit sets the DSCP of outgoing packets to the one recorded by the inbound
+const DSCPInherit = -1
+
+// ParseDSCP parses a DSCP value in 0-63 or "inherit", 0 keeps the system default
+func ParseDSCP(s string) (int, error) {
+	if s == "inherit" {
+		return DSCPInherit, nil
+	}
+	dscp, err := strconv.Atoi(s)
+	if err != nil || dscp < 0 {
+		return 0, fmt.Errorf("invalid DSCP %s, must be 0-63 or inherit", s)
+	}
+	return dscp, CheckSocketMark(dscp, 0)
+}
+
+// CheckSocketMark validates the values for WithDSCP and WithTTL
+func CheckSocketMark(dscp int, ttl int) error {
+	if dscp != DSCPInherit && (dscp < 0 || dscp > 63) {
+		return fmt.Errorf("invalid DSCP %d, must be 0-63", dscp)
+	}
+	if ttl < 0 || ttl > 255 {
+		return fmt.Errorf("invalid TTL %d, must be 0-255", ttl)
+	}
+	return nil
+}
+
+func (opt *option) needSocketMark() bool {
+	return opt.dscp != 0 || opt.ttl != 0
+}
+
+// socketMark resolves the DSCP to set, 0 means not to set it
+func (opt *option) socketMark(ctx context.Context) (dscp int, ttl int) {
+	dscp = opt.dscp
+	if dscp == DSCPInherit {
+		dscp = 0
+		if inbound, ok := ctx.Value(inboundDSCPKey{}).(uint8); ok {
+			dscp = int(inbound)
+		}
+	}
+	return dscp, opt.ttl
+}
+
+type inboundDSCPKey struct{}
+
+// WithInboundDSCP saves the DSCP of the inbound connection in ctx for DSCPInherit
+func WithInboundDSCP(ctx context.Context, dscp uint8) context.Context {
+	return context.WithValue(ctx, inboundDSCPKey{}, dscp)
+}
+
+type contextOptionsKey struct{}
+
+// WithContextOptions saves options in ctx, they are applied after the options of the dialer,
+// so the per-rule options can override the ones of the proxy
+func WithContextOptions(ctx context.Context, options ...Option) context.Context {
+	if len(options) == 0 {
+		return ctx
+	}
+	if parent, ok := ctx.Value(contextOptionsKey{}).([]Option); ok {
+		options = append(append([]Option{}, parent...), options...)
+	}
+	return context.WithValue(ctx, contextOptionsKey{}, options)
+}
+
+func contextOptions(ctx context.Context) []Option {
+	options, _ := ctx.Value(contextOptionsKey{}).([]Option)
+	return options
+}
@@ -0,0 +1,27 @@
+//go:build !unix
+
+package dialer
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/metacubex/mihomo/log"
+)
+
+var printSocketMarkWarnOnce sync.Once
+
+func printSocketMarkWarn() {
+	printSocketMarkWarnOnce.Do(func() {
+		log.Warnln("DSCP and TTL on socket are not supported on current platform")
+	})
+}
+
+func bindSocketMarkToDialer(ctx context.Context, opt *option, dialer *net.Dialer) {
+	printSocketMarkWarn()
+}
+
+func bindSocketMarkToListenConfig(ctx context.Context, opt *option, lc *net.ListenConfig) {
+	printSocketMarkWarn()
+}
@@ -0,0 +1,37 @@
+package dialer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDSCP(t *testing.T) {
+	dscp, err := ParseDSCP("46")
+	require.NoError(t, err)
+	assert.Equal(t, 46, dscp)
+	dscp, err = ParseDSCP("inherit")
+	require.NoError(t, err)
+	assert.Equal(t, DSCPInherit, dscp)
+	for _, s := range []string{"-1", "64", "ef"} {
+		_, err = ParseDSCP(s)
+		assert.Error(t, err, s)
+	}
+	assert.Error(t, CheckSocketMark(0, 256))
+}
+
+func TestSocketMarkContext(t *testing.T) {
+	ctx := WithContextOptions(context.Background(), WithDSCP(8))
+	opt := applyContextOptions(ctx, WithDSCP(46), WithTTL(64))
+	dscp, ttl := opt.socketMark(ctx)
+	assert.Equal(t, 8, dscp, "the options in ctx override the ones of the dialer")
+	assert.Equal(t, 64, ttl)
+
+	opt = applyOptions(WithDSCP(DSCPInherit))
+	dscp, _ = opt.socketMark(context.Background())
+	assert.Equal(t, 0, dscp)
+	dscp, _ = opt.socketMark(WithInboundDSCP(context.Background(), 34))
+	assert.Equal(t, 34, dscp)
+}
@@ -0,0 +1,70 @@
+//go:build unix
+
+package dialer
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func bindSocketMarkToDialer(ctx context.Context, opt *option, dialer *net.Dialer) {
+	dscp, ttl := opt.socketMark(ctx)
+	if dscp == 0 && ttl == 0 {
+		return
+	}
+	addControlToDialer(dialer, socketMarkControl(dscp, ttl))
+}
+
+func bindSocketMarkToListenConfig(ctx context.Context, opt *option, lc *net.ListenConfig) {
+	dscp, ttl := opt.socketMark(ctx)
+	if dscp == 0 && ttl == 0 {
+		return
+	}
+	addControlToListenConfig(lc, socketMarkControl(dscp, ttl))
+}
+
+func socketMarkControl(dscp int, ttl int) controlFn {
+	return func(ctx context.Context, network, address string, c syscall.RawConn) (err error) {
+		// dual stack sockets of udp listeners carry both families, set both of them
+		is4, is6 := true, true
+		if addrPort, err := netip.ParseAddrPort(address); err == nil && addrPort.Addr().IsValid() &&
+			!addrPort.Addr().IsUnspecified() {
+			is4, is6 = addrPort.Addr().Unmap().Is4(), !addrPort.Addr().Is4()
+		}
+		if network == "tcp4" || network == "udp4" {
+			is6 = false
+		}
+
+		var innerErr error
+		err = c.Control(func(fd uintptr) {
+			if is4 {
+				if dscp != 0 {
+					innerErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_TOS, dscp<<2)
+				}
+				if innerErr == nil && ttl != 0 {
+					innerErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_TTL, ttl)
+				}
+				if is6 {
+					// an AF_INET6 socket may refuse the ipv4 options
+					innerErr = nil
+				}
+			}
+			if is6 && innerErr == nil {
+				if dscp != 0 {
+					innerErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_TCLASS, dscp<<2)
+				}
+				if innerErr == nil && ttl != 0 {
+					innerErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_UNICAST_HOPS, ttl)
+				}
+			}
+		})
+		if innerErr != nil {
+			err = innerErr
+		}
+		return
+	}
+}
@@ -0,0 +1,158 @@
+package ech
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/metacubex/mihomo/component/resolver"
+	"github.com/metacubex/mihomo/log"
+
+	D "github.com/miekg/dns"
+)
+
+var (
+	ErrNotSupported = errors.New("encrypted client hello requires go1.23 or later")
+	ErrNoConfig     = errors.New("no ECH config found in HTTPS record")
+)
+
+// minCacheTTL avoid querying the HTTPS record for every handshake when upstream returns a tiny TTL
+const minCacheTTL = 60 * time.Second
+
+type Config struct {
+	// ConfigList is a static serialized ECHConfigList, if empty it will be fetched by HTTPS record
+	ConfigList []byte
+	// QueryServerName overrides the domain used to query the HTTPS record, default is the tls ServerName
+	QueryServerName string
+	// Fallback allows to continue a plain tls handshake when no ECH config can be obtained
+	Fallback bool
+
+	mutex       sync.Mutex
+	retryConfig []byte
+	cached      []byte
+	cachedName  string
+	expireAt    time.Time
+}
+
+// GetConfigList return the ECHConfigList should be used for serverName
+func (c *Config) GetConfigList(ctx context.Context, serverName string) ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.retryConfig) > 0 {
+		return c.retryConfig, nil
+	}
+	if len(c.ConfigList) > 0 {
+		return c.ConfigList, nil
+	}
+
+	queryName := serverName
+	if c.QueryServerName != "" {
+		queryName = c.QueryServerName
+	}
+	if len(c.cached) > 0 && c.cachedName == queryName && time.Now().Before(c.expireAt) {
+		return c.cached, nil
+	}
+	configList, ttl, err := lookupConfigList(ctx, queryName)
+	if err != nil {
+		return nil, fmt.Errorf("query ECH config for %s failed: %w", queryName, err)
+	}
+	if ttl < minCacheTTL {
+		ttl = minCacheTTL
+	}
+	c.cached = configList
+	c.cachedName = queryName
+	c.expireAt = time.Now().Add(ttl)
+	return configList, nil
+}
+
+// ClientHandle set the ECHConfigList into tlsConfig, tlsConfig should be a private copy
+func (c *Config) ClientHandle(ctx context.Context, tlsConfig *tls.Config) error {
+	configList, err := c.GetConfigList(ctx, tlsConfig.ServerName)
+	if err != nil {
+		if c.Fallback {
+			log.Warnln("[ECH] %s, fallback to plain tls handshake", err.Error())
+			return nil
+		}
+		return err
+	}
+	return setConfigList(tlsConfig, configList)
+}
+
+// ClientHandleCopy sets the ECHConfigList into a private copy of base and then copies
+// the ECH fields to tlsConfig, for the clients which keep tlsConfig and clone it when
+// dialing, the calls must be serialized with the dials. A fallback resets the fields.
+func (c *Config) ClientHandleCopy(ctx context.Context, tlsConfig, base *tls.Config) error {
+	dialConfig := base.Clone()
+	if err := c.ClientHandle(ctx, dialConfig); err != nil {
+		return err
+	}
+	copyConfigList(tlsConfig, dialConfig)
+	return nil
+}
+
+// HandleError records the retry configs sent by server when ECH was rejected,
+// so that the next handshake can use them.
+func (c *Config) HandleError(err error) {
+	retryConfig, ok := retryConfigList(err)
+	if !ok {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(retryConfig) > 0 {
+		log.Infoln("[ECH] server rejected ECH, use the retry configs it provided for next handshake")
+		c.retryConfig = retryConfig
+	} else {
+		// server has disabled ECH or our config is stale, drop everything we learned
+		c.retryConfig = nil
+		c.cached = nil
+	}
+}
+
+// ClientHandshake performs a tls handshake over conn with ECH enabled
+func (c *Config) ClientHandshake(ctx context.Context, conn net.Conn, tlsConfig *tls.Config) (*tls.Conn, error) {
+	tlsConfig = tlsConfig.Clone()
+	if err := c.ClientHandle(ctx, tlsConfig); err != nil {
+		return nil, err
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		c.HandleError(err)
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+func lookupConfigList(ctx context.Context, serverName string) ([]byte, time.Duration, error) {
+	r := resolver.ProxyServerHostResolver
+	if r == nil {
+		r = resolver.DefaultResolver
+	}
+	if r == nil {
+		return nil, 0, errors.New("no available resolver")
+	}
+
+	msg := &D.Msg{}
+	msg.SetQuestion(D.Fqdn(serverName), D.TypeHTTPS)
+	msg.RecursionDesired = true
+	resp, err := r.ExchangeContext(ctx, msg)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, rr := range resp.Answer {
+		https, ok := rr.(*D.HTTPS)
+		if !ok {
+			continue
+		}
+		for _, value := range https.Value {
+			if echConfig, ok := value.(*D.SVCBECHConfig); ok && len(echConfig.ECH) > 0 {
+				return echConfig.ECH, time.Duration(rr.Header().Ttl) * time.Second, nil
+			}
+		}
+	}
+	return nil, 0, ErrNoConfig
+}
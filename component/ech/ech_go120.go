@@ -0,0 +1,15 @@
+//go:build !go1.23
+
+package ech
+
+import "crypto/tls"
+
+func setConfigList(tlsConfig *tls.Config, configList []byte) error {
+	return ErrNotSupported
+}
+
+func copyConfigList(dst, src *tls.Config) {}
+
+func retryConfigList(err error) ([]byte, bool) {
+	return nil, false
+}
@@ -0,0 +1,45 @@
+//go:build go1.23
+
+package ech
+
+import (
+	"crypto/tls"
+	"errors"
+)
+
+func setConfigList(tlsConfig *tls.Config, configList []byte) error {
+	if tlsConfig.MinVersion != 0 && tlsConfig.MinVersion < tls.VersionTLS13 {
+		// ECH requires and forces TLS 1.3
+		tlsConfig.MinVersion = tls.VersionTLS13
+	}
+	tlsConfig.EncryptedClientHelloConfigList = configList
+	if tlsConfig.InsecureSkipVerify && tlsConfig.EncryptedClientHelloRejectionVerify == nil {
+		// keep the same verification as the inner handshake (skip-cert-verify or fingerprint pinning)
+		verifyPeerCertificate := tlsConfig.VerifyPeerCertificate
+		tlsConfig.EncryptedClientHelloRejectionVerify = func(state tls.ConnectionState) error {
+			if verifyPeerCertificate == nil {
+				return nil
+			}
+			rawCerts := make([][]byte, 0, len(state.PeerCertificates))
+			for _, cert := range state.PeerCertificates {
+				rawCerts = append(rawCerts, cert.Raw)
+			}
+			return verifyPeerCertificate(rawCerts, nil)
+		}
+	}
+	return nil
+}
+
+func copyConfigList(dst, src *tls.Config) {
+	dst.MinVersion = src.MinVersion
+	dst.EncryptedClientHelloConfigList = src.EncryptedClientHelloConfigList
+	dst.EncryptedClientHelloRejectionVerify = src.EncryptedClientHelloRejectionVerify
+}
+
+func retryConfigList(err error) ([]byte, bool) {
+	var echErr *tls.ECHRejectionError
+	if errors.As(err, &echErr) {
+		return echErr.RetryConfigList, true
+	}
+	return nil, false
+}
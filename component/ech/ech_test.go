@@ -0,0 +1,136 @@
+//go:build go1.24
+
+package ech
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCertificate(t *testing.T, names ...string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// serveECH runs a local tls server which only knows the given keys
+func serveECH(t *testing.T, keys ...*KeyPair) net.Listener {
+	var echKeys []tls.EncryptedClientHelloKey
+	for _, key := range keys {
+		echKeys = append(echKeys, tls.EncryptedClientHelloKey{
+			Config:      key.Config,
+			PrivateKey:  key.PrivateKey,
+			SendAsRetry: true,
+		})
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates:             []tls.Certificate{newCertificate(t, "inner.example.com", "public.example.com")},
+		EncryptedClientHelloKeys: echKeys,
+	})
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = conn.(*tls.Conn).Handshake()
+				_, _ = conn.Write([]byte{0})
+			}()
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return listener
+}
+
+func handshake(t *testing.T, listener net.Listener, cfg *Config) (*tls.Conn, error) {
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return cfg.ClientHandshake(context.Background(), conn, &tls.Config{
+		ServerName:         "inner.example.com",
+		InsecureSkipVerify: true,
+	})
+}
+
+func TestECH_Accepted(t *testing.T) {
+	key, err := GenerateKeyPair(1, "public.example.com")
+	require.NoError(t, err)
+	listener := serveECH(t, key)
+
+	tlsConn, err := handshake(t, listener, &Config{ConfigList: key.ConfigList})
+	require.NoError(t, err)
+	state := tlsConn.ConnectionState()
+	assert.True(t, state.ECHAccepted)
+	assert.Equal(t, "inner.example.com", state.ServerName)
+}
+
+func TestECH_RetryConfig(t *testing.T) {
+	staleKey, err := GenerateKeyPair(1, "public.example.com")
+	require.NoError(t, err)
+	key, err := GenerateKeyPair(2, "public.example.com")
+	require.NoError(t, err)
+	listener := serveECH(t, key)
+
+	cfg := &Config{ConfigList: staleKey.ConfigList}
+	_, err = handshake(t, listener, cfg)
+	var echErr *tls.ECHRejectionError
+	require.ErrorAs(t, err, &echErr)
+	assert.NotEmpty(t, echErr.RetryConfigList)
+
+	tlsConn, err := handshake(t, listener, cfg)
+	require.NoError(t, err)
+	assert.True(t, tlsConn.ConnectionState().ECHAccepted)
+}
+
+func TestECH_Fallback(t *testing.T) {
+	key, err := GenerateKeyPair(1, "public.example.com")
+	require.NoError(t, err)
+	listener := serveECH(t, key)
+
+	// no static config and no resolver available
+	_, err = handshake(t, listener, &Config{})
+	assert.Error(t, err)
+
+	tlsConn, err := handshake(t, listener, &Config{Fallback: true})
+	require.NoError(t, err)
+	assert.False(t, tlsConn.ConnectionState().ECHAccepted)
+}
+
+func TestECH_ClientHandleCopy(t *testing.T) {
+	key, err := GenerateKeyPair(1, "public.example.com")
+	require.NoError(t, err)
+	base := &tls.Config{ServerName: "inner.example.com"}
+	tlsConfig := base.Clone()
+
+	require.NoError(t, (&Config{ConfigList: key.ConfigList}).ClientHandleCopy(context.Background(), tlsConfig, base))
+	assert.Equal(t, key.ConfigList, tlsConfig.EncryptedClientHelloConfigList)
+	assert.Empty(t, base.EncryptedClientHelloConfigList)
+
+	// the stale list is dropped when falling back
+	require.NoError(t, (&Config{Fallback: true}).ClientHandleCopy(context.Background(), tlsConfig, base))
+	assert.Empty(t, tlsConfig.EncryptedClientHelloConfigList)
+}
@@ -0,0 +1,65 @@
+package ech
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	extensionEncryptedClientHello = 0xfe0d
+	kemX25519HKDFSHA256           = 0x0020
+	kdfHKDFSHA256                 = 0x0001
+	aeadAES128GCM                 = 0x0001
+	aeadChaCha20Poly1305          = 0x0003
+)
+
+// KeyPair is a generated ECH key, Config can be used by server side
+// and ConfigList can be distributed to clients (or published in HTTPS record)
+type KeyPair struct {
+	Config     []byte
+	ConfigList []byte
+	PrivateKey []byte
+}
+
+// GenerateKeyPair generates an X25519 ECH key whose outer ClientHello will use publicName as SNI
+func GenerateKeyPair(configID uint8, publicName string) (*KeyPair, error) {
+	if len(publicName) == 0 || len(publicName) > 255 {
+		return nil, errors.New("invalid ECH public name")
+	}
+	privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	publicKey := privateKey.PublicKey().Bytes()
+
+	var contents []byte
+	contents = append(contents, configID)
+	contents = binary.BigEndian.AppendUint16(contents, kemX25519HKDFSHA256)
+	contents = binary.BigEndian.AppendUint16(contents, uint16(len(publicKey)))
+	contents = append(contents, publicKey...)
+	contents = binary.BigEndian.AppendUint16(contents, 8) // two cipher suites
+	contents = binary.BigEndian.AppendUint16(contents, kdfHKDFSHA256)
+	contents = binary.BigEndian.AppendUint16(contents, aeadAES128GCM)
+	contents = binary.BigEndian.AppendUint16(contents, kdfHKDFSHA256)
+	contents = binary.BigEndian.AppendUint16(contents, aeadChaCha20Poly1305)
+	contents = append(contents, 0) // maximum_name_length
+	contents = append(contents, uint8(len(publicName)))
+	contents = append(contents, publicName...)
+	contents = binary.BigEndian.AppendUint16(contents, 0) // no extensions
+
+	var config []byte
+	config = binary.BigEndian.AppendUint16(config, extensionEncryptedClientHello)
+	config = binary.BigEndian.AppendUint16(config, uint16(len(contents)))
+	config = append(config, contents...)
+
+	configList := binary.BigEndian.AppendUint16(nil, uint16(len(config)))
+	configList = append(configList, config...)
+
+	return &KeyPair{
+		Config:     config,
+		ConfigList: configList,
+		PrivateKey: privateKey.Bytes(),
+	}, nil
+}
@@ -0,0 +1,324 @@
+// Package builder compiles the domain and IP lists into the geosite.dat and geoip.dat
+// of component/geodata/router and into a Meta-geoip0 mmdb. A list is named after its
+// file, e.g. google.txt is geosite:google, and is either a text file of one entry per
+// line or a YAML rule-set file with a payload.
+//
+// The domain entries follow the domain rule-set: example.com (the domain only),
+// +.example.com (the domain and its subdomains), .example.com (the subdomains only),
+// *.example.com (a wildcard label). The v2fly prefixes domain:, full:, keyword: and
+// regexp:, and the classical DOMAIN, DOMAIN-SUFFIX, DOMAIN-KEYWORD and DOMAIN-REGEX
+// rules are accepted as well, the attributes follow the entry, e.g. example.cn @cn.
+//
+// The IP entries are the CIDRs or the addresses, or the classical IP-CIDR and IP-CIDR6
+// rules. The other classical rules are skipped.
+package builder
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/metacubex/mihomo/component/geodata/router"
+	"github.com/metacubex/mihomo/component/mmdb"
+	"github.com/metacubex/mihomo/log"
+
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+var errSkip = errors.New("skip")
+
+type Builder struct {
+	sites map[string][]*router.Domain
+	ips   map[string][]netip.Prefix
+}
+
+func New() *Builder {
+	return &Builder{
+		sites: map[string][]*router.Domain{},
+		ips:   map[string][]netip.Prefix{},
+	}
+}
+
+// AddSiteDir adds every file of the directory as a geosite list
+func (b *Builder) AddSiteDir(dir string) error {
+	return addDir(dir, b.AddSiteFile)
+}
+
+// AddIPDir adds every file of the directory as a geoip list
+func (b *Builder) AddIPDir(dir string) error {
+	return addDir(dir, b.AddIPFile)
+}
+
+func (b *Builder) AddSiteFile(path string) error {
+	name, entries, err := readList(path)
+	if err != nil {
+		return err
+	}
+	for i, entry := range entries {
+		domain, err := parseDomain(entry)
+		if errors.Is(err, errSkip) {
+			log.Debugln("[GeoData] %s: skip %s", path, entry)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s entry %d: %w", path, i+1, err)
+		}
+		b.sites[name] = append(b.sites[name], domain)
+	}
+	return nil
+}
+
+func (b *Builder) AddIPFile(path string) error {
+	name, entries, err := readList(path)
+	if err != nil {
+		return err
+	}
+	for i, entry := range entries {
+		prefix, err := parsePrefix(entry)
+		if errors.Is(err, errSkip) {
+			log.Debugln("[GeoData] %s: skip %s", path, entry)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s entry %d: %w", path, i+1, err)
+		}
+		b.ips[name] = append(b.ips[name], prefix)
+	}
+	return nil
+}
+
+func (b *Builder) WriteGeoSite(w io.Writer) error {
+	list := &router.GeoSiteList{}
+	for _, name := range sortedKeys(b.sites) {
+		list.Entry = append(list.Entry, &router.GeoSite{CountryCode: name, Domain: b.sites[name]})
+	}
+	buf, err := proto.Marshal(list)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+func (b *Builder) WriteGeoIP(w io.Writer) error {
+	list := &router.GeoIPList{}
+	for _, name := range sortedKeys(b.ips) {
+		geoip := &router.GeoIP{CountryCode: name}
+		for _, prefix := range b.ips[name] {
+			geoip.Cidr = append(geoip.Cidr, &router.CIDR{Ip: prefix.Addr().AsSlice(), Prefix: uint32(prefix.Bits())})
+		}
+		list.Entry = append(list.Entry, geoip)
+	}
+	buf, err := proto.Marshal(list)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// WriteMMDB writes the geoip lists as a mmdb, the codes are in lower case like
+// the ones of the Meta-geoip0 databases
+func (b *Builder) WriteMMDB(w io.Writer) error {
+	writer := mmdb.NewWriter()
+	for name, prefixes := range b.ips {
+		code := strings.ToLower(name)
+		for _, prefix := range prefixes {
+			writer.Insert(prefix, code)
+		}
+	}
+	_, err := writer.WriteTo(w)
+	return err
+}
+
+// HasSite reports whether the geosite has the list, e.g. CN which the files are
+// checked with at startup
+func (b *Builder) HasSite(name string) bool {
+	_, ok := b.sites[strings.ToUpper(name)]
+	return ok
+}
+
+func (b *Builder) HasIP(name string) bool {
+	_, ok := b.ips[strings.ToUpper(name)]
+	return ok
+}
+
+func (b *Builder) SiteCount() int {
+	return len(b.sites)
+}
+
+func (b *Builder) IPCount() int {
+	return len(b.ips)
+}
+
+func addDir(dir string, add func(string) error) error {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		if err := add(filepath.Join(dir, file.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readList returns the name of the list, in upper case like the v2fly ones, and
+// its entries without the comments
+func readList(path string) (string, []string, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	ext := filepath.Ext(path)
+	name := strings.ToUpper(strings.TrimSuffix(filepath.Base(path), ext))
+
+	switch strings.ToLower(ext) {
+	case ".yaml", ".yml":
+		schema := &struct {
+			Payload []string `yaml:"payload"`
+		}{}
+		if err := yaml.Unmarshal(buf, schema); err != nil {
+			return "", nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return name, schema.Payload, nil
+	case ".mrs":
+		return "", nil, fmt.Errorf("%s: unsupported format", path)
+	}
+
+	var entries []string
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || strings.HasPrefix(line, "//") {
+			continue
+		}
+		entries = append(entries, line)
+	}
+	return name, entries, scanner.Err()
+}
+
+func parseDomain(entry string) (*router.Domain, error) {
+	fields := strings.Fields(entry)
+	domain := &router.Domain{}
+	for _, attr := range fields[1:] {
+		key, ok := strings.CutPrefix(attr, "@")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid attribute %s", attr)
+		}
+		domain.Attribute = append(domain.Attribute, &router.Domain_Attribute{
+			Key:        strings.ToLower(key),
+			TypedValue: &router.Domain_Attribute_BoolValue{BoolValue: true},
+		})
+	}
+	value := fields[0]
+
+	if tp, payload, ok := strings.Cut(value, ","); ok {
+		payload, _, _ = strings.Cut(payload, ",")
+		switch strings.ToUpper(tp) {
+		case "DOMAIN":
+			domain.Type = router.Domain_Full
+		case "DOMAIN-SUFFIX":
+			domain.Type = router.Domain_Domain
+		case "DOMAIN-KEYWORD":
+			domain.Type = router.Domain_Plain
+		case "DOMAIN-REGEX":
+			domain.Type = router.Domain_Regex
+		default:
+			return nil, errSkip
+		}
+		value = payload
+	} else if tp, payload, ok := strings.Cut(value, ":"); ok {
+		switch tp {
+		case "domain":
+			domain.Type = router.Domain_Domain
+		case "full":
+			domain.Type = router.Domain_Full
+		case "keyword":
+			domain.Type = router.Domain_Plain
+		case "regexp":
+			domain.Type = router.Domain_Regex
+		default:
+			return nil, fmt.Errorf("unsupported prefix %s", tp)
+		}
+		value = payload
+	} else {
+		value = strings.ToLower(value)
+		switch {
+		case strings.HasPrefix(value, "+."):
+			domain.Type, value = router.Domain_Domain, strings.TrimSuffix(value[2:], ".")
+		case strings.HasPrefix(value, "."):
+			domain.Type, value = router.Domain_Regex, `\.`+regexp.QuoteMeta(value[1:])+`$`
+		case strings.Contains(value, "*"):
+			labels := strings.Split(value, ".")
+			for i, label := range labels {
+				if label == "*" {
+					labels[i] = `[^.]+`
+				} else {
+					labels[i] = regexp.QuoteMeta(label)
+				}
+			}
+			domain.Type, value = router.Domain_Regex, `^`+strings.Join(labels, `\.`)+`$`
+		default:
+			domain.Type, value = router.Domain_Full, strings.TrimSuffix(value, ".")
+		}
+	}
+
+	if value == "" {
+		return nil, errors.New("empty domain")
+	}
+	if domain.Type == router.Domain_Regex {
+		if _, err := regexp.Compile(value); err != nil {
+			return nil, err
+		}
+	} else {
+		value = strings.ToLower(value)
+	}
+	domain.Value = value
+	return domain, nil
+}
+
+func parsePrefix(entry string) (netip.Prefix, error) {
+	if tp, payload, ok := strings.Cut(entry, ","); ok {
+		switch strings.ToUpper(tp) {
+		case "IP-CIDR", "IP-CIDR6":
+		default:
+			return netip.Prefix{}, errSkip
+		}
+		entry, _, _ = strings.Cut(payload, ",")
+	}
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,86 @@
+package builder
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/metacubex/mihomo/component/geodata/router"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestParseDomain(t *testing.T) {
+	for entry, expected := range map[string]*router.Domain{
+		"Example.com":                {Type: router.Domain_Full, Value: "example.com"},
+		"+.example.com":              {Type: router.Domain_Domain, Value: "example.com"},
+		".example.com":               {Type: router.Domain_Regex, Value: `\.example\.com$`},
+		"*.example.com":              {Type: router.Domain_Regex, Value: `^[^.]+\.example\.com$`},
+		"domain:example.com":         {Type: router.Domain_Domain, Value: "example.com"},
+		"keyword:example":            {Type: router.Domain_Plain, Value: "example"},
+		"regexp:^ex.*$":              {Type: router.Domain_Regex, Value: "^ex.*$"},
+		"DOMAIN-SUFFIX,example.com":  {Type: router.Domain_Domain, Value: "example.com"},
+		"DOMAIN,example.com,no-load": {Type: router.Domain_Full, Value: "example.com"},
+	} {
+		domain, err := parseDomain(entry)
+		require.NoError(t, err, entry)
+		assert.Equal(t, expected.Type, domain.Type, entry)
+		assert.Equal(t, expected.Value, domain.Value, entry)
+	}
+
+	domain, err := parseDomain("full:example.cn @CN @ads")
+	require.NoError(t, err)
+	if assert.Len(t, domain.Attribute, 2) {
+		assert.Equal(t, "cn", domain.Attribute[0].Key)
+		assert.Equal(t, "ads", domain.Attribute[1].Key)
+	}
+
+	_, err = parseDomain("IP-CIDR,10.0.0.0/8")
+	assert.ErrorIs(t, err, errSkip)
+	for _, entry := range []string{"include:google", "regexp:(", "example.com cn", "+."} {
+		_, err = parseDomain(entry)
+		assert.Error(t, err, entry)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	dir := t.TempDir()
+	siteDir, ipDir := filepath.Join(dir, "site"), filepath.Join(dir, "ip")
+	require.NoError(t, os.Mkdir(siteDir, 0o755))
+	require.NoError(t, os.Mkdir(ipDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(siteDir, "company.txt"), []byte("# internal\n+.corp.example.com\nwiki.example.com @cn\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(siteDir, "ads.yaml"), []byte("payload:\n  - DOMAIN-SUFFIX,ads.example.com\n  - IP-CIDR,1.1.1.1/32\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(ipDir, "office.list"), []byte("203.0.113.0/24\n2001:db8::1\nIP-CIDR,198.51.100.0/24,no-resolve\nDST-PORT,443\n"), 0o644))
+
+	b := New()
+	require.NoError(t, b.AddSiteDir(siteDir))
+	require.NoError(t, b.AddIPDir(ipDir))
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, b.WriteGeoSite(buf))
+	sites := &router.GeoSiteList{}
+	require.NoError(t, proto.Unmarshal(buf.Bytes(), sites))
+	if assert.Len(t, sites.Entry, 2) {
+		assert.Equal(t, "ADS", sites.Entry[0].CountryCode)
+		assert.Len(t, sites.Entry[0].Domain, 1)
+		assert.Equal(t, "COMPANY", sites.Entry[1].CountryCode)
+		assert.Len(t, sites.Entry[1].Domain, 2)
+	}
+
+	buf.Reset()
+	require.NoError(t, b.WriteGeoIP(buf))
+	ips := &router.GeoIPList{}
+	require.NoError(t, proto.Unmarshal(buf.Bytes(), ips))
+	if assert.Len(t, ips.Entry, 1) {
+		assert.Equal(t, "OFFICE", ips.Entry[0].CountryCode)
+		assert.Len(t, ips.Entry[0].Cidr, 3)
+		assert.Equal(t, uint32(128), ips.Entry[0].Cidr[1].Prefix)
+	}
+
+	buf.Reset()
+	require.NoError(t, b.WriteMMDB(buf))
+	assert.NotZero(t, buf.Len())
+}
@@ -0,0 +1,182 @@
+package geodata
+
+import (
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/metacubex/mihomo/component/cidr"
+	"github.com/metacubex/mihomo/component/geodata/router"
+	C "github.com/metacubex/mihomo/constant"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// SiteMatch is a geosite list containing a domain, Attributes are the attributes of the
+// entries of the list which match it, e.g. cn for geosite:google@cn
+type SiteMatch struct {
+	Name       string   `json:"name"`
+	Attributes []string `json:"attributes,omitempty"`
+}
+
+type siteLookup struct {
+	name       string
+	matcher    router.DomainMatcher
+	attributes []attributeLookup
+}
+
+// attributeLookup matches the entries of a list which have the attribute
+type attributeLookup struct {
+	key     string
+	matcher router.DomainMatcher
+}
+
+type ipLookup struct {
+	code string
+	set  *cidr.IpCidrSet
+}
+
+// lookupCache keeps all the lists of the files for the lookups, unlike the loaders which
+// decode a single list. It's dropped by ClearCache when the files are updated.
+var lookupCache struct {
+	mutex    sync.Mutex
+	sitePath string
+	sites    []siteLookup
+	ipPath   string
+	ips      []ipLookup
+}
+
+func clearLookupCache() {
+	lookupCache.mutex.Lock()
+	defer lookupCache.mutex.Unlock()
+	lookupCache.sitePath, lookupCache.sites = "", nil
+	lookupCache.ipPath, lookupCache.ips = "", nil
+}
+
+func loadSiteLookups() ([]siteLookup, error) {
+	lookupCache.mutex.Lock()
+	defer lookupCache.mutex.Unlock()
+
+	path := C.Path.GetAssetLocation(C.GeositeName)
+	if lookupCache.sitePath == path {
+		return lookupCache.sites, nil
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var geositeList router.GeoSiteList
+	if err := proto.Unmarshal(buf, &geositeList); err != nil {
+		return nil, err
+	}
+
+	sites := make([]siteLookup, 0, len(geositeList.Entry))
+	for _, site := range geositeList.Entry {
+		lookup := siteLookup{name: strings.ToLower(site.CountryCode)}
+		if lookup.matcher, err = router.NewSuccinctMatcherGroup(site.Domain, false); err != nil {
+			return nil, err
+		}
+
+		attributes := map[string][]*router.Domain{}
+		for _, entry := range site.Domain {
+			for _, attr := range entry.Attribute {
+				key := strings.ToLower(attr.GetKey())
+				if !slices.Contains(attributes[key], entry) {
+					attributes[key] = append(attributes[key], entry)
+				}
+			}
+		}
+		for key, domains := range attributes {
+			matcher, err := router.NewSuccinctMatcherGroup(domains, false)
+			if err != nil {
+				return nil, err
+			}
+			lookup.attributes = append(lookup.attributes, attributeLookup{key: key, matcher: matcher})
+		}
+		slices.SortFunc(lookup.attributes, func(a, b attributeLookup) int {
+			return strings.Compare(a.key, b.key)
+		})
+		sites = append(sites, lookup)
+	}
+	lookupCache.sitePath, lookupCache.sites = path, sites
+	return sites, nil
+}
+
+func loadIPLookups() ([]ipLookup, error) {
+	lookupCache.mutex.Lock()
+	defer lookupCache.mutex.Unlock()
+
+	path := C.Path.GetAssetLocation(C.GeoipName)
+	if lookupCache.ipPath == path {
+		return lookupCache.ips, nil
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var geoipList router.GeoIPList
+	if err := proto.Unmarshal(buf, &geoipList); err != nil {
+		return nil, err
+	}
+
+	ips := make([]ipLookup, 0, len(geoipList.Entry))
+	for _, geoip := range geoipList.Entry {
+		set := cidr.NewIpCidrSet()
+		for _, c := range geoip.Cidr {
+			if addr, ok := netip.AddrFromSlice(c.Ip); ok {
+				if err := set.AddIpCidr(netip.PrefixFrom(addr, int(c.Prefix))); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if err := set.Merge(); err != nil {
+			return nil, err
+		}
+		ips = append(ips, ipLookup{code: strings.ToLower(geoip.CountryCode), set: set})
+	}
+	lookupCache.ipPath, lookupCache.ips = path, ips
+	return ips, nil
+}
+
+// LookupGeoSite matches the domain against all the lists of the geosite file
+func LookupGeoSite(domain string) ([]SiteMatch, error) {
+	sites, err := loadSiteLookups()
+	if err != nil {
+		return nil, err
+	}
+
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	matches := []SiteMatch{}
+	for _, site := range sites {
+		if !site.matcher.ApplyDomain(domain) {
+			continue
+		}
+		var attributes []string
+		for _, attr := range site.attributes {
+			if attr.matcher.ApplyDomain(domain) {
+				attributes = append(attributes, attr.key)
+			}
+		}
+		matches = append(matches, SiteMatch{Name: site.name, Attributes: attributes})
+	}
+	return matches, nil
+}
+
+// LookupGeoIP matches the ip against all the countries of the geoip file
+func LookupGeoIP(ip netip.Addr) ([]string, error) {
+	ips, err := loadIPLookups()
+	if err != nil {
+		return nil, err
+	}
+
+	ip = ip.Unmap()
+	codes := []string{}
+	for _, lookup := range ips {
+		if lookup.set.IsContain(ip) {
+			codes = append(codes, lookup.code)
+		}
+	}
+	return codes, nil
+}
@@ -0,0 +1,71 @@
+package geodata
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/metacubex/mihomo/component/geodata/router"
+	C "github.com/metacubex/mihomo/constant"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestLookup(t *testing.T) {
+	dir := t.TempDir()
+	C.SetHomeDir(dir)
+
+	geosite, err := proto.Marshal(&router.GeoSiteList{Entry: []*router.GeoSite{
+		{CountryCode: "GOOGLE", Domain: []*router.Domain{
+			{Type: router.Domain_Domain, Value: "google.com"},
+			{Type: router.Domain_Domain, Value: "google.cn", Attribute: []*router.Domain_Attribute{{Key: "cn"}}},
+		}},
+		{CountryCode: "CN", Domain: []*router.Domain{
+			{Type: router.Domain_Regex, Value: `\.cn$`},
+		}},
+		{CountryCode: "EMPTY"},
+	}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, C.GeositeName), geosite, 0o644))
+
+	matches, err := LookupGeoSite("WWW.google.cn.")
+	require.NoError(t, err)
+	assert.Equal(t, []SiteMatch{{Name: "google", Attributes: []string{"cn"}}, {Name: "cn"}}, matches)
+
+	matches, err = LookupGeoSite("example.com")
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+
+	geoip, err := proto.Marshal(&router.GeoIPList{Entry: []*router.GeoIP{
+		{CountryCode: "US", Cidr: []*router.CIDR{{Ip: []byte{203, 0, 113, 0}, Prefix: 24}}},
+		{CountryCode: "PRIVATE", Cidr: []*router.CIDR{{Ip: []byte{203, 0, 0, 0}, Prefix: 8}}},
+	}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, C.GeoipName), geoip, 0o644))
+
+	codes, err := LookupGeoIP(netip.MustParseAddr("::ffff:203.0.113.1"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"us", "private"}, codes)
+
+	codes, err = LookupGeoIP(netip.MustParseAddr("2001:db8::1"))
+	require.NoError(t, err)
+	assert.Empty(t, codes)
+
+	// the parsed lists are kept until the files are updated
+	geoip, err = proto.Marshal(&router.GeoIPList{Entry: []*router.GeoIP{
+		{CountryCode: "JP", Cidr: []*router.CIDR{{Ip: []byte{203, 0, 113, 0}, Prefix: 24}}},
+	}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, C.GeoipName), geoip, 0o644))
+	codes, err = LookupGeoIP(netip.MustParseAddr("203.0.113.1"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"us", "private"}, codes)
+
+	ClearCache()
+	codes, err = LookupGeoIP(netip.MustParseAddr("203.0.113.1"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"jp"}, codes)
+}
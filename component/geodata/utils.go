@@ -204,4 +204,5 @@ func LoadGeoIPMatcher(country string) (*router.GeoIPMatcher, int, error) {
 func ClearCache() {
 	loadGeoSiteMatcherSF = singleflight.Group{}
 	loadGeoIPMatcherSF = singleflight.Group{}
+	clearLookupCache()
 }
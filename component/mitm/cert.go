@@ -0,0 +1,103 @@
+package mitm
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/netip"
+	"time"
+
+	"github.com/metacubex/mihomo/common/lru"
+)
+
+const (
+	leafValidity = 397 * 24 * time.Hour // the limit of the browsers for the publicly trusted certificates
+	leafCacheAge = 24 * 60 * 60         // seconds
+	leafCacheMax = 1024
+)
+
+// certStore issues the leaf certificates signed by the configured CA, all
+// leaves share one key to save the cost of key generation per host
+type certStore struct {
+	ca     *x509.Certificate
+	caCert tls.Certificate
+	key    *ecdsa.PrivateKey
+	cache  *lru.LruCache[string, *tls.Certificate]
+}
+
+func newCertStore(ca tls.Certificate) (*certStore, error) {
+	if len(ca.Certificate) == 0 {
+		return nil, errors.New("empty ca certificate")
+	}
+	caX509, err := x509.ParseCertificate(ca.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	if !caX509.IsCA {
+		return nil, errors.New("the certificate is not a ca")
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &certStore{
+		ca:     caX509,
+		caCert: ca,
+		key:    key,
+		cache: lru.New[string, *tls.Certificate](
+			lru.WithSize[string, *tls.Certificate](leafCacheMax),
+			lru.WithAge[string, *tls.Certificate](leafCacheAge),
+		),
+	}, nil
+}
+
+// Get returns the leaf certificate for host, which is a domain or an ip
+func (s *certStore) Get(host string) (*tls.Certificate, error) {
+	if cert, ok := s.cache.Get(host); ok {
+		return cert, nil
+	}
+	cert, err := s.issue(host)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.Set(host, cert)
+	return cert, nil
+}
+
+func (s *certStore) issue(host string) (*tls.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	notAfter := now.Add(leafValidity)
+	if notAfter.After(s.ca.NotAfter) {
+		notAfter = s.ca.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		template.IPAddresses = append(template.IPAddresses, ip.AsSlice())
+	} else {
+		template.DNSNames = append(template.DNSNames, host)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, s.ca, &s.key.PublicKey, s.caCert.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der, s.ca.Raw},
+		PrivateKey:  s.key,
+	}, nil
+}
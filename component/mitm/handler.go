@@ -0,0 +1,243 @@
+package mitm
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	N "github.com/metacubex/mihomo/common/net"
+	"github.com/metacubex/mihomo/component/ca"
+	C "github.com/metacubex/mihomo/constant"
+	"github.com/metacubex/mihomo/log"
+
+	"golang.org/x/net/http2"
+)
+
+const (
+	idleTimeout      = 90 * time.Second
+	maxBodyRewrite   = 4 << 20 // larger bodies are forwarded without the response-body rewrites
+	handshakeTimeout = 10 * time.Second
+)
+
+var httpMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodOptions, http.MethodTrace,
+}
+
+// Handle decrypts conn, which starts with a TLS ClientHello, and serves the
+// requests on it by forwarding them to the original destination of metadata
+// through tunnel with the rewrites applied, it blocks until conn is done
+func (m *MITM) Handle(conn net.Conn, metadata *C.Metadata, tunnel C.Tunnel) {
+	tlsConn := tls.Server(conn, &tls.Config{
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			host := hello.ServerName
+			if host == "" {
+				host = metadata.Host
+			}
+			if host == "" {
+				host = metadata.DstIP.String()
+			}
+			return m.certs.Get(host)
+		},
+	})
+	_ = conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		log.Debugln("[MITM] handshake with %s error: %s", metadata.SourceDetail(), err)
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	state := tlsConn.ConnectionState()
+	m.serve(tlsConn, metadata, tunnel, "https", state.ServerName, state.NegotiatedProtocol == "h2")
+}
+
+// HandleHTTP serves the plain HTTP/1.x requests on conn like Handle, for the
+// http:// rewrites, it blocks until conn is done
+func (m *MITM) HandleHTTP(conn net.Conn, metadata *C.Metadata, tunnel C.Tunnel) {
+	m.serve(conn, metadata, tunnel, "http", "", false)
+}
+
+func (m *MITM) serve(conn net.Conn, metadata *C.Metadata, tunnel C.Tunnel, scheme string, serverName string, h2 bool) {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			upstream := *metadata
+			upstream.SkipMITM = true
+			upstream.HTTP, _ = ctx.Value(httpRequestKey{}).(*C.HTTPRequest)
+			left, right := N.Pipe()
+			go tunnel.HandleTCPConn(right, &upstream)
+			return left, nil
+		},
+		TLSClientConfig:     ca.GetGlobalTLSConfig(&tls.Config{ServerName: serverName}),
+		ForceAttemptHTTP2:   true,
+		MaxIdleConnsPerHost: 1,
+		IdleConnTimeout:     idleTimeout,
+	}
+	defer transport.CloseIdleConnections()
+
+	handler := &handler{mitm: m, transport: transport, tunnel: tunnel, scheme: scheme}
+	if h2 {
+		(&http2.Server{IdleTimeout: idleTimeout}).ServeConn(conn, &http2.ServeConnOpts{Handler: handler})
+		return
+	}
+	l := &connListener{conn: conn, done: make(chan struct{})}
+	server := &http.Server{
+		Handler:     handler,
+		IdleTimeout: idleTimeout,
+		ConnState: func(c net.Conn, state http.ConnState) {
+			if state == http.StateClosed || state == http.StateHijacked {
+				_ = l.Close()
+			}
+		},
+	}
+	_ = server.Serve(l)
+}
+
+// IsHTTPRequest reports whether b starts with the request line of a plain HTTP/1.x request,
+// CONNECT isn't included as it can't be forwarded
+func IsHTTPRequest(b []byte) bool {
+	method, _, ok := bytes.Cut(b, []byte{' '})
+	return ok && slices.Contains(httpMethods, string(method))
+}
+
+type handler struct {
+	mitm      *MITM
+	transport http.RoundTripper
+	tunnel    C.Tunnel
+	scheme    string // https for the decrypted connections, http for the plain ones
+}
+
+type httpRequestKey struct{}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	url := h.scheme + "://" + r.Host + r.URL.RequestURI()
+	rewrites := h.mitm.Rewrites(url)
+
+	var response []*Rewrite
+	for _, rw := range rewrites {
+		switch rw.Action {
+		case ActionReject:
+			log.Debugln("[MITM] reject %s", url)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case ActionRedirect302, ActionRedirect307:
+			code, target := rw.Redirect(url)
+			log.Debugln("[MITM] redirect %s to %s", url, target)
+			http.Redirect(w, r, target, code)
+			return
+		}
+		if !rw.IsRequest() {
+			response = append(response, rw)
+		}
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Scheme = h.scheme
+			pr.Out.URL.Host = r.Host
+			for _, rw := range rewrites {
+				if rw.IsRequest() {
+					rw.ApplyHeader(pr.Out.Header)
+				}
+			}
+			if hasBodyRewrite(response) {
+				// let the transport decompress the body
+				pr.Out.Header.Del("Accept-Encoding")
+			}
+			if h.tunnel.ShouldParseHTTP() {
+				// the rules may route the requests to the same host differently,
+				// so the upstream connections are not reused
+				pr.Out.Close = true
+			}
+			pr.Out = pr.Out.WithContext(context.WithValue(pr.Out.Context(), httpRequestKey{}, &C.HTTPRequest{
+				Method: pr.Out.Method,
+				URL:    url,
+				Header: pr.Out.Header,
+			}))
+		},
+		Transport: h.transport,
+		ModifyResponse: func(resp *http.Response) error {
+			return modifyResponse(resp, response)
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Debugln("[MITM] forward %s error: %s", url, err)
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+func hasBodyRewrite(rewrites []*Rewrite) bool {
+	for _, rw := range rewrites {
+		if rw.Action == ActionResponseBody {
+			return true
+		}
+	}
+	return false
+}
+
+func modifyResponse(resp *http.Response, rewrites []*Rewrite) error {
+	for _, rw := range rewrites {
+		rw.ApplyHeader(resp.Header)
+	}
+	if !hasBodyRewrite(rewrites) || resp.Header.Get("Content-Encoding") != "" || resp.ContentLength > maxBodyRewrite {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyRewrite+1))
+	if err != nil {
+		return err
+	}
+	if len(body) > maxBodyRewrite {
+		resp.Body = &readCloser{Reader: io.MultiReader(bytes.NewReader(body), resp.Body), Closer: resp.Body}
+		return nil
+	}
+	_ = resp.Body.Close()
+	for _, rw := range rewrites {
+		body = rw.ApplyBody(body)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// connListener serves a single connection for http.Server
+type connListener struct {
+	conn     net.Conn
+	accepted bool
+	once     sync.Once
+	done     chan struct{}
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	if !l.accepted {
+		l.accepted = true
+		return l.conn, nil
+	}
+	<-l.done
+	return nil, net.ErrClosed
+}
+
+func (l *connListener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+	})
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
@@ -0,0 +1,101 @@
+// Package mitm decrypts the HTTPS connections to the configured hostnames
+// with the certificates issued by a local CA and applies the rewrites to them.
+package mitm
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sort"
+
+	"github.com/metacubex/mihomo/common/atomic"
+	"github.com/metacubex/mihomo/component/trie"
+	"github.com/metacubex/mihomo/log"
+)
+
+var defaultMITM = atomic.NewTypedValue[*MITM](nil)
+
+// Default returns the running MITM, it is nil when MITM is disabled
+func Default() *MITM {
+	return defaultMITM.Load()
+}
+
+// Update replaces the running MITM and destroys the providers of the old one, m can be nil
+func Update(m *MITM) {
+	if m != nil {
+		for _, rp := range m.providers {
+			if err := rp.Initial(); err != nil {
+				log.Errorln("[MITM] initial rewrite provider %s error: %s", rp.Name(), err)
+			}
+		}
+	}
+	if old := defaultMITM.Swap(m); old != nil && old != m {
+		for _, rp := range old.providers {
+			_ = rp.Destroy()
+		}
+	}
+}
+
+type MITM struct {
+	certs     *certStore
+	hostnames *trie.DomainSet
+	rewrites  []*Rewrite
+	providers []*RewriteProvider
+}
+
+// New creates a MITM, the providers are not loaded until Update
+func New(ca tls.Certificate, hostnames []string, rewrites []string, providers map[string]*RewriteProvider) (*MITM, error) {
+	certs, err := newCertStore(ca)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mitm ca: %w", err)
+	}
+	m := &MITM{certs: certs}
+
+	hostnameTrie := trie.New[struct{}]()
+	for _, hostname := range hostnames {
+		if err := hostnameTrie.Insert(hostname, struct{}{}); err != nil {
+			return nil, fmt.Errorf("invalid mitm hostname %s: %w", hostname, err)
+		}
+	}
+	m.hostnames = hostnameTrie.NewDomainSet()
+
+	for _, line := range rewrites {
+		r, err := ParseRewrite(line)
+		if err != nil {
+			return nil, err
+		}
+		m.rewrites = append(m.rewrites, r)
+	}
+
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		m.providers = append(m.providers, providers[name])
+	}
+	return m, nil
+}
+
+// Match reports whether the connections to host should be decrypted
+func (m *MITM) Match(host string) bool {
+	return host != "" && m.hostnames.Has(host)
+}
+
+// Rewrites returns the rewrites matching url, the inline ones come first,
+// then the ones of the providers in the order of their names
+func (m *MITM) Rewrites(url string) (matched []*Rewrite) {
+	for _, r := range m.rewrites {
+		if r.URL.MatchString(url) {
+			matched = append(matched, r)
+		}
+	}
+	for _, rp := range m.providers {
+		for _, r := range rp.Rewrites() {
+			if r.URL.MatchString(url) {
+				matched = append(matched, r)
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,141 @@
+package mitm
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testCA(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestParseRewrite(t *testing.T) {
+	r, err := ParseRewrite(`^https://example\.com/(.*) 302 https://example.org/$1`)
+	require.NoError(t, err)
+	code, target := r.Redirect("https://example.com/a?b=c")
+	assert.Equal(t, http.StatusFound, code)
+	assert.Equal(t, "https://example.org/a?b=c", target)
+
+	r, err = ParseRewrite(`^https://example\.com/ request-header-replace User-Agent "Mozilla/5.0 (test)"`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"User-Agent", "Mozilla/5.0 (test)"}, r.Args)
+	assert.True(t, r.IsRequest())
+	assert.Equal(t, `^https://example\.com/ request-header-replace User-Agent "Mozilla/5.0 (test)"`, r.String())
+
+	for _, line := range []string{
+		`^https://example\.com/`,
+		`^https://example\.com/ unknown`,
+		`^https://example\.com/ reject extra`,
+		`^https://example\.com/ response-body "unterminated`,
+		`( reject`,
+	} {
+		_, err = ParseRewrite(line)
+		assert.Error(t, err, line)
+	}
+
+	rewrites, err := ParseRewrites([]byte("# comment\n\n^https://a\\.com/ reject\n^https://b\\.com/ response-header-del Set-Cookie\n"))
+	require.NoError(t, err)
+	assert.Len(t, rewrites, 2)
+}
+
+func TestMITM(t *testing.T) {
+	ca := testCA(t)
+	m, err := New(ca, []string{"+.example.com"}, []string{
+		`^https://www\.example\.com/ad reject`,
+		`^https://www\.example\.com/ response-body "\"ad\":true" "\"ad\":false"`,
+	}, nil)
+	require.NoError(t, err)
+	assert.True(t, m.Match("www.example.com"))
+	assert.False(t, m.Match("example.org"))
+	assert.Len(t, m.Rewrites("https://www.example.com/ad"), 2)
+	assert.Len(t, m.Rewrites("https://www.example.com/api"), 1)
+
+	cert, err := m.certs.Get("www.example.com")
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	caX509, err := x509.ParseCertificate(ca.Certificate[0])
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(caX509)
+	_, err = leaf.Verify(x509.VerifyOptions{DNSName: "www.example.com", Roots: roots})
+	assert.NoError(t, err)
+	cached, err := m.certs.Get("www.example.com")
+	require.NoError(t, err)
+	assert.Same(t, cert, cached)
+
+	_, err = New(tls.Certificate{Certificate: cert.Certificate[:1], PrivateKey: cert.PrivateKey}, nil, nil, nil)
+	assert.Error(t, err, "the leaf is not a ca")
+}
+
+func TestModifyResponse(t *testing.T) {
+	r, err := ParseRewrite(`^https://example\.com/ response-body "\"ad\":true" "\"ad\":false"`)
+	require.NoError(t, err)
+	h, err := ParseRewrite(`^https://example\.com/ response-header-add X-Test yes`)
+	require.NoError(t, err)
+
+	resp := &http.Response{
+		Header:        http.Header{},
+		Body:          io.NopCloser(bytes.NewReader([]byte(`{"ad":true}`))),
+		ContentLength: -1,
+	}
+	require.NoError(t, modifyResponse(resp, []*Rewrite{r, h}))
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, `{"ad":false}`, string(body))
+	assert.Equal(t, int64(len(body)), resp.ContentLength)
+	assert.Equal(t, "yes", resp.Header.Get("X-Test"))
+
+	resp = &http.Response{
+		Header: http.Header{"Content-Encoding": {"br"}},
+		Body:   io.NopCloser(bytes.NewReader([]byte(`{"ad":true}`))),
+	}
+	require.NoError(t, modifyResponse(resp, []*Rewrite{r}))
+	body, _ = io.ReadAll(resp.Body)
+	assert.Equal(t, `{"ad":true}`, string(body), "encoded bodies are not rewritten")
+}
+
+func TestPlainHTTP(t *testing.T) {
+	assert.True(t, IsHTTPRequest([]byte("GET / HT")))
+	assert.True(t, IsHTTPRequest([]byte("OPTIONS ")))
+	assert.False(t, IsHTTPRequest([]byte("CONNECT ")))
+	assert.False(t, IsHTTPRequest([]byte("GETX / H")))
+	assert.False(t, IsHTTPRequest([]byte{0x16, 0x03, 0x01}))
+
+	m, err := New(testCA(t), []string{"example.com"}, []string{
+		`^http://example\.com/(.*) 302 https://example.com/$1`,
+	}, nil)
+	require.NoError(t, err)
+	h := &handler{mitm: m, scheme: "http"}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/path?q=1", nil))
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://example.com/path?q=1", w.Header().Get("Location"))
+}
@@ -0,0 +1,75 @@
+package mitm
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/metacubex/mihomo/common/atomic"
+	"github.com/metacubex/mihomo/common/structure"
+	"github.com/metacubex/mihomo/component/resource"
+	C "github.com/metacubex/mihomo/constant"
+	"github.com/metacubex/mihomo/constant/features"
+	P "github.com/metacubex/mihomo/constant/provider"
+)
+
+var errSubPath = errors.New("path is not subpath of home directory")
+
+type rewriteProviderSchema struct {
+	Type     string `provider:"type"`
+	Path     string `provider:"path,omitempty"`
+	URL      string `provider:"url,omitempty"`
+	Proxy    string `provider:"proxy,omitempty"`
+	Interval int    `provider:"interval,omitempty"`
+}
+
+// RewriteProvider loads the rewrites from a file or an url, one rewrite per line
+type RewriteProvider struct {
+	*resource.Fetcher[[]*Rewrite]
+	rewrites atomic.TypedValue[[]*Rewrite]
+}
+
+func ParseRewriteProvider(name string, mapping map[string]any) (*RewriteProvider, error) {
+	schema := &rewriteProviderSchema{}
+	decoder := structure.NewDecoder(structure.Option{TagName: "provider", WeaklyTypedInput: true})
+	if err := decoder.Decode(mapping, schema); err != nil {
+		return nil, err
+	}
+
+	var vehicle P.Vehicle
+	switch schema.Type {
+	case "file":
+		path := C.Path.Resolve(schema.Path)
+		vehicle = resource.NewFileVehicle(path)
+	case "http":
+		path := C.Path.GetPathByHash("rewrites", schema.URL)
+		if schema.Path != "" {
+			path = C.Path.Resolve(schema.Path)
+			if !features.CMFA && !C.Path.IsSafePath(path) {
+				return nil, fmt.Errorf("%w: %s", errSubPath, path)
+			}
+		}
+		vehicle = resource.NewHTTPVehicle(schema.URL, path, schema.Proxy, nil)
+	default:
+		return nil, fmt.Errorf("unsupported vehicle type: %s", schema.Type)
+	}
+
+	rp := &RewriteProvider{}
+	rp.Fetcher = resource.NewFetcher(name, time.Duration(uint(schema.Interval))*time.Second, vehicle, ParseRewrites, func(rewrites []*Rewrite) {
+		rp.rewrites.Store(rewrites)
+	})
+	return rp, nil
+}
+
+func (rp *RewriteProvider) Initial() error {
+	rewrites, err := rp.Fetcher.Initial()
+	if err != nil {
+		return err
+	}
+	rp.rewrites.Store(rewrites)
+	return nil
+}
+
+func (rp *RewriteProvider) Rewrites() []*Rewrite {
+	return rp.rewrites.Load()
+}
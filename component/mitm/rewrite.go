@@ -0,0 +1,188 @@
+package mitm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	ActionReject                = "reject"
+	ActionRedirect302           = "302"
+	ActionRedirect307           = "307"
+	ActionRequestHeaderAdd      = "request-header-add"
+	ActionRequestHeaderDel      = "request-header-del"
+	ActionRequestHeaderReplace  = "request-header-replace"
+	ActionResponseHeaderAdd     = "response-header-add"
+	ActionResponseHeaderDel     = "response-header-del"
+	ActionResponseHeaderReplace = "response-header-replace"
+	ActionResponseBody          = "response-body"
+)
+
+// Rewrite is a line of "<url-regex> <action> [args...]", the fields can be
+// double-quoted with the escapes of Go strings when they contain spaces, e.g.
+//
+//	^https?://example\.com/ads reject
+//	^http://example\.com/(.*) 302 https://example.com/$1
+//	^https://example\.com/ request-header-replace User-Agent "Mozilla/5.0"
+//	^https://example\.com/api response-body "\"ad\":true" "\"ad\":false"
+type Rewrite struct {
+	URL    *regexp.Regexp
+	Action string
+	Args   []string
+
+	body *regexp.Regexp // the pattern of response-body
+}
+
+// ParseRewrite parses a rewrite line
+func ParseRewrite(line string) (*Rewrite, error) {
+	fields, err := splitFields(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("invalid rewrite: %s", line)
+	}
+	url, err := regexp.Compile(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid rewrite url %s: %w", fields[0], err)
+	}
+	r := &Rewrite{URL: url, Action: fields[1], Args: fields[2:]}
+
+	var args int
+	switch r.Action {
+	case ActionReject:
+		args = 0
+	case ActionRedirect302, ActionRedirect307,
+		ActionRequestHeaderDel, ActionResponseHeaderDel:
+		args = 1
+	case ActionRequestHeaderAdd, ActionRequestHeaderReplace,
+		ActionResponseHeaderAdd, ActionResponseHeaderReplace, ActionResponseBody:
+		args = 2
+	default:
+		return nil, fmt.Errorf("unsupported rewrite action: %s", r.Action)
+	}
+	if len(r.Args) != args {
+		return nil, fmt.Errorf("rewrite action %s requires %d arguments, got %d", r.Action, args, len(r.Args))
+	}
+	if r.Action == ActionResponseBody {
+		if r.body, err = regexp.Compile(r.Args[0]); err != nil {
+			return nil, fmt.Errorf("invalid rewrite body %s: %w", r.Args[0], err)
+		}
+	}
+	return r, nil
+}
+
+// ParseRewrites parses the lines of a rewrite provider, the empty lines and
+// the lines starting with # are ignored
+func ParseRewrites(buf []byte) ([]*Rewrite, error) {
+	var rewrites []*Rewrite
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r, err := ParseRewrite(line)
+		if err != nil {
+			return nil, err
+		}
+		rewrites = append(rewrites, r)
+	}
+	return rewrites, scanner.Err()
+}
+
+// IsRequest reports whether r is applied before the request is sent to the server
+func (r *Rewrite) IsRequest() bool {
+	switch r.Action {
+	case ActionReject, ActionRedirect302, ActionRedirect307,
+		ActionRequestHeaderAdd, ActionRequestHeaderDel, ActionRequestHeaderReplace:
+		return true
+	}
+	return false
+}
+
+// Redirect returns the target of a 302 or 307 rewrite, $1 etc. are expanded from the url
+func (r *Rewrite) Redirect(url string) (int, string) {
+	code := http.StatusFound
+	if r.Action == ActionRedirect307 {
+		code = http.StatusTemporaryRedirect
+	}
+	var target []byte
+	for _, submatches := range r.URL.FindAllStringSubmatchIndex(url, 1) {
+		target = r.URL.ExpandString(target, r.Args[0], url, submatches)
+	}
+	return code, string(target)
+}
+
+// ApplyHeader applies the header actions to h
+func (r *Rewrite) ApplyHeader(h http.Header) {
+	switch r.Action {
+	case ActionRequestHeaderAdd, ActionResponseHeaderAdd:
+		h.Add(r.Args[0], r.Args[1])
+	case ActionRequestHeaderDel, ActionResponseHeaderDel:
+		h.Del(r.Args[0])
+	case ActionRequestHeaderReplace, ActionResponseHeaderReplace:
+		if h.Get(r.Args[0]) != "" {
+			h.Set(r.Args[0], r.Args[1])
+		}
+	}
+}
+
+// ApplyBody applies the response-body action to body
+func (r *Rewrite) ApplyBody(body []byte) []byte {
+	if r.body == nil {
+		return body
+	}
+	return r.body.ReplaceAll(body, []byte(r.Args[1]))
+}
+
+func (r *Rewrite) String() string {
+	fields := append([]string{r.URL.String(), r.Action}, r.Args...)
+	for i, field := range fields {
+		if field == "" || strings.ContainsAny(field, " \t\"") {
+			fields[i] = strconv.Quote(field)
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+func splitFields(line string) ([]string, error) {
+	var fields []string
+	for {
+		line = strings.TrimLeft(line, " \t")
+		if line == "" {
+			return fields, nil
+		}
+		if line[0] != '"' {
+			end := strings.IndexAny(line, " \t")
+			if end < 0 {
+				end = len(line)
+			}
+			fields = append(fields, line[:end])
+			line = line[end:]
+			continue
+		}
+		end := 1
+		for ; end < len(line); end++ {
+			if line[end] == '\\' {
+				end++
+			} else if line[end] == '"' {
+				break
+			}
+		}
+		if end >= len(line) {
+			return nil, fmt.Errorf("unterminated quote in: %s", line)
+		}
+		field, err := strconv.Unquote(line[:end+1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted field %s: %w", line[:end+1], err)
+		}
+		fields = append(fields, field)
+		line = line[end+1:]
+	}
+}
@@ -2,14 +2,11 @@ package mmdb
 
 import (
 	"context"
-	"io"
-	"net/http"
-	"os"
 	"sync"
-	"time"
+	"sync/atomic"
 
 	mihomoOnce "github.com/metacubex/mihomo/common/once"
-	mihomoHttp "github.com/metacubex/mihomo/component/http"
+	"github.com/metacubex/mihomo/component/verify"
 	C "github.com/metacubex/mihomo/constant"
 	"github.com/metacubex/mihomo/log"
 
@@ -29,6 +26,10 @@ var (
 	ASNreader ASNReader
 	IPonce    sync.Once
 	ASNonce   sync.Once
+
+	// ipLoaded and asnLoaded are set once the readers are assigned, see LoadedIP
+	ipLoaded  atomic.Bool
+	asnLoaded atomic.Bool
 )
 
 func LoadFromBytes(buffer []byte) {
@@ -46,6 +47,7 @@ func LoadFromBytes(buffer []byte) {
 		default:
 			IPreader.databaseType = typeMaxmind
 		}
+		ipLoaded.Store(true)
 	})
 }
 
@@ -74,28 +76,22 @@ func IPInstance() IPReader {
 		default:
 			IPreader.databaseType = typeMaxmind
 		}
+		ipLoaded.Store(true)
 	})
 
 	return IPreader
 }
 
-func DownloadMMDB(path string) (err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*90)
-	defer cancel()
-	resp, err := mihomoHttp.HttpRequest(ctx, C.MmdbUrl, http.MethodGet, http.Header{"User-Agent": {C.UA}}, nil)
-	if err != nil {
-		return
-	}
-	defer resp.Body.Close()
-
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0o644)
-	if err != nil {
-		return err
+// LoadedIP returns the mmdb reader if it's loaded, unlike IPInstance it never loads the file
+func LoadedIP() (IPReader, bool) {
+	if !ipLoaded.Load() {
+		return IPReader{}, false
 	}
-	defer f.Close()
-	_, err = io.Copy(f, resp.Body)
+	return IPreader, true
+}
 
-	return err
+func DownloadMMDB(path string) error {
+	return verify.DownloadFile(context.Background(), C.MmdbUrl, path)
 }
 
 func ASNInstance() ASNReader {
@@ -107,34 +103,30 @@ func ASNInstance() ASNReader {
 			log.Fatalln("Can't load ASN: %s", err.Error())
 		}
 		ASNreader = ASNReader{Reader: asn}
+		asnLoaded.Store(true)
 	})
 
 	return ASNreader
 }
 
-func DownloadASN(path string) (err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*90)
-	defer cancel()
-	resp, err := mihomoHttp.HttpRequest(ctx, C.ASNUrl, http.MethodGet, http.Header{"User-Agent": {C.UA}}, nil)
-	if err != nil {
-		return
+// LoadedASN returns the asn reader if it's loaded, unlike ASNInstance it never loads the file
+func LoadedASN() (ASNReader, bool) {
+	if !asnLoaded.Load() {
+		return ASNReader{}, false
 	}
-	defer resp.Body.Close()
-
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0o644)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	_, err = io.Copy(f, resp.Body)
+	return ASNreader, true
+}
 
-	return err
+func DownloadASN(path string) error {
+	return verify.DownloadFile(context.Background(), C.ASNUrl, path)
 }
 
 func ReloadIP() {
+	ipLoaded.Store(false)
 	mihomoOnce.Reset(&IPonce)
 }
 
 func ReloadASN() {
+	asnLoaded.Store(false)
 	mihomoOnce.Reset(&ASNonce)
 }
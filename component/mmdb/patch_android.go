@@ -15,4 +15,5 @@ func InstallOverride(override *maxminddb.Reader) {
 		IPreader.databaseType = typeMaxmind
 	}
 	IPreader = newReader
+	ipLoaded.Store(true)
 }
@@ -0,0 +1,219 @@
+package mmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	dataTypePointer = iota + 1
+	dataTypeString
+	dataTypeDouble
+	dataTypeBytes
+	dataTypeUint16
+	dataTypeUint32
+	dataTypeMap
+	dataTypeInt32
+	dataTypeUint64
+	dataTypeUint128
+	dataTypeArray
+)
+
+var metadataStart = []byte("\xAB\xCD\xEFMaxMind.com")
+
+type writerNode struct {
+	children [2]*writerNode
+	codes    []string
+}
+
+// Writer builds a Meta-geoip0 database, the IPv4 networks are stored in ::/96
+// like the MaxMind ones, an address in several networks maps to all their codes
+type Writer struct {
+	root writerNode
+}
+
+func NewWriter() *Writer {
+	return &Writer{}
+}
+
+func (w *Writer) Insert(prefix netip.Prefix, code string) {
+	prefix = prefix.Masked()
+	raw, bits := prefix.Addr().As16(), prefix.Bits()
+	if prefix.Addr().Is4() {
+		// not the mapped form but ::a.b.c.d, which the readers look up for IPv4
+		raw[10], raw[11] = 0, 0
+		bits += 96
+	}
+	node := &w.root
+	for i := 0; i < bits; i++ {
+		bit := raw[i/8] >> (7 - i%8) & 1
+		if node.children[bit] == nil {
+			node.children[bit] = &writerNode{}
+		}
+		node = node.children[bit]
+	}
+	if !slices.Contains(node.codes, code) {
+		node.codes = append(node.codes, code)
+	}
+}
+
+// record is a node index, or with leaf the codes of a network, none for no data
+type record struct {
+	node  int
+	leaf  bool
+	codes string
+}
+
+type treeBuilder struct {
+	nodes [][2]record
+}
+
+func (b *treeBuilder) build(node *writerNode, depth int, inherited []string) record {
+	codes := inherited
+	for _, code := range node.codes {
+		if !slices.Contains(codes, code) {
+			codes = append(slices.Clip(codes), code)
+		}
+	}
+	sorted := slices.Clone(codes)
+	slices.Sort(sorted)
+	leaf := record{leaf: true, codes: strings.Join(sorted, "\x00")}
+	// the root is always a node
+	if depth == 128 || depth > 0 && node.children[0] == nil && node.children[1] == nil {
+		return leaf
+	}
+
+	index := len(b.nodes)
+	b.nodes = append(b.nodes, [2]record{})
+	var records [2]record
+	for bit, child := range node.children {
+		if child == nil {
+			records[bit] = leaf
+		} else {
+			records[bit] = b.build(child, depth+1, codes)
+		}
+	}
+	// the children of a node are appended after it, so the node is the last one
+	// when both of its records are leaves
+	if depth > 0 && records[0] == records[1] && records[0].leaf {
+		b.nodes = b.nodes[:index]
+		return records[0]
+	}
+	b.nodes[index] = records
+	return record{node: index}
+}
+
+// WriteTo writes the database with 32 bits records
+func (w *Writer) WriteTo(out io.Writer) (int64, error) {
+	b := &treeBuilder{}
+	b.build(&w.root, 0, nil)
+	nodeCount := uint32(len(b.nodes))
+
+	data := &bytes.Buffer{}
+	offsets := map[string]uint32{}
+	recordValue := func(r record) uint32 {
+		if !r.leaf {
+			return uint32(r.node)
+		}
+		if r.codes == "" {
+			return nodeCount
+		}
+		offset, ok := offsets[r.codes]
+		if !ok {
+			offset = uint32(data.Len())
+			offsets[r.codes] = offset
+			codes := strings.Split(r.codes, "\x00")
+			if len(codes) == 1 {
+				encodeString(data, codes[0])
+			} else {
+				encodeStrings(data, codes)
+			}
+		}
+		return nodeCount + 16 + offset
+	}
+
+	buf := &bytes.Buffer{}
+	for _, node := range b.nodes {
+		_ = binary.Write(buf, binary.BigEndian, recordValue(node[0]))
+		_ = binary.Write(buf, binary.BigEndian, recordValue(node[1]))
+	}
+	buf.Write(make([]byte, 16))
+	buf.Write(data.Bytes())
+
+	buf.Write(metadataStart)
+	encodeControl(buf, dataTypeMap, 9)
+	encodeString(buf, "binary_format_major_version")
+	encodeUint(buf, dataTypeUint16, 2)
+	encodeString(buf, "binary_format_minor_version")
+	encodeUint(buf, dataTypeUint16, 0)
+	encodeString(buf, "build_epoch")
+	encodeUint(buf, dataTypeUint64, uint64(time.Now().Unix()))
+	encodeString(buf, "database_type")
+	encodeString(buf, "Meta-geoip0")
+	encodeString(buf, "description")
+	encodeControl(buf, dataTypeMap, 1)
+	encodeString(buf, "en")
+	encodeString(buf, "Meta-geoip0 database built by mihomo")
+	encodeString(buf, "ip_version")
+	encodeUint(buf, dataTypeUint16, 6)
+	encodeString(buf, "languages")
+	encodeStrings(buf, nil)
+	encodeString(buf, "node_count")
+	encodeUint(buf, dataTypeUint32, uint64(nodeCount))
+	encodeString(buf, "record_size")
+	encodeUint(buf, dataTypeUint16, 32)
+
+	return buf.WriteTo(out)
+}
+
+func encodeControl(buf *bytes.Buffer, dataType byte, size int) {
+	var ctrl byte
+	var ext []byte
+	if dataType > 7 {
+		ext = append(ext, dataType-7)
+	} else {
+		ctrl = dataType << 5
+	}
+	switch {
+	case size < 29:
+		ctrl |= byte(size)
+	case size < 285:
+		ctrl |= 29
+		ext = append(ext, byte(size-29))
+	case size < 65821:
+		ctrl |= 30
+		ext = binary.BigEndian.AppendUint16(ext, uint16(size-285))
+	default:
+		ctrl |= 31
+		size -= 65821
+		ext = append(ext, byte(size>>16), byte(size>>8), byte(size))
+	}
+	buf.WriteByte(ctrl)
+	buf.Write(ext)
+}
+
+func encodeString(buf *bytes.Buffer, s string) {
+	encodeControl(buf, dataTypeString, len(s))
+	buf.WriteString(s)
+}
+
+func encodeStrings(buf *bytes.Buffer, strs []string) {
+	encodeControl(buf, dataTypeArray, len(strs))
+	for _, s := range strs {
+		encodeString(buf, s)
+	}
+}
+
+func encodeUint(buf *bytes.Buffer, dataType byte, v uint64) {
+	raw := binary.BigEndian.AppendUint64(nil, v)
+	for len(raw) > 0 && raw[0] == 0 {
+		raw = raw[1:]
+	}
+	encodeControl(buf, dataType, len(raw))
+	buf.Write(raw)
+}
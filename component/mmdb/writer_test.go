@@ -0,0 +1,46 @@
+package mmdb
+
+import (
+	"bytes"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriter(t *testing.T) {
+	w := NewWriter()
+	w.Insert(netip.MustParsePrefix("203.0.113.0/24"), "us")
+	w.Insert(netip.MustParsePrefix("203.0.0.0/8"), "private")
+	w.Insert(netip.MustParsePrefix("198.51.100.7/32"), "cn")
+	w.Insert(netip.MustParsePrefix("2001:db8::/32"), "cn")
+
+	buf := &bytes.Buffer{}
+	_, err := w.WriteTo(buf)
+	require.NoError(t, err)
+
+	db, err := maxminddb.FromBytes(buf.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, db.Verify())
+	assert.Equal(t, "Meta-geoip0", db.Metadata.DatabaseType)
+
+	reader := IPReader{Reader: db, databaseType: typeMetaV0}
+	for ip, expected := range map[string][]string{
+		"203.0.113.1":    {"private", "us"},
+		"203.1.1.1":      {"private"},
+		"198.51.100.7":   {"cn"},
+		"198.51.100.8":   {},
+		"2001:db8::1":    {"cn"},
+		"2001:db9::1":    {},
+		"192.0.2.1":      {},
+		"::ffff:1.2.3.4": {},
+	} {
+		assert.Equal(t, expected, reader.LookupCode(net.ParseIP(ip)), ip)
+	}
+
+	_, err = NewWriter().WriteTo(&bytes.Buffer{})
+	require.NoError(t, err)
+}
@@ -3,8 +3,12 @@ package nat
 import (
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/metacubex/mihomo/component/capture"
 	C "github.com/metacubex/mihomo/constant"
+	"github.com/metacubex/mihomo/log"
 
 	"github.com/puzpuzpuz/xsync/v3"
 )
@@ -12,22 +16,79 @@ import (
 type Table struct {
 	mapping *xsync.MapOf[string, *Entry]
 	lockMap *xsync.MapOf[string, *sync.Cond]
+	locals  *xsync.MapOf[string, *localEntry]
 }
 
 type Entry struct {
-	PacketConn      C.PacketConn
-	WriteBackProxy  C.WriteBackProxy
+	PacketConn     C.PacketConn
+	WriteBackProxy C.WriteBackProxy
+	LocalAddr      string // the source address of the client, the key of the tproxy local conns
+	Mapping        C.UDPMapping
+	Route          string // the proxy chain of the rule, the destinations of other chains don't share the entry
+	Timeout        time.Duration
+	Capture        *capture.Flow // nil unless the session is captured
+
+	lastActive   atomic.Int64
+	destinations sync.Map // the destination IPs allowed to use an endpoint-independent entry
+}
+
+// NewEntry returns an endpoint-independent entry of the client lAddr
+func NewEntry(lAddr string, pc C.PacketConn, w C.WriteBackProxy, timeout time.Duration) *Entry {
+	e := &Entry{
+		PacketConn:     pc,
+		WriteBackProxy: w,
+		LocalAddr:      lAddr,
+		Timeout:        timeout,
+	}
+	e.Touch()
+	return e
+}
+
+// Touch records the activity of the entry
+func (e *Entry) Touch() {
+	e.lastActive.Store(time.Now().UnixNano())
+}
+
+// Idle returns the duration since the last activity
+func (e *Entry) Idle() time.Duration {
+	return time.Since(time.Unix(0, e.lastActive.Load()))
+}
+
+// Allow lets the packets to dst use the entry, after the rule of dst has been checked
+func (e *Entry) Allow(dst string) {
+	e.destinations.Store(dst, struct{}{})
+}
+
+// Allows reports whether Allow has been called with dst
+func (e *Entry) Allows(dst string) bool {
+	_, ok := e.destinations.Load(dst)
+	return ok
+}
+
+// localEntry holds the tproxy local conns of a client, it is shared by the entries of the client
+type localEntry struct {
+	refs            int
 	LocalUDPConnMap *xsync.MapOf[string, *net.UDPConn]
 	LocalLockMap    *xsync.MapOf[string, *sync.Cond]
 }
 
-func (t *Table) Set(key string, e C.PacketConn, w C.WriteBackProxy) {
-	t.mapping.Store(key, &Entry{
-		PacketConn:      e,
-		WriteBackProxy:  w,
-		LocalUDPConnMap: xsync.NewMapOf[string, *net.UDPConn](),
-		LocalLockMap:    xsync.NewMapOf[string, *sync.Cond](),
+// Store adds e if there is no entry of key, otherwise it returns the existing one and false
+func (t *Table) Store(key string, e *Entry) (actual *Entry, stored bool) {
+	actual, loaded := t.mapping.LoadOrStore(key, e)
+	if loaded {
+		return actual, false
+	}
+	t.locals.Compute(e.LocalAddr, func(local *localEntry, loaded bool) (*localEntry, bool) {
+		if !loaded {
+			local = &localEntry{
+				LocalUDPConnMap: xsync.NewMapOf[string, *net.UDPConn](),
+				LocalLockMap:    xsync.NewMapOf[string, *sync.Cond](),
+			}
+		}
+		local.refs++
+		return local, false
 	})
+	return e, true
 }
 
 func (t *Table) Get(key string) (C.PacketConn, C.WriteBackProxy) {
@@ -38,13 +99,61 @@ func (t *Table) Get(key string) (C.PacketConn, C.WriteBackProxy) {
 	return entry.PacketConn, entry.WriteBackProxy
 }
 
+// Load returns the entry of key
+func (t *Table) Load(key string) (*Entry, bool) {
+	return t.getEntry(key)
+}
+
+// Range calls f for each entry until f returns false
+func (t *Table) Range(f func(key string, e *Entry) bool) {
+	t.mapping.Range(f)
+}
+
 func (t *Table) GetOrCreateLock(key string) (*sync.Cond, bool) {
 	item, loaded := t.lockMap.LoadOrCompute(key, makeLock)
 	return item, loaded
 }
 
 func (t *Table) Delete(key string) {
-	t.mapping.Delete(key)
+	if entry, loaded := t.mapping.LoadAndDelete(key); loaded {
+		t.release(entry.LocalAddr)
+	}
+}
+
+// DeleteEntry deletes the entry of key only if it is e
+func (t *Table) DeleteEntry(key string, e *Entry) {
+	deleted := false
+	t.mapping.Compute(key, func(entry *Entry, loaded bool) (*Entry, bool) {
+		deleted = loaded && entry == e
+		return entry, !loaded || deleted
+	})
+	if deleted {
+		t.release(e.LocalAddr)
+	}
+}
+
+// release closes the tproxy local conns of the client after its last entry is deleted
+func (t *Table) release(lAddr string) {
+	var closed *localEntry
+	t.locals.Compute(lAddr, func(local *localEntry, loaded bool) (*localEntry, bool) {
+		if !loaded {
+			return nil, true
+		}
+		local.refs--
+		if local.refs > 0 {
+			return local, false
+		}
+		closed = local
+		return nil, true
+	})
+	if closed == nil {
+		return
+	}
+	closed.LocalUDPConnMap.Range(func(key string, conn *net.UDPConn) bool {
+		_ = conn.Close()
+		log.Debugln("Closing TProxy local conn... lAddr=%s rAddr=%s", lAddr, key)
+		return true
+	})
 }
 
 func (t *Table) DeleteLock(lockKey string) {
@@ -52,7 +161,7 @@ func (t *Table) DeleteLock(lockKey string) {
 }
 
 func (t *Table) GetForLocalConn(lAddr, rAddr string) *net.UDPConn {
-	entry, exist := t.getEntry(lAddr)
+	entry, exist := t.getLocalEntry(lAddr)
 	if !exist {
 		return nil
 	}
@@ -64,7 +173,7 @@ func (t *Table) GetForLocalConn(lAddr, rAddr string) *net.UDPConn {
 }
 
 func (t *Table) AddForLocalConn(lAddr, rAddr string, conn *net.UDPConn) bool {
-	entry, exist := t.getEntry(lAddr)
+	entry, exist := t.getLocalEntry(lAddr)
 	if !exist {
 		return false
 	}
@@ -73,7 +182,7 @@ func (t *Table) AddForLocalConn(lAddr, rAddr string, conn *net.UDPConn) bool {
 }
 
 func (t *Table) RangeForLocalConn(lAddr string, f func(key string, value *net.UDPConn) bool) {
-	entry, exist := t.getEntry(lAddr)
+	entry, exist := t.getLocalEntry(lAddr)
 	if !exist {
 		return
 	}
@@ -81,7 +190,7 @@ func (t *Table) RangeForLocalConn(lAddr string, f func(key string, value *net.UD
 }
 
 func (t *Table) GetOrCreateLockForLocalConn(lAddr, key string) (*sync.Cond, bool) {
-	entry, loaded := t.getEntry(lAddr)
+	entry, loaded := t.getLocalEntry(lAddr)
 	if !loaded {
 		return nil, false
 	}
@@ -90,7 +199,7 @@ func (t *Table) GetOrCreateLockForLocalConn(lAddr, key string) (*sync.Cond, bool
 }
 
 func (t *Table) DeleteForLocalConn(lAddr, key string) {
-	entry, loaded := t.getEntry(lAddr)
+	entry, loaded := t.getLocalEntry(lAddr)
 	if !loaded {
 		return
 	}
@@ -98,7 +207,7 @@ func (t *Table) DeleteForLocalConn(lAddr, key string) {
 }
 
 func (t *Table) DeleteLockForLocalConn(lAddr, key string) {
-	entry, loaded := t.getEntry(lAddr)
+	entry, loaded := t.getLocalEntry(lAddr)
 	if !loaded {
 		return
 	}
@@ -109,6 +218,10 @@ func (t *Table) getEntry(key string) (*Entry, bool) {
 	return t.mapping.Load(key)
 }
 
+func (t *Table) getLocalEntry(lAddr string) (*localEntry, bool) {
+	return t.locals.Load(lAddr)
+}
+
 func makeLock() *sync.Cond {
 	return sync.NewCond(&sync.Mutex{})
 }
@@ -118,5 +231,6 @@ func New() *Table {
 	return &Table{
 		mapping: xsync.NewMapOf[string, *Entry](),
 		lockMap: xsync.NewMapOf[string, *sync.Cond](),
+		locals:  xsync.NewMapOf[string, *localEntry](),
 	}
 }
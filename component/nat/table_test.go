@@ -0,0 +1,48 @@
+package nat
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableLocalConn(t *testing.T) {
+	table := New()
+	lAddr := "127.0.0.1:10000"
+	first := NewEntry(lAddr, nil, nil, 0)
+	second := NewEntry(lAddr, nil, nil, 0)
+
+	_, stored := table.Store(lAddr, first)
+	require.True(t, stored)
+	actual, stored := table.Store(lAddr, second)
+	assert.False(t, stored)
+	assert.Equal(t, first, actual)
+	_, stored = table.Store(lAddr+"|198.51.100.1", second)
+	require.True(t, stored)
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	require.True(t, table.AddForLocalConn(lAddr, "198.51.100.1:53", conn))
+
+	table.DeleteEntry(lAddr, second)
+	_, ok := table.Load(lAddr)
+	assert.True(t, ok, "only the same entry is deleted")
+
+	table.DeleteEntry(lAddr, first)
+	assert.NotNil(t, table.GetForLocalConn(lAddr, "198.51.100.1:53"), "the local conns are kept by the other entry")
+
+	table.Delete(lAddr + "|198.51.100.1")
+	assert.Nil(t, table.GetForLocalConn(lAddr, "198.51.100.1:53"))
+	_, err = conn.Write([]byte{0})
+	assert.ErrorIs(t, err, net.ErrClosed)
+}
+
+func TestEntryAllows(t *testing.T) {
+	entry := NewEntry("127.0.0.1:10000", nil, nil, 0)
+	assert.False(t, entry.Allows("198.51.100.1"))
+	entry.Allow("198.51.100.1")
+	assert.True(t, entry.Allows("198.51.100.1"))
+	assert.False(t, entry.Allows("198.51.100.2"))
+}
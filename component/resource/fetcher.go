@@ -120,6 +120,24 @@ func (f *Fetcher[V]) Initial() (V, error) {
 	return contents, nil
 }
 
+// ReadLocal parses the local copy of the resource without fetching it or starting
+// the pull loop, the resources of HTTP fail if they are never downloaded
+func (f *Fetcher[V]) ReadLocal() (V, error) {
+	var (
+		buf []byte
+		err error
+	)
+	if f.vehicle.Type() == types.HTTP {
+		buf, err = os.ReadFile(f.vehicle.Path())
+	} else {
+		buf, err = f.vehicle.Read()
+	}
+	if err != nil {
+		return lo.Empty[V](), err
+	}
+	return f.parser(buf)
+}
+
 func (f *Fetcher[V]) Update() (V, bool, error) {
 	buf, err := f.vehicle.Read()
 	if err != nil {
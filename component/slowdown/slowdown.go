@@ -33,6 +33,18 @@ func New() *SlowDown {
 	}
 }
 
+// NewWithBackoff returns a SlowDown waiting from min to max with a factor of 2
+func NewWithBackoff(min, max time.Duration) *SlowDown {
+	return &SlowDown{
+		backoff: Backoff{
+			Min:    min,
+			Max:    max,
+			Factor: 2,
+			Jitter: true,
+		},
+	}
+}
+
 func Do[T any](s *SlowDown, ctx context.Context, fn func() (T, error)) (t T, err error) {
 	if s.errTimes.Load() > 10 {
 		err = s.Wait(ctx)
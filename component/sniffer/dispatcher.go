@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"net/netip"
+	"strings"
 	"sync"
 	"time"
 
@@ -56,7 +57,7 @@ func (sd *SnifferDispatcher) UDPSniff(packet C.PacketAdapter) bool {
 						continue
 					}
 
-					sd.replaceDomain(metadata, host, overrideDest)
+					sd.replaceDomain(metadata, host, sniffer.Protocol(), overrideDest)
 					return true
 				}
 			}
@@ -94,7 +95,7 @@ func (sd *SnifferDispatcher) TCPSniff(conn *N.BufferedConn, metadata *C.Metadata
 		}
 		sd.rwMux.RUnlock()
 
-		if host, err := sd.sniffDomain(conn, metadata); err != nil {
+		if host, protocol, err := sd.sniffDomain(conn, metadata); err != nil {
 			sd.cacheSniffFailed(metadata)
 			log.Debugln("[Sniffer] All sniffing sniff failed with from [%s:%d] to [%s:%d]", metadata.SrcIP, metadata.SrcPort, metadata.String(), metadata.DstPort)
 			return false
@@ -108,14 +109,47 @@ func (sd *SnifferDispatcher) TCPSniff(conn *N.BufferedConn, metadata *C.Metadata
 			sd.skipList.Delete(dst)
 			sd.rwMux.RUnlock()
 
-			sd.replaceDomain(metadata, host, overrideDest)
+			sd.replaceDomain(metadata, host, protocol, overrideDest)
 			return true
 		}
 	}
 	return false
 }
 
-func (sd *SnifferDispatcher) replaceDomain(metadata *C.Metadata, host string, overrideDest bool) {
+// SniffHTTPRequest parses the request of a connection to a port of the HTTP sniffer
+// into metadata.HTTP for the rules matching on the HTTP requests
+func (sd *SnifferDispatcher) SniffHTTPRequest(conn *N.BufferedConn, metadata *C.Metadata) bool {
+	if metadata.HTTP != nil {
+		return true
+	}
+	for s := range sd.sniffers {
+		if _, ok := s.(*HTTPSniffer); !ok || !s.SupportPort(metadata.DstPort) {
+			continue
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(1 * time.Second))
+		_, err := conn.Peek(1)
+		_ = conn.SetReadDeadline(time.Time{})
+		if err != nil {
+			return false
+		}
+		bytes, err := conn.Peek(conn.Buffered())
+		if err != nil {
+			return false
+		}
+		host := strings.TrimSuffix(metadata.RemoteAddress(), ":80")
+		request, err := ParseHTTPRequest(bytes, host)
+		if err != nil {
+			return false
+		}
+		log.Debugln("[Sniffer] Sniff http request [%s]-->[%s] %s %s",
+			metadata.SourceDetail(), metadata.RemoteAddress(), request.Method, request.URL)
+		metadata.HTTP = request
+		return true
+	}
+	return false
+}
+
+func (sd *SnifferDispatcher) replaceDomain(metadata *C.Metadata, host, protocol string, overrideDest bool) {
 	// show log early, since the following code may mutate `metadata.Host`
 	log.Debugln("[Sniffer] Sniff %s [%s]-->[%s] success, replace domain [%s]-->[%s]",
 		metadata.NetWork,
@@ -123,6 +157,7 @@ func (sd *SnifferDispatcher) replaceDomain(metadata *C.Metadata, host string, ov
 		metadata.RemoteAddress(),
 		metadata.Host, host)
 	metadata.SniffHost = host
+	metadata.SniffProtocol = protocol
 	if overrideDest {
 		metadata.Host = host
 	}
@@ -133,7 +168,7 @@ func (sd *SnifferDispatcher) Enable() bool {
 	return sd.enable
 }
 
-func (sd *SnifferDispatcher) sniffDomain(conn *N.BufferedConn, metadata *C.Metadata) (string, error) {
+func (sd *SnifferDispatcher) sniffDomain(conn *N.BufferedConn, metadata *C.Metadata) (string, string, error) {
 	for s := range sd.sniffers {
 		if s.SupportNetwork() == C.TCP {
 			_ = conn.SetReadDeadline(time.Now().Add(1 * time.Second))
@@ -147,7 +182,7 @@ func (sd *SnifferDispatcher) sniffDomain(conn *N.BufferedConn, metadata *C.Metad
 					_ = conn.Close()
 				}
 
-				return "", err
+				return "", "", err
 			}
 
 			bufferedLen := conn.Buffered()
@@ -169,11 +204,11 @@ func (sd *SnifferDispatcher) sniffDomain(conn *N.BufferedConn, metadata *C.Metad
 				continue
 			}
 
-			return host, nil
+			return host, s.Protocol(), nil
 		}
 	}
 
-	return "", ErrorSniffFailed
+	return "", "", ErrorSniffFailed
 }
 
 func (sd *SnifferDispatcher) cacheSniffFailed(metadata *C.Metadata) {
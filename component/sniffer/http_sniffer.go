@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"strings"
 
 	"github.com/metacubex/mihomo/common/utils"
@@ -134,3 +135,46 @@ func parseHost(host string) (*string, error) {
 
 	return &host, nil
 }
+
+// ParseHTTPRequest parses the request line and the complete header lines in b,
+// host is used to build the url when the request has no Host header
+func ParseHTTPRequest(b []byte, host string) (*C.HTTPRequest, error) {
+	if err := beginWithHTTPMethod(b); err != nil {
+		return nil, err
+	}
+	lines := bytes.Split(b, []byte{'\n'})
+	if len(lines) < 2 {
+		return nil, ErrNoClue // the request line is not complete
+	}
+	requestLine := strings.Fields(string(lines[0]))
+	if len(requestLine) != 3 || !strings.HasPrefix(requestLine[2], "HTTP/") {
+		return nil, fmt.Errorf("invalid request line")
+	}
+
+	request := &C.HTTPRequest{
+		Method: strings.ToUpper(requestLine[0]),
+		Header: http.Header{},
+	}
+	// the last line is skipped since it may be truncated
+	for _, line := range lines[1 : len(lines)-1] {
+		line = bytes.TrimRight(line, "\r")
+		if len(line) == 0 {
+			break
+		}
+		key, value, ok := bytes.Cut(line, []byte{':'})
+		if !ok {
+			continue
+		}
+		request.Header.Add(string(bytes.TrimSpace(key)), string(bytes.TrimSpace(value)))
+	}
+
+	target := requestLine[1]
+	if strings.HasPrefix(target, "/") {
+		if h := request.Header.Get("Host"); h != "" {
+			host = h
+		}
+		target = "http://" + host + target
+	}
+	request.URL = target
+	return request, nil
+}
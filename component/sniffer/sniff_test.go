@@ -190,3 +190,25 @@ func TestTLSHeaders(t *testing.T) {
 		assert.Equal(t, input, test.input)
 	}
 }
+
+func TestHTTPRequest(t *testing.T) {
+	request, err := ParseHTTPRequest([]byte("POST /ads/1?x=y HTTP/1.1\r\nHost: example.com\r\nuser-agent: curl/8.0\r\nCookie: a"), "1.2.3.4")
+	assert.NoError(t, err)
+	assert.Equal(t, "POST", request.Method)
+	assert.Equal(t, "http://example.com/ads/1?x=y", request.URL)
+	assert.Equal(t, "curl/8.0", request.Header.Get("User-Agent"))
+	assert.Empty(t, request.Header.Get("Cookie"), "the truncated line is skipped")
+
+	request, err = ParseHTTPRequest([]byte("GET http://example.org/ HTTP/1.1\r\n\r\n"), "1.2.3.4")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.org/", request.URL)
+
+	request, err = ParseHTTPRequest([]byte("GET / HTTP/1.0\r\n\r\n"), "1.2.3.4:8080")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://1.2.3.4:8080/", request.URL)
+
+	_, err = ParseHTTPRequest([]byte("GET / HTT"), "1.2.3.4")
+	assert.Error(t, err)
+	_, err = ParseHTTPRequest([]byte("\x16\x03\x01"), "1.2.3.4")
+	assert.Error(t, err)
+}
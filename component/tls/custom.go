@@ -0,0 +1,422 @@
+package tls
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gaukas/godicttls"
+	utls "github.com/sagernet/utls"
+)
+
+// CustomFingerprint describes a ClientHello defined by user, ClientHelloSpec
+// build a fresh utls.ClientHelloSpec for every connection since extensions are stateful.
+type CustomFingerprint struct {
+	TLSVersMin          uint16
+	TLSVersMax          uint16
+	CipherSuites        []uint16
+	Extensions          []uint16
+	Curves              []uint16
+	PointFormats        []uint8
+	SignatureAlgorithms []uint16
+	ALPN                []string
+}
+
+type CustomFingerprintOption struct {
+	JA3                 string
+	GREASE              bool
+	CipherSuites        []string
+	Extensions          []string
+	Curves              []string
+	PointFormats        []string
+	SignatureAlgorithms []string
+	ALPN                []string
+	Padding             bool
+	MinVersion          string
+	MaxVersion          string
+}
+
+var (
+	customFingerprints      = map[string]*CustomFingerprint{}
+	customFingerprintsMutex sync.RWMutex
+
+	defaultALPN                = []string{"h2", "http/1.1"}
+	defaultSignatureAlgorithms = []uint16{
+		uint16(utls.ECDSAWithP256AndSHA256),
+		uint16(utls.PSSWithSHA256),
+		uint16(utls.PKCS1WithSHA256),
+		uint16(utls.ECDSAWithP384AndSHA384),
+		uint16(utls.PSSWithSHA384),
+		uint16(utls.PKCS1WithSHA384),
+		uint16(utls.PSSWithSHA512),
+		uint16(utls.PKCS1WithSHA512),
+	}
+	curveAliases = map[string]uint16{
+		"p-256": uint16(utls.CurveP256),
+		"p-384": uint16(utls.CurveP384),
+		"p-521": uint16(utls.CurveP521),
+	}
+)
+
+const (
+	extensionPadding          = 21
+	extensionPreSharedKey     = 41
+	extensionSupportedVersion = 43
+)
+
+// SetCustomFingerprints replace all custom fingerprints, names must not conflict with the builtin ones
+func SetCustomFingerprints(fingerprints map[string]*CustomFingerprint) {
+	customFingerprintsMutex.Lock()
+	defer customFingerprintsMutex.Unlock()
+	customFingerprints = fingerprints
+}
+
+func getCustomFingerprint(name string) (*CustomFingerprint, bool) {
+	customFingerprintsMutex.RLock()
+	defer customFingerprintsMutex.RUnlock()
+	fingerprint, ok := customFingerprints[name]
+	return fingerprint, ok
+}
+
+func ParseCustomFingerprint(name string, option CustomFingerprintOption) (*CustomFingerprint, error) {
+	if _, ok := Fingerprints[name]; ok || name == "none" {
+		return nil, fmt.Errorf("client fingerprint %s conflicts with the builtin one", name)
+	}
+
+	var fingerprint *CustomFingerprint
+	var err error
+	if option.JA3 != "" {
+		fingerprint, err = ParseJA3(option.JA3)
+	} else {
+		fingerprint, err = parseSpecOption(option)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("client fingerprint %s: %w", name, err)
+	}
+
+	if len(option.ALPN) > 0 {
+		fingerprint.ALPN = option.ALPN
+	}
+	if len(option.SignatureAlgorithms) > 0 && option.JA3 != "" {
+		fingerprint.SignatureAlgorithms, err = parseList(option.SignatureAlgorithms, godicttls.DictSignatureSchemeNameIndexed)
+		if err != nil {
+			return nil, fmt.Errorf("client fingerprint %s: %w", name, err)
+		}
+	}
+	if option.GREASE {
+		fingerprint.addGREASE()
+	}
+	if option.Padding && !containsUint16(fingerprint.Extensions, extensionPadding) {
+		fingerprint.Extensions = append(fingerprint.Extensions, extensionPadding)
+	}
+
+	// make sure the spec can be applied before any connection use it
+	uConn := utls.UClient(nil, &utls.Config{ServerName: "example.com"}, utls.HelloCustom)
+	if err = uConn.ApplyPreset(fingerprint.ClientHelloSpec()); err != nil {
+		return nil, fmt.Errorf("client fingerprint %s: %w", name, err)
+	}
+	return fingerprint, nil
+}
+
+// ParseJA3 parse a JA3 string "SSLVersion,Ciphers,Extensions,EllipticCurves,EllipticCurvePointFormats"
+func ParseJA3(ja3 string) (*CustomFingerprint, error) {
+	fields := strings.Split(strings.TrimSpace(ja3), ",")
+	if len(fields) != 5 {
+		return nil, errors.New("invalid JA3 string, need 5 fields")
+	}
+	version, err := strconv.ParseUint(fields[0], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JA3 version: %w", err)
+	}
+	fingerprint := &CustomFingerprint{
+		TLSVersMin: utls.VersionTLS10,
+		TLSVersMax: uint16(version),
+	}
+	if fingerprint.CipherSuites, err = parseJA3Field(fields[1], 16); err != nil {
+		return nil, fmt.Errorf("invalid JA3 ciphers: %w", err)
+	}
+	if fingerprint.Extensions, err = parseJA3Field(fields[2], 16); err != nil {
+		return nil, fmt.Errorf("invalid JA3 extensions: %w", err)
+	}
+	if fingerprint.Curves, err = parseJA3Field(fields[3], 16); err != nil {
+		return nil, fmt.Errorf("invalid JA3 curves: %w", err)
+	}
+	pointFormats, err := parseJA3Field(fields[4], 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JA3 point formats: %w", err)
+	}
+	for _, pointFormat := range pointFormats {
+		fingerprint.PointFormats = append(fingerprint.PointFormats, uint8(pointFormat))
+	}
+	if containsUint16(fingerprint.Extensions, extensionSupportedVersion) {
+		// JA3 records the legacy version, supported_versions decides the real one
+		fingerprint.TLSVersMin = utls.VersionTLS12
+		fingerprint.TLSVersMax = utls.VersionTLS13
+	}
+	return fingerprint, nil
+}
+
+func parseJA3Field(field string, bitSize int) ([]uint16, error) {
+	if field == "" {
+		return nil, nil
+	}
+	var values []uint16
+	for _, s := range strings.Split(field, "-") {
+		value, err := strconv.ParseUint(s, 10, bitSize)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, uint16(value))
+	}
+	return values, nil
+}
+
+func parseSpecOption(option CustomFingerprintOption) (fingerprint *CustomFingerprint, err error) {
+	fingerprint = &CustomFingerprint{
+		TLSVersMin: utls.VersionTLS12,
+		TLSVersMax: utls.VersionTLS13,
+	}
+	if len(option.CipherSuites) == 0 || len(option.Extensions) == 0 {
+		return nil, errors.New("cipher-suites and extensions are required")
+	}
+	if fingerprint.CipherSuites, err = parseList(option.CipherSuites, godicttls.DictCipherSuiteNameIndexed); err != nil {
+		return nil, err
+	}
+	if fingerprint.Extensions, err = parseList(option.Extensions, godicttls.DictExtTypeNameIndexed); err != nil {
+		return nil, err
+	}
+	curveNames := make(map[string]uint16, len(godicttls.DictSupportedGroupsNameIndexed)+len(curveAliases))
+	for k, v := range godicttls.DictSupportedGroupsNameIndexed {
+		curveNames[k] = v
+	}
+	for k, v := range curveAliases {
+		curveNames[k] = v
+	}
+	if fingerprint.Curves, err = parseList(option.Curves, curveNames); err != nil {
+		return nil, err
+	}
+	pointFormats, err := parseList(option.PointFormats, func() map[string]uint16 {
+		m := make(map[string]uint16, len(godicttls.DictECPointFormatNameIndexed))
+		for k, v := range godicttls.DictECPointFormatNameIndexed {
+			m[k] = uint16(v)
+		}
+		return m
+	}())
+	if err != nil {
+		return nil, err
+	}
+	for _, pointFormat := range pointFormats {
+		fingerprint.PointFormats = append(fingerprint.PointFormats, uint8(pointFormat))
+	}
+	if fingerprint.SignatureAlgorithms, err = parseList(option.SignatureAlgorithms, godicttls.DictSignatureSchemeNameIndexed); err != nil {
+		return nil, err
+	}
+	if option.MinVersion != "" {
+		if fingerprint.TLSVersMin, err = parseVersion(option.MinVersion); err != nil {
+			return nil, err
+		}
+	}
+	if option.MaxVersion != "" {
+		if fingerprint.TLSVersMax, err = parseVersion(option.MaxVersion); err != nil {
+			return nil, err
+		}
+	}
+	return fingerprint, nil
+}
+
+// parseList accept IANA names, decimal or hex numbers and "GREASE"
+func parseList(values []string, names map[string]uint16) ([]uint16, error) {
+	var result []uint16
+	for _, value := range values {
+		if strings.EqualFold(value, "GREASE") {
+			result = append(result, utls.GREASE_PLACEHOLDER)
+			continue
+		}
+		if id, ok := names[value]; ok {
+			result = append(result, id)
+			continue
+		}
+		if id, ok := names[strings.ToLower(value)]; ok {
+			result = append(result, id)
+			continue
+		}
+		id, err := strconv.ParseUint(value, 0, 16)
+		if err != nil {
+			return nil, fmt.Errorf("unknown value: %s", value)
+		}
+		result = append(result, uint16(id))
+	}
+	return result, nil
+}
+
+func parseVersion(version string) (uint16, error) {
+	switch version {
+	case "1.0":
+		return utls.VersionTLS10, nil
+	case "1.1":
+		return utls.VersionTLS11, nil
+	case "1.2":
+		return utls.VersionTLS12, nil
+	case "1.3":
+		return utls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unknown tls version: %s", version)
+	}
+}
+
+// addGREASE place GREASE values the way BoringSSL does, JA3 strings never contain them
+func (f *CustomFingerprint) addGREASE() {
+	if !isGREASE(firstOrZero(f.CipherSuites)) {
+		f.CipherSuites = append([]uint16{utls.GREASE_PLACEHOLDER}, f.CipherSuites...)
+	}
+	if !isGREASE(firstOrZero(f.Curves)) {
+		f.Curves = append([]uint16{utls.GREASE_PLACEHOLDER}, f.Curves...)
+	}
+	if !isGREASE(firstOrZero(f.Extensions)) {
+		f.Extensions = append([]uint16{utls.GREASE_PLACEHOLDER}, f.Extensions...)
+		// the second GREASE extension goes before padding (or pre_shared_key), or at the end
+		index := len(f.Extensions)
+		for i, id := range f.Extensions {
+			if id == extensionPadding || id == extensionPreSharedKey {
+				index = i
+				break
+			}
+		}
+		f.Extensions = append(f.Extensions[:index], append([]uint16{utls.GREASE_PLACEHOLDER}, f.Extensions[index:]...)...)
+	}
+}
+
+func (f *CustomFingerprint) ClientHelloSpec() *utls.ClientHelloSpec {
+	spec := &utls.ClientHelloSpec{
+		TLSVersMin:         f.TLSVersMin,
+		TLSVersMax:         f.TLSVersMax,
+		CipherSuites:       append([]uint16(nil), f.CipherSuites...),
+		CompressionMethods: []uint8{0}, // no compression
+	}
+
+	alpn := f.ALPN
+	if len(alpn) == 0 {
+		alpn = defaultALPN
+	}
+	sigAlgs := f.SignatureAlgorithms
+	if len(sigAlgs) == 0 {
+		sigAlgs = defaultSignatureAlgorithms
+	}
+	signatureSchemes := make([]utls.SignatureScheme, 0, len(sigAlgs))
+	for _, sigAlg := range sigAlgs {
+		signatureSchemes = append(signatureSchemes, utls.SignatureScheme(sigAlg))
+	}
+	curves := make([]utls.CurveID, 0, len(f.Curves))
+	for _, curve := range f.Curves {
+		curves = append(curves, utls.CurveID(curve))
+	}
+	if len(curves) == 0 {
+		curves = []utls.CurveID{utls.X25519, utls.CurveP256}
+	}
+
+	for _, id := range f.Extensions {
+		var extension utls.TLSExtension
+		switch {
+		case isGREASE(id):
+			extension = &utls.UtlsGREASEExtension{}
+		case id == 10:
+			extension = &utls.SupportedCurvesExtension{Curves: curves}
+		case id == 11:
+			pointFormats := f.PointFormats
+			if len(pointFormats) == 0 {
+				pointFormats = []uint8{0}
+			}
+			extension = &utls.SupportedPointsExtension{SupportedPoints: pointFormats}
+		case id == 13:
+			extension = &utls.SignatureAlgorithmsExtension{SupportedSignatureAlgorithms: signatureSchemes}
+		case id == 16:
+			extension = &utls.ALPNExtension{AlpnProtocols: alpn}
+		case id == extensionPadding:
+			extension = &utls.UtlsPaddingExtension{GetPaddingLen: utls.BoringPaddingStyle}
+		case id == 27:
+			extension = &utls.UtlsCompressCertExtension{Algorithms: []utls.CertCompressionAlgo{utls.CertCompressionBrotli}}
+		case id == 28:
+			extension = &utls.FakeRecordSizeLimitExtension{Limit: 0x4001}
+		case id == 34:
+			extension = &utls.FakeDelegatedCredentialsExtension{SupportedSignatureAlgorithms: []utls.SignatureScheme{
+				utls.ECDSAWithP256AndSHA256,
+				utls.ECDSAWithP384AndSHA384,
+				utls.ECDSAWithP521AndSHA512,
+				utls.ECDSAWithSHA1,
+			}}
+		case id == extensionPreSharedKey:
+			// a real pre_shared_key requires a session, skip it
+			continue
+		case id == extensionSupportedVersion:
+			extension = &utls.SupportedVersionsExtension{Versions: f.supportedVersions()}
+		case id == 45:
+			extension = &utls.PSKKeyExchangeModesExtension{Modes: []uint8{utls.PskModeDHE}}
+		case id == 50:
+			extension = &utls.SignatureAlgorithmsCertExtension{SupportedSignatureAlgorithms: signatureSchemes}
+		case id == 51:
+			extension = &utls.KeyShareExtension{KeyShares: keyShares(curves)}
+		case id == 17513:
+			extension = &utls.ApplicationSettingsExtension{SupportedProtocols: []string{"h2"}}
+		case id == 65281:
+			extension = &utls.RenegotiationInfoExtension{Renegotiation: utls.RenegotiateOnceAsClient}
+		default:
+			extension = utls.ExtensionFromID(id)
+			if extension == nil {
+				extension = &utls.GenericExtension{Id: id}
+			}
+		}
+		spec.Extensions = append(spec.Extensions, extension)
+	}
+	return spec
+}
+
+func (f *CustomFingerprint) supportedVersions() []uint16 {
+	var versions []uint16
+	if isGREASE(firstOrZero(f.CipherSuites)) {
+		versions = append(versions, utls.GREASE_PLACEHOLDER)
+	}
+	for version := f.TLSVersMax; version >= f.TLSVersMin && version >= utls.VersionTLS10; version-- {
+		versions = append(versions, version)
+	}
+	return versions
+}
+
+// keyShares send a GREASE share if curves start with GREASE, then a real share for the first usable curve
+func keyShares(curves []utls.CurveID) []utls.KeyShare {
+	var shares []utls.KeyShare
+	for _, curve := range curves {
+		if isGREASE(uint16(curve)) {
+			if len(shares) == 0 {
+				shares = append(shares, utls.KeyShare{Group: utls.CurveID(utls.GREASE_PLACEHOLDER), Data: []byte{0}})
+			}
+			continue
+		}
+		switch curve {
+		case utls.X25519, utls.CurveP256, utls.CurveP384, utls.CurveP521, utls.X25519Kyber768Draft00:
+			return append(shares, utls.KeyShare{Group: curve})
+		}
+	}
+	return append(shares, utls.KeyShare{Group: utls.X25519})
+}
+
+func isGREASE(value uint16) bool {
+	return value&0x0f0f == 0x0a0a && value>>8 == value&0xff
+}
+
+func firstOrZero(values []uint16) uint16 {
+	if len(values) == 0 {
+		return 0
+	}
+	return values[0]
+}
+
+func containsUint16(values []uint16, target uint16) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package tls
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	utls "github.com/sagernet/utls"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const chromeJA3 = "771,4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53,0-23-65281-10-11-35-16-5-13-18-51-45-43-27-17513-21,29-23-24,0"
+
+func TestParseJA3(t *testing.T) {
+	fingerprint, err := ParseJA3(chromeJA3)
+	require.NoError(t, err)
+	assert.Len(t, fingerprint.CipherSuites, 15)
+	assert.Equal(t, []uint16{29, 23, 24}, fingerprint.Curves)
+	assert.Equal(t, []uint8{0}, fingerprint.PointFormats)
+	assert.EqualValues(t, tls.VersionTLS13, fingerprint.TLSVersMax)
+
+	_, err = ParseJA3("771,4865,0")
+	assert.Error(t, err)
+	_, err = ParseJA3("771,4865,0-99999,29,0")
+	assert.Error(t, err)
+}
+
+func TestParseCustomFingerprint(t *testing.T) {
+	fingerprint, err := ParseCustomFingerprint("my-chrome", CustomFingerprintOption{JA3: chromeJA3, GREASE: true})
+	require.NoError(t, err)
+	assert.True(t, isGREASE(fingerprint.CipherSuites[0]))
+	assert.True(t, isGREASE(fingerprint.Extensions[0]))
+	// the second GREASE extension is placed before padding
+	assert.True(t, isGREASE(fingerprint.Extensions[len(fingerprint.Extensions)-2]))
+	assert.EqualValues(t, extensionPadding, fingerprint.Extensions[len(fingerprint.Extensions)-1])
+
+	fingerprint, err = ParseCustomFingerprint("my-spec", CustomFingerprintOption{
+		CipherSuites: []string{"GREASE", "TLS_AES_128_GCM_SHA256", "0xc02b"},
+		Extensions:   []string{"server_name", "supported_groups", "key_share", "supported_versions", "signature_algorithms", "application_layer_protocol_negotiation"},
+		Curves:       []string{"X25519", "P-256"},
+		ALPN:         []string{"http/1.1"},
+		Padding:      true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{0x0a0a, 0x1301, 0xc02b}, fingerprint.CipherSuites)
+	assert.Equal(t, []uint16{29, 23}, fingerprint.Curves)
+	assert.EqualValues(t, extensionPadding, fingerprint.Extensions[len(fingerprint.Extensions)-1])
+
+	_, err = ParseCustomFingerprint("chrome", CustomFingerprintOption{JA3: chromeJA3})
+	assert.Error(t, err)
+	_, err = ParseCustomFingerprint("bad", CustomFingerprintOption{CipherSuites: []string{"NOT_A_CIPHER"}, Extensions: []string{"server_name"}})
+	assert.Error(t, err)
+}
+
+func TestCustomFingerprintHandshake(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		NextProtos:   []string{"h2"},
+	})
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.(*tls.Conn).Handshake()
+	}()
+
+	custom, err := ParseCustomFingerprint("my-chrome", CustomFingerprintOption{JA3: chromeJA3, GREASE: true})
+	require.NoError(t, err)
+	SetCustomFingerprints(map[string]*CustomFingerprint{"my-chrome": custom})
+	defer SetCustomFingerprints(nil)
+
+	fingerprint, ok := GetFingerprint("my-chrome")
+	require.True(t, ok)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	uConn := UClient(conn, &tls.Config{ServerName: "example.com", InsecureSkipVerify: true}, fingerprint)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, uConn.HandshakeContext(ctx))
+	assert.Equal(t, "h2", uConn.ConnectionState().NegotiatedProtocol)
+}
+
+func TestCustomFingerprintFallback(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	// no cipher suite nor extension, utls refuses the spec
+	fingerprint := UClientHelloID{ClientHelloID: &utls.HelloCustom, Custom: &CustomFingerprint{TLSVersMin: tls.VersionTLS13, TLSVersMax: tls.VersionTLS12}}
+	conn := UClient(client, &tls.Config{ServerName: "example.com"}, fingerprint)
+	assert.Equal(t, utls.HelloChrome_Auto, conn.ClientHelloID)
+}
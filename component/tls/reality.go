@@ -61,7 +61,11 @@ func GetRealityConn(ctx context.Context, conn net.Conn, ClientFingerprint string
 		}
 		uConn := utls.UClient(conn, uConfig, clientID)
 		verifier.UConn = uConn
-		err := uConn.BuildHandshakeState()
+		err := fingerprint.ApplyPreset(uConn)
+		if err != nil {
+			return nil, err
+		}
+		err = uConn.BuildHandshakeState()
 		if err != nil {
 			return nil, err
 		}
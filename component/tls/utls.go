@@ -16,6 +16,7 @@ type UConn struct {
 
 type UClientHelloID struct {
 	*utls.ClientHelloID
+	Custom *CustomFingerprint
 }
 
 var initRandomFingerprint UClientHelloID
@@ -27,9 +28,22 @@ func UClient(c net.Conn, config *tls.Config, fingerprint UClientHelloID) *UConn
 		Version: fingerprint.Version,
 		Seed:    fingerprint.Seed,
 	})
+	if err := fingerprint.ApplyPreset(utlsConn); err != nil {
+		// HelloCustom without the spec sends a broken ClientHello, which is easy to fingerprint
+		log.Errorln("apply custom fingerprint %s failed, fall back to chrome: %s", fingerprint.Client, err)
+		utlsConn = utls.UClient(c, copyConfig(config), utls.HelloChrome_Auto)
+	}
 	return &UConn{UConn: utlsConn}
 }
 
+// ApplyPreset applies the custom ClientHelloSpec, it's a no-op for builtin fingerprints
+func (f UClientHelloID) ApplyPreset(uConn *utls.UConn) error {
+	if f.Custom == nil {
+		return nil
+	}
+	return uConn.ApplyPreset(f.Custom.ClientHelloSpec())
+}
+
 func GetFingerprint(ClientFingerprint string) (UClientHelloID, bool) {
 	if ClientFingerprint == "none" {
 		return UClientHelloID{}, false
@@ -48,6 +62,9 @@ func GetFingerprint(ClientFingerprint string) (UClientHelloID, bool) {
 	if ok {
 		log.Debugln("use specified fingerprint:%s", fingerprint.Client)
 		return fingerprint, ok
+	} else if custom, ok := getCustomFingerprint(ClientFingerprint); ok {
+		log.Debugln("use custom fingerprint:%s", ClientFingerprint)
+		return UClientHelloID{ClientHelloID: &utls.HelloCustom, Custom: custom}, true
 	} else {
 		log.Warnln("wrong ClientFingerprint:%s", ClientFingerprint)
 		return UClientHelloID{}, false
@@ -68,21 +85,21 @@ func RollFingerprint() (UClientHelloID, bool) {
 }
 
 var Fingerprints = map[string]UClientHelloID{
-	"chrome":                     {&utls.HelloChrome_Auto},
-	"chrome_psk":                 {&utls.HelloChrome_100_PSK},
-	"chrome_psk_shuffle":         {&utls.HelloChrome_106_Shuffle},
-	"chrome_padding_psk_shuffle": {&utls.HelloChrome_114_Padding_PSK_Shuf},
-	"chrome_pq":                  {&utls.HelloChrome_115_PQ},
-	"chrome_pq_psk":              {&utls.HelloChrome_115_PQ_PSK},
-	"firefox":                    {&utls.HelloFirefox_Auto},
-	"safari":                     {&utls.HelloSafari_Auto},
-	"ios":                        {&utls.HelloIOS_Auto},
-	"android":                    {&utls.HelloAndroid_11_OkHttp},
-	"edge":                       {&utls.HelloEdge_Auto},
-	"360":                        {&utls.Hello360_Auto},
-	"qq":                         {&utls.HelloQQ_Auto},
-	"random":                     {nil},
-	"randomized":                 {nil},
+	"chrome":                     {ClientHelloID: &utls.HelloChrome_Auto},
+	"chrome_psk":                 {ClientHelloID: &utls.HelloChrome_100_PSK},
+	"chrome_psk_shuffle":         {ClientHelloID: &utls.HelloChrome_106_Shuffle},
+	"chrome_padding_psk_shuffle": {ClientHelloID: &utls.HelloChrome_114_Padding_PSK_Shuf},
+	"chrome_pq":                  {ClientHelloID: &utls.HelloChrome_115_PQ},
+	"chrome_pq_psk":              {ClientHelloID: &utls.HelloChrome_115_PQ_PSK},
+	"firefox":                    {ClientHelloID: &utls.HelloFirefox_Auto},
+	"safari":                     {ClientHelloID: &utls.HelloSafari_Auto},
+	"ios":                        {ClientHelloID: &utls.HelloIOS_Auto},
+	"android":                    {ClientHelloID: &utls.HelloAndroid_11_OkHttp},
+	"edge":                       {ClientHelloID: &utls.HelloEdge_Auto},
+	"360":                        {ClientHelloID: &utls.Hello360_Auto},
+	"qq":                         {ClientHelloID: &utls.HelloQQ_Auto},
+	"random":                     {ClientHelloID: nil},
+	"randomized":                 {ClientHelloID: nil},
 }
 
 func init() {
@@ -92,11 +109,12 @@ func init() {
 	randomized := utls.HelloRandomized
 	randomized.Seed, _ = utls.NewPRNGSeed()
 	randomized.Weights = &weights
-	Fingerprints["randomized"] = UClientHelloID{&randomized}
+	Fingerprints["randomized"] = UClientHelloID{ClientHelloID: &randomized}
 }
 
 func copyConfig(c *tls.Config) *utls.Config {
 	return &utls.Config{
+		Certificates:          CopyCertificates(c.Certificates),
 		RootCAs:               c.RootCAs,
 		ServerName:            c.ServerName,
 		InsecureSkipVerify:    c.InsecureSkipVerify,
@@ -104,6 +122,24 @@ func copyConfig(c *tls.Config) *utls.Config {
 	}
 }
 
+// CopyCertificates converts client certificates for uTLS
+func CopyCertificates(certificates []tls.Certificate) []utls.Certificate {
+	if len(certificates) == 0 {
+		return nil
+	}
+	uCertificates := make([]utls.Certificate, 0, len(certificates))
+	for _, cert := range certificates {
+		uCertificates = append(uCertificates, utls.Certificate{
+			Certificate:                 cert.Certificate,
+			PrivateKey:                  cert.PrivateKey,
+			OCSPStaple:                  cert.OCSPStaple,
+			SignedCertificateTimestamps: cert.SignedCertificateTimestamps,
+			Leaf:                        cert.Leaf,
+		})
+	}
+	return uCertificates
+}
+
 // BuildWebsocketHandshakeState it will only send http/1.1 in its ALPN.
 // Copy from https://github.com/XTLS/Xray-core/blob/main/transport/internet/tls/tls.go
 func (c *UConn) BuildWebsocketHandshakeState() error {
@@ -0,0 +1,245 @@
+// Package verify checks the downloaded core packages, UIs and geodata files against
+// the sidecar files published next to them: <url>.sha256sum (or <url>.sha256) with
+// the hex sha256 of the file, and <url>.minisig (minisign) or <url>.sig (a base64
+// Ed25519 signature) when a public key is set.
+package verify
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	mihomoHttp "github.com/metacubex/mihomo/component/http"
+	C "github.com/metacubex/mihomo/constant"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// maxSidecarSize bounds the checksum and signature files
+const maxSidecarSize = 4096
+
+var (
+	mu        sync.RWMutex
+	checksum  bool
+	publicKey *PublicKey
+)
+
+// PublicKey is a minisign public key, or a raw Ed25519 one without keyID
+type PublicKey struct {
+	minisign bool
+	keyID    [8]byte
+	key      ed25519.PublicKey
+}
+
+// ParsePublicKey parses the base64 of a minisign public key (the second line of the
+// .pub file) or of a raw 32 bytes Ed25519 public key
+func ParsePublicKey(s string) (*PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	switch {
+	case len(raw) == ed25519.PublicKeySize:
+		return &PublicKey{key: raw}, nil
+	case len(raw) == 2+8+ed25519.PublicKeySize && string(raw[:2]) == "Ed":
+		pk := &PublicKey{minisign: true, key: raw[10:]}
+		copy(pk.keyID[:], raw[2:10])
+		return pk, nil
+	default:
+		return nil, errors.New("invalid public key: neither minisign nor Ed25519")
+	}
+}
+
+// SetPolicy sets whether the checksums are required and the key the signatures are
+// required with, nil not to check them
+func SetPolicy(requireChecksum bool, key *PublicKey) {
+	mu.Lock()
+	defer mu.Unlock()
+	checksum = requireChecksum
+	publicKey = key
+}
+
+// Enabled reports whether the downloads are verified at all
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return checksum || publicKey != nil
+}
+
+// Verify checks data downloaded from url against its sidecar files, it does nothing
+// when neither the checksums nor the signatures are required
+func Verify(ctx context.Context, url string, data []byte) error {
+	mu.RLock()
+	requireChecksum, key := checksum, publicKey
+	mu.RUnlock()
+
+	if requireChecksum {
+		if err := verifyChecksum(ctx, url, data); err != nil {
+			return err
+		}
+	}
+	if key != nil {
+		suffix := ".sig"
+		if key.minisign {
+			suffix = ".minisig"
+		}
+		signature, err := fetch(ctx, url+suffix)
+		if err != nil {
+			return fmt.Errorf("can't download the signature: %w", err)
+		}
+		if err := key.Verify(data, signature); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Download downloads url and verifies it
+func Download(ctx context.Context, url string) ([]byte, error) {
+	data, err := fetchAll(ctx, url, -1)
+	if err != nil {
+		return nil, err
+	}
+	if err := Verify(ctx, url, data); err != nil {
+		return nil, fmt.Errorf("%s: %w", url, err)
+	}
+	return data, nil
+}
+
+// DownloadFile downloads url, verifies it and then replaces path with it, path is
+// left intact when any step fails
+func DownloadFile(ctx context.Context, url, path string) error {
+	data, err := Download(ctx, url)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func verifyChecksum(ctx context.Context, url string, data []byte) error {
+	sum, err := fetch(ctx, url+".sha256sum")
+	if err != nil {
+		var err2 error
+		if sum, err2 = fetch(ctx, url+".sha256"); err2 != nil {
+			return fmt.Errorf("can't download the checksum: %w", err)
+		}
+	}
+	return VerifyChecksum(data, sum)
+}
+
+// VerifyChecksum checks data against a sha256sum file, the first field of which is
+// the hex digest
+func VerifyChecksum(data, sum []byte) error {
+	fields := strings.Fields(string(sum))
+	if len(fields) == 0 {
+		return errors.New("empty checksum")
+	}
+	expected, err := hex.DecodeString(fields[0])
+	if err != nil || len(expected) != sha256.Size {
+		return fmt.Errorf("invalid checksum %q", fields[0])
+	}
+	actual := sha256.Sum256(data)
+	if !bytes.Equal(actual[:], expected) {
+		return fmt.Errorf("checksum mismatch, expected %x, got %x", expected, actual)
+	}
+	return nil
+}
+
+// Verify checks a minisign signature file, or a base64 (or raw) Ed25519 signature
+// for a raw key
+func (pk *PublicKey) Verify(data, signature []byte) error {
+	if !pk.minisign {
+		raw := signature
+		if len(raw) != ed25519.SignatureSize {
+			var err error
+			if raw, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature))); err != nil {
+				return fmt.Errorf("invalid signature: %w", err)
+			}
+		}
+		if !ed25519.Verify(pk.key, data, raw) {
+			return errors.New("signature mismatch")
+		}
+		return nil
+	}
+
+	// untrusted comment, signature, trusted comment, global signature
+	lines := strings.Split(strings.ReplaceAll(string(signature), "\r", ""), "\n")
+	if len(lines) < 4 {
+		return errors.New("invalid minisign signature")
+	}
+	sig, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(sig) != 2+8+ed25519.SignatureSize {
+		return errors.New("invalid minisign signature")
+	}
+	if !bytes.Equal(sig[2:10], pk.keyID[:]) {
+		return errors.New("signed with another key")
+	}
+	message := data
+	switch string(sig[:2]) {
+	case "Ed":
+	case "ED":
+		digest := blake2b.Sum512(data)
+		message = digest[:]
+	default:
+		return fmt.Errorf("unsupported signature algorithm %q", sig[:2])
+	}
+	if !ed25519.Verify(pk.key, message, sig[10:]) {
+		return errors.New("signature mismatch")
+	}
+
+	trustedComment, ok := strings.CutPrefix(lines[2], "trusted comment: ")
+	if !ok {
+		return errors.New("invalid minisign trusted comment")
+	}
+	globalSig, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return errors.New("invalid minisign global signature")
+	}
+	signed := make([]byte, 0, ed25519.SignatureSize+len(trustedComment))
+	signed = append(append(signed, sig[10:]...), trustedComment...)
+	if !ed25519.Verify(pk.key, signed, globalSig) {
+		return errors.New("trusted comment signature mismatch")
+	}
+	return nil
+}
+
+func fetch(ctx context.Context, url string) ([]byte, error) {
+	return fetchAll(ctx, url, maxSidecarSize)
+}
+
+func fetchAll(ctx context.Context, url string, limit int64) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*90)
+	defer cancel()
+	resp, err := mihomoHttp.HttpRequest(ctx, url, http.MethodGet, http.Header{"User-Agent": {C.UA}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var body io.Reader = resp.Body
+	if limit >= 0 {
+		body = io.LimitReader(body, limit)
+	}
+	return io.ReadAll(body)
+}
@@ -0,0 +1,72 @@
+package verify
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/blake2b"
+)
+
+func TestVerifyChecksum(t *testing.T) {
+	data := []byte("geosite")
+	sum := sha256.Sum256(data)
+
+	assert.NoError(t, VerifyChecksum(data, []byte(hex.EncodeToString(sum[:])+"  geosite.dat\n")))
+	assert.Error(t, VerifyChecksum([]byte("geoip"), []byte(hex.EncodeToString(sum[:]))))
+	assert.Error(t, VerifyChecksum(data, []byte("deadbeef")))
+	assert.Error(t, VerifyChecksum(data, nil))
+}
+
+func TestEd25519(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	pk, err := ParsePublicKey(base64.StdEncoding.EncodeToString(pub))
+	require.NoError(t, err)
+
+	data := []byte("mihomo-linux-amd64.gz")
+	signature := ed25519.Sign(priv, data)
+	assert.NoError(t, pk.Verify(data, signature))
+	assert.NoError(t, pk.Verify(data, []byte(base64.StdEncoding.EncodeToString(signature)+"\n")))
+	assert.Error(t, pk.Verify([]byte("mihomo-linux-arm64.gz"), signature))
+
+	_, err = ParsePublicKey("bWlob21v")
+	assert.Error(t, err)
+}
+
+func TestMinisign(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	keyID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	pk, err := ParsePublicKey(base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), pub...)))
+	require.NoError(t, err)
+
+	data := []byte("geoip.metadb")
+	sign := func(algorithm string, id []byte, trustedComment string) []byte {
+		message := data
+		if algorithm == "ED" {
+			digest := blake2b.Sum512(data)
+			message = digest[:]
+		}
+		signature := ed25519.Sign(priv, message)
+		globalSignature := ed25519.Sign(priv, append(append([]byte{}, signature...), trustedComment...))
+		return []byte(fmt.Sprintf("untrusted comment: signature from minisign secret key\n%s\ntrusted comment: %s\n%s\n",
+			base64.StdEncoding.EncodeToString(append(append([]byte(algorithm), id...), signature...)),
+			trustedComment,
+			base64.StdEncoding.EncodeToString(globalSignature)))
+	}
+
+	assert.NoError(t, pk.Verify(data, sign("Ed", keyID, "timestamp:1700000000")))
+	assert.NoError(t, pk.Verify(data, sign("ED", keyID, "timestamp:1700000000\tfile:geoip.metadb")))
+	assert.Error(t, pk.Verify([]byte("geosite.dat"), sign("ED", keyID, "")))
+	assert.Error(t, pk.Verify(data, sign("ED", []byte{8, 7, 6, 5, 4, 3, 2, 1}, "")))
+
+	tampered := strings.Replace(string(sign("ED", keyID, "timestamp:1700000000")), "1700000000", "1800000000", 1)
+	assert.Error(t, pk.Verify(data, []byte(tampered)))
+}
@@ -20,14 +20,18 @@ import (
 	N "github.com/metacubex/mihomo/common/net"
 	"github.com/metacubex/mihomo/common/utils"
 	"github.com/metacubex/mihomo/component/auth"
+	"github.com/metacubex/mihomo/component/ca"
+	"github.com/metacubex/mihomo/component/dialer"
 	"github.com/metacubex/mihomo/component/fakeip"
 	"github.com/metacubex/mihomo/component/geodata"
 	"github.com/metacubex/mihomo/component/geodata/router"
+	"github.com/metacubex/mihomo/component/mitm"
 	P "github.com/metacubex/mihomo/component/process"
 	"github.com/metacubex/mihomo/component/resolver"
 	SNIFF "github.com/metacubex/mihomo/component/sniffer"
 	tlsC "github.com/metacubex/mihomo/component/tls"
 	"github.com/metacubex/mihomo/component/trie"
+	"github.com/metacubex/mihomo/component/verify"
 	C "github.com/metacubex/mihomo/constant"
 	"github.com/metacubex/mihomo/constant/features"
 	providerTypes "github.com/metacubex/mihomo/constant/provider"
@@ -38,6 +42,7 @@ import (
 	"github.com/metacubex/mihomo/log"
 	R "github.com/metacubex/mihomo/rules"
 	RP "github.com/metacubex/mihomo/rules/provider"
+	"github.com/metacubex/mihomo/transport/congestion"
 	T "github.com/metacubex/mihomo/tunnel"
 
 	orderedmap "github.com/wk8/go-ordered-map/v2"
@@ -66,6 +71,8 @@ type General struct {
 	EBpf                    EBpf              `json:"-"`
 	GlobalClientFingerprint string            `json:"global-client-fingerprint"`
 	GlobalUA                string            `json:"global-ua"`
+
+	SourcePool *dialer.SourcePool `json:"-"`
 }
 
 // Inbound config
@@ -171,6 +178,7 @@ type Experimental struct {
 	QUICGoDisableGSO bool     `yaml:"quic-go-disable-gso"`
 	QUICGoDisableECN bool     `yaml:"quic-go-disable-ecn"`
 	IP4PEnable       bool     `yaml:"dialer-ip4p-convert"`
+	RuleCacheSize    int      `yaml:"rule-cache-size"`
 }
 
 // Config is mihomo config manager
@@ -192,6 +200,7 @@ type Config struct {
 	Tunnels       []LC.Tunnel
 	Sniffer       *Sniffer
 	TLS           *TLS
+	MITM          *mitm.MITM
 }
 
 type RawNTP struct {
@@ -313,6 +322,8 @@ type RawConfig struct {
 	Secret                  string            `yaml:"secret"`
 	Interface               string            `yaml:"interface-name"`
 	RoutingMark             int               `yaml:"routing-mark"`
+	SourceAddresses         []string          `yaml:"source-addresses"`
+	SourceAddressStrategy   string            `yaml:"source-address-strategy"`
 	Tunnels                 []LC.Tunnel       `yaml:"tunnels"`
 	GeoAutoUpdate           bool              `yaml:"geo-auto-update" json:"geo-auto-update"`
 	GeoUpdateInterval       int               `yaml:"geo-update-interval" json:"geo-update-interval"`
@@ -326,6 +337,7 @@ type RawConfig struct {
 	KeepAliveInterval       int               `yaml:"keep-alive-interval"`
 
 	Sniffer       RawSniffer                `yaml:"sniffer" json:"sniffer"`
+	MITM          RawMITM                   `yaml:"mitm"`
 	ProxyProvider map[string]map[string]any `yaml:"proxy-providers"`
 	RuleProvider  map[string]map[string]any `yaml:"rule-providers"`
 	Hosts         map[string]any            `yaml:"hosts" json:"hosts"`
@@ -338,16 +350,32 @@ type RawConfig struct {
 	Experimental  Experimental              `yaml:"experimental"`
 	Profile       Profile                   `yaml:"profile"`
 	GeoXUrl       GeoXUrl                   `yaml:"geox-url"`
+	UpdateVerify  RawUpdateVerify           `yaml:"update-verify"`
 	Proxy         []map[string]any          `yaml:"proxies"`
 	ProxyGroup    []map[string]any          `yaml:"proxy-groups"`
 	Rule          []string                  `yaml:"rules"`
 	SubRules      map[string][]string       `yaml:"sub-rules"`
+	Fingerprints  map[string]RawFingerprint `yaml:"client-fingerprints"`
 	RawTLS        TLS                       `yaml:"tls"`
 	Listeners     []map[string]any          `yaml:"listeners"`
 
 	ClashForAndroid RawClashForAndroid `yaml:"clash-for-android" json:"clash-for-android"`
 }
 
+type RawFingerprint struct {
+	JA3                 string   `yaml:"ja3" json:"ja3"`
+	GREASE              bool     `yaml:"grease" json:"grease"`
+	CipherSuites        []string `yaml:"cipher-suites" json:"cipher-suites"`
+	Extensions          []string `yaml:"extensions" json:"extensions"`
+	Curves              []string `yaml:"curves" json:"curves"`
+	PointFormats        []string `yaml:"point-formats" json:"point-formats"`
+	SignatureAlgorithms []string `yaml:"signature-algorithms" json:"signature-algorithms"`
+	ALPN                []string `yaml:"alpn" json:"alpn"`
+	Padding             bool     `yaml:"padding" json:"padding"`
+	MinVersion          string   `yaml:"min-version" json:"min-version"`
+	MaxVersion          string   `yaml:"max-version" json:"max-version"`
+}
+
 type GeoXUrl struct {
 	GeoIp   string `yaml:"geoip" json:"geoip"`
 	Mmdb    string `yaml:"mmdb" json:"mmdb"`
@@ -355,6 +383,12 @@ type GeoXUrl struct {
 	GeoSite string `yaml:"geosite" json:"geosite"`
 }
 
+// RawUpdateVerify is the verification of the downloaded core, UI and geodata files
+type RawUpdateVerify struct {
+	Checksum  bool   `yaml:"checksum"`   // require the <url>.sha256sum (or .sha256) sidecar
+	PublicKey string `yaml:"public-key"` // minisign or Ed25519 public key, require the <url>.minisig (or .sig) signature
+}
+
 type RawSniffer struct {
 	Enable          bool                         `yaml:"enable" json:"enable"`
 	OverrideDest    bool                         `yaml:"override-destination" json:"override-destination"`
@@ -367,6 +401,15 @@ type RawSniffer struct {
 	Sniff           map[string]RawSniffingConfig `yaml:"sniff" json:"sniff"`
 }
 
+type RawMITM struct {
+	Enable           bool                      `yaml:"enable"`
+	CACert           string                    `yaml:"ca-cert"`
+	CAKey            string                    `yaml:"ca-key"`
+	Hostnames        []string                  `yaml:"hostnames"`
+	Rewrites         []string                  `yaml:"rewrites"`
+	RewriteProviders map[string]map[string]any `yaml:"rewrite-providers"`
+}
+
 type RawSniffingConfig struct {
 	Ports        []string `yaml:"ports" json:"ports"`
 	OverrideDest *bool    `yaml:"override-destination" json:"override-destination"`
@@ -533,6 +576,11 @@ func ParseRawConfig(rawCfg *RawConfig) (*Config, error) {
 	}
 	config.General = general
 
+	err = parseFingerprints(rawCfg)
+	if err != nil {
+		return nil, err
+	}
+
 	if len(config.General.GlobalClientFingerprint) != 0 {
 		log.Debugln("GlobalClientFingerprint: %s", config.General.GlobalClientFingerprint)
 		tlsC.SetGlobalUtlsClient(config.General.GlobalClientFingerprint)
@@ -553,7 +601,7 @@ func ParseRawConfig(rawCfg *RawConfig) (*Config, error) {
 
 	log.Infoln("Geodata Loader mode: %s", geodata.LoaderName())
 	log.Infoln("Geosite Matcher implementation: %s", geodata.SiteMatcherName())
-	ruleProviders, err := parseRuleProviders(rawCfg)
+	ruleProviders, err := parseRuleProviders(rawCfg, proxies)
 	if err != nil {
 		return nil, err
 	}
@@ -613,6 +661,11 @@ func ParseRawConfig(rawCfg *RawConfig) (*Config, error) {
 		return nil, err
 	}
 
+	config.MITM, err = parseMITM(rawCfg.MITM)
+	if err != nil {
+		return nil, err
+	}
+
 	elapsedTime := time.Since(startTime) / time.Millisecond                     // duration in ms
 	log.Infoln("Initial configuration complete, total time: %dms", elapsedTime) //Segment finished in xxm
 
@@ -661,6 +714,25 @@ func parseGeneral(cfg *RawConfig) (*General, error) {
 		ExternalUIURL = cfg.ExternalUIURL
 	}
 
+	var publicKey *verify.PublicKey
+	if cfg.UpdateVerify.PublicKey != "" {
+		var err error
+		publicKey, err = verify.ParsePublicKey(cfg.UpdateVerify.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("update-verify: %w", err)
+		}
+	}
+	verify.SetPolicy(cfg.UpdateVerify.Checksum, publicKey)
+
+	var sourcePool *dialer.SourcePool
+	if len(cfg.SourceAddresses) != 0 {
+		var err error
+		sourcePool, err = dialer.NewSourcePool(cfg.SourceAddresses, cfg.SourceAddressStrategy)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	cfg.Tun.RedirectToTun = cfg.EBpf.RedirectToTun
 	return &General{
 		Inbound: Inbound{
@@ -692,6 +764,7 @@ func parseGeneral(cfg *RawConfig) (*General, error) {
 		IPv6:                    cfg.IPv6,
 		Interface:               cfg.Interface,
 		RoutingMark:             cfg.RoutingMark,
+		SourcePool:              sourcePool,
 		GeoXUrl:                 cfg.GeoXUrl,
 		GeoAutoUpdate:           cfg.GeoAutoUpdate,
 		GeoUpdateInterval:       cfg.GeoUpdateInterval,
@@ -705,6 +778,31 @@ func parseGeneral(cfg *RawConfig) (*General, error) {
 	}, nil
 }
 
+func parseFingerprints(cfg *RawConfig) error {
+	fingerprints := make(map[string]*tlsC.CustomFingerprint, len(cfg.Fingerprints))
+	for name, raw := range cfg.Fingerprints {
+		fingerprint, err := tlsC.ParseCustomFingerprint(name, tlsC.CustomFingerprintOption{
+			JA3:                 raw.JA3,
+			GREASE:              raw.GREASE,
+			CipherSuites:        raw.CipherSuites,
+			Extensions:          raw.Extensions,
+			Curves:              raw.Curves,
+			PointFormats:        raw.PointFormats,
+			SignatureAlgorithms: raw.SignatureAlgorithms,
+			ALPN:                raw.ALPN,
+			Padding:             raw.Padding,
+			MinVersion:          raw.MinVersion,
+			MaxVersion:          raw.MaxVersion,
+		})
+		if err != nil {
+			return err
+		}
+		fingerprints[name] = fingerprint
+	}
+	tlsC.SetCustomFingerprints(fingerprints)
+	return nil
+}
+
 func parseProxies(cfg *RawConfig) (proxies map[string]C.Proxy, providersMap map[string]providerTypes.ProxyProvider, err error) {
 	proxies = make(map[string]C.Proxy)
 	providersMap = make(map[string]providerTypes.ProxyProvider)
@@ -831,11 +929,22 @@ func parseListeners(cfg *RawConfig) (listeners map[string]C.InboundListener, err
 	return
 }
 
-func parseRuleProviders(cfg *RawConfig) (ruleProviders map[string]providerTypes.RuleProvider, err error) {
+func parseRuleProviders(cfg *RawConfig, proxies map[string]C.Proxy) (ruleProviders map[string]providerTypes.RuleProvider, err error) {
 	ruleProviders = map[string]providerTypes.RuleProvider{}
+	// the rules of the providers are parsed on every update, the ones with an unknown fallback are skipped
+	parse := func(tp, payload, target string, params []string, subRules map[string][]C.Rule) (C.Rule, error) {
+		parsed, err := R.ParseRule(tp, payload, target, params, subRules)
+		if err != nil {
+			return nil, err
+		}
+		if err = verifyFallback(parsed, proxies); err != nil {
+			return nil, err
+		}
+		return parsed, nil
+	}
 	// parse rule provider
 	for name, mapping := range cfg.RuleProvider {
-		rp, err := RP.ParseRuleProvider(name, mapping, R.ParseRule)
+		rp, err := RP.ParseRuleProvider(name, mapping, parse)
 		if err != nil {
 			return nil, err
 		}
@@ -924,7 +1033,7 @@ func parseRules(rulesConfig []string, proxies map[string]C.Proxy, subRules map[s
 
 		l := len(rule)
 
-		if ruleName == "NOT" || ruleName == "OR" || ruleName == "AND" || ruleName == "SUB-RULE" || ruleName == "DOMAIN-REGEX" {
+		if ruleName == "NOT" || ruleName == "OR" || ruleName == "AND" || ruleName == "SUB-RULE" || ruleName == "DOMAIN-REGEX" || ruleName == "EXPR" {
 			target = rule[l-1]
 			payload = strings.Join(rule[1:l-1], ",")
 		} else {
@@ -957,6 +1066,9 @@ func parseRules(rulesConfig []string, proxies map[string]C.Proxy, subRules map[s
 		if parseErr != nil {
 			return nil, fmt.Errorf("%s[%d] [%s] error: %s", format, idx, line, parseErr.Error())
 		}
+		if err := verifyFallback(parsed, proxies); err != nil {
+			return nil, fmt.Errorf("%s[%d] [%s] error: %s", format, idx, line, err.Error())
+		}
 
 		rules = append(rules, parsed)
 	}
@@ -964,6 +1076,16 @@ func parseRules(rulesConfig []string, proxies map[string]C.Proxy, subRules map[s
 	return rules, nil
 }
 
+// verifyFallback checks the fallback proxy in the options of rule exists
+func verifyFallback(rule C.Rule, proxies map[string]C.Proxy) error {
+	if options := rule.Options(); options != nil && options.Fallback != "" {
+		if _, ok := proxies[options.Fallback]; !ok {
+			return fmt.Errorf("fallback proxy [%s] not found", options.Fallback)
+		}
+	}
+	return nil
+}
+
 func parseHosts(cfg *RawConfig) (*trie.DomainTrie[resolver.HostValue], error) {
 	tree := trie.New[resolver.HostValue]()
 
@@ -1051,27 +1173,14 @@ func parseNameServer(servers []string, preferH3 bool) ([]dns.NameServer, error)
 		case "tls":
 			addr, err = hostWithDefaultPort(u.Host, "853")
 			dnsNetType = "tcp-tls" // DNS over TLS
+			proxyName = parseNameServerFragment(u.Fragment, params)
 		case "https":
 			addr, err = hostWithDefaultPort(u.Host, "443")
 			if err == nil {
-				proxyName = ""
 				clearURL := url.URL{Scheme: "https", Host: addr, Path: u.Path, User: u.User}
 				addr = clearURL.String()
 				dnsNetType = "https" // DNS over HTTPS
-				if len(u.Fragment) != 0 {
-					for _, s := range strings.Split(u.Fragment, "&") {
-						arr := strings.Split(s, "=")
-						if len(arr) == 0 {
-							continue
-						} else if len(arr) == 1 {
-							proxyName = arr[0]
-						} else if len(arr) == 2 {
-							params[arr[0]] = arr[1]
-						} else {
-							params[arr[0]] = strings.Join(arr[1:], "=")
-						}
-					}
-				}
+				proxyName = parseNameServerFragment(u.Fragment, params)
 			}
 		case "dhcp":
 			addr = u.Host
@@ -1079,6 +1188,7 @@ func parseNameServer(servers []string, preferH3 bool) ([]dns.NameServer, error)
 		case "quic":
 			addr, err = hostWithDefaultPort(u.Host, "853")
 			dnsNetType = "quic" // DNS over QUIC
+			proxyName = parseNameServerFragment(u.Fragment, params)
 		case "system":
 			dnsNetType = "system" // System DNS
 		case "rcode":
@@ -1102,20 +1212,50 @@ func parseNameServer(servers []string, preferH3 bool) ([]dns.NameServer, error)
 			return nil, fmt.Errorf("DNS NameServer[%d] format error: %s", idx, err.Error())
 		}
 
+		certificates, err := ca.LoadClientCertificate(params["certificate"], params["private-key"])
+		if err != nil {
+			return nil, fmt.Errorf("DNS NameServer[%d] format error: %s", idx, err.Error())
+		}
+		if err = congestion.Check(params["congestion-controller"], congestion.Options{}); err != nil {
+			return nil, fmt.Errorf("DNS NameServer[%d] format error: %s", idx, err.Error())
+		}
+
 		nameservers = append(
 			nameservers,
 			dns.NameServer{
-				Net:       dnsNetType,
-				Addr:      addr,
-				ProxyName: proxyName,
-				Params:    params,
-				PreferH3:  preferH3,
+				Net:          dnsNetType,
+				Addr:         addr,
+				ProxyName:    proxyName,
+				Params:       params,
+				PreferH3:     preferH3,
+				Certificates: certificates,
 			},
 		)
 	}
 	return nameservers, nil
 }
 
+// parseNameServerFragment split the url fragment into proxy name and params,
+// e.g. "proxy&h3=true&certificate=client.crt&private-key=client.key"
+func parseNameServerFragment(fragment string, params map[string]string) (proxyName string) {
+	if len(fragment) == 0 {
+		return
+	}
+	for _, s := range strings.Split(fragment, "&") {
+		arr := strings.Split(s, "=")
+		if len(arr) == 0 {
+			continue
+		} else if len(arr) == 1 {
+			proxyName = arr[0]
+		} else if len(arr) == 2 {
+			params[arr[0]] = arr[1]
+		} else {
+			params[arr[0]] = strings.Join(arr[1:], "=")
+		}
+	}
+	return
+}
+
 func init() {
 	dns.ParseNameServer = func(servers []string) ([]dns.NameServer, error) { // using by wireguard
 		return parseNameServer(servers, false)
@@ -1564,3 +1704,22 @@ func parseSniffer(snifferRaw RawSniffer) (*Sniffer, error) {
 
 	return sniffer, nil
 }
+
+func parseMITM(rawMITM RawMITM) (*mitm.MITM, error) {
+	if !rawMITM.Enable {
+		return nil, nil
+	}
+	caCert, err := N.ParseCert(rawMITM.CACert, rawMITM.CAKey, C.Path)
+	if err != nil {
+		return nil, fmt.Errorf("parse mitm ca error: %w", err)
+	}
+	providers := make(map[string]*mitm.RewriteProvider, len(rawMITM.RewriteProviders))
+	for name, mapping := range rawMITM.RewriteProviders {
+		rp, err := mitm.ParseRewriteProvider(name, mapping)
+		if err != nil {
+			return nil, fmt.Errorf("parse rewrite provider %s error: %w", name, err)
+		}
+		providers[name] = rp
+	}
+	return mitm.New(caCert, rawMITM.Hostnames, rawMITM.Rewrites, providers)
+}
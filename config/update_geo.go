@@ -1,7 +1,9 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"runtime"
 
 	"github.com/metacubex/mihomo/component/geodata"
@@ -12,6 +14,20 @@ import (
 	"github.com/oschwald/maxminddb-golang"
 )
 
+type geoFile struct {
+	path      string
+	data      []byte
+	release   func() // mmdb is loaded with mmap, so it needs to be closed before replacing the file
+	reload    func()
+	hasBackup bool
+}
+
+// geoBackups are the files replaced by the last UpdateGeoDatabases, their previous
+// versions are kept as .bak until the update is committed or rolled back
+var geoBackups []*geoFile
+
+// UpdateGeoDatabases downloads and checks all the databases before replacing any of
+// them, the calls must not be concurrent
 func UpdateGeoDatabases() error {
 	defer runtime.GC()
 	geoLoader, err := geodata.GetGeoDataLoader("standard")
@@ -19,6 +35,7 @@ func UpdateGeoDatabases() error {
 		return err
 	}
 
+	var files []*geoFile
 	if C.GeodataMode {
 		data, err := downloadForBytes(C.GeoIpUrl)
 		if err != nil {
@@ -28,13 +45,8 @@ func UpdateGeoDatabases() error {
 		if _, err = geoLoader.LoadIPByBytes(data, "cn"); err != nil {
 			return fmt.Errorf("invalid GeoIP database file: %s", err)
 		}
-
-		if err = saveFile(data, C.Path.GeoIP()); err != nil {
-			return fmt.Errorf("can't save GeoIP database file: %w", err)
-		}
-
+		files = append(files, &geoFile{path: C.Path.GeoIP(), data: data})
 	} else {
-		defer mmdb.ReloadIP()
 		data, err := downloadForBytes(C.MmdbUrl)
 		if err != nil {
 			return fmt.Errorf("can't download MMDB database file: %w", err)
@@ -45,15 +57,19 @@ func UpdateGeoDatabases() error {
 			return fmt.Errorf("invalid MMDB database file: %s", err)
 		}
 		_ = instance.Close()
-
-		mmdb.IPInstance().Reader.Close() //  mmdb is loaded with mmap, so it needs to be closed before overwriting the file
-		if err = saveFile(data, C.Path.MMDB()); err != nil {
-			return fmt.Errorf("can't save MMDB database file: %w", err)
-		}
+		files = append(files, &geoFile{
+			path: C.Path.MMDB(),
+			data: data,
+			release: func() {
+				if reader, ok := mmdb.LoadedIP(); ok {
+					_ = reader.Close()
+				}
+			},
+			reload: mmdb.ReloadIP,
+		})
 	}
 
 	if C.ASNEnable {
-		defer mmdb.ReloadASN()
 		data, err := downloadForBytes(C.ASNUrl)
 		if err != nil {
 			return fmt.Errorf("can't download ASN database file: %w", err)
@@ -64,11 +80,16 @@ func UpdateGeoDatabases() error {
 			return fmt.Errorf("invalid ASN database file: %s", err)
 		}
 		_ = instance.Close()
-
-		mmdb.ASNInstance().Reader.Close()
-		if err = saveFile(data, C.Path.ASN()); err != nil {
-			return fmt.Errorf("can't save ASN database file: %w", err)
-		}
+		files = append(files, &geoFile{
+			path: C.Path.ASN(),
+			data: data,
+			release: func() {
+				if reader, ok := mmdb.LoadedASN(); ok {
+					_ = reader.Close()
+				}
+			},
+			reload: mmdb.ReloadASN,
+		})
 	}
 
 	data, err := downloadForBytes(C.GeoSiteUrl)
@@ -79,12 +100,84 @@ func UpdateGeoDatabases() error {
 	if _, err = geoLoader.LoadSiteByBytes(data, "cn"); err != nil {
 		return fmt.Errorf("invalid GeoSite database file: %s", err)
 	}
+	files = append(files, &geoFile{path: C.Path.GeoSite(), data: data})
 
-	if err = saveFile(data, C.Path.GeoSite()); err != nil {
-		return fmt.Errorf("can't save GeoSite database file: %w", err)
+	CommitGeoDatabases()
+	for _, file := range files {
+		if err = file.replace(); err != nil {
+			_ = RollbackGeoDatabases()
+			return fmt.Errorf("can't save %s: %w", file.path, err)
+		}
+		file.data = nil
+		geoBackups = append(geoBackups, file)
+	}
+
+	geodata.ClearCache()
+
+	return nil
+}
+
+// CommitGeoDatabases removes the previous versions of the updated databases
+func CommitGeoDatabases() {
+	for _, file := range geoBackups {
+		if file.hasBackup {
+			_ = os.Remove(file.path + ".bak")
+		}
 	}
+	geoBackups = nil
+}
 
+// RollbackGeoDatabases restores the previous versions of the updated databases, e.g.
+// when the config can't be loaded with the new ones
+func RollbackGeoDatabases() error {
+	var errs []error
+	for i := len(geoBackups) - 1; i >= 0; i-- {
+		if err := geoBackups[i].restore(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	geoBackups = nil
 	geodata.ClearCache()
+	return errors.Join(errs...)
+}
+
+func (f *geoFile) replace() error {
+	tmp := f.path + ".tmp"
+	if err := saveFile(f.data, tmp); err != nil {
+		return err
+	}
+	if f.release != nil {
+		f.release()
+	}
+	if f.reload != nil {
+		defer f.reload()
+	}
 
+	err := os.Rename(f.path, f.path+".bak")
+	if err != nil && !os.IsNotExist(err) {
+		_ = os.Remove(tmp)
+		return err
+	}
+	f.hasBackup = err == nil
+	if err = os.Rename(tmp, f.path); err != nil {
+		_ = os.Remove(tmp)
+		if f.hasBackup {
+			_ = os.Rename(f.path+".bak", f.path)
+		}
+		return err
+	}
 	return nil
 }
+
+func (f *geoFile) restore() error {
+	if f.release != nil {
+		f.release()
+	}
+	if f.reload != nil {
+		defer f.reload()
+	}
+	if !f.hasBackup {
+		return os.Remove(f.path)
+	}
+	return os.Rename(f.path+".bak", f.path)
+}
@@ -45,22 +45,36 @@ func UpdateUI() error {
 	}
 	defer os.Remove(saved)
 
-	err = cleanup(ExternalUIFolder)
+	// extract aside, the current UI is only replaced once the new one is complete
+	tmpDir, err := os.MkdirTemp(C.Path.HomeDir(), "ui-")
 	if err != nil {
-		if !os.IsNotExist(err) {
-			return fmt.Errorf("cleanup exist file error: %w", err)
-		}
+		return fmt.Errorf("can't create temp folder: %w", err)
 	}
+	defer os.RemoveAll(tmpDir)
 
-	unzipFolder, err := unzip(saved, C.Path.HomeDir())
+	unzipFolder, err := unzip(saved, tmpDir)
 	if err != nil {
 		return fmt.Errorf("can't extract zip file: %w", err)
 	}
 
+	backup := ExternalUIFolder + ".bak"
+	_ = os.RemoveAll(backup)
+	err = os.Rename(ExternalUIFolder, backup)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("can't backup exist folder: %w", err)
+	}
+	hasBackup := err == nil
+
 	err = os.Rename(unzipFolder, ExternalUIFolder)
 	if err != nil {
+		if hasBackup {
+			_ = os.Rename(backup, ExternalUIFolder)
+		}
 		return fmt.Errorf("can't rename folder: %w", err)
 	}
+	if hasBackup {
+		_ = os.RemoveAll(backup)
+	}
 	return nil
 }
 
@@ -122,24 +136,3 @@ func unzip(src, dest string) (string, error) {
 	}
 	return extractedFolder, nil
 }
-
-func cleanup(root string) error {
-	if _, err := os.Stat(root); os.IsNotExist(err) {
-		return nil
-	}
-	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if info.IsDir() {
-			if err := os.RemoveAll(path); err != nil {
-				return err
-			}
-		} else {
-			if err := os.Remove(path); err != nil {
-				return err
-			}
-		}
-		return nil
-	})
-}
@@ -285,8 +285,6 @@ type WriteBackProxy interface {
 }
 
 type NatTable interface {
-	Set(key string, e PacketConn, w WriteBackProxy)
-
 	Get(key string) (PacketConn, WriteBackProxy)
 
 	GetOrCreateLock(key string) (*sync.Cond, bool)
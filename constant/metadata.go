@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"net/http"
 	"net/netip"
 	"strconv"
 
@@ -155,6 +156,19 @@ type Metadata struct {
 	RawDstAddr net.Addr `json:"-"`
 	// Only domain rule
 	SniffHost string `json:"sniffHost"`
+	// The protocol of the sniffer found SniffHost, e.g. tls, quic, http1
+	SniffProtocol string `json:"sniffProtocol"`
+	// Set on the upstream connections of MITM to avoid intercepting them again
+	SkipMITM bool `json:"-"`
+	// The request parsed by the HTTP sniffer, the HTTP inbound or MITM, nil if no request is visible
+	HTTP *HTTPRequest `json:"-"`
+}
+
+// HTTPRequest is the request line and the headers of a plain or decrypted HTTP request
+type HTTPRequest struct {
+	Method string
+	URL    string // absolute url, e.g. http://example.com/path?query
+	Header http.Header
 }
 
 func (m *Metadata) RemoteAddress() string {
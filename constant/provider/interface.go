@@ -84,6 +84,8 @@ type RuleProvider interface {
 	Match(*constant.Metadata) bool
 	ShouldResolveIP() bool
 	ShouldFindProcess() bool
+	ShouldParseHTTP() bool
+	IsVolatile() bool
 	AsRule(adaptor string) constant.Rule
 }
 
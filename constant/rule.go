@@ -1,5 +1,7 @@
 package constant
 
+import "time"
+
 // Rule Type
 const (
 	Domain RuleType = iota
@@ -24,6 +26,10 @@ const (
 	InType
 	Process
 	ProcessPath
+	URLRegex
+	HTTPMethod
+	HTTPHeader
+	Expr
 	RuleSet
 	Network
 	Uid
@@ -80,6 +86,14 @@ func (rt RuleType) String() string {
 		return "Process"
 	case ProcessPath:
 		return "ProcessPath"
+	case URLRegex:
+		return "URLRegex"
+	case HTTPMethod:
+		return "HTTPMethod"
+	case HTTPHeader:
+		return "HTTPHeader"
+	case Expr:
+		return "Expr"
 	case MATCH:
 		return "Match"
 	case RuleSet:
@@ -110,4 +124,67 @@ type Rule interface {
 	Payload() string
 	ShouldResolveIP() bool
 	ShouldFindProcess() bool
+	ShouldParseHTTP() bool
+	// IsVolatile reports whether the result depends on the attributes varying between
+	// the flows to the same destination, e.g. the source port, so it can't be cached
+	IsVolatile() bool
+	Options() *RuleOptions
+}
+
+// RuleOptions are set by the params of a rule, e.g. "DOMAIN,example.com,PROXY,dscp=46,ttl=64",
+// and override the options of the proxy for the outgoing connections of the matched traffic
+type RuleOptions struct {
+	DSCP     int          // 0 keeps the option of the proxy, -1 uses the DSCP of the inbound
+	TTL      int          // 0 keeps the option of the proxy
+	Retry    *RetryPolicy // nil uses the default policy of the tunnel
+	Fallback string       // the proxy to try when the matched one fails to dial
+
+	UDPTimeout time.Duration // idle timeout of the udp sessions, 0 uses the default of the tunnel
+	UDPMapping UDPMapping
+}
+
+// UDPMapping is the NAT mapping behaviour of the udp sessions, see RFC 4787
+type UDPMapping uint8
+
+const (
+	// EndpointIndependent reuses the session of a client for all the destinations (full cone)
+	EndpointIndependent UDPMapping = iota
+	// AddressDependent creates a session for each destination address of a client
+	AddressDependent
+)
+
+func (m UDPMapping) String() string {
+	switch m {
+	case EndpointIndependent:
+		return "endpoint-independent"
+	case AddressDependent:
+		return "address-dependent"
+	default:
+		return "unknown"
+	}
+}
+
+// RetryOn is the set of the dial errors to retry, 0 retries all of them
+type RetryOn uint8
+
+const (
+	RetryOnTimeout RetryOn = 1 << iota
+	RetryOnRefused
+	RetryOnReset
+	RetryOnUnreachable
+)
+
+// RetryPolicy controls how the tunnel retries the failed dials of a proxy
+type RetryPolicy struct {
+	Attempts   int
+	BackoffMin time.Duration
+	BackoffMax time.Duration
+	RetryOn    RetryOn
+}
+
+// DefaultRetryPolicy is used for the rules without the retry params
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:   10,
+	BackoffMin: 10 * time.Millisecond,
+	BackoffMax: 1 * time.Second,
 }
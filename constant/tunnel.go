@@ -9,4 +9,6 @@ type Tunnel interface {
 	HandleUDPPacket(packet UDPPacket, metadata *Metadata)
 	// NatTable return nat table
 	NatTable() NatTable
+	// ShouldParseHTTP reports whether any rule matches on the HTTP requests
+	ShouldParseHTTP() bool
 }
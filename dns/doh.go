@@ -18,6 +18,7 @@ import (
 	"github.com/metacubex/mihomo/component/ca"
 	C "github.com/metacubex/mihomo/constant"
 	"github.com/metacubex/mihomo/log"
+	"github.com/metacubex/mihomo/transport/congestion"
 	"github.com/metacubex/quic-go"
 	"github.com/metacubex/quic-go/http3"
 	D "github.com/miekg/dns"
@@ -67,13 +68,15 @@ type dnsOverHTTPS struct {
 	proxyAdapter    C.ProxyAdapter
 	proxyName       string
 	addr            string
+	certificates    []tls.Certificate
+	congestion      string
 }
 
 // type check
 var _ dnsClient = (*dnsOverHTTPS)(nil)
 
 // newDoH returns the DNS-over-HTTPS Upstream.
-func newDoHClient(urlString string, r *Resolver, preferH3 bool, params map[string]string, proxyAdapter C.ProxyAdapter, proxyName string) dnsClient {
+func newDoHClient(urlString string, r *Resolver, preferH3 bool, params map[string]string, certificates []tls.Certificate, proxyAdapter C.ProxyAdapter, proxyName string) dnsClient {
 	u, _ := url.Parse(urlString)
 	httpVersions := DefaultHTTPVersions
 	if preferH3 {
@@ -95,6 +98,8 @@ func newDoHClient(urlString string, r *Resolver, preferH3 bool, params map[strin
 			TokenStore:      newQUICTokenStore(),
 		},
 		httpVersions: httpVersions,
+		certificates: certificates,
+		congestion:   params["congestion-controller"],
 	}
 
 	runtime.SetFinalizer(doh, (*dnsOverHTTPS).Close)
@@ -382,6 +387,7 @@ func (doh *dnsOverHTTPS) createTransport(ctx context.Context) (t http.RoundTripp
 			InsecureSkipVerify:     false,
 			MinVersion:             tls.VersionTLS12,
 			SessionTicketsDisabled: false,
+			Certificates:           doh.certificates,
 		})
 	var nextProtos []string
 	for _, v := range doh.httpVersions {
@@ -548,7 +554,14 @@ func (doh *dnsOverHTTPS) dialQuic(ctx context.Context, addr string, tlsCfg *tls.
 		// It's ok if net.SplitHostPort returns an error - it could be a hostname/IP address without a port.
 		tlsCfg.ServerName = doh.url.Host
 	}
-	return transport.DialEarly(ctx, &udpAddr, tlsCfg, cfg)
+	quicConn, err := transport.DialEarly(ctx, &udpAddr, tlsCfg, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err = congestion.Set(quicConn, doh.congestion, congestion.Options{Tag: "dns " + doh.addr}); err != nil {
+		log.Warnln("[DNS] %s set congestion controller failed: %s", doh.addr, err)
+	}
+	return quicConn, nil
 }
 
 // probeH3 runs a test to check whether QUIC is faster than TLS for this
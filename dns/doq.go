@@ -15,6 +15,7 @@ import (
 	"github.com/metacubex/mihomo/component/ca"
 	C "github.com/metacubex/mihomo/constant"
 	"github.com/metacubex/mihomo/log"
+	"github.com/metacubex/mihomo/transport/congestion"
 	"github.com/metacubex/quic-go"
 
 	D "github.com/miekg/dns"
@@ -64,18 +65,20 @@ type dnsOverQUIC struct {
 	proxyAdapter C.ProxyAdapter
 	proxyName    string
 	r            *Resolver
+	congestion   string
 }
 
 // type check
 var _ dnsClient = (*dnsOverQUIC)(nil)
 
 // newDoQ returns the DNS-over-QUIC Upstream.
-func newDoQ(resolver *Resolver, addr string, proxyAdapter C.ProxyAdapter, proxyName string) (dnsClient, error) {
+func newDoQ(resolver *Resolver, addr string, params map[string]string, proxyAdapter C.ProxyAdapter, proxyName string) (dnsClient, error) {
 	doq := &dnsOverQUIC{
 		addr:         addr,
 		proxyAdapter: proxyAdapter,
 		proxyName:    proxyName,
 		r:            resolver,
+		congestion:   params["congestion-controller"],
 		quicConfig: &quic.Config{
 			KeepAlivePeriod: QUICKeepAlivePeriod,
 			TokenStore:      newQUICTokenStore(),
@@ -342,6 +345,9 @@ func (doq *dnsOverQUIC) openConnection(ctx context.Context) (conn quic.Connectio
 	if err != nil {
 		return nil, fmt.Errorf("opening quic connection to %s: %w", doq.addr, err)
 	}
+	if err = congestion.Set(conn, doq.congestion, congestion.Options{Tag: "dns " + doq.addr}); err != nil {
+		log.Warnln("[DNS] %s set congestion controller failed: %s", doq.addr, err)
+	}
 
 	return conn, nil
 }
@@ -2,6 +2,7 @@ package dns
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"net/netip"
 	"strings"
@@ -376,6 +377,8 @@ type NameServer struct {
 	ProxyName    string
 	Params       map[string]string
 	PreferH3     bool
+	// Certificates is the client certificate loaded from the certificate and private-key params
+	Certificates []tls.Certificate
 }
 
 func (ns NameServer) Equal(ns2 NameServer) bool {
@@ -18,6 +18,7 @@ import (
 	"github.com/metacubex/mihomo/component/dialer"
 	G "github.com/metacubex/mihomo/component/geodata"
 	"github.com/metacubex/mihomo/component/iface"
+	"github.com/metacubex/mihomo/component/mitm"
 	"github.com/metacubex/mihomo/component/profile"
 	"github.com/metacubex/mihomo/component/profile/cachefile"
 	"github.com/metacubex/mihomo/component/resolver"
@@ -110,6 +111,7 @@ func ApplyConfig(cfg *config.Config, force bool) {
 	loadProxyProvider(cfg.Providers)
 	updateProfile(cfg)
 	loadRuleProvider(cfg.RuleProviders)
+	updateMITM(cfg.MITM)
 	runtime.GC()
 	tunnel.OnRunning()
 	hcCompatibleProvider(cfg.Providers)
@@ -198,6 +200,7 @@ func updateExperimental(c *config.Config) {
 		_ = os.Setenv("QUIC_GO_DISABLE_ECN", strconv.FormatBool(true))
 	}
 	dialer.GetIP4PEnable(c.Experimental.IP4PEnable)
+	tunnel.SetRuleCacheSize(c.Experimental.RuleCacheSize)
 }
 
 func updateNTP(c *config.NTP) {
@@ -357,6 +360,13 @@ func updateTun(general *config.General) {
 	listener.ReCreateRedirToTun(general.Tun.RedirectToTun)
 }
 
+func updateMITM(m *mitm.MITM) {
+	mitm.Update(m)
+	if m != nil {
+		log.Infoln("MITM is loaded and working")
+	}
+}
+
 func updateSniffer(sniffer *config.Sniffer) {
 	if sniffer.Enable {
 		dispatcher, err := SNI.NewSnifferDispatcher(
@@ -401,6 +411,7 @@ func updateGeneral(general *config.General) {
 
 	dialer.DefaultInterface.Store(general.Interface)
 	dialer.DefaultRoutingMark.Store(int32(general.RoutingMark))
+	dialer.DefaultSourcePool.Store(general.SourcePool)
 	if general.RoutingMark > 0 {
 		log.Infoln("Use routing mark: %#x", general.RoutingMark)
 	}
@@ -0,0 +1,97 @@
+package route
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/metacubex/mihomo/component/capture"
+	"github.com/metacubex/mihomo/log"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+func captureRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/", getCapture)
+	return r
+}
+
+type flushWriter struct {
+	http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (w *flushWriter) Write(b []byte) (n int, err error) {
+	n, err = w.ResponseWriter.Write(b)
+	if w.flusher != nil {
+		w.flusher.Flush()
+	}
+	return
+}
+
+// getCapture streams the pcapng of the new flows matching the query until the limits are reached or the request is canceled
+func getCapture(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	options := capture.Options{
+		Filter: capture.Filter{
+			Host:    query.Get("host"),
+			Rule:    query.Get("rule"),
+			Process: query.Get("process"),
+			Inbound: query.Get("inbound"),
+			Network: query.Get("network"),
+		},
+	}
+	var err error
+	if value := query.Get("duration"); value != "" {
+		if options.Duration, err = time.ParseDuration(value); err != nil {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, newError(err.Error()))
+			return
+		}
+	}
+	if value := query.Get("size"); value != "" {
+		if options.MaxSize, err = strconv.ParseInt(value, 10, 64); err != nil {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, newError(err.Error()))
+			return
+		}
+	}
+	if value := query.Get("snaplen"); value != "" {
+		if options.SnapLen, err = strconv.Atoi(value); err != nil {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, newError(err.Error()))
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-pcapng")
+	w.Header().Set("Content-Disposition", `attachment; filename="mihomo.pcapng"`)
+	flusher, _ := w.(http.Flusher)
+	c, err := capture.Start(&flushWriter{ResponseWriter: w, flusher: flusher}, options)
+	if err != nil {
+		w.Header().Del("Content-Type")
+		w.Header().Del("Content-Disposition")
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, newError(err.Error()))
+		return
+	}
+	log.Infoln("[Capture] start capturing %s for %s", options.Filter, r.RemoteAddr)
+
+	select {
+	case <-c.Done():
+	case <-r.Context().Done():
+		_ = c.Close()
+		// the capture writes w until it's done
+		<-c.Done()
+	}
+	if err = c.Err(); err != nil {
+		log.Infoln("[Capture] stop capturing %s: %s", options.Filter, err)
+	} else {
+		log.Infoln("[Capture] stop capturing %s", options.Filter)
+	}
+	if dropped := c.Dropped(); dropped > 0 {
+		log.Warnln("[Capture] %d packets of %s are dropped, the output is read too slowly", dropped, options.Filter)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"net/http"
 	"net/netip"
 	"path/filepath"
-	"sync"
 
 	"github.com/metacubex/mihomo/adapter/inbound"
 	"github.com/metacubex/mihomo/component/dialer"
@@ -12,6 +11,7 @@ import (
 	"github.com/metacubex/mihomo/config"
 	C "github.com/metacubex/mihomo/constant"
 	"github.com/metacubex/mihomo/hub/executor"
+	"github.com/metacubex/mihomo/hub/updater"
 	P "github.com/metacubex/mihomo/listener"
 	LC "github.com/metacubex/mihomo/listener/config"
 	"github.com/metacubex/mihomo/log"
@@ -21,15 +21,11 @@ import (
 	"github.com/go-chi/render"
 )
 
-var (
-	updateGeoMux sync.Mutex
-	updatingGeo  = false
-)
-
 func configRouter() http.Handler {
 	r := chi.NewRouter()
 	r.Get("/", getConfigs)
 	r.Put("/", updateConfigs)
+	r.Get("/geo", getGeoStatus)
 	r.Post("/geo", updateGeoDatabases)
 	r.Patch("/", patchConfigs)
 	return r
@@ -368,41 +364,17 @@ func updateConfigs(w http.ResponseWriter, r *http.Request) {
 	render.NoContent(w, r)
 }
 
-func updateGeoDatabases(w http.ResponseWriter, r *http.Request) {
-	updateGeoMux.Lock()
+func getGeoStatus(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, updater.GeoStatus())
+}
 
-	if updatingGeo {
-		updateGeoMux.Unlock()
+func updateGeoDatabases(w http.ResponseWriter, r *http.Request) {
+	if err := updater.UpdateGeoDatabasesAsync(); err != nil {
 		render.Status(r, http.StatusBadRequest)
 		render.JSON(w, r, newError("updating..."))
 		return
 	}
 
-	updatingGeo = true
-	updateGeoMux.Unlock()
-
-	go func() {
-		defer func() {
-			updatingGeo = false
-		}()
-
-		log.Warnln("[REST-API] updating GEO databases...")
-
-		if err := config.UpdateGeoDatabases(); err != nil {
-			log.Errorln("[REST-API] update GEO databases failed: %v", err)
-			return
-		}
-
-		cfg, err := executor.ParseWithPath(C.Path.Config())
-		if err != nil {
-			log.Errorln("[REST-API] update GEO databases failed: %v", err)
-			return
-		}
-
-		log.Warnln("[REST-API] update GEO databases successful, apply config...")
-
-		executor.ApplyConfig(cfg, false)
-	}()
-
+	log.Warnln("[REST-API] updating GEO databases...")
 	render.NoContent(w, r)
 }
@@ -0,0 +1,74 @@
+package route
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/netip"
+
+	"github.com/metacubex/mihomo/component/geodata"
+	"github.com/metacubex/mihomo/component/mmdb"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+func geoRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/ip", lookupGeoIP)
+	r.Get("/site", lookupGeoSite)
+	return r
+}
+
+type asnSchema struct {
+	Number       uint32 `json:"number"`
+	Organization string `json:"organization"`
+}
+
+// lookupGeoIP answers from the databases which are loaded or present, the fields of
+// the others are omitted
+func lookupGeoIP(w http.ResponseWriter, r *http.Request) {
+	ip, err := netip.ParseAddr(r.URL.Query().Get("ip"))
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, newError("invalid ip"))
+		return
+	}
+	ip = ip.Unmap()
+
+	response := render.M{"ip": ip.String()}
+	if reader, ok := mmdb.LoadedIP(); ok {
+		response["mmdb"] = reader.LookupCode(ip.AsSlice())
+	}
+	if reader, ok := mmdb.LoadedASN(); ok {
+		result := reader.LookupASN(ip.AsSlice())
+		response["asn"] = asnSchema{Number: result.AutonomousSystemNumber, Organization: result.AutonomousSystemOrganization}
+	}
+	codes, err := geodata.LookupGeoIP(ip)
+	switch {
+	case err == nil:
+		response["geoip"] = codes
+	case !errors.Is(err, fs.ErrNotExist):
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, newError(err.Error()))
+		return
+	}
+	render.JSON(w, r, response)
+}
+
+func lookupGeoSite(w http.ResponseWriter, r *http.Request) {
+	domain := r.URL.Query().Get("domain")
+	if domain == "" {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, newError("invalid domain"))
+		return
+	}
+
+	matches, err := geodata.LookupGeoSite(domain)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, newError(err.Error()))
+		return
+	}
+	render.JSON(w, r, render.M{"domain": domain, "geosite": matches})
+}
@@ -0,0 +1,38 @@
+package route
+
+import (
+	"net/http"
+
+	"github.com/metacubex/mihomo/tunnel"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+func natRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/", getUDPSessions)
+	r.Delete("/", closeAllUDPSessions)
+	r.Delete("/{id}", closeUDPSession)
+	return r
+}
+
+func getUDPSessions(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, render.M{
+		"sessions": tunnel.UDPSessions(),
+	})
+}
+
+func closeUDPSession(w http.ResponseWriter, r *http.Request) {
+	if tunnel.CloseUDPSessions(chi.URLParam(r, "id")) == 0 {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, ErrNotFound)
+		return
+	}
+	render.NoContent(w, r)
+}
+
+func closeAllUDPSessions(w http.ResponseWriter, r *http.Request) {
+	tunnel.CloseUDPSessions("")
+	render.NoContent(w, r)
+}
@@ -13,6 +13,7 @@ import (
 func ruleRouter() http.Handler {
 	r := chi.NewRouter()
 	r.Get("/", getRules)
+	r.Get("/cache", getRuleCache)
 	return r
 }
 
@@ -44,3 +45,7 @@ func getRules(w http.ResponseWriter, r *http.Request) {
 		"rules": rules,
 	})
 }
+
+func getRuleCache(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, tunnel.RuleCache())
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/metacubex/mihomo/common/utils"
 	C "github.com/metacubex/mihomo/constant"
 	"github.com/metacubex/mihomo/log"
+	"github.com/metacubex/mihomo/transport/congestion"
 	"github.com/metacubex/mihomo/tunnel/statistic"
 
 	"github.com/go-chi/chi/v5"
@@ -66,6 +67,12 @@ func router(isDebug bool, withAuth bool) *chi.Mux {
 			r.Put("/gc", func(w http.ResponseWriter, r *http.Request) {
 				debug.FreeOSMemory()
 			})
+			r.Get("/congestion", func(w http.ResponseWriter, r *http.Request) {
+				render.JSON(w, r, render.M{
+					"algorithms":  congestion.Names(),
+					"connections": congestion.Connections(),
+				})
+			})
 			handler := middleware.Profiler
 			r.Mount("/", handler())
 			return r
@@ -85,10 +92,13 @@ func router(isDebug bool, withAuth bool) *chi.Mux {
 		r.Mount("/group", GroupRouter())
 		r.Mount("/rules", ruleRouter())
 		r.Mount("/connections", connectionRouter())
+		r.Mount("/nat", natRouter())
+		r.Mount("/capture", captureRouter())
 		r.Mount("/providers/proxies", proxyProviderRouter())
 		r.Mount("/providers/rules", ruleProviderRouter())
 		r.Mount("/cache", cacheRouter())
 		r.Mount("/dns", dnsRouter())
+		r.Mount("/geo", geoRouter())
 		r.Mount("/restart", restartRouter())
 		r.Mount("/upgrade", upgradeRouter())
 		addExternalRouters(r)
@@ -16,11 +16,16 @@ import (
 
 func upgradeRouter() http.Handler {
 	r := chi.NewRouter()
+	r.Get("/", getUpgradeStatus)
 	r.Post("/", upgradeCore)
 	r.Post("/ui", updateUI)
 	return r
 }
 
+func getUpgradeStatus(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, updater.Statuses())
+}
+
 func upgradeCore(w http.ResponseWriter, r *http.Request) {
 	// modify from https://github.com/AdguardTeam/AdGuardHome/blob/595484e0b3fb4c457f9bb727a6b94faa78a66c5f/internal/home/controlupdate.go#L108
 	log.Infoln("start update")
@@ -48,7 +53,7 @@ func upgradeCore(w http.ResponseWriter, r *http.Request) {
 }
 
 func updateUI(w http.ResponseWriter, r *http.Request) {
-	err := config.UpdateUI()
+	err := updater.UpdateUI()
 	if err != nil {
 		if errors.Is(err, config.ErrIncompleteConf) {
 			log.Warnln("%s", err)
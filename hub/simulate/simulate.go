@@ -0,0 +1,259 @@
+// Package simulate runs the test cases of the routing through the rules of a config
+// without making any connection, e.g. to validate a config change in CI.
+package simulate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/metacubex/mihomo/component/process"
+	"github.com/metacubex/mihomo/component/resolver"
+	"github.com/metacubex/mihomo/config"
+	C "github.com/metacubex/mihomo/constant"
+	"github.com/metacubex/mihomo/log"
+	"github.com/metacubex/mihomo/tunnel"
+
+	D "github.com/miekg/dns"
+	"gopkg.in/yaml.v3"
+)
+
+// Cases is the file of the test cases
+//
+//	hosts:                 # the DNS fixtures, the hosts of the config are used as well
+//	  example.com: 203.0.113.1
+//	cases:
+//	  - host: example.com  # a domain or an IP
+//	    port: 443
+//	    expect: PROXY      # the name of the matched proxy or group
+type Cases struct {
+	Hosts map[string]any `yaml:"hosts"`
+	Cases []Case         `yaml:"cases"`
+}
+
+type Case struct {
+	Name        string `yaml:"name"`
+	Host        string `yaml:"host"`
+	IP          string `yaml:"ip"` // the destination IP known with the domain, e.g. a sniffed connection
+	Port        uint16 `yaml:"port"`
+	Network     string `yaml:"network"` // tcp (default) or udp
+	SrcIP       string `yaml:"src-ip"`
+	SrcPort     uint16 `yaml:"src-port"`
+	InType      string `yaml:"in-type"` // SOCKS5 by default
+	InName      string `yaml:"in-name"`
+	InPort      uint16 `yaml:"in-port"`
+	InUser      string `yaml:"in-user"`
+	Process     string `yaml:"process"`
+	ProcessPath string `yaml:"process-path"`
+	Uid         uint32 `yaml:"uid"`
+	DSCP        uint8  `yaml:"dscp"`
+
+	Expect     string `yaml:"expect"`
+	ExpectRule string `yaml:"expect-rule"` // optional, the type or the type and the payload, e.g. DOMAIN-SUFFIX,example.com
+}
+
+func (c *Case) metadata() (*C.Metadata, error) {
+	metadata := &C.Metadata{
+		NetWork:     C.TCP,
+		Type:        C.SOCKS5,
+		Host:        c.Host,
+		DstPort:     c.Port,
+		SrcIP:       netip.AddrFrom4([4]byte{127, 0, 0, 1}),
+		SrcPort:     c.SrcPort,
+		InName:      c.InName,
+		InPort:      c.InPort,
+		InUser:      c.InUser,
+		Process:     c.Process,
+		ProcessPath: c.ProcessPath,
+		Uid:         c.Uid,
+		DSCP:        c.DSCP,
+	}
+	switch strings.ToLower(c.Network) {
+	case "", "tcp":
+	case "udp":
+		metadata.NetWork = C.UDP
+	default:
+		return nil, fmt.Errorf("invalid network %s", c.Network)
+	}
+	if c.IP != "" {
+		ip, err := netip.ParseAddr(c.IP)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ip %s", c.IP)
+		}
+		metadata.DstIP = ip
+	}
+	if c.SrcIP != "" {
+		ip, err := netip.ParseAddr(c.SrcIP)
+		if err != nil {
+			return nil, fmt.Errorf("invalid src-ip %s", c.SrcIP)
+		}
+		metadata.SrcIP = ip
+	}
+	if c.InType != "" {
+		tp, err := C.ParseType(strings.ToUpper(c.InType))
+		if err != nil {
+			return nil, err
+		}
+		metadata.Type = *tp
+	}
+	if metadata.Host == "" && !metadata.DstIP.IsValid() {
+		return nil, errors.New("missing host")
+	}
+	return metadata, nil
+}
+
+func (c *Case) String() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	host := c.Host
+	if host == "" {
+		host = c.IP
+	} else if c.IP != "" {
+		host += "(" + c.IP + ")"
+	}
+	network := c.Network
+	if network == "" {
+		network = "tcp"
+	}
+	return fmt.Sprintf("%s:%d/%s", host, c.Port, strings.ToLower(network))
+}
+
+// offlineResolver fails the lookups not answered by the hosts
+type offlineResolver struct{}
+
+func (offlineResolver) LookupIP(ctx context.Context, host string) ([]netip.Addr, error) {
+	return nil, resolver.ErrIPNotFound
+}
+
+func (offlineResolver) LookupIPv4(ctx context.Context, host string) ([]netip.Addr, error) {
+	return nil, resolver.ErrIPNotFound
+}
+
+func (offlineResolver) LookupIPv6(ctx context.Context, host string) ([]netip.Addr, error) {
+	return nil, resolver.ErrIPNotFound
+}
+
+func (offlineResolver) ExchangeContext(ctx context.Context, m *D.Msg) (*D.Msg, error) {
+	return nil, resolver.ErrIPNotFound
+}
+
+func (offlineResolver) Invalid() bool {
+	return true
+}
+
+// Run loads cfg into the tunnel without the listeners, DNS and the network, runs the cases
+// in buf and writes a table of the results to w, it returns the number of the failed cases
+func Run(cfg *config.Config, buf []byte, w io.Writer) (int, error) {
+	cases := &Cases{}
+	if err := yaml.Unmarshal(buf, cases); err != nil {
+		return 0, err
+	}
+
+	hosts := cfg.Hosts
+	for domain, anyValue := range cases.Hosts {
+		value, err := resolver.NewHostValue(anyValue)
+		if err != nil {
+			return 0, fmt.Errorf("invalid hosts %s: %w", domain, err)
+		}
+		if err := hosts.Insert(domain, value); err != nil {
+			return 0, fmt.Errorf("invalid hosts %s: %w", domain, err)
+		}
+	}
+	resolver.DefaultHosts = resolver.NewHosts(hosts)
+	resolver.DefaultResolver = offlineResolver{}
+	resolver.ProxyServerHostResolver = offlineResolver{}
+
+	for name, rp := range cfg.RuleProviders {
+		loader, ok := rp.(interface{ InitialOffline() error })
+		if !ok {
+			continue
+		}
+		if err := loader.InitialOffline(); err != nil {
+			log.Warnln("[Simulate] rule provider %s is empty: %s", name, err)
+		}
+	}
+	tunnel.SetMode(cfg.General.Mode)
+	// the processes of the cases are used instead of looking them up
+	tunnel.SetFindProcessMode(process.FindProcessOff)
+	tunnel.UpdateProxies(cfg.Proxies, cfg.Providers)
+	tunnel.UpdateRules(cfg.Rules, cfg.SubRules, cfg.RuleProviders)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "#\tCASE\tEXPECT\tGOT\tRULE\tRESULT")
+	failed := 0
+	for i := range cases.Cases {
+		c := &cases.Cases[i]
+		got, rule, err := run(c)
+		result := "ok"
+		switch {
+		case err != nil:
+			got, result = "-", "error: "+err.Error()
+		case !strings.EqualFold(got, c.Expect):
+			result = "FAIL"
+		case c.ExpectRule != "" && !matchRule(c.ExpectRule, rule):
+			result = "FAIL: rule"
+		}
+		if result != "ok" {
+			failed++
+		}
+		_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", i+1, c, c.Expect, got, rule, result)
+	}
+	_ = tw.Flush()
+	_, _ = fmt.Fprintf(w, "%d cases, %d failed\n", len(cases.Cases), failed)
+	return failed, nil
+}
+
+func run(c *Case) (string, string, error) {
+	if c.Expect == "" {
+		return "", "", errors.New("missing expect")
+	}
+	metadata, err := c.metadata()
+	if err != nil {
+		return "", "", err
+	}
+	proxy, rule, err := tunnel.Simulate(metadata)
+	if err != nil {
+		return "", "", err
+	}
+	if proxy == nil {
+		return "", "", errors.New("no proxy")
+	}
+	ruleString := "-"
+	if rule != nil {
+		ruleString = rule.RuleType().String()
+		if payload := rule.Payload(); payload != "" {
+			ruleString += "," + payload
+		}
+	}
+	return proxy.Name(), ruleString, nil
+}
+
+var ruleTypeAliases = map[string]string{
+	"ipcidr6":     "ipcidr",
+	"processname": "process",
+	"subrule":     "subrules",
+}
+
+// matchRule reports whether the rule, formatted as Type,Payload, is the expected
+// one, the type can be written in the config style, e.g. DOMAIN-SUFFIX
+func matchRule(expected, rule string) bool {
+	normalize := func(s string) string {
+		tp, payload, _ := strings.Cut(s, ",")
+		tp = strings.ToLower(strings.ReplaceAll(tp, "-", ""))
+		if alias, ok := ruleTypeAliases[tp]; ok {
+			tp = alias
+		}
+		return tp + "," + payload
+	}
+	expected, rule = normalize(expected), normalize(rule)
+	if strings.HasSuffix(expected, ",") {
+		tp, _, _ := strings.Cut(rule, ",")
+		return expected == tp+","
+	}
+	return expected == rule
+}
@@ -0,0 +1,79 @@
+package simulate
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/metacubex/mihomo/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	cfg, err := config.Parse([]byte(`
+hosts:
+  internal.example.com: 10.0.0.1
+proxy-groups:
+  - name: PROXY
+    type: select
+    proxies: [DIRECT, REJECT]
+rules:
+  - DOMAIN-SUFFIX,ads.example.com,REJECT
+  - PROCESS-NAME,curl,DIRECT
+  - IP-CIDR,10.0.0.0/8,DIRECT
+  - IP-CIDR,203.0.113.0/24,REJECT
+  - DST-PORT,22,DIRECT
+  - MATCH,PROXY
+`))
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	failed, err := Run(cfg, []byte(`
+hosts:
+  fixture.example.com: 203.0.113.1
+cases:
+  - host: www.ads.example.com
+    port: 443
+    expect: REJECT
+    expect-rule: DOMAIN-SUFFIX,ads.example.com
+  - host: internal.example.com
+    port: 80
+    expect: DIRECT
+    expect-rule: IP-CIDR
+  - host: fixture.example.com
+    port: 443
+    expect: REJECT
+  - host: unresolvable.example.com
+    port: 443
+    expect: PROXY
+    expect-rule: MATCH
+  - host: www.example.com
+    port: 443
+    process: curl
+    expect: DIRECT
+  - name: ssh
+    host: 198.51.100.1
+    port: 22
+    expect: PROXY
+  - host: 198.51.100.1
+    port: 80
+    expect: DIRECT
+    expect-rule: MATCH
+  - port: 80
+    expect: DIRECT
+`), &out)
+	require.NoError(t, err)
+	assert.Equal(t, 3, failed, out.String())
+	assert.Contains(t, out.String(), "8 cases, 3 failed")
+	assert.Contains(t, out.String(), "error: missing host")
+}
+
+func TestMatchRule(t *testing.T) {
+	assert.True(t, matchRule("DOMAIN-SUFFIX,example.com", "DomainSuffix,example.com"))
+	assert.True(t, matchRule("ip-cidr6", "IPCIDR,2001:db8::/32"))
+	assert.True(t, matchRule("PROCESS-NAME,curl", "Process,curl"))
+	assert.True(t, matchRule("MATCH", "Match"))
+	assert.False(t, matchRule("DOMAIN,example.com", "DomainSuffix,example.com"))
+	assert.False(t, matchRule("DOMAIN-SUFFIX,example.org", "DomainSuffix,example.com"))
+}
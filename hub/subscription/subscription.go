@@ -0,0 +1,122 @@
+// Package subscription converts a subscription, either the share links (optionally
+// base64 encoded) or a YAML with the proxies, to the proxies of a config. Every proxy
+// is validated by building its adapter, the invalid ones are skipped.
+package subscription
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/metacubex/mihomo/adapter"
+	"github.com/metacubex/mihomo/adapter/provider"
+	"github.com/metacubex/mihomo/common/convert"
+	C "github.com/metacubex/mihomo/constant"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	selectGroup  = "PROXY"
+	urlTestGroup = "AUTO"
+)
+
+// reserved are the names of the built-in proxies and the groups of the full config
+var reserved = map[string]struct{}{
+	"DIRECT": {}, "REJECT": {}, "REJECT-DROP": {}, "PASS": {}, "COMPATIBLE": {},
+	selectGroup: {}, urlTestGroup: {},
+}
+
+type Result struct {
+	Proxies []map[string]any
+	// Skipped tells the line of the skipped share links, the name (or the index)
+	// of the skipped proxies of a YAML
+	Skipped []convert.Skipped
+}
+
+// Convert decodes and validates the proxies of the subscription in buf
+func Convert(buf []byte) (*Result, error) {
+	result := &Result{}
+
+	schema := &provider.ProxySchema{}
+	if err := yaml.Unmarshal(buf, schema); err != nil || schema.Proxies == nil {
+		proxies, skipped, err := convert.ConvertsV2RayWithSkipped(buf)
+		result.Skipped = skipped
+		if err != nil {
+			return result, err
+		}
+		schema.Proxies = proxies
+	}
+
+	names := map[string]struct{}{}
+	for idx, mapping := range schema.Proxies {
+		name, _ := mapping["name"].(string)
+		label := name
+		if label == "" {
+			label = "#" + strconv.Itoa(idx)
+		}
+		skip := func(err error) {
+			result.Skipped = append(result.Skipped, convert.Skipped{Line: label, Reason: err})
+		}
+
+		proxy, err := adapter.ParseProxy(mapping)
+		if err != nil {
+			skip(err)
+			continue
+		}
+		name = proxy.Name()
+		mapping["name"] = name
+		if _, ok := reserved[name]; ok {
+			skip(errors.New("reserved name"))
+			continue
+		}
+		if _, ok := names[name]; ok {
+			skip(errors.New("duplicate name"))
+			continue
+		}
+		names[name] = struct{}{}
+		result.Proxies = append(result.Proxies, mapping)
+	}
+
+	if len(result.Proxies) == 0 {
+		return result, errors.New("no valid proxy")
+	}
+	return result, nil
+}
+
+// Marshal returns the proxies list, or with full a minimal config which selects
+// between the proxies and an url-test group of them
+func (r *Result) Marshal(full bool) ([]byte, error) {
+	if !full {
+		return yaml.Marshal(map[string]any{"proxies": r.Proxies})
+	}
+
+	names := make([]string, 0, len(r.Proxies))
+	for _, mapping := range r.Proxies {
+		names = append(names, mapping["name"].(string))
+	}
+	return yaml.Marshal(&struct {
+		MixedPort   int              `yaml:"mixed-port"`
+		Proxies     []map[string]any `yaml:"proxies"`
+		ProxyGroups []map[string]any `yaml:"proxy-groups"`
+		Rules       []string         `yaml:"rules"`
+	}{
+		MixedPort: 7890,
+		Proxies:   r.Proxies,
+		ProxyGroups: []map[string]any{
+			{
+				"name":    selectGroup,
+				"type":    "select",
+				"proxies": append([]string{urlTestGroup}, names...),
+			},
+			{
+				"name":     urlTestGroup,
+				"type":     "url-test",
+				"url":      C.DefaultTestURL,
+				"interval": 300,
+				"proxies":  names,
+			},
+		},
+		Rules: []string{fmt.Sprintf("MATCH,%s", selectGroup)},
+	})
+}
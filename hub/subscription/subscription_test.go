@@ -0,0 +1,58 @@
+package subscription
+
+import (
+	"testing"
+
+	"github.com/metacubex/mihomo/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertLinks(t *testing.T) {
+	result, err := Convert([]byte("trojan://password@example.com:443#a\n" +
+		"trojan://password@example.com:443#a\n" +
+		"ss://bm90LWEtY2lwaGVyOnBhc3N3b3Jk@example.com:8388#bad-cipher\n" +
+		"foo://bar\n"))
+	require.NoError(t, err)
+	assert.Len(t, result.Proxies, 2)
+	assert.Equal(t, "a-01", result.Proxies[1]["name"])
+	if assert.Len(t, result.Skipped, 2) {
+		assert.Equal(t, "foo://bar", result.Skipped[0].Line)
+		assert.Equal(t, "bad-cipher", result.Skipped[1].Line)
+	}
+}
+
+func TestConvertYAML(t *testing.T) {
+	result, err := Convert([]byte(`
+proxies:
+  - {name: a, type: socks5, server: 127.0.0.1, port: 1080}
+  - {name: a, type: http, server: 127.0.0.1, port: 8080}
+  - {name: DIRECT, type: http, server: 127.0.0.1, port: 8080}
+  - {name: b, type: unknown, server: 127.0.0.1, port: 8080}
+  - {type: http}
+`))
+	require.NoError(t, err)
+	assert.Len(t, result.Proxies, 1)
+	if assert.Len(t, result.Skipped, 4) {
+		assert.EqualError(t, result.Skipped[0].Reason, "duplicate name")
+		assert.EqualError(t, result.Skipped[1].Reason, "reserved name")
+		assert.Equal(t, "b", result.Skipped[2].Line)
+		assert.Equal(t, "#4", result.Skipped[3].Line)
+	}
+
+	_, err = Convert([]byte("proxies: []"))
+	assert.Error(t, err)
+}
+
+func TestMarshalFull(t *testing.T) {
+	result, err := Convert([]byte("trojan://password@example.com:443#a\n"))
+	require.NoError(t, err)
+	buf, err := result.Marshal(true)
+	require.NoError(t, err)
+	cfg, err := config.Parse(buf)
+	require.NoError(t, err)
+	assert.Contains(t, cfg.Proxies, "a")
+	assert.Contains(t, cfg.Proxies, selectGroup)
+	assert.Contains(t, cfg.Proxies, urlTestGroup)
+}
@@ -0,0 +1,92 @@
+package updater
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/metacubex/mihomo/config"
+	C "github.com/metacubex/mihomo/constant"
+	"github.com/metacubex/mihomo/hub/executor"
+	"github.com/metacubex/mihomo/log"
+)
+
+var ErrGeoUpdating = errors.New("GEO databases are updating")
+
+// UpdateGeoDatabases downloads the geo databases and reloads the config with them,
+// the previous databases are restored when the config fails to load
+func UpdateGeoDatabases() error {
+	if !geoStatus.start() {
+		return ErrGeoUpdating
+	}
+	err := updateGeoDatabases()
+	geoStatus.finish(err)
+	return err
+}
+
+// UpdateGeoDatabasesAsync is UpdateGeoDatabases in the background, it only fails
+// when an update is already running
+func UpdateGeoDatabasesAsync() error {
+	if !geoStatus.start() {
+		return ErrGeoUpdating
+	}
+	go func() {
+		err := updateGeoDatabases()
+		if err != nil {
+			log.Errorln("[GEO] update GEO databases failed: %s", err)
+		}
+		geoStatus.finish(err)
+	}()
+	return nil
+}
+
+func updateGeoDatabases() error {
+	log.Infoln("[GEO] Updating GEO databases")
+	if err := config.UpdateGeoDatabases(); err != nil {
+		return err
+	}
+
+	cfg, err := executor.ParseWithPath(C.Path.Config())
+	if err != nil {
+		if rollbackErr := config.RollbackGeoDatabases(); rollbackErr != nil {
+			log.Errorln("[GEO] restore GEO databases failed: %s", rollbackErr)
+		}
+		return fmt.Errorf("config can't be loaded with the new GEO databases, restored the previous ones: %w", err)
+	}
+	config.CommitGeoDatabases()
+
+	log.Infoln("[GEO] Update GEO databases success, apply new config")
+	executor.ApplyConfig(cfg, false)
+	return nil
+}
+
+// StartGeoScheduler updates the geo databases every geo-update-interval hours while
+// geo-auto-update is enabled, it follows the reloaded configs
+func StartGeoScheduler() {
+	go func() {
+		last := time.Now()
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			if !C.GeoAutoUpdate || C.GeoUpdateInterval <= 0 {
+				geoStatus.setNext(nil)
+			} else {
+				next := last.Add(time.Duration(C.GeoUpdateInterval) * time.Hour)
+				if time.Now().Before(next) {
+					geoStatus.setNext(&next)
+				} else {
+					last = time.Now()
+					if err := UpdateGeoDatabases(); err != nil {
+						if errors.Is(err, ErrGeoUpdating) {
+							log.Infoln("[GEO] GEO databases are updating, skip")
+						} else {
+							log.Errorln("[GEO] update GEO databases failed: %s", err)
+						}
+					}
+					continue
+				}
+			}
+			<-ticker.C
+		}
+	}()
+}
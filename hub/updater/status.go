@@ -0,0 +1,84 @@
+package updater
+
+import (
+	"sync"
+	"time"
+
+	"github.com/metacubex/mihomo/config"
+)
+
+// Status is the state of the updates of a component, as reported by the API
+type Status struct {
+	Updating     bool       `json:"updating"`
+	UpdatedAt    *time.Time `json:"updatedAt,omitempty"`
+	Error        string     `json:"error,omitempty"`
+	NextUpdateAt *time.Time `json:"nextUpdateAt,omitempty"`
+}
+
+type tracker struct {
+	mu     sync.Mutex
+	status Status
+}
+
+var (
+	coreStatus = &tracker{}
+	uiStatus   = &tracker{}
+	geoStatus  = &tracker{}
+)
+
+// start marks the update as running, it returns false when one already is
+func (t *tracker) start() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.status.Updating {
+		return false
+	}
+	t.status.Updating = true
+	return true
+}
+
+func (t *tracker) finish(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.Updating = false
+	if err != nil {
+		t.status.Error = err.Error()
+		return
+	}
+	now := time.Now()
+	t.status.UpdatedAt = &now
+	t.status.Error = ""
+}
+
+func (t *tracker) setNext(next *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.NextUpdateAt = next
+}
+
+func (t *tracker) get() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.status
+}
+
+// UpdateUI downloads the external UI and records the result
+func UpdateUI() error {
+	uiStatus.start()
+	err := config.UpdateUI()
+	uiStatus.finish(err)
+	return err
+}
+
+func GeoStatus() Status {
+	return geoStatus.get()
+}
+
+// Statuses returns the status of the core, UI and geo database updates
+func Statuses() map[string]Status {
+	return map[string]Status{
+		"core": coreStatus.get(),
+		"ui":   uiStatus.get(),
+		"geo":  geoStatus.get(),
+	}
+}
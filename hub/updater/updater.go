@@ -16,6 +16,7 @@ import (
 	"time"
 
 	mihomoHttp "github.com/metacubex/mihomo/component/http"
+	"github.com/metacubex/mihomo/component/verify"
 	C "github.com/metacubex/mihomo/constant"
 	"github.com/metacubex/mihomo/log"
 
@@ -71,6 +72,9 @@ func Update(execPath string) (err error) {
 	mu.Lock()
 	defer mu.Unlock()
 
+	coreStatus.start()
+	defer func() { coreStatus.finish(err) }()
+
 	latestVersion, err = getLatestVersion()
 	if err != nil {
 		return err
@@ -119,6 +123,9 @@ func Update(execPath string) (err error) {
 
 	err = replace()
 	if err != nil {
+		if restoreErr := restore(); restoreErr != nil {
+			log.Errorln("updater: restoring %s failed: %v", currentExeName, restoreErr)
+		}
 		return fmt.Errorf("replacing: %w", err)
 	}
 
@@ -223,6 +230,13 @@ func replace() error {
 	return nil
 }
 
+// restore moves the backup back in place of the current executable file
+func restore() error {
+	log.Infoln("updater: restoring %s to %s", backupExeName, currentExeName)
+	_ = os.Remove(currentExeName) // may be partially copied on windows
+	return os.Rename(backupExeName, currentExeName)
+}
+
 // clean removes the temporary directory itself and all it's contents.
 func clean() {
 	_ = os.RemoveAll(updateDir)
@@ -262,6 +276,10 @@ func downloadPackageFile() (err error) {
 		return fmt.Errorf("io.ReadAll() failed: %w", err)
 	}
 
+	if err = verify.Verify(ctx, packageURL, body); err != nil {
+		return fmt.Errorf("verifying package: %w", err)
+	}
+
 	log.Debugln("updateDir %s", updateDir)
 	err = os.Mkdir(updateDir, 0o755)
 	if err != nil {
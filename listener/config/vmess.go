@@ -17,6 +17,7 @@ type VmessServer struct {
 	Listen      string
 	Users       []VmessUser
 	WsPath      string
+	XHTTPPath   string
 	Certificate string
 	PrivateKey  string
 	MuxOption   sing.MuxOption `yaml:"mux-option" json:"mux-option,omitempty"`
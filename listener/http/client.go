@@ -33,6 +33,10 @@ func newClient(srcConn net.Conn, tunnel C.Tunnel, additions ...inbound.Addition)
 
 				left, right := N.Pipe()
 
+				additions := additions
+				if request, ok := context.Value(httpRequestKey{}).(*C.HTTPRequest); ok {
+					additions = append(additions[:len(additions):len(additions)], inbound.WithHTTPRequest(request))
+				}
 				go tunnel.HandleTCPConn(inbound.NewHTTP(dstAddr, srcConn, right, additions...))
 
 				return left, nil
@@ -43,3 +47,24 @@ func newClient(srcConn net.Conn, tunnel C.Tunnel, additions ...inbound.Addition)
 		},
 	}
 }
+
+type httpRequestKey struct{}
+
+// httpRequest returns the request for the rules matching on the HTTP requests
+func httpRequest(request *http.Request) *C.HTTPRequest {
+	u := *request.URL
+	if u.Scheme == "" {
+		u.Scheme = "http"
+		if request.TLS != nil {
+			u.Scheme = "https"
+		}
+	}
+	if u.Host == "" {
+		u.Host = request.Host
+	}
+	return &C.HTTPRequest{
+		Method: request.Method,
+		URL:    u.String(),
+		Header: request.Header,
+	}
+}
@@ -88,7 +88,12 @@ func HandleConn(c net.Conn, tunnel C.Tunnel, cache *lru.LruCache[string, bool],
 			if request.URL.Scheme == "" || request.URL.Host == "" {
 				resp = responseWith(request, http.StatusBadRequest)
 			} else {
-				request = request.WithContext(ctx)
+				request = request.WithContext(context.WithValue(ctx, httpRequestKey{}, httpRequest(request)))
+				if tunnel.ShouldParseHTTP() {
+					// the rules may route the requests to the same host differently,
+					// so the upstream connections are not reused
+					request.Close = true
+				}
 
 				startBackgroundRead := func() {
 					go func() {
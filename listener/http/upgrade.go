@@ -43,6 +43,7 @@ func handleUpgrade(conn net.Conn, request *http.Request, tunnel C.Tunnel, additi
 
 	left, right := N.Pipe()
 
+	additions = append(additions, inbound.WithHTTPRequest(httpRequest(request)))
 	go tunnel.HandleTCPConn(inbound.NewHTTP(dstAddr, conn, right, additions...))
 
 	var bufferedLeft *N.BufferedConn
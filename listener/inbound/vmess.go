@@ -11,6 +11,7 @@ type VmessOption struct {
 	BaseOption
 	Users       []VmessUser `inbound:"users"`
 	WsPath      string      `inbound:"ws-path,omitempty"`
+	XHTTPPath   string      `inbound:"xhttp-path,omitempty"`
 	Certificate string      `inbound:"certificate,omitempty"`
 	PrivateKey  string      `inbound:"private-key,omitempty"`
 	MuxOption   MuxOption   `inbound:"mux-option,omitempty"`
@@ -54,6 +55,7 @@ func NewVmess(options *VmessOption) (*Vmess, error) {
 			Listen:      base.RawAddress(),
 			Users:       users,
 			WsPath:      options.WsPath,
+			XHTTPPath:   options.XHTTPPath,
 			Certificate: options.Certificate,
 			PrivateKey:  options.PrivateKey,
 			MuxOption:   options.MuxOption.Build(),
@@ -14,17 +14,22 @@ import (
 	LC "github.com/metacubex/mihomo/listener/config"
 	"github.com/metacubex/mihomo/listener/sing"
 	"github.com/metacubex/mihomo/ntp"
+	"github.com/metacubex/mihomo/transport/splithttp"
 	mihomoVMess "github.com/metacubex/mihomo/transport/vmess"
 
+	"github.com/metacubex/quic-go/http3"
 	vmess "github.com/metacubex/sing-vmess"
 	"github.com/sagernet/sing/common"
 	"github.com/sagernet/sing/common/metadata"
+	"golang.org/x/exp/slices"
+	"golang.org/x/net/http2"
 )
 
 type Listener struct {
 	closed    bool
 	config    LC.VmessServer
 	listeners []net.Listener
+	h3Servers []*http3.Server
 	service   *vmess.Service[string]
 }
 
@@ -70,7 +75,7 @@ func New(config LC.VmessServer, tunnel C.Tunnel, additions ...inbound.Addition)
 		return nil, err
 	}
 
-	sl = &Listener{false, config, nil, service}
+	sl = &Listener{closed: false, config: config, service: service}
 
 	tlsConfig := &tls.Config{}
 	var httpMux *http.ServeMux
@@ -94,6 +99,19 @@ func New(config LC.VmessServer, tunnel C.Tunnel, additions ...inbound.Addition)
 		})
 		tlsConfig.NextProtos = append(tlsConfig.NextProtos, "http/1.1")
 	}
+	if config.XHTTPPath != "" {
+		if httpMux == nil {
+			httpMux = http.NewServeMux()
+		}
+		xhttpConfig := &splithttp.Config{Path: config.XHTTPPath}
+		httpMux.Handle(xhttpConfig.NormalizedPath(), splithttp.NewServerHandler(xhttpConfig, func(conn net.Conn) {
+			sl.HandleConn(conn, tunnel)
+		}))
+		tlsConfig.NextProtos = append([]string{"h2"}, tlsConfig.NextProtos...)
+		if !slices.Contains(tlsConfig.NextProtos, "http/1.1") {
+			tlsConfig.NextProtos = append(tlsConfig.NextProtos, "http/1.1")
+		}
+	}
 
 	for _, addr := range strings.Split(config.Listen, ",") {
 		addr := addr
@@ -108,9 +126,30 @@ func New(config LC.VmessServer, tunnel C.Tunnel, additions ...inbound.Addition)
 		}
 		sl.listeners = append(sl.listeners, l)
 
+		if config.XHTTPPath != "" && len(tlsConfig.Certificates) > 0 {
+			// HTTP/3 for xhttp
+			pc, err := net.ListenPacket("udp", addr)
+			if err != nil {
+				return nil, err
+			}
+			h3Server := &http3.Server{
+				Handler:   httpMux,
+				TLSConfig: http3.ConfigureTLSConfig(tlsConfig.Clone()),
+			}
+			sl.h3Servers = append(sl.h3Servers, h3Server)
+			go func() {
+				_ = h3Server.Serve(pc)
+				_ = pc.Close()
+			}()
+		}
+
 		go func() {
 			if httpMux != nil {
-				_ = http.Serve(l, httpMux)
+				server := &http.Server{Handler: httpMux}
+				if config.XHTTPPath != "" {
+					_ = http2.ConfigureServer(server, &http2.Server{})
+				}
+				_ = server.Serve(l)
 				return
 			}
 			for {
@@ -140,6 +179,12 @@ func (l *Listener) Close() error {
 			retErr = err
 		}
 	}
+	for _, h3Server := range l.h3Servers {
+		err := h3Server.Close()
+		if err != nil {
+			retErr = err
+		}
+	}
 	err := l.service.Close()
 	if err != nil {
 		retErr = err
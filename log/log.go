@@ -2,6 +2,7 @@ package log
 
 import (
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/metacubex/mihomo/common/observable"
@@ -79,6 +80,11 @@ func SetLevel(newLevel LogLevel) {
 	level = newLevel
 }
 
+// SetOutput redirects the log, which is written to stdout by default
+func SetOutput(out io.Writer) {
+	log.SetOutput(out)
+}
+
 func print(data Event) {
 	if data.LogLevel < level {
 		return
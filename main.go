@@ -3,20 +3,23 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"runtime"
 	"strings"
-	"sync"
 	"syscall"
-	"time"
 
+	"github.com/metacubex/mihomo/component/geodata/builder"
 	"github.com/metacubex/mihomo/config"
 	C "github.com/metacubex/mihomo/constant"
 	"github.com/metacubex/mihomo/constant/features"
 	"github.com/metacubex/mihomo/hub"
 	"github.com/metacubex/mihomo/hub/executor"
+	"github.com/metacubex/mihomo/hub/simulate"
+	"github.com/metacubex/mihomo/hub/subscription"
+	"github.com/metacubex/mihomo/hub/updater"
 	"github.com/metacubex/mihomo/log"
 
 	"go.uber.org/automaxprocs/maxprocs"
@@ -32,8 +35,7 @@ var (
 	externalController     string
 	externalControllerUnix string
 	secret                 string
-	updateGeoMux           sync.Mutex
-	updatingGeo            = false
+	simulateFile           string
 )
 
 func init() {
@@ -46,6 +48,7 @@ func init() {
 	flag.BoolVar(&geodataMode, "m", false, "set geodata mode")
 	flag.BoolVar(&version, "v", false, "show current version of mihomo")
 	flag.BoolVar(&testConfig, "t", false, "test configuration and exit")
+	flag.StringVar(&simulateFile, "sim", "", "simulate the routing of the test cases in the file and exit")
 	flag.Parse()
 }
 
@@ -61,6 +64,18 @@ func main() {
 		return
 	}
 
+	// mihomo convert [-full] [-o file] [subscription], the subscription is read from stdin by default
+	if flag.Arg(0) == "convert" {
+		convertSubscription(flag.Args()[1:])
+		return
+	}
+
+	// mihomo geodata [-site dir] [-ip dir] [-o dir]
+	if flag.Arg(0) == "geodata" {
+		buildGeodata(flag.Args()[1:])
+		return
+	}
+
 	if homeDir != "" {
 		if !filepath.IsAbs(homeDir) {
 			currentDir, _ := os.Getwd()
@@ -97,6 +112,25 @@ func main() {
 		return
 	}
 
+	if simulateFile != "" {
+		cfg, err := executor.Parse()
+		if err != nil {
+			log.Fatalln("Parse config error: %s", err.Error())
+		}
+		buf, err := os.ReadFile(simulateFile)
+		if err != nil {
+			log.Fatalln("Read test cases error: %s", err.Error())
+		}
+		failed, err := simulate.Run(cfg, buf, os.Stdout)
+		if err != nil {
+			log.Fatalln("Simulate error: %s", err.Error())
+		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
 	var options []hub.Option
 	if externalUI != "" {
 		options = append(options, hub.WithExternalUI(externalUI))
@@ -116,15 +150,9 @@ func main() {
 	}
 
 	if C.GeoAutoUpdate {
-		ticker := time.NewTicker(time.Duration(C.GeoUpdateInterval) * time.Hour)
-
 		log.Infoln("[GEO] Start update GEO database every %d hours", C.GeoUpdateInterval)
-		go func() {
-			for range ticker.C {
-				updateGeoDatabases()
-			}
-		}()
 	}
+	updater.StartGeoScheduler()
 
 	defer executor.Shutdown()
 
@@ -146,38 +174,92 @@ func main() {
 	}
 }
 
-func updateGeoDatabases() {
-	log.Infoln("[GEO] Start updating GEO database")
-	updateGeoMux.Lock()
+func convertSubscription(args []string) {
+	flags := flag.NewFlagSet("convert", flag.ExitOnError)
+	full := flags.Bool("full", false, "output a minimal config with a select and an url-test group instead of the proxies only")
+	output := flags.String("o", "", "write to the file instead of stdout")
+	_ = flags.Parse(args)
+	// the converted config may be written to stdout
+	log.SetOutput(os.Stderr)
 
-	if updatingGeo {
-		updateGeoMux.Unlock()
-		log.Infoln("[GEO] GEO database is updating, skip")
-		return
+	var (
+		buf []byte
+		err error
+	)
+	if path := flags.Arg(0); path != "" && path != "-" {
+		buf, err = os.ReadFile(path)
+	} else {
+		buf, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		log.Fatalln("Read subscription error: %s", err.Error())
 	}
 
-	updatingGeo = true
-	updateGeoMux.Unlock()
-
-	go func() {
-		defer func() {
-			updatingGeo = false
-		}()
+	result, err := subscription.Convert(buf)
+	if result != nil {
+		for _, skipped := range result.Skipped {
+			fmt.Fprintf(os.Stderr, "skipped %s: %s\n", skipped.Line, skipped.Reason)
+		}
+	}
+	if err != nil {
+		log.Fatalln("Convert subscription error: %s", err.Error())
+	}
+	buf, err = result.Marshal(*full)
+	if err != nil {
+		log.Fatalln("Marshal error: %s", err.Error())
+	}
 
-		log.Infoln("[GEO] Updating GEO database")
+	if *output == "" {
+		_, _ = os.Stdout.Write(buf)
+	} else if err := os.WriteFile(*output, buf, 0o644); err != nil {
+		log.Fatalln("Write error: %s", err.Error())
+	}
+	fmt.Fprintf(os.Stderr, "%d proxies converted, %d skipped\n", len(result.Proxies), len(result.Skipped))
+}
 
-		if err := config.UpdateGeoDatabases(); err != nil {
-			log.Errorln("[GEO] update GEO database error: %s", err.Error())
-			return
-		}
+func buildGeodata(args []string) {
+	flags := flag.NewFlagSet("geodata", flag.ExitOnError)
+	siteDir := flags.String("site", "", "directory of the domain lists, compiled into the geosite")
+	ipDir := flags.String("ip", "", "directory of the IP lists, compiled into the geoip and the mmdb")
+	output := flags.String("o", ".", "output directory")
+	_ = flags.Parse(args)
+	if *siteDir == "" && *ipDir == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
 
-		cfg, err := executor.ParseWithPath(C.Path.Config())
+	b := builder.New()
+	write := func(name string, lists int, writeTo func(io.Writer) error) {
+		path := filepath.Join(*output, name)
+		f, err := os.Create(path)
 		if err != nil {
-			log.Errorln("[GEO] update GEO database failed: %s", err.Error())
-			return
+			log.Fatalln("Write %s error: %s", path, err.Error())
 		}
-
-		log.Infoln("[GEO] Update GEO database success, apply new config")
-		executor.ApplyConfig(cfg, false)
-	}()
+		if err := writeTo(f); err != nil {
+			log.Fatalln("Write %s error: %s", path, err.Error())
+		}
+		if err := f.Close(); err != nil {
+			log.Fatalln("Write %s error: %s", path, err.Error())
+		}
+		log.Infoln("%s written, %d lists", path, lists)
+	}
+	if *siteDir != "" {
+		if err := b.AddSiteDir(*siteDir); err != nil {
+			log.Fatalln("Build geosite error: %s", err.Error())
+		}
+		write(C.GeositeName, b.SiteCount(), b.WriteGeoSite)
+		if !b.HasSite("cn") {
+			log.Warnln("%s has no cn list, it fails the check at startup and is replaced by the one of geox-url", C.GeositeName)
+		}
+	}
+	if *ipDir != "" {
+		if err := b.AddIPDir(*ipDir); err != nil {
+			log.Fatalln("Build geoip error: %s", err.Error())
+		}
+		write(C.GeoipName, b.IPCount(), b.WriteGeoIP)
+		if !b.HasIP("cn") {
+			log.Warnln("%s has no cn list, it fails the check at startup and is replaced by the one of geox-url", C.GeoipName)
+		}
+		write("geoip.metadb", b.IPCount(), b.WriteMMDB)
+	}
 }
@@ -2,6 +2,13 @@ package common
 
 import (
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/metacubex/mihomo/component/dialer"
+	C "github.com/metacubex/mihomo/constant"
 )
 
 var (
@@ -9,7 +16,10 @@ var (
 	noResolve  = "no-resolve"
 )
 
+const maxRetryAttempts = 100
+
 type Base struct {
+	options *C.RuleOptions
 }
 
 func (b *Base) ShouldFindProcess() bool {
@@ -20,6 +30,127 @@ func (b *Base) ShouldResolveIP() bool {
 	return false
 }
 
+func (b *Base) ShouldParseHTTP() bool {
+	return false
+}
+
+func (b *Base) IsVolatile() bool {
+	return false
+}
+
+func (b *Base) Options() *C.RuleOptions {
+	return b.options
+}
+
+func (b *Base) SetOptions(options *C.RuleOptions) {
+	b.options = options
+}
+
+// ParseOptions parses the dscp=<0-63|inherit>, ttl=<1-255>, retry=<attempts>,
+// retry-backoff=<min>[-<max>], retry-on=<timeout|refused|reset|unreachable>, fallback=<proxy>,
+// udp-timeout=<duration> and udp-nat=<endpoint-independent|address-dependent> params,
+// it returns nil if none of them are set
+func ParseOptions(params []string) (*C.RuleOptions, error) {
+	var options *C.RuleOptions
+	get := func() *C.RuleOptions {
+		if options == nil {
+			options = &C.RuleOptions{}
+		}
+		return options
+	}
+	retry := func() *C.RetryPolicy {
+		if get().Retry == nil {
+			policy := C.DefaultRetryPolicy
+			options.Retry = &policy
+		}
+		return options.Retry
+	}
+	for _, p := range params {
+		key, value, ok := strings.Cut(p, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "dscp":
+			dscp, err := dialer.ParseDSCP(value)
+			if err != nil {
+				return nil, err
+			}
+			get().DSCP = dscp
+		case "ttl":
+			ttl, err := strconv.Atoi(value)
+			if err == nil {
+				err = dialer.CheckSocketMark(0, ttl)
+			}
+			if err != nil || ttl == 0 {
+				return nil, fmt.Errorf("invalid TTL %s, must be 1-255", value)
+			}
+			get().TTL = ttl
+		case "retry":
+			attempts, err := strconv.Atoi(value)
+			if err != nil || attempts < 1 || attempts > maxRetryAttempts {
+				return nil, fmt.Errorf("invalid retry attempts %s, must be 1-%d", value, maxRetryAttempts)
+			}
+			retry().Attempts = attempts
+		case "retry-backoff":
+			minValue, maxValue, _ := strings.Cut(value, "-")
+			if maxValue == "" {
+				maxValue = minValue
+			}
+			min, err := time.ParseDuration(minValue)
+			if err != nil {
+				return nil, fmt.Errorf("invalid retry backoff %s: %w", value, err)
+			}
+			max, err := time.ParseDuration(maxValue)
+			if err != nil {
+				return nil, fmt.Errorf("invalid retry backoff %s: %w", value, err)
+			}
+			if min <= 0 || max < min {
+				return nil, fmt.Errorf("invalid retry backoff %s", value)
+			}
+			retry().BackoffMin, options.Retry.BackoffMax = min, max
+		case "retry-on":
+			var retryOn C.RetryOn
+			for _, name := range strings.Split(value, "|") {
+				switch name {
+				case "timeout":
+					retryOn |= C.RetryOnTimeout
+				case "refused":
+					retryOn |= C.RetryOnRefused
+				case "reset":
+					retryOn |= C.RetryOnReset
+				case "unreachable":
+					retryOn |= C.RetryOnUnreachable
+				default:
+					return nil, fmt.Errorf("invalid retry-on %s", name)
+				}
+			}
+			retry().RetryOn = retryOn
+		case "udp-timeout":
+			timeout, err := time.ParseDuration(value)
+			if err != nil || timeout <= 0 {
+				return nil, fmt.Errorf("invalid udp-timeout %s", value)
+			}
+			get().UDPTimeout = timeout
+		case "udp-nat":
+			switch value {
+			case C.EndpointIndependent.String(), "full-cone":
+				get().UDPMapping = C.EndpointIndependent
+			case C.AddressDependent.String():
+				get().UDPMapping = C.AddressDependent
+			default:
+				return nil, fmt.Errorf("invalid udp-nat %s", value)
+			}
+		case "fallback":
+			if value == "" {
+				return nil, errors.New("fallback requires a proxy name")
+			}
+			get().Fallback = value
+		}
+	}
+	return options, nil
+}
+
 func HasNoResolve(params []string) bool {
 	for _, p := range params {
 		if p == noResolve {
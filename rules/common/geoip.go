@@ -2,6 +2,7 @@ package common
 
 import (
 	"fmt"
+	"net/netip"
 	"strings"
 
 	"github.com/metacubex/mihomo/component/geodata"
@@ -41,12 +42,7 @@ func (g *GEOIP) Match(metadata *C.Metadata) (bool, string) {
 	}
 
 	if g.country == "lan" {
-		return ip.IsPrivate() ||
-			ip.IsUnspecified() ||
-			ip.IsLoopback() ||
-			ip.IsMulticast() ||
-			ip.IsLinkLocalUnicast() ||
-			resolver.IsFakeBroadcastIP(ip), g.adapter
+		return IsLAN(ip), g.adapter
 	}
 
 	for _, code := range metadata.DstGeoIP {
@@ -85,6 +81,16 @@ func (g *GEOIP) Match(metadata *C.Metadata) (bool, string) {
 	return match, g.adapter
 }
 
+// IsLAN reports whether ip matches GEOIP,lan
+func IsLAN(ip netip.Addr) bool {
+	return ip.IsPrivate() ||
+		ip.IsUnspecified() ||
+		ip.IsLoopback() ||
+		ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() ||
+		resolver.IsFakeBroadcastIP(ip)
+}
+
 func (g *GEOIP) Adapter() string {
 	return g.adapter
 }
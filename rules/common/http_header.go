@@ -0,0 +1,70 @@
+package common
+
+import (
+	"fmt"
+	"net/textproto"
+	"regexp"
+	"strings"
+
+	C "github.com/metacubex/mihomo/constant"
+)
+
+type HTTPHeader struct {
+	*Base
+	name    string
+	regex   *regexp.Regexp
+	payload string
+	adapter string
+}
+
+func (h *HTTPHeader) RuleType() C.RuleType {
+	return C.HTTPHeader
+}
+
+func (h *HTTPHeader) Match(metadata *C.Metadata) (bool, string) {
+	if metadata.HTTP == nil {
+		return false, h.adapter
+	}
+	for _, value := range metadata.HTTP.Header.Values(h.name) {
+		if h.regex.MatchString(value) {
+			return true, h.adapter
+		}
+	}
+	return false, h.adapter
+}
+
+func (h *HTTPHeader) Adapter() string {
+	return h.adapter
+}
+
+func (h *HTTPHeader) Payload() string {
+	return h.payload
+}
+
+func (h *HTTPHeader) ShouldParseHTTP() bool {
+	return true
+}
+
+func (h *HTTPHeader) IsVolatile() bool {
+	return true
+}
+
+// NewHTTPHeader parses "<name>:<regex>", e.g. "User-Agent:^curl/"
+func NewHTTPHeader(payload string, adapter string) (*HTTPHeader, error) {
+	name, regex, ok := strings.Cut(payload, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return nil, fmt.Errorf("parse HTTP-HEADER rule fail: %s is not in the form of name:regex", payload)
+	}
+	r, err := regexp.Compile(regex)
+	if err != nil {
+		return nil, fmt.Errorf("parse HTTP-HEADER rule fail: %w", err)
+	}
+	return &HTTPHeader{
+		Base:    &Base{},
+		name:    textproto.CanonicalMIMEHeaderKey(name),
+		regex:   r,
+		payload: payload,
+		adapter: adapter,
+	}, nil
+}
@@ -0,0 +1,65 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+
+	C "github.com/metacubex/mihomo/constant"
+)
+
+type HTTPMethod struct {
+	*Base
+	methods []string
+	payload string
+	adapter string
+}
+
+func (h *HTTPMethod) RuleType() C.RuleType {
+	return C.HTTPMethod
+}
+
+func (h *HTTPMethod) Match(metadata *C.Metadata) (bool, string) {
+	if metadata.HTTP == nil {
+		return false, h.adapter
+	}
+	for _, method := range h.methods {
+		if strings.EqualFold(method, metadata.HTTP.Method) {
+			return true, h.adapter
+		}
+	}
+	return false, h.adapter
+}
+
+func (h *HTTPMethod) Adapter() string {
+	return h.adapter
+}
+
+func (h *HTTPMethod) Payload() string {
+	return h.payload
+}
+
+func (h *HTTPMethod) ShouldParseHTTP() bool {
+	return true
+}
+
+func (h *HTTPMethod) IsVolatile() bool {
+	return true
+}
+
+// NewHTTPMethod parses methods separated by "/", e.g. "POST/PUT"
+func NewHTTPMethod(payload string, adapter string) (*HTTPMethod, error) {
+	var methods []string
+	for _, method := range strings.Split(payload, "/") {
+		method = strings.TrimSpace(method)
+		if method == "" {
+			return nil, fmt.Errorf("parse HTTP-METHOD rule fail: empty method in %s", payload)
+		}
+		methods = append(methods, strings.ToUpper(method))
+	}
+	return &HTTPMethod{
+		Base:    &Base{},
+		methods: methods,
+		payload: payload,
+		adapter: adapter,
+	}, nil
+}
@@ -38,6 +38,10 @@ func (p *Port) Payload() string {
 	return p.port
 }
 
+func (p *Port) IsVolatile() bool {
+	return p.ruleType == C.SrcPort
+}
+
 func NewPort(port string, adapter string, ruleType C.RuleType) (*Port, error) {
 	portRanges, err := utils.NewUnsignedRanges[uint16](port)
 	if err != nil {
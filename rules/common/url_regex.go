@@ -0,0 +1,52 @@
+package common
+
+import (
+	"regexp"
+
+	C "github.com/metacubex/mihomo/constant"
+)
+
+type URLRegex struct {
+	*Base
+	regex   *regexp.Regexp
+	adapter string
+}
+
+func (u *URLRegex) RuleType() C.RuleType {
+	return C.URLRegex
+}
+
+func (u *URLRegex) Match(metadata *C.Metadata) (bool, string) {
+	if metadata.HTTP == nil {
+		return false, u.adapter
+	}
+	return u.regex.MatchString(metadata.HTTP.URL), u.adapter
+}
+
+func (u *URLRegex) Adapter() string {
+	return u.adapter
+}
+
+func (u *URLRegex) Payload() string {
+	return u.regex.String()
+}
+
+func (u *URLRegex) ShouldParseHTTP() bool {
+	return true
+}
+
+func (u *URLRegex) IsVolatile() bool {
+	return true
+}
+
+func NewURLRegex(regex string, adapter string) (*URLRegex, error) {
+	r, err := regexp.Compile(regex)
+	if err != nil {
+		return nil, err
+	}
+	return &URLRegex{
+		Base:    &Base{},
+		regex:   r,
+		adapter: adapter,
+	}, nil
+}
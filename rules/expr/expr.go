@@ -0,0 +1,106 @@
+// Package expr implements the EXPR rule, which evaluates a typed expression over the
+// metadata of a connection, e.g. EXPR,dst_port > 1024 and not private(dst_ip),PROXY
+//
+// The operands are the fields host, network, protocol (sniffed), in_type, in_name, in_user,
+// process, process_path (strings), in_port, dst_port, src_port, dscp, uid (ints), dst_ip,
+// src_ip (IPs), the literals and the functions geoip(code), src_geoip(code), geosite(name),
+// rule_set(name) and private(ip). The operators are ==, !=, <, <=, >, >=, =~ (regexp),
+// in and not in followed by a literal or a list like [80, 443, 8000-9000] or
+// [10.0.0.0/8, "fd00::/8"], and, or, not (or &&, ||, !) and the parentheses.
+package expr
+
+import (
+	"fmt"
+
+	C "github.com/metacubex/mihomo/constant"
+	"github.com/metacubex/mihomo/rules/common"
+)
+
+type Expr struct {
+	*common.Base
+	payload string
+	adapter string
+	match   func(*C.Metadata) bool
+
+	needIP      bool
+	needProcess bool
+	volatile    bool
+	rules       []C.Rule // the rules of the geoip, src_geoip, geosite and rule_set calls
+}
+
+func (e *Expr) RuleType() C.RuleType {
+	return C.Expr
+}
+
+func (e *Expr) Match(metadata *C.Metadata) (bool, string) {
+	return e.match(metadata), e.adapter
+}
+
+func (e *Expr) Adapter() string {
+	return e.adapter
+}
+
+func (e *Expr) Payload() string {
+	return e.payload
+}
+
+func (e *Expr) ShouldResolveIP() bool {
+	if e.needIP {
+		return true
+	}
+	for _, rule := range e.rules {
+		if rule.ShouldResolveIP() {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Expr) ShouldFindProcess() bool {
+	if e.needProcess {
+		return true
+	}
+	for _, rule := range e.rules {
+		if rule.ShouldFindProcess() {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Expr) ShouldParseHTTP() bool {
+	for _, rule := range e.rules {
+		if rule.ShouldParseHTTP() {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Expr) IsVolatile() bool {
+	if e.volatile {
+		return true
+	}
+	for _, rule := range e.rules {
+		if rule.IsVolatile() {
+			return true
+		}
+	}
+	return false
+}
+
+// New compiles the expression, the errors tell the offset in it
+func New(payload, adapter string) (*Expr, error) {
+	tokens, err := lex(payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %w", err)
+	}
+	e := &Expr{Base: &common.Base{}, payload: payload, adapter: adapter}
+	e.match, err = (&parser{tokens: tokens, expr: e}).parse()
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %w", err)
+	}
+	return e, nil
+}
+
+var _ C.Rule = (*Expr)(nil)
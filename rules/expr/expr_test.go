@@ -0,0 +1,94 @@
+package expr
+
+import (
+	"net/netip"
+	"testing"
+
+	C "github.com/metacubex/mihomo/constant"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatch(t *testing.T) {
+	metadata := &C.Metadata{
+		NetWork:       C.TCP,
+		Type:          C.SOCKS5,
+		Host:          "www.example.com",
+		DstIP:         netip.MustParseAddr("203.0.113.1"),
+		DstPort:       8443,
+		SrcIP:         netip.MustParseAddr("192.168.1.2"),
+		InName:        "socks-in",
+		Process:       "curl",
+		SniffProtocol: "tls",
+	}
+	for payload, expected := range map[string]bool{
+		`dst_port > 1024 and not private(dst_ip)`:                            true,
+		`dst_port > 1024 && !private(src_ip)`:                                false,
+		`dst_port in [80, 443, 8000-9000]`:                                   true,
+		`dst_port not in 8000-9000`:                                          false,
+		`dst_ip in [10.0.0.0/8, 203.0.113.0/24]`:                             true,
+		`src_ip in "fd00::/8"`:                                               false,
+		`dst_ip == "203.0.113.1" or dst_ip == 1.1.1.1`:                       true,
+		`host =~ "\\.example\\.com$" and network == "tcp"`:                   true,
+		`host in ["example.com", "example.org"]`:                             false,
+		`(in_type == "SOCKS5" || in_name == "http-in") && process == "curl"`: true,
+		`protocol == "tls" and not (dst_port == 443)`:                        true,
+		`private(dst_ip) == false`:                                           true,
+	} {
+		e, err := New(payload, "PROXY")
+		require.NoError(t, err, payload)
+		matched, adapter := e.Match(metadata)
+		assert.Equal(t, expected, matched, payload)
+		assert.Equal(t, "PROXY", adapter)
+	}
+
+	// the IP is unknown before resolving
+	e, err := New(`dst_ip in 0.0.0.0/0`, "PROXY")
+	require.NoError(t, err)
+	matched, _ := e.Match(&C.Metadata{Host: "example.com"})
+	assert.False(t, matched)
+}
+
+func TestFlags(t *testing.T) {
+	e, err := New(`host == "example.com"`, "DIRECT")
+	require.NoError(t, err)
+	assert.False(t, e.ShouldResolveIP())
+	assert.False(t, e.ShouldFindProcess())
+	assert.False(t, e.IsVolatile())
+
+	e, err = New(`dst_ip in 10.0.0.0/8 or process == "curl" or src_port < 1024`, "DIRECT")
+	require.NoError(t, err)
+	assert.True(t, e.ShouldResolveIP())
+	assert.True(t, e.ShouldFindProcess())
+	assert.True(t, e.IsVolatile())
+}
+
+func TestError(t *testing.T) {
+	for _, payload := range []string{
+		``,
+		`dst_port`,
+		`dst_port == "443"`,
+		`host > "a"`,
+		`host =~ host`,
+		`host =~ "("`,
+		`dst_ip == "example.com"`,
+		`dst_ip == 10.0.0.0/8`,
+		`dst_port in ["a"]`,
+		`dst_port in [1, 2`,
+		`unknown == 1`,
+		`unknown(host)`,
+		`private(host)`,
+		`geoip(host)`,
+		`host == "unterminated`,
+		`dst_port == 1 and`,
+		`dst_port == 1)`,
+		`1abc == 1`,
+		`host == "a" @`,
+	} {
+		_, err := New(payload, "DIRECT")
+		assert.Error(t, err, payload)
+	}
+	_, err := New(`dst_port == "443"`, "DIRECT")
+	assert.EqualError(t, err, `invalid expression at 9: int == string`)
+}
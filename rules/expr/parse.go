@@ -0,0 +1,587 @@
+package expr
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+
+	C "github.com/metacubex/mihomo/constant"
+	RC "github.com/metacubex/mihomo/rules/common"
+	RP "github.com/metacubex/mihomo/rules/provider"
+)
+
+type tokenKind uint8
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokInt
+	tokAddr // an IP or a CIDR starting with a digit, the others have to be quoted
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+var operators = []string{"==", "!=", "<=", ">=", "=~", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ",", "-"}
+
+func lex(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case isLetter(c):
+			j := i
+			for j < len(s) && (isLetter(s[j]) || isDigit(s[j])) {
+				j++
+			}
+			tokens = append(tokens, token{tokIdent, s[i:j], i})
+			i = j
+		case isDigit(c):
+			j := i
+			for j < len(s) && (isDigit(s[j]) || isLetter(s[j]) || s[j] == '.' || s[j] == ':' || s[j] == '/') {
+				j++
+			}
+			text := s[i:j]
+			kind := tokInt
+			if strings.ContainsAny(text, ".:/") {
+				kind = tokAddr
+			} else if _, err := strconv.Atoi(text); err != nil {
+				return nil, fmt.Errorf("at %d: invalid number %q", i, text)
+			}
+			tokens = append(tokens, token{kind, text, i})
+			i = j
+		case c == '"':
+			j := i + 1
+			for j < len(s) && s[j] != '"' {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("at %d: unterminated string", i)
+			}
+			text, err := strconv.Unquote(s[i : j+1])
+			if err != nil {
+				return nil, fmt.Errorf("at %d: invalid string %s", i, s[i:j+1])
+			}
+			tokens = append(tokens, token{tokString, text, i})
+			i = j + 1
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(s[i:], op) {
+					tokens = append(tokens, token{tokOp, op, i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("at %d: unexpected %q", i, c)
+			}
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(s)}), nil
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+type kind uint8
+
+const (
+	kindBool kind = iota
+	kindInt
+	kindString
+	kindIP
+)
+
+func (k kind) String() string {
+	switch k {
+	case kindBool:
+		return "bool"
+	case kindInt:
+		return "int"
+	case kindString:
+		return "string"
+	default:
+		return "ip"
+	}
+}
+
+// node is a compiled expression, the function of its kind is set
+type node struct {
+	kind kind
+	lit  *token // the literal of the node, a string literal can be used as an IP
+
+	b  func(*C.Metadata) bool
+	i  func(*C.Metadata) int
+	s  func(*C.Metadata) string
+	ip func(*C.Metadata) netip.Addr
+}
+
+type field struct {
+	node
+	needIP      bool
+	needProcess bool
+	volatile    bool
+}
+
+var fields = map[string]field{
+	"host":         {node: node{kind: kindString, s: func(m *C.Metadata) string { return m.RuleHost() }}},
+	"network":      {node: node{kind: kindString, s: func(m *C.Metadata) string { return m.NetWork.String() }}},
+	"protocol":     {node: node{kind: kindString, s: func(m *C.Metadata) string { return m.SniffProtocol }}},
+	"in_type":      {node: node{kind: kindString, s: func(m *C.Metadata) string { return strings.ToUpper(m.Type.String()) }}},
+	"in_name":      {node: node{kind: kindString, s: func(m *C.Metadata) string { return m.InName }}},
+	"in_user":      {node: node{kind: kindString, s: func(m *C.Metadata) string { return m.InUser }}},
+	"in_port":      {node: node{kind: kindInt, i: func(m *C.Metadata) int { return int(m.InPort) }}},
+	"dst_port":     {node: node{kind: kindInt, i: func(m *C.Metadata) int { return int(m.DstPort) }}},
+	"src_port":     {node: node{kind: kindInt, i: func(m *C.Metadata) int { return int(m.SrcPort) }}, volatile: true},
+	"dscp":         {node: node{kind: kindInt, i: func(m *C.Metadata) int { return int(m.DSCP) }}},
+	"dst_ip":       {node: node{kind: kindIP, ip: func(m *C.Metadata) netip.Addr { return m.DstIP }}, needIP: true},
+	"src_ip":       {node: node{kind: kindIP, ip: func(m *C.Metadata) netip.Addr { return m.SrcIP }}},
+	"process":      {node: node{kind: kindString, s: func(m *C.Metadata) string { return m.Process }}, needProcess: true},
+	"process_path": {node: node{kind: kindString, s: func(m *C.Metadata) string { return m.ProcessPath }}, needProcess: true},
+	"uid":          {node: node{kind: kindInt, i: func(m *C.Metadata) int { return int(m.Uid) }}, needProcess: true},
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	expr   *Expr
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is one of the operators or keywords
+func (p *parser) accept(texts ...string) bool {
+	t := p.peek()
+	if t.kind != tokOp && t.kind != tokIdent {
+		return false
+	}
+	for _, text := range texts {
+		if t.text == text || (t.kind == tokIdent && strings.EqualFold(t.text, text)) {
+			p.pos++
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		t := p.peek()
+		return fmt.Errorf("at %d: expected %q, got %s", t.pos, text, t)
+	}
+	return nil
+}
+
+func (p *parser) parse() (func(*C.Metadata) bool, error) {
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("at %d: unexpected %s", t.pos, t)
+	}
+	if n.kind != kindBool {
+		return nil, fmt.Errorf("at 0: the result is %s, not bool", n.kind)
+	}
+	return n.b, nil
+}
+
+func (p *parser) parseOr() (*node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		pos := p.peek().pos
+		if !p.accept("or", "||") {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if left.kind != kindBool || right.kind != kindBool {
+			return nil, fmt.Errorf("at %d: or of %s and %s", pos, left.kind, right.kind)
+		}
+		l, r := left.b, right.b
+		left = &node{kind: kindBool, b: func(m *C.Metadata) bool { return l(m) || r(m) }}
+	}
+}
+
+func (p *parser) parseAnd() (*node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		pos := p.peek().pos
+		if !p.accept("and", "&&") {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if left.kind != kindBool || right.kind != kindBool {
+			return nil, fmt.Errorf("at %d: and of %s and %s", pos, left.kind, right.kind)
+		}
+		l, r := left.b, right.b
+		left = &node{kind: kindBool, b: func(m *C.Metadata) bool { return l(m) && r(m) }}
+	}
+}
+
+func (p *parser) parseUnary() (*node, error) {
+	pos := p.peek().pos
+	if p.accept("not", "!") {
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if n.kind != kindBool {
+			return nil, fmt.Errorf("at %d: not of %s", pos, n.kind)
+		}
+		b := n.b
+		return &node{kind: kindBool, b: func(m *C.Metadata) bool { return !b(m) }}, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *parser) parseCompare() (*node, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	switch {
+	case t.kind == tokOp && (t.text == "==" || t.text == "!=" || t.text == "<" || t.text == "<=" || t.text == ">" || t.text == ">=" || t.text == "=~"):
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return compare(left, t, right)
+	case p.accept("in"):
+		return p.parseSet(left, t.pos, false)
+	case t.kind == tokIdent && strings.EqualFold(t.text, "not") && p.tokens[p.pos+1].kind == tokIdent && strings.EqualFold(p.tokens[p.pos+1].text, "in"):
+		p.pos += 2
+		return p.parseSet(left, t.pos, true)
+	}
+	return left, nil
+}
+
+func (p *parser) parseOperand() (*node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokInt:
+		v, _ := strconv.Atoi(t.text)
+		return &node{kind: kindInt, lit: &t, i: func(*C.Metadata) int { return v }}, nil
+	case tokString:
+		return &node{kind: kindString, lit: &t, s: func(*C.Metadata) string { return t.text }}, nil
+	case tokAddr:
+		ip, err := netip.ParseAddr(t.text)
+		if err != nil {
+			if strings.Contains(t.text, "/") {
+				return nil, fmt.Errorf("at %d: a CIDR can only follow in", t.pos)
+			}
+			return nil, fmt.Errorf("at %d: invalid IP %s", t.pos, t.text)
+		}
+		return &node{kind: kindIP, lit: &t, ip: func(*C.Metadata) netip.Addr { return ip }}, nil
+	case tokIdent:
+		switch strings.ToLower(t.text) {
+		case "true", "false":
+			v := strings.EqualFold(t.text, "true")
+			return &node{kind: kindBool, lit: &t, b: func(*C.Metadata) bool { return v }}, nil
+		}
+		if p.accept("(") {
+			return p.parseCall(t)
+		}
+		f, ok := fields[strings.ToLower(t.text)]
+		if !ok {
+			return nil, fmt.Errorf("at %d: unknown field %s", t.pos, t.text)
+		}
+		p.expr.needIP = p.expr.needIP || f.needIP
+		p.expr.needProcess = p.expr.needProcess || f.needProcess
+		p.expr.volatile = p.expr.volatile || f.volatile
+		n := f.node
+		return &n, nil
+	case tokOp:
+		if t.text == "(" {
+			n, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		}
+	}
+	return nil, fmt.Errorf("at %d: unexpected %s", t.pos, t)
+}
+
+func (p *parser) parseCall(name token) (*node, error) {
+	var args []*node
+	if !p.accept(")") {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.accept(")") {
+				break
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	fn := strings.ToLower(name.text)
+	switch fn {
+	case "private":
+		if len(args) != 1 || args[0].kind != kindIP {
+			return nil, fmt.Errorf("at %d: private takes an ip", name.pos)
+		}
+		ip := args[0].ip
+		return &node{kind: kindBool, b: func(m *C.Metadata) bool {
+			addr := ip(m)
+			return addr.IsValid() && RC.IsLAN(addr)
+		}}, nil
+	case "geoip", "src_geoip", "geosite", "rule_set":
+		if len(args) != 1 || args[0].kind != kindString || args[0].lit == nil {
+			return nil, fmt.Errorf("at %d: %s takes a string literal", name.pos, fn)
+		}
+		arg := args[0].lit.text
+		var (
+			rule C.Rule
+			err  error
+		)
+		switch fn {
+		case "geoip":
+			rule, err = RC.NewGEOIP(arg, "", false, false)
+		case "src_geoip":
+			rule, err = RC.NewGEOIP(arg, "", true, true)
+		case "geosite":
+			rule, err = RC.NewGEOSITE(arg, "")
+		default:
+			rule, err = RP.NewRuleSet(arg, "", false)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("at %d: %s(%q): %w", name.pos, fn, arg, err)
+		}
+		p.expr.rules = append(p.expr.rules, rule)
+		return &node{kind: kindBool, b: func(m *C.Metadata) bool {
+			matched, _ := rule.Match(m)
+			return matched
+		}}, nil
+	}
+	return nil, fmt.Errorf("at %d: unknown function %s", name.pos, name.text)
+}
+
+// asIP converts a string literal to an IP literal for comparing with an IP
+func asIP(n *node) (*node, error) {
+	if n.kind != kindString || n.lit == nil {
+		return n, nil
+	}
+	ip, err := netip.ParseAddr(n.lit.text)
+	if err != nil {
+		return nil, fmt.Errorf("at %d: invalid IP %s", n.lit.pos, n.lit)
+	}
+	return &node{kind: kindIP, lit: n.lit, ip: func(*C.Metadata) netip.Addr { return ip }}, nil
+}
+
+func compare(left *node, op token, right *node) (*node, error) {
+	var err error
+	if left.kind == kindIP {
+		right, err = asIP(right)
+	} else if right.kind == kindIP {
+		left, err = asIP(left)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if left.kind != right.kind {
+		return nil, fmt.Errorf("at %d: %s %s %s", op.pos, left.kind, op.text, right.kind)
+	}
+
+	equal := op.text == "==" || op.text == "<=" || op.text == ">="
+	switch left.kind {
+	case kindInt:
+		l, r := left.i, right.i
+		var cmp func(a, b int) bool
+		switch op.text {
+		case "==":
+			cmp = func(a, b int) bool { return a == b }
+		case "!=":
+			cmp = func(a, b int) bool { return a != b }
+		case "<":
+			cmp = func(a, b int) bool { return a < b }
+		case "<=":
+			cmp = func(a, b int) bool { return a <= b }
+		case ">":
+			cmp = func(a, b int) bool { return a > b }
+		case ">=":
+			cmp = func(a, b int) bool { return a >= b }
+		default:
+			return nil, fmt.Errorf("at %d: int %s int", op.pos, op.text)
+		}
+		return &node{kind: kindBool, b: func(m *C.Metadata) bool { return cmp(l(m), r(m)) }}, nil
+	case kindString:
+		l, r := left.s, right.s
+		switch op.text {
+		case "==", "!=":
+			return &node{kind: kindBool, b: func(m *C.Metadata) bool { return (l(m) == r(m)) == equal }}, nil
+		case "=~":
+			if right.lit == nil {
+				return nil, fmt.Errorf("at %d: =~ takes a string literal", op.pos)
+			}
+			regex, err := regexp.Compile(right.lit.text)
+			if err != nil {
+				return nil, fmt.Errorf("at %d: %w", right.lit.pos, err)
+			}
+			return &node{kind: kindBool, b: func(m *C.Metadata) bool { return regex.MatchString(l(m)) }}, nil
+		}
+	case kindIP:
+		l, r := left.ip, right.ip
+		switch op.text {
+		case "==", "!=":
+			return &node{kind: kindBool, b: func(m *C.Metadata) bool { return (l(m) == r(m)) == equal }}, nil
+		}
+	case kindBool:
+		l, r := left.b, right.b
+		switch op.text {
+		case "==", "!=":
+			return &node{kind: kindBool, b: func(m *C.Metadata) bool { return (l(m) == r(m)) == equal }}, nil
+		}
+	}
+	return nil, fmt.Errorf("at %d: %s %s %s", op.pos, left.kind, op.text, right.kind)
+}
+
+// parseSet parses the list or the single item after in, the items are literals
+// of the kind of left, ints can be ranges like 1000-2000 and IPs can be CIDRs
+func (p *parser) parseSet(left *node, pos int, negate bool) (*node, error) {
+	var (
+		ranges   [][2]int
+		strs     = map[string]struct{}{}
+		prefixes []netip.Prefix
+	)
+	item := func() error {
+		t := p.next()
+		switch {
+		case left.kind == kindInt && t.kind == tokInt:
+			lo, _ := strconv.Atoi(t.text)
+			hi := lo
+			if p.accept("-") {
+				end := p.next()
+				if end.kind != tokInt {
+					return fmt.Errorf("at %d: invalid range end %s", end.pos, end)
+				}
+				hi, _ = strconv.Atoi(end.text)
+			}
+			ranges = append(ranges, [2]int{lo, hi})
+		case left.kind == kindString && t.kind == tokString:
+			strs[t.text] = struct{}{}
+		case left.kind == kindIP && (t.kind == tokAddr || t.kind == tokString):
+			prefix, err := netip.ParsePrefix(t.text)
+			if err != nil {
+				ip, ipErr := netip.ParseAddr(t.text)
+				if ipErr != nil {
+					return fmt.Errorf("at %d: invalid CIDR %s", t.pos, t)
+				}
+				prefix = netip.PrefixFrom(ip, ip.BitLen())
+			}
+			prefixes = append(prefixes, prefix.Masked())
+		default:
+			return fmt.Errorf("at %d: %s in %s", t.pos, left.kind, t)
+		}
+		return nil
+	}
+
+	if p.accept("[") {
+		for {
+			if err := item(); err != nil {
+				return nil, err
+			}
+			if p.accept("]") {
+				break
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	} else if err := item(); err != nil {
+		return nil, err
+	}
+
+	var in func(m *C.Metadata) bool
+	switch left.kind {
+	case kindInt:
+		l := left.i
+		in = func(m *C.Metadata) bool {
+			v := l(m)
+			for _, r := range ranges {
+				if r[0] <= v && v <= r[1] {
+					return true
+				}
+			}
+			return false
+		}
+	case kindString:
+		l := left.s
+		in = func(m *C.Metadata) bool {
+			_, ok := strs[l(m)]
+			return ok
+		}
+	case kindIP:
+		l := left.ip
+		in = func(m *C.Metadata) bool {
+			ip := l(m).Unmap()
+			for _, prefix := range prefixes {
+				if prefix.Contains(ip) {
+					return true
+				}
+			}
+			return false
+		}
+	default:
+		return nil, fmt.Errorf("at %d: in of %s", pos, left.kind)
+	}
+	if negate {
+		return &node{kind: kindBool, b: func(m *C.Metadata) bool { return !in(m) }}, nil
+	}
+	return &node{kind: kindBool, b: in}, nil
+}
@@ -0,0 +1,317 @@
+// Package index compiles the consecutive DOMAIN, DOMAIN-SUFFIX, IP-CIDR, GEOIP and
+// port rules into blocks of tables, so finding the first matching rule of a block
+// costs a few map lookups instead of evaluating the rules one by one.
+package index
+
+import (
+	"net/netip"
+	"sort"
+
+	"github.com/metacubex/mihomo/common/utils"
+	"github.com/metacubex/mihomo/component/mmdb"
+	C "github.com/metacubex/mihomo/constant"
+	RC "github.com/metacubex/mihomo/rules/common"
+)
+
+// shorter runs are cheaper to be evaluated one by one
+const minBlockSize = 8
+
+// Index finds the first rule matching a metadata with the same result as
+// evaluating the rules in order
+type Index struct {
+	rules  []C.Rule
+	blocks []*block // blocks[i] is the block starting at or containing rules[i], nil if not indexed
+}
+
+func New(rules []C.Rule) *Index {
+	idx := &Index{rules: rules, blocks: make([]*block, len(rules))}
+	for start := 0; start < len(rules); {
+		end := start
+		for end < len(rules) && indexable(rules[end]) {
+			end++
+		}
+		if end-start >= minBlockSize {
+			b := newBlock(rules, start, end)
+			for i := start; i < end; i++ {
+				idx.blocks[i] = b
+			}
+		}
+		if end == start {
+			end++
+		}
+		start = end
+	}
+	return idx
+}
+
+// Next returns the index of the first rule at or after start matching metadata and the
+// adapter returned by the rule, the index is -1 if no rule matches.
+// prepare is called before a rule is evaluated when the rule may need the lookups of
+// DNS or process, for an indexed block it is called with the first rule to evaluate and
+// with the earliest rule requiring the destination IP only if no earlier rule matches
+func (idx *Index) Next(metadata *C.Metadata, start int, prepare func(rule C.Rule)) (int, string) {
+	for i := start; i < len(idx.rules); {
+		if b := idx.blocks[i]; b != nil {
+			if matched := b.match(idx.rules, metadata, i, prepare); matched >= 0 {
+				return matched, idx.rules[matched].Adapter()
+			}
+			i = b.end
+			continue
+		}
+		rule := idx.rules[i]
+		prepare(rule)
+		if matched, adapter := rule.Match(metadata); matched {
+			return i, adapter
+		}
+		i++
+	}
+	return -1, ""
+}
+
+func indexable(rule C.Rule) bool {
+	switch r := rule.(type) {
+	case *RC.Domain, *RC.DomainSuffix, *RC.IPCIDR, *RC.Port:
+		return true
+	case *RC.GEOIP:
+		// the matchers of geodata and the lookups of the source IP are evaluated one by one
+		return r.GetIPMatcher() == nil && (r.RuleType() == C.GEOIP || r.GetCountry() == "lan")
+	}
+	return false
+}
+
+type block struct {
+	start, end int
+
+	domains   map[string][]int
+	suffixes  map[string][]int
+	dstCIDR   cidrTable
+	srcCIDR   cidrTable
+	dstGeoIP  map[string][]int
+	dstLAN    []int
+	srcLAN    []int
+	dstPort   portTable
+	srcPort   portTable
+	inPort    portTable
+	resolveIP []int // the rules requiring the destination IP
+}
+
+func newBlock(rules []C.Rule, start, end int) *block {
+	b := &block{
+		start:    start,
+		end:      end,
+		domains:  map[string][]int{},
+		suffixes: map[string][]int{},
+		dstGeoIP: map[string][]int{},
+	}
+	var dstPorts, srcPorts, inPorts []portRule
+	for i := start; i < end; i++ {
+		rule := rules[i]
+		if rule.ShouldResolveIP() {
+			b.resolveIP = append(b.resolveIP, i)
+		}
+		switch r := rule.(type) {
+		case *RC.Domain:
+			b.domains[r.Payload()] = append(b.domains[r.Payload()], i)
+		case *RC.DomainSuffix:
+			b.suffixes[r.Payload()] = append(b.suffixes[r.Payload()], i)
+		case *RC.IPCIDR:
+			prefix := netip.MustParsePrefix(r.Payload())
+			if r.RuleType() == C.SrcIPCIDR {
+				b.srcCIDR.insert(prefix, i)
+			} else {
+				b.dstCIDR.insert(prefix, i)
+			}
+		case *RC.GEOIP:
+			switch {
+			case r.GetCountry() == "lan" && r.RuleType() == C.SrcGEOIP:
+				b.srcLAN = append(b.srcLAN, i)
+			case r.GetCountry() == "lan":
+				b.dstLAN = append(b.dstLAN, i)
+			default:
+				b.dstGeoIP[r.GetCountry()] = append(b.dstGeoIP[r.GetCountry()], i)
+			}
+		case *RC.Port:
+			ranges, _ := utils.NewUnsignedRanges[uint16](r.Payload())
+			switch r.RuleType() {
+			case C.SrcPort:
+				srcPorts = append(srcPorts, portRule{ranges, i})
+			case C.InPort:
+				inPorts = append(inPorts, portRule{ranges, i})
+			default:
+				dstPorts = append(dstPorts, portRule{ranges, i})
+			}
+		}
+	}
+	b.dstPort = newPortTable(dstPorts)
+	b.srcPort = newPortTable(srcPorts)
+	b.inPort = newPortTable(inPorts)
+	return b
+}
+
+func (b *block) match(rules []C.Rule, metadata *C.Metadata, start int, prepare func(rule C.Rule)) int {
+	prepare(rules[start])
+	matched := b.lookup(metadata, start)
+	if metadata.DstIP.IsValid() || metadata.Host == "" {
+		return matched
+	}
+	// the destination IP is unknown, the rules before the first one requiring
+	// it are matched without the IP as evaluating them in order
+	resolveAt := first(b.resolveIP, start)
+	if resolveAt <= start || (matched >= 0 && matched < resolveAt) {
+		return matched
+	}
+	prepare(rules[resolveAt])
+	return b.lookup(metadata, resolveAt)
+}
+
+// lookup returns the first rule at or after start in the block matching metadata
+func (b *block) lookup(metadata *C.Metadata, start int) int {
+	matched := -1
+	found := func(indexes []int) {
+		if i := first(indexes, start); i >= 0 && (matched < 0 || i < matched) {
+			matched = i
+		}
+	}
+
+	host := metadata.RuleHost()
+	found(b.domains[host])
+	if len(b.suffixes) > 0 {
+		found(b.suffixes[host])
+		for i := 0; i < len(host); i++ {
+			if host[i] == '.' {
+				found(b.suffixes[host[i+1:]])
+			}
+		}
+	}
+
+	found(b.dstPort.lookup(metadata.DstPort))
+	found(b.srcPort.lookup(metadata.SrcPort))
+	found(b.inPort.lookup(metadata.InPort))
+
+	if ip := metadata.SrcIP; ip.IsValid() {
+		b.srcCIDR.lookup(ip, found)
+		if len(b.srcLAN) > 0 && RC.IsLAN(ip) {
+			found(b.srcLAN)
+		}
+	}
+
+	if ip := metadata.DstIP; ip.IsValid() {
+		b.dstCIDR.lookup(ip, found)
+		if len(b.dstLAN) > 0 && RC.IsLAN(ip) {
+			found(b.dstLAN)
+		}
+		if len(b.dstGeoIP) > 0 {
+			if metadata.DstGeoIP == nil {
+				metadata.DstGeoIP = mmdb.IPInstance().LookupCode(ip.AsSlice())
+			}
+			for _, code := range metadata.DstGeoIP {
+				found(b.dstGeoIP[code])
+			}
+		}
+	}
+	return matched
+}
+
+// first returns the first index at or after start in the sorted indexes, or -1
+func first(indexes []int, start int) int {
+	if i := sort.SearchInts(indexes, start); i < len(indexes) {
+		return indexes[i]
+	}
+	return -1
+}
+
+type cidrTable struct {
+	bits4    []int // the distinct prefix lengths
+	bits6    []int
+	prefixes map[netip.Prefix][]int
+}
+
+func (t *cidrTable) insert(prefix netip.Prefix, i int) {
+	if t.prefixes == nil {
+		t.prefixes = map[netip.Prefix][]int{}
+	}
+	prefix = prefix.Masked()
+	bits := &t.bits6
+	if prefix.Addr().Is4() {
+		bits = &t.bits4
+	}
+	if _, ok := t.prefixes[prefix]; !ok && !contains(*bits, prefix.Bits()) {
+		*bits = append(*bits, prefix.Bits())
+	}
+	t.prefixes[prefix] = append(t.prefixes[prefix], i)
+}
+
+func (t *cidrTable) lookup(ip netip.Addr, found func([]int)) {
+	if len(t.prefixes) == 0 || ip.Zone() != "" {
+		return
+	}
+	bits := t.bits6
+	if ip.Is4() {
+		bits = t.bits4
+	}
+	for _, b := range bits {
+		if prefix, err := ip.Prefix(b); err == nil {
+			found(t.prefixes[prefix])
+		}
+	}
+}
+
+func contains(s []int, v int) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+type portRule struct {
+	ranges utils.IntRanges[uint16]
+	index  int
+}
+
+// portTable splits the ports into segments covered by the same rules
+type portTable struct {
+	starts   []int   // the first port of each segment
+	segments [][]int // the rules covering each segment
+}
+
+func newPortTable(rules []portRule) portTable {
+	if len(rules) == 0 {
+		return portTable{}
+	}
+	cuts := map[int]struct{}{0: {}}
+	for _, r := range rules {
+		for _, rg := range r.ranges {
+			cuts[int(rg.Start())] = struct{}{}
+			cuts[int(rg.End())+1] = struct{}{}
+		}
+	}
+	t := portTable{}
+	for cut := range cuts {
+		if cut <= 0xffff {
+			t.starts = append(t.starts, cut)
+		}
+	}
+	sort.Ints(t.starts)
+	t.segments = make([][]int, len(t.starts))
+	for _, r := range rules {
+		for _, rg := range r.ranges {
+			for s := sort.SearchInts(t.starts, int(rg.Start())); s < len(t.starts) && t.starts[s] <= int(rg.End()); s++ {
+				if n := len(t.segments[s]); n == 0 || t.segments[s][n-1] != r.index {
+					t.segments[s] = append(t.segments[s], r.index)
+				}
+			}
+		}
+	}
+	return t
+}
+
+func (t portTable) lookup(port uint16) []int {
+	if len(t.starts) == 0 {
+		return nil
+	}
+	// the segment containing port is the last one starting at or before it
+	s := sort.SearchInts(t.starts, int(port)+1) - 1
+	return t.segments[s]
+}
@@ -0,0 +1,132 @@
+package index
+
+import (
+	"fmt"
+	"math/rand"
+	"net/netip"
+	"testing"
+
+	"github.com/metacubex/mihomo/common/utils"
+	C "github.com/metacubex/mihomo/constant"
+	"github.com/metacubex/mihomo/rules"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseRules(t *testing.T, lines [][]string) []C.Rule {
+	var parsed []C.Rule
+	for _, l := range lines {
+		rule, err := rules.ParseRule(l[0], l[1], l[2], l[3:], nil)
+		require.NoError(t, err, l)
+		parsed = append(parsed, rule)
+	}
+	return parsed
+}
+
+// testPrepare resolves the host to 10.0.0.1 once like the tunnel
+func testPrepare(metadata *C.Metadata, resolved *int) func(rule C.Rule) {
+	return func(rule C.Rule) {
+		if *resolved == 0 && rule.ShouldResolveIP() && metadata.Host != "" && !metadata.DstIP.IsValid() {
+			*resolved = 1
+			metadata.DstIP = netip.MustParseAddr("10.0.0.1")
+		}
+	}
+}
+
+func linear(rules []C.Rule, metadata *C.Metadata, resolved *int) int {
+	prepare := testPrepare(metadata, resolved)
+	for i, rule := range rules {
+		prepare(rule)
+		if matched, _ := rule.Match(metadata); matched {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestIndex(t *testing.T) {
+	lines := [][]string{
+		{"PROCESS-NAME", "curl", "DIRECT"},
+		{"DOMAIN", "example.com", "A"},
+		{"DOMAIN-SUFFIX", "example.org", "B"},
+		{"DST-PORT", "22/8000-8100", "C"},
+		{"DOMAIN-SUFFIX", "a.example.org", "D"},
+		{"SRC-IP-CIDR", "192.168.1.0/24", "E"},
+		{"IP-CIDR", "10.0.0.0/8", "F", "no-resolve"},
+		{"DOMAIN", "example.net", "G"},
+		{"IN-PORT", "7890", "H"},
+		{"IP-CIDR", "10.0.0.0/24", "I"},
+		{"IP-CIDR6", "2001:db8::/32", "J"},
+		{"DOMAIN-SUFFIX", "resolve", "K"},
+		{"SRC-PORT", "1000-2000", "L"},
+		{"DOMAIN-KEYWORD", "keyword", "M"},
+		{"MATCH", "", "N"},
+	}
+	parsed := parseRules(t, lines)
+	idx := New(parsed)
+	assert.Nil(t, idx.blocks[0])
+	assert.NotNil(t, idx.blocks[1])
+	assert.Same(t, idx.blocks[1], idx.blocks[12])
+	assert.Nil(t, idx.blocks[13])
+
+	hosts := []string{"", "example.com", "b.example.org", "a.example.org", "example.net", "x.resolve", "keyword.com"}
+	ips := []string{"", "10.0.0.1", "10.1.0.1", "1.1.1.1", "2001:db8::1"}
+	srcIPs := []string{"192.168.1.2", "192.168.2.2"}
+	ports := []uint16{22, 80, 8050, 1500, 7890}
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 2000; n++ {
+		newMetadata := func() *C.Metadata {
+			m := &C.Metadata{
+				Host:    hosts[r.Intn(len(hosts))],
+				SrcIP:   netip.MustParseAddr(srcIPs[r.Intn(len(srcIPs))]),
+				DstPort: ports[r.Intn(len(ports))],
+				SrcPort: ports[r.Intn(len(ports))],
+				InPort:  ports[r.Intn(len(ports))],
+			}
+			if ip := ips[r.Intn(len(ips))]; ip != "" {
+				m.DstIP = netip.MustParseAddr(ip)
+			}
+			return m
+		}
+		expected := newMetadata()
+		actual := *expected
+		description := fmt.Sprintf("%+v", actual)
+
+		var expectedResolved, actualResolved int
+		for start := 0; start < len(parsed); start++ {
+			e := *expected
+			a := actual
+			expectedResolved, actualResolved = 0, 0
+			want := linear(parsed[start:], &e, &expectedResolved)
+			if want >= 0 {
+				want += start
+			}
+			got, adapter := idx.Next(&a, start, testPrepare(&a, &actualResolved))
+			require.Equal(t, want, got, "start %d, %s", start, description)
+			if got >= 0 {
+				assert.Equal(t, parsed[got].Adapter(), adapter)
+			}
+			assert.Equal(t, expectedResolved, actualResolved, "start %d, %s", start, description)
+		}
+	}
+}
+
+func mustRanges(t *testing.T, s string) utils.IntRanges[uint16] {
+	ranges, err := utils.NewUnsignedRanges[uint16](s)
+	require.NoError(t, err)
+	return ranges
+}
+
+func TestPortTable(t *testing.T) {
+	table := newPortTable([]portRule{
+		{ranges: mustRanges(t, "80/443"), index: 1},
+		{ranges: mustRanges(t, "1-1024"), index: 3},
+		{ranges: mustRanges(t, "443-65535"), index: 5},
+	})
+	assert.Equal(t, []int(nil), table.lookup(0))
+	assert.Equal(t, []int{1, 3}, table.lookup(80))
+	assert.Equal(t, []int{3}, table.lookup(81))
+	assert.Equal(t, []int{1, 3, 5}, table.lookup(443))
+	assert.Equal(t, []int{5}, table.lookup(65535))
+}
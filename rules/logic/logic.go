@@ -19,6 +19,8 @@ type Logic struct {
 	subRules    map[string][]C.Rule
 	needIP      bool
 	needProcess bool
+	needHTTP    bool
+	volatile    bool
 }
 
 type ParseRuleFunc func(tp, payload, target string, params []string, subRules map[string][]C.Rule) (C.Rule, error)
@@ -40,6 +42,12 @@ func NewSubRule(payload, adapter string, subRules map[string][]C.Rule, parseRule
 		if rule.ShouldFindProcess() {
 			logic.needProcess = true
 		}
+		if rule.ShouldParseHTTP() {
+			logic.needHTTP = true
+		}
+		if rule.IsVolatile() {
+			logic.volatile = true
+		}
 	}
 	logic.subRules = subRules
 	return logic, nil
@@ -57,6 +65,8 @@ func NewNOT(payload string, adapter string, parseRule ParseRuleFunc) (*Logic, er
 	}
 	logic.needIP = logic.rules[0].ShouldResolveIP()
 	logic.needProcess = logic.rules[0].ShouldFindProcess()
+	logic.needHTTP = logic.rules[0].ShouldParseHTTP()
+	logic.volatile = logic.rules[0].IsVolatile()
 	logic.payload = fmt.Sprintf("(!(%s,%s))", logic.rules[0].RuleType(), logic.rules[0].Payload())
 	return logic, nil
 }
@@ -77,6 +87,12 @@ func NewOR(payload string, adapter string, parseRule ParseRuleFunc) (*Logic, err
 		if rule.ShouldFindProcess() {
 			logic.needProcess = true
 		}
+		if rule.ShouldParseHTTP() {
+			logic.needHTTP = true
+		}
+		if rule.IsVolatile() {
+			logic.volatile = true
+		}
 	}
 	logic.payload = fmt.Sprintf("(%s)", strings.Join(payloads, " || "))
 
@@ -98,6 +114,12 @@ func NewAND(payload string, adapter string, parseRule ParseRuleFunc) (*Logic, er
 		if rule.ShouldFindProcess() {
 			logic.needProcess = true
 		}
+		if rule.ShouldParseHTTP() {
+			logic.needHTTP = true
+		}
+		if rule.IsVolatile() {
+			logic.volatile = true
+		}
 	}
 	logic.payload = fmt.Sprintf("(%s)", strings.Join(payloads, " && "))
 
@@ -223,6 +245,12 @@ func (logic *Logic) parsePayload(payload string, parseRule ParseRuleFunc) error
 			if rule.ShouldFindProcess() {
 				logic.needProcess = true
 			}
+			if rule.ShouldParseHTTP() {
+				logic.needHTTP = true
+			}
+			if rule.IsVolatile() {
+				logic.volatile = true
+			}
 
 			rules = append(rules, rule)
 		}
@@ -298,3 +326,11 @@ func (logic *Logic) ShouldResolveIP() bool {
 func (logic *Logic) ShouldFindProcess() bool {
 	return logic.needProcess
 }
+
+func (logic *Logic) ShouldParseHTTP() bool {
+	return logic.needHTTP
+}
+
+func (logic *Logic) IsVolatile() bool {
+	return logic.volatile
+}
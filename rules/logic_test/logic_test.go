@@ -7,6 +7,7 @@ import (
 	C "github.com/metacubex/mihomo/constant"
 	"github.com/metacubex/mihomo/rules"
 	"github.com/stretchr/testify/assert"
+	"net/http"
 	"testing"
 )
 
@@ -55,3 +56,48 @@ func TestOR(t *testing.T) {
 	assert.Equal(t, true, m)
 	assert.Equal(t, false, or.ShouldResolveIP())
 }
+
+func TestHTTPRules(t *testing.T) {
+	and, err := NewAND("((URL-REGEX,^http://example\\.com/ads/),(HTTP-METHOD,GET/HEAD),(HTTP-HEADER,User-Agent:^curl/))", "REJECT", ParseRule)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, and.ShouldParseHTTP())
+	m, _ := and.Match(&C.Metadata{
+		HTTP: &C.HTTPRequest{
+			Method: "GET",
+			URL:    "http://example.com/ads/banner.png",
+			Header: http.Header{"User-Agent": {"curl/8.0"}},
+		},
+	})
+	assert.Equal(t, true, m)
+	m, _ = and.Match(&C.Metadata{
+		HTTP: &C.HTTPRequest{
+			Method: "POST",
+			URL:    "http://example.com/ads/banner.png",
+			Header: http.Header{"User-Agent": {"curl/8.0"}},
+		},
+	})
+	assert.Equal(t, false, m)
+
+	// no HTTP request is visible, e.g. TLS or a port without the HTTP sniffer
+	not, err := NewNOT("((URL-REGEX,^http://example\\.com/ads/))", "DIRECT", ParseRule)
+	assert.Equal(t, nil, err)
+	m, _ = not.Match(&C.Metadata{Host: "example.com"})
+	assert.Equal(t, true, m)
+
+	_, err = NewAND("((HTTP-HEADER,User-Agent),(NETWORK,TCP))", "REJECT", ParseRule)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestVolatile(t *testing.T) {
+	or, err := NewOR("((DOMAIN,example.com),(SRC-PORT,5000-6000))", "DIRECT", ParseRule)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, or.IsVolatile())
+
+	and, err := NewAND("((DOMAIN,example.com),(DST-PORT,443))", "DIRECT", ParseRule)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, and.IsVolatile())
+
+	not, err := NewNOT("((HTTP-METHOD,CONNECT))", "DIRECT", ParseRule)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, not.IsVolatile())
+}
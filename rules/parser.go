@@ -5,6 +5,7 @@ import (
 
 	C "github.com/metacubex/mihomo/constant"
 	RC "github.com/metacubex/mihomo/rules/common"
+	"github.com/metacubex/mihomo/rules/expr"
 	"github.com/metacubex/mihomo/rules/logic"
 	RP "github.com/metacubex/mihomo/rules/provider"
 )
@@ -53,6 +54,12 @@ func ParseRule(tp, payload, target string, params []string, subRules map[string]
 		parsed, parseErr = RC.NewProcess(payload, target, true)
 	case "PROCESS-PATH":
 		parsed, parseErr = RC.NewProcess(payload, target, false)
+	case "URL-REGEX":
+		parsed, parseErr = RC.NewURLRegex(payload, target)
+	case "HTTP-METHOD":
+		parsed, parseErr = RC.NewHTTPMethod(payload, target)
+	case "HTTP-HEADER":
+		parsed, parseErr = RC.NewHTTPHeader(payload, target)
 	case "NETWORK":
 		parsed, parseErr = RC.NewNetworkType(payload, target)
 	case "UID":
@@ -71,6 +78,8 @@ func ParseRule(tp, payload, target string, params []string, subRules map[string]
 		parsed, parseErr = logic.NewOR(payload, target, ParseRule)
 	case "NOT":
 		parsed, parseErr = logic.NewNOT(payload, target, ParseRule)
+	case "EXPR":
+		parsed, parseErr = expr.New(payload, target)
 	case "RULE-SET":
 		noResolve := RC.HasNoResolve(params)
 		parsed, parseErr = RP.NewRuleSet(payload, target, noResolve)
@@ -85,5 +94,15 @@ func ParseRule(tp, payload, target string, params []string, subRules map[string]
 		return nil, parseErr
 	}
 
+	options, parseErr := RC.ParseOptions(params)
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	if options != nil {
+		if rule, ok := parsed.(interface{ SetOptions(*C.RuleOptions) }); ok {
+			rule.SetOptions(options)
+		}
+	}
+
 	return
 }
@@ -13,6 +13,8 @@ type classicalStrategy struct {
 	count             int
 	shouldResolveIP   bool
 	shouldFindProcess bool
+	shouldParseHTTP   bool
+	volatile          bool
 	parse             func(tp, payload, target string, params []string) (parsed C.Rule, parseErr error)
 }
 
@@ -38,11 +40,21 @@ func (c *classicalStrategy) ShouldFindProcess() bool {
 	return c.shouldFindProcess
 }
 
+func (c *classicalStrategy) ShouldParseHTTP() bool {
+	return c.shouldParseHTTP
+}
+
+func (c *classicalStrategy) IsVolatile() bool {
+	return c.volatile
+}
+
 func (c *classicalStrategy) Reset() {
 	c.rules = nil
 	c.count = 0
 	c.shouldFindProcess = false
 	c.shouldResolveIP = false
+	c.shouldParseHTTP = false
+	c.volatile = false
 }
 
 func (c *classicalStrategy) Insert(rule string) {
@@ -62,6 +74,12 @@ func (c *classicalStrategy) Insert(rule string) {
 		if r.ShouldFindProcess() {
 			c.shouldFindProcess = true
 		}
+		if r.ShouldParseHTTP() {
+			c.shouldParseHTTP = true
+		}
+		if r.IsVolatile() {
+			c.volatile = true
+		}
 
 		c.rules = append(c.rules, r)
 		c.count++
@@ -77,7 +95,7 @@ func ruleParse(ruleRaw string) (string, string, []string) {
 	} else if len(item) == 2 {
 		return item[0], item[1], nil
 	} else if len(item) > 2 {
-		if item[0] == "NOT" || item[0] == "OR" || item[0] == "AND" || item[0] == "SUB-RULE" || item[0] == "DOMAIN-REGEX" {
+		if item[0] == "NOT" || item[0] == "OR" || item[0] == "AND" || item[0] == "SUB-RULE" || item[0] == "DOMAIN-REGEX" || item[0] == "EXPR" {
 			return item[0], strings.Join(item[1:len(item)], ","), nil
 		} else {
 			return item[0], item[1], item[2:]
@@ -16,6 +16,14 @@ func (d *domainStrategy) ShouldFindProcess() bool {
 	return false
 }
 
+func (d *domainStrategy) ShouldParseHTTP() bool {
+	return false
+}
+
+func (d *domainStrategy) IsVolatile() bool {
+	return false
+}
+
 func (d *domainStrategy) Match(metadata *C.Metadata) bool {
 	return d.domainSet != nil && d.domainSet.Has(metadata.RuleHost())
 }
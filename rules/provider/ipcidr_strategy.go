@@ -17,6 +17,14 @@ func (i *ipcidrStrategy) ShouldFindProcess() bool {
 	return false
 }
 
+func (i *ipcidrStrategy) ShouldParseHTTP() bool {
+	return false
+}
+
+func (i *ipcidrStrategy) IsVolatile() bool {
+	return false
+}
+
 func (i *ipcidrStrategy) Match(metadata *C.Metadata) bool {
 	// return i.trie != nil && i.trie.IsContain(metadata.DstIP.AsSlice())
 	return i.cidrSet != nil && i.cidrSet.IsContain(metadata.DstIP)
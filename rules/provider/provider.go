@@ -7,6 +7,7 @@ import (
 	"gopkg.in/yaml.v3"
 	"runtime"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/metacubex/mihomo/common/pool"
@@ -17,6 +18,7 @@ import (
 
 var (
 	ruleProviders = map[string]P.RuleProvider{}
+	version       atomic.Uint64
 )
 
 type ruleSetProvider struct {
@@ -44,6 +46,8 @@ type ruleStrategy interface {
 	Count() int
 	ShouldResolveIP() bool
 	ShouldFindProcess() bool
+	ShouldParseHTTP() bool
+	IsVolatile() bool
 	Reset()
 	Insert(rule string)
 	FinishInsert()
@@ -53,6 +57,11 @@ func RuleProviders() map[string]P.RuleProvider {
 	return ruleProviders
 }
 
+// Version is increased each time the rules of any provider change
+func Version() uint64 {
+	return version.Load()
+}
+
 func SetRuleProvider(ruleProvider P.RuleProvider) {
 	if ruleProvider != nil {
 		ruleProviders[(ruleProvider).Name()] = ruleProvider
@@ -73,6 +82,17 @@ func (rp *ruleSetProvider) Initial() error {
 	return nil
 }
 
+// InitialOffline loads the rules from the local copy only, for the simulations
+func (rp *ruleSetProvider) InitialOffline() error {
+	elm, err := rp.Fetcher.ReadLocal()
+	if err != nil {
+		return err
+	}
+
+	rp.OnUpdate(elm)
+	return nil
+}
+
 func (rp *ruleSetProvider) Update() error {
 	elm, same, err := rp.Fetcher.Update()
 	if err == nil && !same {
@@ -99,6 +119,14 @@ func (rp *ruleSetProvider) ShouldFindProcess() bool {
 	return rp.strategy.ShouldFindProcess()
 }
 
+func (rp *ruleSetProvider) ShouldParseHTTP() bool {
+	return rp.strategy.ShouldParseHTTP()
+}
+
+func (rp *ruleSetProvider) IsVolatile() bool {
+	return rp.strategy.IsVolatile()
+}
+
 func (rp *ruleSetProvider) AsRule(adaptor string) C.Rule {
 	panic("implement me")
 }
@@ -126,6 +154,7 @@ func NewRuleSetProvider(name string, behavior P.RuleBehavior, format P.RuleForma
 	onUpdate := func(elm interface{}) {
 		strategy := elm.(ruleStrategy)
 		rp.strategy = strategy
+		version.Add(1)
 	}
 
 	rp.strategy = newStrategy(behavior, parse)
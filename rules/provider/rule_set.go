@@ -20,6 +20,14 @@ func (rs *RuleSet) ShouldFindProcess() bool {
 	return rs.shouldFindProcess || rs.getProviders().ShouldFindProcess()
 }
 
+func (rs *RuleSet) ShouldParseHTTP() bool {
+	return rs.getProviders().ShouldParseHTTP()
+}
+
+func (rs *RuleSet) IsVolatile() bool {
+	return rs.getProviders().IsVolatile()
+}
+
 func (rs *RuleSet) RuleType() C.RuleType {
 	return C.RuleSet
 }
@@ -0,0 +1,253 @@
+// Package amneziawg implements the packet obfuscation of AmneziaWG on top of
+// a standard WireGuard connection.
+//
+// Handshake initiations are preceded by junk packets and padded together with
+// handshake responses, the message type of every packet is replaced by the
+// custom headers. The peer must use the same parameters.
+package amneziawg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/metacubex/mihomo/common/pool"
+
+	"github.com/zhangyunhao116/fastrand"
+)
+
+const (
+	messageInitiationType  = 1
+	messageResponseType    = 2
+	messageCookieReplyType = 3
+	messageTransportType   = 4
+
+	messageInitiationSize  = 148
+	messageResponseSize    = 92
+	messageCookieReplySize = 64
+	messageTransportSize   = 32 // the minimum, keepalive
+
+	maxJunkSize = 1280
+)
+
+type Config struct {
+	JunkPacketCount            int    // Jc
+	JunkPacketMinSize          int    // Jmin
+	JunkPacketMaxSize          int    // Jmax
+	InitPacketJunkSize         int    // S1
+	ResponsePacketJunkSize     int    // S2
+	InitPacketMagicHeader      uint32 // H1
+	ResponsePacketMagicHeader  uint32 // H2
+	UnderloadPacketMagicHeader uint32 // H3
+	TransportPacketMagicHeader uint32 // H4
+}
+
+// Check validates the config and fills the default magic headers
+func (c *Config) Check() error {
+	if c.JunkPacketCount < 0 || c.JunkPacketMinSize < 0 || c.JunkPacketMaxSize < 0 ||
+		c.InitPacketJunkSize < 0 || c.ResponsePacketJunkSize < 0 {
+		return errors.New("amneziawg parameters must not be negative")
+	}
+	if c.JunkPacketMinSize > c.JunkPacketMaxSize {
+		return fmt.Errorf("amneziawg jmin %d is larger than jmax %d", c.JunkPacketMinSize, c.JunkPacketMaxSize)
+	}
+	if c.JunkPacketMaxSize >= maxJunkSize {
+		return fmt.Errorf("amneziawg jmax must be less than %d", maxJunkSize)
+	}
+	if c.InitPacketJunkSize+messageInitiationSize >= maxJunkSize || c.ResponsePacketJunkSize+messageResponseSize >= maxJunkSize {
+		return fmt.Errorf("amneziawg s1 and s2 are too large")
+	}
+	if c.InitPacketJunkSize+messageInitiationSize == c.ResponsePacketJunkSize+messageResponseSize {
+		return errors.New("amneziawg s1 + 56 must not equal to s2")
+	}
+
+	if c.InitPacketMagicHeader == 0 {
+		c.InitPacketMagicHeader = messageInitiationType
+	}
+	if c.ResponsePacketMagicHeader == 0 {
+		c.ResponsePacketMagicHeader = messageResponseType
+	}
+	if c.UnderloadPacketMagicHeader == 0 {
+		c.UnderloadPacketMagicHeader = messageCookieReplyType
+	}
+	if c.TransportPacketMagicHeader == 0 {
+		c.TransportPacketMagicHeader = messageTransportType
+	}
+	headers := map[uint32]struct{}{
+		c.InitPacketMagicHeader:      {},
+		c.ResponsePacketMagicHeader:  {},
+		c.UnderloadPacketMagicHeader: {},
+		c.TransportPacketMagicHeader: {},
+	}
+	if len(headers) != 4 {
+		return errors.New("amneziawg magic headers must be different from each other")
+	}
+	return nil
+}
+
+// obfuscator converts packets between WireGuard and AmneziaWG, the Config must be checked
+type obfuscator struct {
+	*Config
+}
+
+// junkPackets returns the junk packets sent before a handshake initiation
+func (o obfuscator) junkPackets() [][]byte {
+	packets := make([][]byte, o.JunkPacketCount)
+	for i := range packets {
+		size := o.JunkPacketMinSize
+		if o.JunkPacketMaxSize > o.JunkPacketMinSize {
+			size += fastrand.Intn(o.JunkPacketMaxSize - o.JunkPacketMinSize + 1)
+		}
+		packets[i] = make([]byte, size)
+		_, _ = fastrand.Read(packets[i])
+	}
+	return packets
+}
+
+// encode writes the obfuscated packet of b into buf, which must have room for the padding
+func (o obfuscator) encode(buf []byte, b []byte) (int, bool) {
+	if len(b) < 4 {
+		return copy(buf, b), false
+	}
+	var junkSize int
+	var header uint32
+	var isInitiation bool
+	switch b[0] {
+	case messageInitiationType:
+		junkSize, header, isInitiation = o.InitPacketJunkSize, o.InitPacketMagicHeader, true
+	case messageResponseType:
+		junkSize, header = o.ResponsePacketJunkSize, o.ResponsePacketMagicHeader
+	case messageCookieReplyType:
+		header = o.UnderloadPacketMagicHeader
+	case messageTransportType:
+		header = o.TransportPacketMagicHeader
+	default:
+		return copy(buf, b), false
+	}
+	_, _ = fastrand.Read(buf[:junkSize])
+	n := junkSize + copy(buf[junkSize:], b)
+	binary.LittleEndian.PutUint32(buf[junkSize:], header)
+	return n, isInitiation
+}
+
+// decode restores the WireGuard packet in place, returns false for junk packets
+func (o obfuscator) decode(b []byte) (int, bool) {
+	size := len(b)
+	var junkSize int
+	var header uint32
+	switch size {
+	case o.InitPacketJunkSize + messageInitiationSize:
+		junkSize, header = o.InitPacketJunkSize, o.InitPacketMagicHeader
+	case o.ResponsePacketJunkSize + messageResponseSize:
+		junkSize, header = o.ResponsePacketJunkSize, o.ResponsePacketMagicHeader
+	case messageCookieReplySize:
+		header = o.UnderloadPacketMagicHeader
+	}
+	// transport packets may line up with the sizes above, check the header of them too
+	if header != 0 && binary.LittleEndian.Uint32(b[junkSize:]) == header {
+		copy(b, b[junkSize:])
+		b = b[:size-junkSize]
+	} else if size < messageTransportSize || binary.LittleEndian.Uint32(b) != o.TransportPacketMagicHeader {
+		return 0, false
+	} else {
+		header = o.TransportPacketMagicHeader
+	}
+
+	switch header {
+	case o.InitPacketMagicHeader:
+		binary.LittleEndian.PutUint32(b, messageInitiationType)
+	case o.ResponsePacketMagicHeader:
+		binary.LittleEndian.PutUint32(b, messageResponseType)
+	case o.UnderloadPacketMagicHeader:
+		binary.LittleEndian.PutUint32(b, messageCookieReplyType)
+	case o.TransportPacketMagicHeader:
+		binary.LittleEndian.PutUint32(b, messageTransportType)
+	}
+	return len(b), true
+}
+
+func (o obfuscator) bufferSize(size int) int {
+	if o.InitPacketJunkSize > o.ResponsePacketJunkSize {
+		return size + o.InitPacketJunkSize
+	}
+	return size + o.ResponsePacketJunkSize
+}
+
+type conn struct {
+	net.Conn
+	obfuscator
+}
+
+// NewConn wraps a connected udp conn
+func NewConn(c net.Conn, cfg *Config) net.Conn {
+	return &conn{Conn: c, obfuscator: obfuscator{cfg}}
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	for {
+		n, err := c.Conn.Read(b)
+		if err != nil {
+			return n, err
+		}
+		if n, ok := c.decode(b[:n]); ok {
+			return n, nil
+		}
+	}
+}
+
+func (c *conn) Write(b []byte) (int, error) {
+	buf := pool.Get(c.bufferSize(len(b)))
+	defer pool.Put(buf)
+	n, isInitiation := c.encode(buf, b)
+	if isInitiation {
+		for _, junk := range c.junkPackets() {
+			if _, err := c.Conn.Write(junk); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if _, err := c.Conn.Write(buf[:n]); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+type packetConn struct {
+	net.PacketConn
+	obfuscator
+}
+
+// NewPacketConn wraps an unconnected udp conn
+func NewPacketConn(pc net.PacketConn, cfg *Config) net.PacketConn {
+	return &packetConn{PacketConn: pc, obfuscator: obfuscator{cfg}}
+}
+
+func (c *packetConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(b)
+		if err != nil {
+			return n, addr, err
+		}
+		if n, ok := c.decode(b[:n]); ok {
+			return n, addr, nil
+		}
+	}
+}
+
+func (c *packetConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	buf := pool.Get(c.bufferSize(len(b)))
+	defer pool.Put(buf)
+	n, isInitiation := c.encode(buf, b)
+	if isInitiation {
+		for _, junk := range c.junkPackets() {
+			if _, err := c.PacketConn.WriteTo(junk, addr); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if _, err := c.PacketConn.WriteTo(buf[:n], addr); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
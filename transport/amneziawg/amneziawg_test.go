@@ -0,0 +1,124 @@
+package amneziawg
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *Config {
+	return &Config{
+		JunkPacketCount:            4,
+		JunkPacketMinSize:          40,
+		JunkPacketMaxSize:          70,
+		InitPacketJunkSize:         15,
+		ResponsePacketJunkSize:     18,
+		InitPacketMagicHeader:      1020325451,
+		ResponsePacketMagicHeader:  3288052141,
+		UnderloadPacketMagicHeader: 1766607858,
+		TransportPacketMagicHeader: 2528465083,
+	}
+}
+
+func wireGuardPacket(msgType byte, size int) []byte {
+	b := make([]byte, size)
+	b[0] = msgType
+	for i := 4; i < size; i++ {
+		b[i] = byte(i)
+	}
+	return b
+}
+
+func TestCheck(t *testing.T) {
+	cfg := &Config{}
+	require.NoError(t, cfg.Check())
+	assert.Equal(t, uint32(messageInitiationType), cfg.InitPacketMagicHeader)
+	assert.Equal(t, uint32(messageTransportType), cfg.TransportPacketMagicHeader)
+
+	assert.Error(t, (&Config{JunkPacketMinSize: 10, JunkPacketMaxSize: 5}).Check())
+	assert.Error(t, (&Config{InitPacketJunkSize: 0, ResponsePacketJunkSize: 56}).Check())
+	assert.Error(t, (&Config{InitPacketMagicHeader: 5, ResponsePacketMagicHeader: 5}).Check())
+}
+
+func TestPacketConn(t *testing.T) {
+	cfg := testConfig()
+	require.NoError(t, cfg.Check())
+
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer server.Close()
+	client, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer client.Close()
+
+	obfsClient := NewPacketConn(client, cfg)
+	obfsServer := NewPacketConn(server, cfg)
+	require.NoError(t, server.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	initiation := wireGuardPacket(messageInitiationType, messageInitiationSize)
+	_, err = obfsClient.WriteTo(initiation, server.LocalAddr())
+	require.NoError(t, err)
+
+	// junk packets and the padded initiation on the wire
+	buf := make([]byte, 2048)
+	for i := 0; i < cfg.JunkPacketCount; i++ {
+		n, _, err := server.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, n, cfg.JunkPacketMinSize)
+		assert.LessOrEqual(t, n, cfg.JunkPacketMaxSize)
+	}
+	n, _, err := server.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, cfg.InitPacketJunkSize+messageInitiationSize, n)
+	assert.Equal(t, cfg.InitPacketMagicHeader, binary.LittleEndian.Uint32(buf[cfg.InitPacketJunkSize:]))
+
+	for _, packet := range [][]byte{
+		initiation,
+		wireGuardPacket(messageResponseType, messageResponseSize),
+		wireGuardPacket(messageCookieReplyType, messageCookieReplySize),
+		wireGuardPacket(messageTransportType, messageTransportSize),
+		wireGuardPacket(messageTransportType, messageInitiationSize+cfg.InitPacketJunkSize),
+	} {
+		_, err = obfsClient.WriteTo(packet, server.LocalAddr())
+		require.NoError(t, err)
+		n, _, err := obfsServer.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, packet, buf[:n])
+	}
+}
+
+func TestConn(t *testing.T) {
+	cfg := testConfig()
+	require.NoError(t, cfg.Check())
+
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer server.Close()
+	client, err := net.Dial("udp", server.LocalAddr().String())
+	require.NoError(t, err)
+	defer client.Close()
+
+	obfsClient := NewConn(client, cfg)
+	obfsServer := NewPacketConn(server, cfg)
+	require.NoError(t, server.SetReadDeadline(time.Now().Add(5*time.Second)))
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	buf := make([]byte, 2048)
+	initiation := wireGuardPacket(messageInitiationType, messageInitiationSize)
+	_, err = obfsClient.Write(initiation)
+	require.NoError(t, err)
+	n, addr, err := obfsServer.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, initiation, buf[:n])
+
+	response := wireGuardPacket(messageResponseType, messageResponseSize)
+	_, err = obfsServer.WriteTo(response, addr)
+	require.NoError(t, err)
+	n, err = obfsClient.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, response, buf[:n])
+}
@@ -0,0 +1,152 @@
+// Package congestion is the registry of the congestion control algorithms shared by
+// the QUIC based outbounds and DNS clients.
+package congestion
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+
+	hyCongestion "github.com/metacubex/mihomo/transport/hysteria/congestion"
+	tuicCongestion "github.com/metacubex/mihomo/transport/tuic/congestion"
+	tuicCongestionV2 "github.com/metacubex/mihomo/transport/tuic/congestion_v2"
+
+	"github.com/metacubex/quic-go"
+	"github.com/metacubex/quic-go/congestion"
+)
+
+const DefaultCWND = 32
+
+type Options struct {
+	CWND       int    // initial congestion window of bbr in packets
+	BrutalRate uint64 // sending rate of brutal in bytes per second
+	Tag        string // owner of the connection, shown in the stats
+}
+
+// Factory creates a congestion controller for a connection to remote, remote is nil in Check
+type Factory func(remote net.Addr, options Options) (congestion.CongestionControl, error)
+
+var (
+	factoriesMutex sync.RWMutex
+	factories      = map[string]Factory{}
+)
+
+func init() {
+	Register("cubic", func(remote net.Addr, options Options) (congestion.CongestionControl, error) {
+		return tuicCongestion.NewCubicSender(
+			tuicCongestion.DefaultClock{},
+			tuicCongestion.GetInitialPacketSize(remote),
+			false,
+		), nil
+	})
+	Register("new_reno", func(remote net.Addr, options Options) (congestion.CongestionControl, error) {
+		return tuicCongestion.NewCubicSender(
+			tuicCongestion.DefaultClock{},
+			tuicCongestion.GetInitialPacketSize(remote),
+			true,
+		), nil
+	})
+	Register("bbr_meta_v1", func(remote net.Addr, options Options) (congestion.CongestionControl, error) {
+		return tuicCongestion.NewBBRSender(
+			tuicCongestion.DefaultClock{},
+			tuicCongestion.GetInitialPacketSize(remote),
+			congestion.ByteCount(options.cwnd())*tuicCongestion.InitialMaxDatagramSize,
+			tuicCongestion.DefaultBBRMaxCongestionWindow*tuicCongestion.InitialMaxDatagramSize,
+		), nil
+	})
+	bbr := func(remote net.Addr, options Options) (congestion.CongestionControl, error) {
+		return tuicCongestionV2.NewBbrSender(
+			tuicCongestionV2.DefaultClock{},
+			tuicCongestionV2.GetInitialPacketSize(remote),
+			congestion.ByteCount(options.cwnd()),
+		), nil
+	}
+	Register("bbr_meta_v2", bbr)
+	Register("bbr", bbr)
+	// bbr2 is an alias of bbr_meta_v2, there is no implementation of BBRv2 of quiche in this repo
+	Register("bbr2", bbr)
+	Register("brutal", func(remote net.Addr, options Options) (congestion.CongestionControl, error) {
+		if options.BrutalRate == 0 {
+			return nil, errors.New("brutal requires a sending rate")
+		}
+		return hyCongestion.NewBrutalSender(congestion.ByteCount(options.BrutalRate)), nil
+	})
+}
+
+func (o Options) cwnd() int {
+	if o.CWND <= 0 {
+		return DefaultCWND
+	}
+	return o.CWND
+}
+
+// Register adds or replaces an algorithm
+func Register(name string, factory Factory) {
+	factoriesMutex.Lock()
+	defer factoriesMutex.Unlock()
+	factories[name] = factory
+}
+
+// Names returns the registered algorithms in order
+func Names() []string {
+	factoriesMutex.RLock()
+	defer factoriesMutex.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func getFactory(name string) (Factory, error) {
+	factoriesMutex.RLock()
+	defer factoriesMutex.RUnlock()
+	factory, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported congestion controller: %s", name)
+	}
+	return factory, nil
+}
+
+// Check validates the name and options before any connection is made,
+// an empty name keeps the default algorithm of quic-go
+func Check(name string, options Options) error {
+	if name == "" {
+		return nil
+	}
+	factory, err := getFactory(name)
+	if err != nil {
+		return err
+	}
+	_, err = factory(nil, options)
+	return err
+}
+
+// New creates a tracked congestion controller for conn, the stats of it are listed in Connections until conn is closed
+func New(conn quic.Connection, name string, options Options) (congestion.CongestionControl, error) {
+	factory, err := getFactory(name)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := factory(conn.RemoteAddr(), options)
+	if err != nil {
+		return nil, err
+	}
+	return track(conn, name, options.Tag, cc), nil
+}
+
+// Set replaces the congestion controller of conn, an empty name keeps the default algorithm of quic-go
+func Set(conn quic.Connection, name string, options Options) error {
+	if name == "" {
+		return nil
+	}
+	cc, err := New(conn, name, options)
+	if err != nil {
+		return err
+	}
+	conn.SetCongestionControl(cc)
+	return nil
+}
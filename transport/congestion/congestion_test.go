@@ -0,0 +1,102 @@
+package congestion
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/metacubex/quic-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	for _, name := range []string{"", "cubic", "new_reno", "bbr", "bbr2", "bbr_meta_v1", "bbr_meta_v2"} {
+		assert.NoError(t, Check(name, Options{}), name)
+	}
+	assert.Error(t, Check("brutal", Options{}))
+	assert.NoError(t, Check("brutal", Options{BrutalRate: 1 << 20}))
+	assert.Error(t, Check("unknown", Options{}))
+	assert.Contains(t, Names(), "bbr_meta_v2")
+	assert.Contains(t, Names(), "bbr2")
+}
+
+func testTLSConfig(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{cert}, PrivateKey: key}},
+		NextProtos:   []string{"test"},
+	}
+}
+
+func TestStats(t *testing.T) {
+	listener, err := quic.ListenAddr("127.0.0.1:0", testTLSConfig(t), nil)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		stream, err := conn.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		_, _ = io.Copy(stream, stream)
+		_ = stream.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := quic.DialAddr(ctx, listener.Addr().String(), &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"test"}}, nil)
+	require.NoError(t, err)
+	require.NoError(t, Set(conn, "bbr", Options{Tag: "test"}))
+
+	stream, err := conn.OpenStreamSync(ctx)
+	require.NoError(t, err)
+	data := make([]byte, 1<<20)
+	go func() {
+		_, _ = stream.Write(data)
+		_ = stream.Close()
+	}()
+	_, err = io.ReadFull(stream, data)
+	require.NoError(t, err)
+
+	var stats Stats
+	for _, s := range Connections() {
+		if s.Tag == "test" {
+			stats = s
+		}
+	}
+	assert.Equal(t, "bbr", stats.Algorithm)
+	assert.Equal(t, listener.Addr().String(), stats.RemoteAddr)
+	assert.NotZero(t, stats.CWND)
+	assert.NotZero(t, stats.PacketsSent)
+	assert.Greater(t, stats.SmoothedRTT, float64(0))
+
+	_ = conn.CloseWithError(0, "")
+	assert.Eventually(t, func() bool {
+		for _, s := range Connections() {
+			if s.Tag == "test" {
+				return false
+			}
+		}
+		return true
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,131 @@
+package congestion
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/metacubex/quic-go"
+	"github.com/metacubex/quic-go/congestion"
+)
+
+type Stats struct {
+	Tag         string    `json:"tag"`
+	Algorithm   string    `json:"algorithm"`
+	RemoteAddr  string    `json:"remoteAddr"`
+	Start       time.Time `json:"start"`
+	CWND        uint64    `json:"cwnd"`
+	SmoothedRTT float64   `json:"rtt"`    // milliseconds
+	MinRTT      float64   `json:"minRTT"` // milliseconds
+	PacketsSent uint64    `json:"packetsSent"`
+	PacketsLost uint64    `json:"packetsLost"`
+	BytesLost   uint64    `json:"bytesLost"`
+}
+
+var trackers sync.Map // map[*tracker]struct{}
+
+// Connections returns the stats of the alive connections using a registered algorithm
+func Connections() []Stats {
+	stats := make([]Stats, 0)
+	trackers.Range(func(key, value any) bool {
+		stats = append(stats, key.(*tracker).Stats())
+		return true
+	})
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Start.Before(stats[j].Start)
+	})
+	return stats
+}
+
+// tracker records the stats of a congestion controller, the values are
+// copied into atomics since the controller is only safe in the quic-go loop
+type tracker struct {
+	congestion.CongestionControl
+	rttStats congestion.RTTStatsProvider
+
+	tag        string
+	algorithm  string
+	remoteAddr string
+	start      time.Time
+
+	cwnd        atomic.Uint64
+	smoothedRTT atomic.Int64
+	minRTT      atomic.Int64
+	packetsSent atomic.Uint64
+	packetsLost atomic.Uint64
+	bytesLost   atomic.Uint64
+}
+
+var _ congestion.CongestionControlEx = (*tracker)(nil)
+
+func track(conn quic.Connection, algorithm string, tag string, cc congestion.CongestionControl) *tracker {
+	t := &tracker{
+		CongestionControl: cc,
+		tag:               tag,
+		algorithm:         algorithm,
+		remoteAddr:        conn.RemoteAddr().String(),
+		start:             time.Now(),
+	}
+	t.cwnd.Store(uint64(cc.GetCongestionWindow()))
+	trackers.Store(t, struct{}{})
+	go func() {
+		<-conn.Context().Done()
+		trackers.Delete(t)
+	}()
+	return t
+}
+
+func (t *tracker) update() {
+	t.cwnd.Store(uint64(t.CongestionControl.GetCongestionWindow()))
+	if t.rttStats != nil {
+		t.smoothedRTT.Store(int64(t.rttStats.SmoothedRTT()))
+		t.minRTT.Store(int64(t.rttStats.MinRTT()))
+	}
+}
+
+func (t *tracker) SetRTTStatsProvider(provider congestion.RTTStatsProvider) {
+	t.rttStats = provider
+	t.CongestionControl.SetRTTStatsProvider(provider)
+}
+
+func (t *tracker) OnPacketSent(sentTime time.Time, bytesInFlight congestion.ByteCount, packetNumber congestion.PacketNumber, bytes congestion.ByteCount, isRetransmittable bool) {
+	t.CongestionControl.OnPacketSent(sentTime, bytesInFlight, packetNumber, bytes, isRetransmittable)
+	t.packetsSent.Add(1)
+}
+
+func (t *tracker) OnPacketAcked(number congestion.PacketNumber, ackedBytes congestion.ByteCount, priorInFlight congestion.ByteCount, eventTime time.Time) {
+	t.CongestionControl.OnPacketAcked(number, ackedBytes, priorInFlight, eventTime)
+	t.update()
+}
+
+func (t *tracker) OnCongestionEvent(number congestion.PacketNumber, lostBytes congestion.ByteCount, priorInFlight congestion.ByteCount) {
+	t.CongestionControl.OnCongestionEvent(number, lostBytes, priorInFlight)
+	if lostBytes > 0 {
+		t.packetsLost.Add(1)
+		t.bytesLost.Add(uint64(lostBytes))
+	}
+	t.update()
+}
+
+func (t *tracker) OnCongestionEventEx(priorInFlight congestion.ByteCount, eventTime time.Time, ackedPackets []congestion.AckedPacketInfo, lostPackets []congestion.LostPacketInfo) {
+	if cc, ok := t.CongestionControl.(congestion.CongestionControlEx); ok {
+		cc.OnCongestionEventEx(priorInFlight, eventTime, ackedPackets, lostPackets)
+		t.update()
+	}
+}
+
+func (t *tracker) Stats() Stats {
+	return Stats{
+		Tag:         t.tag,
+		Algorithm:   t.algorithm,
+		RemoteAddr:  t.remoteAddr,
+		Start:       t.start,
+		CWND:        t.cwnd.Load(),
+		SmoothedRTT: float64(t.smoothedRTT.Load()) / float64(time.Millisecond),
+		MinRTT:      float64(t.minRTT.Load()) / float64(time.Millisecond),
+		PacketsSent: t.packetsSent.Load(),
+		PacketsLost: t.packetsLost.Load(),
+		BytesLost:   t.bytesLost.Load(),
+	}
+}
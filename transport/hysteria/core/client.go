@@ -26,7 +26,7 @@ var (
 	ErrClosed = errors.New("closed")
 )
 
-type CongestionFactory func(refBPS uint64) congestion.CongestionControl
+type CongestionFactory func(qs quic.Connection, refBPS uint64) congestion.CongestionControl
 
 type Client struct {
 	transport         *transport.ClientTransport
@@ -128,7 +128,7 @@ func (c *Client) handleControlStream(qs quic.Connection, stream quic.Stream) (bo
 	}
 	// Set the congestion accordingly
 	if sh.OK && c.congestionFactory != nil {
-		qs.SetCongestionControl(c.congestionFactory(sh.Rate.RecvBPS))
+		qs.SetCongestionControl(c.congestionFactory(qs, sh.Rate.RecvBPS))
 	}
 	return sh.OK, sh.Message, nil
 }
@@ -0,0 +1,80 @@
+// Package kcp implements the mKCP transport of V2Ray.
+//
+// mKCP is not compatible with the original KCP, every UDP packet carries
+// an obfuscation header, an authenticated (or seed encrypted) payload and
+// one segment of the mKCP protocol.
+package kcp
+
+const (
+	DefaultMTU              = 1350
+	DefaultTTI              = 50
+	DefaultUplinkCapacity   = 5
+	DefaultDownlinkCapacity = 20
+	DefaultWriteBufferSize  = 2
+)
+
+type Config struct {
+	MTU              uint32 // bytes, 576 - 1460
+	TTI              uint32 // milliseconds, 10 - 100
+	UplinkCapacity   uint32 // MB/s
+	DownlinkCapacity uint32 // MB/s
+	Congestion       bool
+	WriteBufferSize  uint32 // MB
+	HeaderType       string
+	Seed             string
+}
+
+func (c *Config) mtu() uint32 {
+	if c.MTU == 0 {
+		return DefaultMTU
+	}
+	return c.MTU
+}
+
+func (c *Config) tti() uint32 {
+	if c.TTI == 0 {
+		return DefaultTTI
+	}
+	return c.TTI
+}
+
+func (c *Config) uplinkCapacity() uint32 {
+	if c.UplinkCapacity == 0 {
+		return DefaultUplinkCapacity
+	}
+	return c.UplinkCapacity
+}
+
+func (c *Config) downlinkCapacity() uint32 {
+	if c.DownlinkCapacity == 0 {
+		return DefaultDownlinkCapacity
+	}
+	return c.DownlinkCapacity
+}
+
+func (c *Config) writeBufferSize() uint32 {
+	if c.WriteBufferSize == 0 {
+		return DefaultWriteBufferSize * 1024 * 1024
+	}
+	return c.WriteBufferSize * 1024 * 1024
+}
+
+func (c *Config) sendingInFlightSize() uint32 {
+	size := c.uplinkCapacity() * 1024 * 1024 / c.mtu() / (1000 / c.tti())
+	if size < 8 {
+		size = 8
+	}
+	return size
+}
+
+func (c *Config) sendingBufferSize() uint32 {
+	return c.writeBufferSize() / c.mtu()
+}
+
+func (c *Config) receivingInFlightSize() uint32 {
+	size := c.downlinkCapacity() * 1024 * 1024 / c.mtu() / (1000 / c.tti())
+	if size < 8 {
+		size = 8
+	}
+	return size
+}
@@ -0,0 +1,561 @@
+package kcp
+
+import (
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type State int32
+
+const (
+	StateActive          State = 0 // Connection is active
+	StateReadyToClose    State = 1 // Connection is closed locally
+	StatePeerClosed      State = 2 // Connection is closed on remote
+	StateTerminating     State = 3 // Connection is ready to be destroyed locally
+	StatePeerTerminating State = 4 // Connection is ready to be destroyed on remote
+	StateTerminated      State = 5 // Connection is destroyed.
+)
+
+func (s State) Is(states ...State) bool {
+	for _, state := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+func nowMillisec() int64 {
+	return time.Now().UnixMilli()
+}
+
+type roundTripInfo struct {
+	mutex            sync.RWMutex
+	variation        uint32
+	srtt             uint32
+	rto              uint32
+	minRtt           uint32
+	updatedTimestamp uint32
+}
+
+func (info *roundTripInfo) UpdatePeerRTO(rto uint32, current uint32) {
+	info.mutex.Lock()
+	defer info.mutex.Unlock()
+
+	if current-info.updatedTimestamp < 3000 {
+		return
+	}
+
+	info.updatedTimestamp = current
+	info.rto = rto
+}
+
+func (info *roundTripInfo) Update(rtt uint32, current uint32) {
+	if rtt > 0x7FFFFFFF {
+		return
+	}
+	info.mutex.Lock()
+	defer info.mutex.Unlock()
+
+	// https://tools.ietf.org/html/rfc6298
+	if info.srtt == 0 {
+		info.srtt = rtt
+		info.variation = rtt / 2
+	} else {
+		delta := rtt - info.srtt
+		if info.srtt > rtt {
+			delta = info.srtt - rtt
+		}
+		info.variation = (3*info.variation + delta) / 4
+		info.srtt = (7*info.srtt + rtt) / 8
+		if info.srtt < info.minRtt {
+			info.srtt = info.minRtt
+		}
+	}
+	var rto uint32
+	if info.minRtt < 4*info.variation {
+		rto = info.srtt + 4*info.variation
+	} else {
+		rto = info.srtt + info.variation
+	}
+
+	if rto > 10000 {
+		rto = 10000
+	}
+	info.rto = rto * 5 / 4
+	info.updatedTimestamp = current
+}
+
+func (info *roundTripInfo) Timeout() uint32 {
+	info.mutex.RLock()
+	defer info.mutex.RUnlock()
+
+	return info.rto
+}
+
+// updater runs updateFunc every interval in a single goroutine until shouldContinue returns false
+type updater struct {
+	interval        int64
+	shouldContinue  func() bool
+	shouldTerminate func() bool
+	updateFunc      func()
+	notifier        chan struct{}
+}
+
+func newUpdater(interval uint32, shouldContinue func() bool, shouldTerminate func() bool, updateFunc func()) *updater {
+	u := &updater{
+		interval:        int64(time.Duration(interval) * time.Millisecond),
+		shouldContinue:  shouldContinue,
+		shouldTerminate: shouldTerminate,
+		updateFunc:      updateFunc,
+		notifier:        make(chan struct{}, 1),
+	}
+	u.notifier <- struct{}{}
+	return u
+}
+
+func (u *updater) WakeUp() {
+	select {
+	case <-u.notifier:
+		go u.run()
+	default:
+	}
+}
+
+func (u *updater) run() {
+	defer func() { u.notifier <- struct{}{} }()
+
+	if u.shouldTerminate() {
+		return
+	}
+	ticker := time.NewTicker(u.Interval())
+	defer ticker.Stop()
+	for u.shouldContinue() {
+		u.updateFunc()
+		<-ticker.C
+	}
+}
+
+func (u *updater) Interval() time.Duration {
+	return time.Duration(atomic.LoadInt64(&u.interval))
+}
+
+func (u *updater) SetInterval(d time.Duration) {
+	atomic.StoreInt64(&u.interval, int64(d))
+}
+
+type notifier chan struct{}
+
+func newNotifier() notifier {
+	return make(notifier, 1)
+}
+
+func (n notifier) Signal() {
+	select {
+	case n <- struct{}{}:
+	default:
+	}
+}
+
+type ConnMetadata struct {
+	LocalAddr    net.Addr
+	RemoteAddr   net.Addr
+	Conversation uint16
+}
+
+// Connection is a KCP connection over UDP.
+type Connection struct {
+	meta       ConnMetadata
+	closer     io.Closer
+	rd         atomic.Value // time.Time
+	wd         atomic.Value // time.Time
+	since      int64
+	dataInput  notifier
+	dataOutput notifier
+	config     *Config
+
+	state            int32
+	stateBeginTime   uint32
+	lastIncomingTime uint32
+	lastPingTime     uint32
+
+	mss       uint32
+	roundTrip *roundTripInfo
+
+	receivingWorker *receivingWorker
+	sendingWorker   *sendingWorker
+
+	output SegmentWriter
+
+	dataUpdater *updater
+	pingUpdater *updater
+}
+
+func newConnection(meta ConnMetadata, writer *packetWriter, closer io.Closer, config *Config) *Connection {
+	conn := &Connection{
+		meta:       meta,
+		closer:     closer,
+		since:      nowMillisec(),
+		dataInput:  newNotifier(),
+		dataOutput: newNotifier(),
+		config:     config,
+		output:     newRetryableWriter(newSegmentWriter(writer)),
+		mss:        config.mtu() - uint32(writer.Overhead()) - DataSegmentOverhead,
+		roundTrip: &roundTripInfo{
+			rto:    100,
+			minRtt: config.tti(),
+		},
+	}
+	conn.rd.Store(time.Time{})
+	conn.wd.Store(time.Time{})
+
+	conn.receivingWorker = newReceivingWorker(conn)
+	conn.sendingWorker = newSendingWorker(conn)
+
+	isTerminating := func() bool {
+		return conn.State().Is(StateTerminating, StateTerminated)
+	}
+	isTerminated := func() bool {
+		return conn.State() == StateTerminated
+	}
+	conn.dataUpdater = newUpdater(
+		config.tti(),
+		func() bool {
+			return !isTerminating() && (conn.sendingWorker.UpdateNecessary() || conn.receivingWorker.UpdateNecessary())
+		},
+		isTerminating,
+		conn.updateTask)
+	conn.pingUpdater = newUpdater(
+		5000, // 5 seconds
+		func() bool { return !isTerminated() },
+		isTerminated,
+		conn.updateTask)
+	conn.pingUpdater.WakeUp()
+
+	return conn
+}
+
+func (c *Connection) Elapsed() uint32 {
+	return uint32(nowMillisec() - c.since)
+}
+
+func (c *Connection) Read(b []byte) (int, error) {
+	for {
+		if c.State().Is(StateReadyToClose, StateTerminating, StateTerminated) {
+			return 0, io.EOF
+		}
+
+		n := c.receivingWorker.Read(b)
+		if n > 0 {
+			c.dataUpdater.WakeUp()
+			return n, nil
+		}
+
+		if c.State() == StatePeerTerminating {
+			return 0, io.EOF
+		}
+
+		if err := c.waitForDataInput(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (c *Connection) waitForDataInput() error {
+	for i := 0; i < 16; i++ {
+		select {
+		case <-c.dataInput:
+			return nil
+		default:
+			runtime.Gosched()
+		}
+	}
+
+	return c.wait(c.dataInput, c.rd.Load().(time.Time))
+}
+
+func (c *Connection) waitForDataOutput() error {
+	for i := 0; i < 16; i++ {
+		select {
+		case <-c.dataOutput:
+			return nil
+		default:
+			runtime.Gosched()
+		}
+	}
+
+	return c.wait(c.dataOutput, c.wd.Load().(time.Time))
+}
+
+func (c *Connection) wait(n notifier, deadline time.Time) error {
+	duration := time.Second * 16
+	if !deadline.IsZero() {
+		duration = time.Until(deadline)
+		if duration < 0 {
+			return os.ErrDeadlineExceeded
+		}
+	}
+
+	timeout := time.NewTimer(duration)
+	defer timeout.Stop()
+
+	select {
+	case <-n:
+	case <-timeout.C:
+		if !deadline.IsZero() && deadline.Before(time.Now()) {
+			return os.ErrDeadlineExceeded
+		}
+	}
+
+	return nil
+}
+
+func (c *Connection) Write(b []byte) (int, error) {
+	updatePending := false
+	defer func() {
+		if updatePending {
+			c.dataUpdater.WakeUp()
+		}
+	}()
+
+	n := 0
+	for n < len(b) {
+		for n < len(b) {
+			if c.State() != StateActive {
+				return n, io.ErrClosedPipe
+			}
+
+			size := len(b) - n
+			if size > int(c.mss) {
+				size = int(c.mss)
+			}
+			if !c.sendingWorker.Push(append([]byte(nil), b[n:n+size]...)) {
+				break
+			}
+			updatePending = true
+			n += size
+		}
+		if n == len(b) {
+			break
+		}
+
+		if updatePending {
+			c.dataUpdater.WakeUp()
+			updatePending = false
+		}
+
+		if err := c.waitForDataOutput(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (c *Connection) SetState(state State) {
+	current := c.Elapsed()
+	atomic.StoreInt32(&c.state, int32(state))
+	atomic.StoreUint32(&c.stateBeginTime, current)
+
+	switch state {
+	case StateReadyToClose:
+		c.receivingWorker.CloseRead()
+	case StatePeerClosed:
+		c.sendingWorker.CloseWrite()
+	case StateTerminating:
+		c.receivingWorker.CloseRead()
+		c.sendingWorker.CloseWrite()
+		c.pingUpdater.SetInterval(time.Second)
+	case StatePeerTerminating:
+		c.sendingWorker.CloseWrite()
+		c.pingUpdater.SetInterval(time.Second)
+	case StateTerminated:
+		c.receivingWorker.CloseRead()
+		c.sendingWorker.CloseWrite()
+		c.pingUpdater.SetInterval(time.Second)
+		c.dataUpdater.WakeUp()
+		c.pingUpdater.WakeUp()
+		go c.Terminate()
+	}
+}
+
+func (c *Connection) Close() error {
+	c.dataInput.Signal()
+	c.dataOutput.Signal()
+
+	switch c.State() {
+	case StateReadyToClose, StateTerminating, StateTerminated:
+		return net.ErrClosed
+	case StateActive:
+		c.SetState(StateReadyToClose)
+	case StatePeerClosed:
+		c.SetState(StateTerminating)
+	case StatePeerTerminating:
+		c.SetState(StateTerminated)
+	}
+
+	return nil
+}
+
+func (c *Connection) LocalAddr() net.Addr {
+	return c.meta.LocalAddr
+}
+
+func (c *Connection) RemoteAddr() net.Addr {
+	return c.meta.RemoteAddr
+}
+
+func (c *Connection) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+func (c *Connection) SetReadDeadline(t time.Time) error {
+	c.rd.Store(t)
+	c.dataInput.Signal()
+	return nil
+}
+
+func (c *Connection) SetWriteDeadline(t time.Time) error {
+	c.wd.Store(t)
+	c.dataOutput.Signal()
+	return nil
+}
+
+// Terminate releases all resources of the connection
+func (c *Connection) Terminate() {
+	c.dataInput.Signal()
+	c.dataOutput.Signal()
+
+	_ = c.closer.Close()
+	c.sendingWorker.Release()
+	c.receivingWorker.Release()
+}
+
+func (c *Connection) handleOption(opt SegmentOption) {
+	if (opt & SegmentOptionClose) == SegmentOptionClose {
+		c.onPeerClosed()
+	}
+}
+
+func (c *Connection) onPeerClosed() {
+	switch c.State() {
+	case StateReadyToClose:
+		c.SetState(StateTerminating)
+	case StateActive:
+		c.SetState(StatePeerClosed)
+	}
+}
+
+// Input handles the segments received from network
+func (c *Connection) Input(segments []Segment) {
+	current := c.Elapsed()
+	atomic.StoreUint32(&c.lastIncomingTime, current)
+
+	for _, seg := range segments {
+		if seg.Conversation() != c.meta.Conversation {
+			break
+		}
+
+		switch seg := seg.(type) {
+		case *DataSegment:
+			c.handleOption(seg.Option)
+			c.receivingWorker.ProcessSegment(seg)
+			if c.receivingWorker.IsDataAvailable() {
+				c.dataInput.Signal()
+			}
+			c.dataUpdater.WakeUp()
+		case *AckSegment:
+			c.handleOption(seg.Option)
+			c.sendingWorker.ProcessSegment(current, seg, c.roundTrip.Timeout())
+			c.dataOutput.Signal()
+			c.dataUpdater.WakeUp()
+		case *CmdOnlySegment:
+			c.handleOption(seg.Option)
+			if seg.Command() == CommandTerminate {
+				switch c.State() {
+				case StateActive, StatePeerClosed:
+					c.SetState(StatePeerTerminating)
+				case StateReadyToClose:
+					c.SetState(StateTerminating)
+				case StateTerminating:
+					c.SetState(StateTerminated)
+				}
+			}
+			if seg.Option == SegmentOptionClose || seg.Command() == CommandTerminate {
+				c.dataInput.Signal()
+				c.dataOutput.Signal()
+			}
+			c.sendingWorker.ProcessReceivingNext(seg.ReceivingNext)
+			c.receivingWorker.ProcessSendingNext(seg.SendingNext)
+			c.roundTrip.UpdatePeerRTO(seg.PeerRTO, current)
+		}
+	}
+}
+
+func (c *Connection) flush() {
+	current := c.Elapsed()
+
+	if c.State() == StateTerminated {
+		return
+	}
+	if c.State() == StateActive && current-atomic.LoadUint32(&c.lastIncomingTime) >= 30000 {
+		_ = c.Close()
+	}
+	if c.State() == StateReadyToClose && c.sendingWorker.IsEmpty() {
+		c.SetState(StateTerminating)
+	}
+
+	if c.State() == StateTerminating {
+		c.Ping(current, CommandTerminate)
+
+		if current-atomic.LoadUint32(&c.stateBeginTime) > 8000 {
+			c.SetState(StateTerminated)
+		}
+		return
+	}
+	if c.State() == StatePeerTerminating && current-atomic.LoadUint32(&c.stateBeginTime) > 4000 {
+		c.SetState(StateTerminating)
+	}
+
+	if c.State() == StateReadyToClose && current-atomic.LoadUint32(&c.stateBeginTime) > 15000 {
+		c.SetState(StateTerminating)
+	}
+
+	// flush acknowledges
+	c.receivingWorker.Flush(current)
+	c.sendingWorker.Flush(current)
+
+	if current-atomic.LoadUint32(&c.lastPingTime) >= 3000 {
+		c.Ping(current, CommandPing)
+	}
+}
+
+func (c *Connection) State() State {
+	return State(atomic.LoadInt32(&c.state))
+}
+
+func (c *Connection) updateTask() {
+	c.flush()
+}
+
+func (c *Connection) Ping(current uint32, cmd Command) {
+	seg := &CmdOnlySegment{
+		Conv:          c.meta.Conversation,
+		Cmd:           cmd,
+		ReceivingNext: c.receivingWorker.NextNumber(),
+		SendingNext:   c.sendingWorker.FirstUnacknowledged(),
+		PeerRTO:       c.roundTrip.Timeout(),
+	}
+	if c.State() == StateReadyToClose {
+		seg.Option = SegmentOptionClose
+	}
+	_ = c.output.Write(seg)
+	atomic.StoreUint32(&c.lastPingTime, current)
+}
@@ -0,0 +1,89 @@
+package kcp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+)
+
+var errInvalidAuth = errors.New("kcp: invalid auth")
+
+// NewSecurity returns AES-128-GCM keyed by the seed, or the simple authenticator without seed
+func NewSecurity(seed string) (cipher.AEAD, error) {
+	if seed == "" {
+		return simpleAuthenticator{}, nil
+	}
+	hashedSeed := sha256.Sum256([]byte(seed))
+	block, err := aes.NewCipher(hashedSeed[:16])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// simpleAuthenticator is [fnv32a(4)][length(2)][payload] obfuscated by xor
+type simpleAuthenticator struct{}
+
+func (simpleAuthenticator) NonceSize() int {
+	return 0
+}
+
+func (simpleAuthenticator) Overhead() int {
+	return 6
+}
+
+func (simpleAuthenticator) Seal(dst, nonce, plain, extra []byte) []byte {
+	start := len(dst)
+	dst = append(dst, 0, 0, 0, 0, 0, 0) // 4 bytes for hash, and then 2 bytes for length
+	sealed := dst[start:]
+	binary.BigEndian.PutUint16(sealed[4:], uint16(len(plain)))
+	dst = append(dst, plain...)
+	sealed = dst[start:]
+
+	fnvHash := fnv.New32a()
+	_, _ = fnvHash.Write(sealed[4:])
+	binary.BigEndian.PutUint32(sealed, fnvHash.Sum32())
+
+	xorfwd(sealed)
+	return dst
+}
+
+func (simpleAuthenticator) Open(dst, nonce, cipherText, extra []byte) ([]byte, error) {
+	start := len(dst)
+	dst = append(dst, cipherText...)
+	opened := dst[start:]
+	xorbkd(opened)
+
+	if len(opened) < 6 {
+		return nil, errInvalidAuth
+	}
+	fnvHash := fnv.New32a()
+	_, _ = fnvHash.Write(opened[4:])
+	if binary.BigEndian.Uint32(opened) != fnvHash.Sum32() {
+		return nil, errInvalidAuth
+	}
+
+	length := binary.BigEndian.Uint16(opened[4:6])
+	if len(opened)-6 != int(length) {
+		return nil, errInvalidAuth
+	}
+
+	return opened[6:], nil
+}
+
+// xorfwd performs XOR forwards in words, x[i] ^= x[i-4], i from 0 to len
+func xorfwd(x []byte) {
+	for i := 4; i < len(x); i++ {
+		x[i] ^= x[i-4]
+	}
+}
+
+// xorbkd performs XOR backwords in words, x[i] ^= x[i-4], i from len to 0
+func xorbkd(x []byte) {
+	for i := len(x) - 1; i >= 4; i-- {
+		x[i] ^= x[i-4]
+	}
+}
@@ -0,0 +1,65 @@
+package kcp
+
+import (
+	"net"
+	"sync/atomic"
+
+	"github.com/metacubex/mihomo/common/pool"
+
+	"github.com/zhangyunhao116/fastrand"
+)
+
+var globalConv = uint32(uint16(fastrand.Uint32()))
+
+type packetConnWriter struct {
+	pc   net.PacketConn
+	addr net.Addr
+}
+
+func (w *packetConnWriter) Write(b []byte) (int, error) {
+	return w.pc.WriteTo(b, w.addr)
+}
+
+// NewConn starts a new KCP session with addr on pc, pc is closed when the session terminates
+func NewConn(pc net.PacketConn, addr net.Addr, cfg *Config) (*Connection, error) {
+	header, err := NewHeader(cfg.HeaderType)
+	if err != nil {
+		return nil, err
+	}
+	security, err := NewSecurity(cfg.Seed)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := &packetReader{header: header, security: security}
+	writer := &packetWriter{header: header, security: security, writer: &packetConnWriter{pc: pc, addr: addr}}
+
+	conv := uint16(atomic.AddUint32(&globalConv, 1))
+	conn := newConnection(ConnMetadata{
+		LocalAddr:    pc.LocalAddr(),
+		RemoteAddr:   addr,
+		Conversation: conv,
+	}, writer, pc, cfg)
+
+	go fetchInput(pc, reader, conn)
+
+	return conn, nil
+}
+
+func fetchInput(pc net.PacketConn, reader *packetReader, conn *Connection) {
+	buf := pool.Get(pool.UDPBufferSize)
+	defer pool.Put(buf)
+	for {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			if conn.State() != StateTerminated {
+				conn.SetState(StateTerminated)
+			}
+			return
+		}
+		segments := reader.Read(buf[:n])
+		if len(segments) > 0 {
+			conn.Input(segments)
+		}
+	}
+}
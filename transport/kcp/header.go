@@ -0,0 +1,142 @@
+package kcp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/zhangyunhao116/fastrand"
+)
+
+// PacketHeader is the obfuscation header in front of every packet, the receiver just skips it
+type PacketHeader interface {
+	Size() int
+	Serialize(b []byte)
+}
+
+// NewHeader returns the header of V2Ray's headerType, nil for none
+func NewHeader(headerType string) (PacketHeader, error) {
+	switch headerType {
+	case "", "none":
+		return nil, nil
+	case "srtp":
+		return &srtpHeader{header: 0xB5E8, number: uint16(fastrand.Uint32())}, nil
+	case "utp":
+		return &utpHeader{header: 1, extension: 0, connectionID: uint16(fastrand.Uint32())}, nil
+	case "wechat-video":
+		return &wechatVideoHeader{sn: fastrand.Uint32() & 0xFFFF}, nil
+	case "dtls":
+		return &dtlsHeader{epoch: uint16(fastrand.Uint32()), length: 17}, nil
+	case "wireguard":
+		return wireguardHeader{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported kcp header type: %s", headerType)
+	}
+}
+
+type srtpHeader struct {
+	mutex  sync.Mutex
+	header uint16
+	number uint16
+}
+
+func (*srtpHeader) Size() int {
+	return 4
+}
+
+func (h *srtpHeader) Serialize(b []byte) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.number++
+	binary.BigEndian.PutUint16(b, h.header)
+	binary.BigEndian.PutUint16(b[2:], h.number)
+}
+
+type utpHeader struct {
+	header       byte
+	extension    byte
+	connectionID uint16
+}
+
+func (*utpHeader) Size() int {
+	return 4
+}
+
+func (h *utpHeader) Serialize(b []byte) {
+	binary.BigEndian.PutUint16(b, h.connectionID)
+	b[2] = h.header
+	b[3] = h.extension
+}
+
+type wechatVideoHeader struct {
+	mutex sync.Mutex
+	sn    uint32
+}
+
+func (*wechatVideoHeader) Size() int {
+	return 13
+}
+
+func (h *wechatVideoHeader) Serialize(b []byte) {
+	h.mutex.Lock()
+	h.sn++
+	sn := h.sn
+	h.mutex.Unlock()
+	b[0] = 0xa1
+	b[1] = 0x08
+	binary.BigEndian.PutUint32(b[2:], sn)
+	b[6] = 0x00
+	b[7] = 0x10
+	b[8] = 0x11
+	b[9] = 0x18
+	b[10] = 0x30
+	b[11] = 0x22
+	b[12] = 0x30
+}
+
+type dtlsHeader struct {
+	mutex    sync.Mutex
+	epoch    uint16
+	length   uint16
+	sequence uint32
+}
+
+func (*dtlsHeader) Size() int {
+	return 1 + 2 + 2 + 6 + 2
+}
+
+func (h *dtlsHeader) Serialize(b []byte) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	b[0] = 23 // application data
+	b[1] = 254
+	b[2] = 253
+	b[3] = byte(h.epoch >> 8)
+	b[4] = byte(h.epoch)
+	b[5] = 0
+	b[6] = 0
+	b[7] = byte(h.sequence >> 24)
+	b[8] = byte(h.sequence >> 16)
+	b[9] = byte(h.sequence >> 8)
+	b[10] = byte(h.sequence)
+	h.sequence++
+	b[11] = byte(h.length >> 8)
+	b[12] = byte(h.length)
+	h.length += 17
+	if h.length > 100 {
+		h.length -= 50
+	}
+}
+
+type wireguardHeader struct{}
+
+func (wireguardHeader) Size() int {
+	return 4
+}
+
+func (wireguardHeader) Serialize(b []byte) {
+	b[0] = 0x04
+	b[1] = 0x00
+	b[2] = 0x00
+	b[3] = 0x00
+}
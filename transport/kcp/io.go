@@ -0,0 +1,137 @@
+package kcp
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/metacubex/mihomo/common/pool"
+)
+
+type SegmentWriter interface {
+	Write(seg Segment) error
+}
+
+// packetReader strips the header and opens the payload of a packet
+type packetReader struct {
+	header   PacketHeader
+	security cipher.AEAD
+}
+
+func (r *packetReader) Read(b []byte) []Segment {
+	if r.header != nil {
+		if len(b) <= r.header.Size() {
+			return nil
+		}
+		b = b[r.header.Size():]
+	}
+	if r.security != nil {
+		nonceSize := r.security.NonceSize()
+		overhead := r.security.Overhead()
+		if len(b) <= nonceSize+overhead {
+			return nil
+		}
+		out, err := r.security.Open(b[nonceSize:nonceSize], b[:nonceSize], b[nonceSize:], nil)
+		if err != nil {
+			return nil
+		}
+		b = out
+	}
+	var result []Segment
+	for len(b) > 0 {
+		seg, x := ReadSegment(b)
+		if seg == nil {
+			break
+		}
+		result = append(result, seg)
+		b = x
+	}
+	return result
+}
+
+// packetWriter prepends the header and seals the payload of a packet
+type packetWriter struct {
+	header   PacketHeader
+	security cipher.AEAD
+	writer   io.Writer
+}
+
+func (w *packetWriter) Overhead() int {
+	overhead := 0
+	if w.header != nil {
+		overhead += w.header.Size()
+	}
+	if w.security != nil {
+		overhead += w.security.NonceSize() + w.security.Overhead()
+	}
+	return overhead
+}
+
+func (w *packetWriter) Write(b []byte) (int, error) {
+	buf := pool.Get(w.Overhead() + len(b))
+	defer pool.Put(buf)
+
+	n := 0
+	if w.header != nil {
+		w.header.Serialize(buf)
+		n += w.header.Size()
+	}
+	if w.security != nil {
+		nonceSize := w.security.NonceSize()
+		nonce := buf[n : n+nonceSize]
+		if _, err := rand.Read(nonce); err != nil {
+			return 0, err
+		}
+		n += nonceSize
+		n += len(w.security.Seal(buf[n:n], nonce, b, nil))
+	} else {
+		n += copy(buf[n:], b)
+	}
+
+	_, err := w.writer.Write(buf[:n])
+	return len(b), err
+}
+
+type simpleSegmentWriter struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	buf    []byte
+}
+
+func newSegmentWriter(writer io.Writer) *simpleSegmentWriter {
+	return &simpleSegmentWriter{writer: writer}
+}
+
+func (w *simpleSegmentWriter) Write(seg Segment) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	size := seg.ByteSize()
+	if cap(w.buf) < size {
+		w.buf = make([]byte, size)
+	}
+	b := w.buf[:size]
+	seg.Serialize(b)
+	_, err := w.writer.Write(b)
+	return err
+}
+
+type retryableWriter struct {
+	writer SegmentWriter
+}
+
+func newRetryableWriter(writer SegmentWriter) *retryableWriter {
+	return &retryableWriter{writer: writer}
+}
+
+func (w *retryableWriter) Write(seg Segment) (err error) {
+	for i := 0; i < 5; i++ {
+		if err = w.writer.Write(seg); err == nil {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return err
+}
@@ -0,0 +1,103 @@
+package kcp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testEcho(t *testing.T, cfg *Config) {
+	serverPC, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	listener, err := NewListener(serverPC, cfg)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	clientPC, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	conn, err := NewConn(clientPC, listener.Addr(), cfg)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(10*time.Second)))
+
+	data := make([]byte, 256*1024)
+	_, _ = rand.Read(data)
+	go func() {
+		_, _ = conn.Write(data)
+	}()
+
+	buf := make([]byte, len(data))
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, buf))
+}
+
+func TestKCP(t *testing.T) {
+	for _, headerType := range []string{"none", "srtp", "utp", "wechat-video", "dtls", "wireguard"} {
+		t.Run(headerType, func(t *testing.T) {
+			testEcho(t, &Config{HeaderType: headerType})
+		})
+	}
+}
+
+func TestKCPSeed(t *testing.T) {
+	testEcho(t, &Config{HeaderType: "dtls", Seed: "mihomo", Congestion: true})
+}
+
+func TestSegment(t *testing.T) {
+	ack := newAckSegment()
+	ack.Conv = 1
+	ack.ReceivingWindow = 2
+	ack.ReceivingNext = 3
+	ack.Timestamp = 4
+	ack.PutNumber(5)
+	ack.PutNumber(6)
+
+	data := &DataSegment{Conv: 1, Timestamp: 2, Number: 3, SendingNext: 4, payload: []byte("mihomo")}
+	cmd := &CmdOnlySegment{Conv: 1, Cmd: CommandTerminate, Option: SegmentOptionClose, SendingNext: 2, ReceivingNext: 3, PeerRTO: 4}
+
+	for _, seg := range []Segment{ack, data, cmd} {
+		b := make([]byte, seg.ByteSize())
+		seg.Serialize(b)
+		parsed, extra := ReadSegment(b)
+		require.NotNil(t, parsed)
+		assert.Empty(t, extra)
+		assert.Equal(t, seg, parsed)
+	}
+}
+
+func TestSimpleAuthenticator(t *testing.T) {
+	security, err := NewSecurity("")
+	require.NoError(t, err)
+
+	plain := []byte("mihomo kcp")
+	sealed := security.Seal(nil, nil, plain, nil)
+	assert.Len(t, sealed, len(plain)+security.Overhead())
+
+	opened, err := security.Open(nil, nil, sealed, nil)
+	require.NoError(t, err)
+	assert.Equal(t, plain, opened)
+
+	sealed[len(sealed)-1] ^= 1
+	_, err = security.Open(nil, nil, sealed, nil)
+	assert.ErrorIs(t, err, errInvalidAuth)
+}
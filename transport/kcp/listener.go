@@ -0,0 +1,160 @@
+package kcp
+
+import (
+	"crypto/cipher"
+	"net"
+	"sync"
+
+	"github.com/metacubex/mihomo/common/pool"
+)
+
+type connectionID struct {
+	remote string
+	conv   uint16
+}
+
+// Listener accepts KCP sessions on a net.PacketConn
+type Listener struct {
+	mutex    sync.Mutex
+	pc       net.PacketConn
+	config   *Config
+	reader   *packetReader
+	header   PacketHeader
+	security cipher.AEAD
+	sessions map[connectionID]*Connection
+	accept   chan *Connection
+	closed   chan struct{}
+	once     sync.Once
+}
+
+func NewListener(pc net.PacketConn, cfg *Config) (*Listener, error) {
+	header, err := NewHeader(cfg.HeaderType)
+	if err != nil {
+		return nil, err
+	}
+	security, err := NewSecurity(cfg.Seed)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Listener{
+		pc:       pc,
+		config:   cfg,
+		reader:   &packetReader{header: header, security: security},
+		header:   header,
+		security: security,
+		sessions: make(map[connectionID]*Connection),
+		accept:   make(chan *Connection, 32),
+		closed:   make(chan struct{}),
+	}
+	go l.handlePackets()
+	return l, nil
+}
+
+func (l *Listener) handlePackets() {
+	buf := pool.Get(pool.UDPBufferSize)
+	defer pool.Put(buf)
+	for {
+		n, addr, err := l.pc.ReadFrom(buf)
+		if err != nil {
+			_ = l.Close()
+			return
+		}
+		l.onReceive(buf[:n], addr)
+	}
+}
+
+func (l *Listener) onReceive(b []byte, src net.Addr) {
+	segments := l.reader.Read(b)
+	if len(segments) == 0 {
+		return
+	}
+
+	conv := segments[0].Conversation()
+	cmd := segments[0].Command()
+
+	id := connectionID{
+		remote: src.String(),
+		conv:   conv,
+	}
+
+	l.mutex.Lock()
+	conn, found := l.sessions[id]
+	if !found {
+		if cmd == CommandTerminate {
+			l.mutex.Unlock()
+			return
+		}
+		writer := &sessionWriter{
+			packetConnWriter: packetConnWriter{pc: l.pc, addr: src},
+			id:               id,
+			listener:         l,
+		}
+		conn = newConnection(ConnMetadata{
+			LocalAddr:    l.pc.LocalAddr(),
+			RemoteAddr:   src,
+			Conversation: conv,
+		}, &packetWriter{header: l.header, security: l.security, writer: writer}, writer, l.config)
+
+		select {
+		case l.accept <- conn:
+			l.sessions[id] = conn
+		default:
+			// the accept queue is full, drop the session
+			l.mutex.Unlock()
+			conn.SetState(StateTerminated)
+			return
+		}
+	}
+	l.mutex.Unlock()
+
+	conn.Input(segments)
+}
+
+func (l *Listener) remove(id connectionID) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	delete(l.sessions, id)
+}
+
+// Accept waits for and returns the next session
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.accept:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops listening and terminates all sessions
+func (l *Listener) Close() error {
+	l.once.Do(func() {
+		close(l.closed)
+		_ = l.pc.Close()
+
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		for _, conn := range l.sessions {
+			go conn.Terminate()
+		}
+	})
+	return nil
+}
+
+func (l *Listener) Addr() net.Addr {
+	return l.pc.LocalAddr()
+}
+
+// sessionWriter writes to the shared net.PacketConn, closing it only removes the session
+type sessionWriter struct {
+	packetConnWriter
+	id       connectionID
+	listener *Listener
+}
+
+func (w *sessionWriter) Close() error {
+	w.listener.remove(w.id)
+	return nil
+}
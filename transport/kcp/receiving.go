@@ -0,0 +1,238 @@
+package kcp
+
+import (
+	"sync"
+)
+
+type receivingWindow struct {
+	cache map[uint32]*DataSegment
+}
+
+func newReceivingWindow() *receivingWindow {
+	return &receivingWindow{cache: make(map[uint32]*DataSegment)}
+}
+
+func (w *receivingWindow) Set(id uint32, value *DataSegment) bool {
+	if _, found := w.cache[id]; found {
+		return false
+	}
+	w.cache[id] = value
+	return true
+}
+
+func (w *receivingWindow) Has(id uint32) bool {
+	_, found := w.cache[id]
+	return found
+}
+
+func (w *receivingWindow) Remove(id uint32) *DataSegment {
+	value, found := w.cache[id]
+	if !found {
+		return nil
+	}
+	delete(w.cache, id)
+	return value
+}
+
+type ackList struct {
+	writer          SegmentWriter
+	timestamps      []uint32
+	numbers         []uint32
+	nextFlush       []uint32
+	flushCandidates []uint32
+	dirty           bool
+}
+
+func newAckList(writer SegmentWriter) *ackList {
+	return &ackList{
+		writer:          writer,
+		timestamps:      make([]uint32, 0, ackNumberLimit),
+		numbers:         make([]uint32, 0, ackNumberLimit),
+		nextFlush:       make([]uint32, 0, ackNumberLimit),
+		flushCandidates: make([]uint32, 0, ackNumberLimit),
+	}
+}
+
+func (l *ackList) Add(number uint32, timestamp uint32) {
+	l.timestamps = append(l.timestamps, timestamp)
+	l.numbers = append(l.numbers, number)
+	l.nextFlush = append(l.nextFlush, 0)
+	l.dirty = true
+}
+
+func (l *ackList) Clear(una uint32) {
+	count := 0
+	for i := 0; i < len(l.numbers); i++ {
+		if l.numbers[i] < una {
+			continue
+		}
+		if i != count {
+			l.numbers[count] = l.numbers[i]
+			l.timestamps[count] = l.timestamps[i]
+			l.nextFlush[count] = l.nextFlush[i]
+		}
+		count++
+	}
+	if count < len(l.numbers) {
+		l.numbers = l.numbers[:count]
+		l.timestamps = l.timestamps[:count]
+		l.nextFlush = l.nextFlush[:count]
+		l.dirty = true
+	}
+}
+
+func (l *ackList) Flush(current uint32, rto uint32) {
+	l.flushCandidates = l.flushCandidates[:0]
+
+	seg := newAckSegment()
+	for i := 0; i < len(l.numbers); i++ {
+		if l.nextFlush[i] > current {
+			if len(l.flushCandidates) < cap(l.flushCandidates) {
+				l.flushCandidates = append(l.flushCandidates, l.numbers[i])
+			}
+			continue
+		}
+		seg.PutNumber(l.numbers[i])
+		seg.PutTimestamp(l.timestamps[i])
+		timeout := rto / 2
+		if timeout < 20 {
+			timeout = 20
+		}
+		l.nextFlush[i] = current + timeout
+
+		if seg.IsFull() {
+			_ = l.writer.Write(seg)
+			seg = newAckSegment()
+			l.dirty = false
+		}
+	}
+
+	if l.dirty || !seg.IsEmpty() {
+		for _, number := range l.flushCandidates {
+			if seg.IsFull() {
+				break
+			}
+			seg.PutNumber(number)
+		}
+		_ = l.writer.Write(seg)
+		l.dirty = false
+	}
+}
+
+type receivingWorker struct {
+	mutex      sync.RWMutex
+	conn       *Connection
+	leftOver   []byte
+	window     *receivingWindow
+	acklist    *ackList
+	nextNumber uint32
+	windowSize uint32
+}
+
+func newReceivingWorker(conn *Connection) *receivingWorker {
+	worker := &receivingWorker{
+		conn:       conn,
+		window:     newReceivingWindow(),
+		windowSize: conn.config.receivingInFlightSize(),
+	}
+	worker.acklist = newAckList(worker)
+	return worker
+}
+
+func (w *receivingWorker) Release() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.window = newReceivingWindow()
+}
+
+func (w *receivingWorker) ProcessSendingNext(number uint32) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.acklist.Clear(number)
+}
+
+func (w *receivingWorker) ProcessSegment(seg *DataSegment) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	number := seg.Number
+	idx := number - w.nextNumber
+	if idx >= w.windowSize {
+		return
+	}
+	w.acklist.Clear(seg.SendingNext)
+	w.acklist.Add(number, seg.Timestamp)
+
+	w.window.Set(seg.Number, seg)
+}
+
+// Read copies the in-order received data into b, it is only called by the reading goroutine
+func (w *receivingWorker) Read(b []byte) int {
+	n := 0
+	if len(w.leftOver) > 0 {
+		n = copy(b, w.leftOver)
+		w.leftOver = w.leftOver[n:]
+		if n == len(b) {
+			return n
+		}
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for n < len(b) {
+		seg := w.window.Remove(w.nextNumber)
+		if seg == nil {
+			break
+		}
+		w.nextNumber++
+		copied := copy(b[n:], seg.payload)
+		n += copied
+		if copied < len(seg.payload) {
+			w.leftOver = seg.payload[copied:]
+		}
+	}
+	return n
+}
+
+func (w *receivingWorker) IsDataAvailable() bool {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	return w.window.Has(w.nextNumber)
+}
+
+func (w *receivingWorker) NextNumber() uint32 {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	return w.nextNumber
+}
+
+func (w *receivingWorker) Flush(current uint32) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.acklist.Flush(current, w.conn.roundTrip.Timeout())
+}
+
+// Write implements SegmentWriter for the ackList, called with the lock held
+func (w *receivingWorker) Write(seg Segment) error {
+	ackSeg := seg.(*AckSegment)
+	ackSeg.Conv = w.conn.meta.Conversation
+	ackSeg.ReceivingNext = w.nextNumber
+	ackSeg.ReceivingWindow = w.nextNumber + w.windowSize
+	ackSeg.Option = 0
+	if w.conn.State() == StateReadyToClose {
+		ackSeg.Option = SegmentOptionClose
+	}
+	return w.conn.output.Write(ackSeg)
+}
+
+func (*receivingWorker) CloseRead() {
+}
+
+func (w *receivingWorker) UpdateNecessary() bool {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	return len(w.acklist.numbers) > 0
+}
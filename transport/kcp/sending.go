@@ -0,0 +1,342 @@
+package kcp
+
+import (
+	"container/list"
+	"sync"
+)
+
+type sendingWindow struct {
+	cache             *list.List
+	totalInFlightSize uint32
+	writer            SegmentWriter
+	onPacketLoss      func(uint32)
+}
+
+func newSendingWindow(writer SegmentWriter, onPacketLoss func(uint32)) *sendingWindow {
+	return &sendingWindow{
+		cache:        list.New(),
+		writer:       writer,
+		onPacketLoss: onPacketLoss,
+	}
+}
+
+func (sw *sendingWindow) Release() {
+	sw.cache.Init()
+}
+
+func (sw *sendingWindow) Len() uint32 {
+	return uint32(sw.cache.Len())
+}
+
+func (sw *sendingWindow) IsEmpty() bool {
+	return sw.cache.Len() == 0
+}
+
+func (sw *sendingWindow) Push(number uint32, payload []byte) {
+	sw.cache.PushBack(&DataSegment{
+		Number:  number,
+		payload: payload,
+	})
+}
+
+func (sw *sendingWindow) FirstNumber() uint32 {
+	return sw.cache.Front().Value.(*DataSegment).Number
+}
+
+func (sw *sendingWindow) Clear(una uint32) {
+	for !sw.IsEmpty() {
+		seg := sw.cache.Front().Value.(*DataSegment)
+		if seg.Number >= una {
+			break
+		}
+		sw.cache.Remove(sw.cache.Front())
+	}
+}
+
+func (sw *sendingWindow) HandleFastAck(number uint32, rto uint32) {
+	sw.visit(func(seg *DataSegment) bool {
+		if number == seg.Number || number-seg.Number > 0x7FFFFFFF {
+			return false
+		}
+
+		if seg.transmit > 0 && seg.timeout > rto/3 {
+			seg.timeout -= rto / 3
+		}
+		return true
+	})
+}
+
+func (sw *sendingWindow) visit(visitor func(seg *DataSegment) bool) {
+	for e := sw.cache.Front(); e != nil; e = e.Next() {
+		if !visitor(e.Value.(*DataSegment)) {
+			break
+		}
+	}
+}
+
+func (sw *sendingWindow) Flush(current uint32, rto uint32, maxInFlightSize uint32) {
+	if sw.IsEmpty() {
+		return
+	}
+
+	var lost uint32
+	var inFlightSize uint32
+
+	sw.visit(func(seg *DataSegment) bool {
+		if inFlightSize >= maxInFlightSize {
+			return false
+		}
+		if current-seg.timeout >= 0x7FFFFFFF {
+			return true
+		}
+
+		if seg.transmit == 0 {
+			// First time
+			sw.totalInFlightSize++
+		} else {
+			lost++
+		}
+		seg.timeout = current + rto
+
+		seg.Timestamp = current
+		seg.transmit++
+		_ = sw.writer.Write(seg)
+		inFlightSize++
+		return true
+	})
+
+	if sw.onPacketLoss != nil && inFlightSize > 0 && sw.totalInFlightSize != 0 {
+		rate := lost * 100 / sw.totalInFlightSize
+		sw.onPacketLoss(rate)
+	}
+}
+
+func (sw *sendingWindow) Remove(number uint32) bool {
+	for e := sw.cache.Front(); e != nil; e = e.Next() {
+		seg := e.Value.(*DataSegment)
+		if seg.Number > number {
+			return false
+		} else if seg.Number == number {
+			if sw.totalInFlightSize > 0 {
+				sw.totalInFlightSize--
+			}
+			sw.cache.Remove(e)
+			return true
+		}
+	}
+	return false
+}
+
+type sendingWorker struct {
+	mutex                      sync.RWMutex
+	conn                       *Connection
+	window                     *sendingWindow
+	firstUnacknowledged        uint32
+	nextNumber                 uint32
+	remoteNextNumber           uint32
+	controlWindow              uint32
+	fastResend                 uint32
+	windowSize                 uint32
+	firstUnacknowledgedUpdated bool
+	closed                     bool
+}
+
+func newSendingWorker(conn *Connection) *sendingWorker {
+	worker := &sendingWorker{
+		conn:             conn,
+		fastResend:       2,
+		remoteNextNumber: 32,
+		controlWindow:    conn.config.sendingInFlightSize(),
+		windowSize:       conn.config.sendingBufferSize(),
+	}
+	worker.window = newSendingWindow(worker, worker.OnPacketLoss)
+	return worker
+}
+
+func (w *sendingWorker) Release() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.window.Release()
+	w.closed = true
+}
+
+func (w *sendingWorker) ProcessReceivingNext(nextNumber uint32) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.processReceivingNextWithoutLock(nextNumber)
+}
+
+func (w *sendingWorker) processReceivingNextWithoutLock(nextNumber uint32) {
+	w.window.Clear(nextNumber)
+	w.findFirstUnacknowledged()
+}
+
+func (w *sendingWorker) findFirstUnacknowledged() {
+	first := w.firstUnacknowledged
+	if !w.window.IsEmpty() {
+		w.firstUnacknowledged = w.window.FirstNumber()
+	} else {
+		w.firstUnacknowledged = w.nextNumber
+	}
+	if first != w.firstUnacknowledged {
+		w.firstUnacknowledgedUpdated = true
+	}
+}
+
+func (w *sendingWorker) processAck(number uint32) bool {
+	// number < w.firstUnacknowledged || number >= w.nextNumber
+	if number-w.firstUnacknowledged > 0x7FFFFFFF || number-w.nextNumber < 0x7FFFFFFF {
+		return false
+	}
+
+	removed := w.window.Remove(number)
+	if removed {
+		w.findFirstUnacknowledged()
+	}
+	return removed
+}
+
+func (w *sendingWorker) ProcessSegment(current uint32, seg *AckSegment, rto uint32) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return
+	}
+
+	if w.remoteNextNumber < seg.ReceivingWindow {
+		w.remoteNextNumber = seg.ReceivingWindow
+	}
+	w.processReceivingNextWithoutLock(seg.ReceivingNext)
+
+	if seg.IsEmpty() {
+		return
+	}
+
+	var maxack uint32
+	var maxackRemoved bool
+	for _, number := range seg.NumberList {
+		removed := w.processAck(number)
+		if maxack < number {
+			maxack = number
+			maxackRemoved = removed
+		}
+	}
+
+	if maxackRemoved {
+		w.window.HandleFastAck(maxack, rto)
+		if current-seg.Timestamp < 10000 {
+			w.conn.roundTrip.Update(current-seg.Timestamp, current)
+		}
+	}
+}
+
+// Push appends payload to the sending window, returns false if the window is full
+func (w *sendingWorker) Push(payload []byte) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return false
+	}
+
+	if w.window.Len() > w.windowSize {
+		return false
+	}
+
+	w.window.Push(w.nextNumber, payload)
+	w.nextNumber++
+	return true
+}
+
+// Write implements SegmentWriter for the sendingWindow, called with the lock held
+func (w *sendingWorker) Write(seg Segment) error {
+	dataSeg := seg.(*DataSegment)
+
+	dataSeg.Conv = w.conn.meta.Conversation
+	dataSeg.SendingNext = w.firstUnacknowledged
+	dataSeg.Option = 0
+	if w.conn.State() == StateReadyToClose {
+		dataSeg.Option = SegmentOptionClose
+	}
+
+	return w.conn.output.Write(dataSeg)
+}
+
+func (w *sendingWorker) OnPacketLoss(lossRate uint32) {
+	if !w.conn.config.Congestion || w.conn.roundTrip.Timeout() == 0 {
+		return
+	}
+
+	if lossRate >= 15 {
+		w.controlWindow = 3 * w.controlWindow / 4
+	} else if lossRate <= 5 {
+		w.controlWindow += w.controlWindow / 4
+	}
+	if w.controlWindow < 16 {
+		w.controlWindow = 16
+	}
+	if w.controlWindow > 2*w.conn.config.sendingInFlightSize() {
+		w.controlWindow = 2 * w.conn.config.sendingInFlightSize()
+	}
+}
+
+func (w *sendingWorker) Flush(current uint32) {
+	w.mutex.Lock()
+
+	if w.closed {
+		w.mutex.Unlock()
+		return
+	}
+
+	cwnd := w.conn.config.sendingInFlightSize()
+	if cwnd > w.remoteNextNumber-w.firstUnacknowledged {
+		cwnd = w.remoteNextNumber - w.firstUnacknowledged
+	}
+	if w.conn.config.Congestion && cwnd > w.controlWindow {
+		cwnd = w.controlWindow
+	}
+
+	cwnd *= 20 // magic
+
+	if !w.window.IsEmpty() {
+		w.window.Flush(current, w.conn.roundTrip.Timeout(), cwnd)
+		w.firstUnacknowledgedUpdated = false
+	}
+
+	updated := w.firstUnacknowledgedUpdated
+	w.firstUnacknowledgedUpdated = false
+
+	w.mutex.Unlock()
+
+	if updated {
+		w.conn.Ping(current, CommandPing)
+	}
+}
+
+func (w *sendingWorker) CloseWrite() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.window.Clear(0xFFFFFFFF)
+}
+
+func (w *sendingWorker) IsEmpty() bool {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	return w.window.IsEmpty()
+}
+
+func (w *sendingWorker) UpdateNecessary() bool {
+	return !w.IsEmpty()
+}
+
+func (w *sendingWorker) FirstUnacknowledged() uint32 {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	return w.firstUnacknowledged
+}
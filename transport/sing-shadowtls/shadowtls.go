@@ -48,7 +48,7 @@ func NewShadowTLS(ctx context.Context, conn net.Conn, option *ShadowTLSOption) (
 	tlsHandshake := shadowtls.DefaultTLSHandshakeFunc(option.Password, tlsConfig)
 	if len(option.ClientFingerprint) != 0 {
 		if fingerprint, exists := tlsC.GetFingerprint(option.ClientFingerprint); exists {
-			tlsHandshake = uTLSHandshakeFunc(tlsConfig, *fingerprint.ClientHelloID)
+			tlsHandshake = uTLSHandshakeFunc(tlsConfig, fingerprint)
 		}
 	}
 	client, err := shadowtls.NewClient(shadowtls.ClientConfig{
@@ -63,9 +63,10 @@ func NewShadowTLS(ctx context.Context, conn net.Conn, option *ShadowTLSOption) (
 	return client.DialContextConn(ctx, conn)
 }
 
-func uTLSHandshakeFunc(config *tls.Config, clientHelloID utls.ClientHelloID) shadowtls.TLSHandshakeFunc {
+func uTLSHandshakeFunc(config *tls.Config, fingerprint tlsC.UClientHelloID) shadowtls.TLSHandshakeFunc {
 	return func(ctx context.Context, conn net.Conn, sessionIDGenerator shadowtls.TLSSessionIDGeneratorFunc) error {
 		tlsConfig := &utls.Config{
+			Certificates:          tlsC.CopyCertificates(config.Certificates),
 			Rand:                  config.Rand,
 			Time:                  config.Time,
 			VerifyPeerCertificate: config.VerifyPeerCertificate,
@@ -83,7 +84,10 @@ func uTLSHandshakeFunc(config *tls.Config, clientHelloID utls.ClientHelloID) sha
 			Renegotiation:          utls.RenegotiationSupport(config.Renegotiation),
 			SessionIDGenerator:     sessionIDGenerator,
 		}
-		tlsConn := utls.UClient(conn, tlsConfig, clientHelloID)
+		tlsConn := utls.UClient(conn, tlsConfig, *fingerprint.ClientHelloID)
+		if err := fingerprint.ApplyPreset(tlsConn); err != nil {
+			return err
+		}
 		return tlsConn.HandshakeContext(ctx)
 	}
 }
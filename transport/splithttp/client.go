@@ -0,0 +1,318 @@
+package splithttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/metacubex/mihomo/common/atomic"
+	N "github.com/metacubex/mihomo/common/net"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/metacubex/quic-go"
+	"github.com/metacubex/quic-go/http3"
+	"golang.org/x/net/http2"
+)
+
+// DialFn returns a connection which is ready to speak HTTP, TLS should be already handled
+type DialFn = func(ctx context.Context) (net.Conn, error)
+
+// DialQUICFn returns a QUIC connection for HTTP/3
+type DialQUICFn = func(ctx context.Context, tlsConfig *tls.Config, quicConfig *quic.Config) (quic.EarlyConnection, error)
+
+type Client struct {
+	roundTripper http.RoundTripper
+	scheme       string
+	remoteAddr   atomic.TypedValue[net.Addr]
+	singleUse    bool
+}
+
+// NewHTTP1Client uses a connection pool of HTTP/1.1, the download and every concurrent upload take their own connection
+func NewHTTP1Client(dialFn DialFn) *Client {
+	client := &Client{scheme: "http"}
+	client.roundTripper = &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return client.dial(ctx, dialFn)
+		},
+		DisableCompression: true,
+		IdleConnTimeout:    90 * time.Second,
+	}
+	return client
+}
+
+// NewHTTP2Client multiplexes the download and uploads of all sessions on HTTP/2 streams
+func NewHTTP2Client(dialFn DialFn) *Client {
+	client := &Client{scheme: "https"}
+	client.roundTripper = &http2.Transport{
+		DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return client.dial(ctx, dialFn)
+		},
+		AllowHTTP:          true,
+		DisableCompression: true,
+		ReadIdleTimeout:    30 * time.Second,
+	}
+	return client
+}
+
+// NewHTTP3Client multiplexes the download and uploads of all sessions on HTTP/3 streams
+func NewHTTP3Client(dialFn DialQUICFn, tlsConfig *tls.Config) *Client {
+	client := &Client{scheme: "https"}
+	client.roundTripper = &http3.RoundTripper{
+		Dial: func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+			conn, err := dialFn(ctx, tlsCfg, cfg)
+			if err != nil {
+				return nil, err
+			}
+			client.remoteAddr.Store(conn.RemoteAddr())
+			return conn, nil
+		},
+		TLSClientConfig:    tlsConfig,
+		DisableCompression: true,
+	}
+	return client
+}
+
+// NewHTTP2ClientWithConn makes all requests on the given connection
+func NewHTTP2ClientWithConn(conn net.Conn) *Client {
+	used := atomic.NewBool(false)
+	return NewHTTP2Client(func(ctx context.Context) (net.Conn, error) {
+		if used.Swap(true) {
+			return nil, ErrClosed
+		}
+		return conn, nil
+	})
+}
+
+func (c *Client) dial(ctx context.Context, dialFn DialFn) (net.Conn, error) {
+	conn, err := dialFn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.remoteAddr.Store(conn.RemoteAddr())
+	return conn, nil
+}
+
+// SetSingleUse makes the client closed together with its first connection
+func (c *Client) SetSingleUse(isSingleUse bool) {
+	c.singleUse = isSingleUse
+}
+
+func (c *Client) Close() error {
+	switch rt := c.roundTripper.(type) {
+	case *http.Transport:
+		rt.CloseIdleConnections()
+	case *http2.Transport:
+		rt.CloseIdleConnections()
+	case *http3.RoundTripper:
+		return rt.Close()
+	}
+	return nil
+}
+
+type Conn struct {
+	client *Client
+	cfg    *Config
+	url    url.URL
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// the download and the upload go through pipes, so the deadlines of them make the pending
+	// Read and Write return os.ErrDeadlineExceeded without closing the session
+	downloadReader net.Conn
+	downloadWriter net.Conn
+	downloadErr    error
+
+	uploadReader net.Conn
+	uploadWriter net.Conn
+	uploadErr    atomic.TypedValue[error]
+
+	closeOnce sync.Once
+}
+
+// StreamConn opens a new session on client
+func StreamConn(client *Client, cfg *Config) (net.Conn, error) {
+	sessionID, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	downloadReader, downloadWriter := N.Pipe()
+	uploadReader, uploadWriter := N.Pipe()
+	conn := &Conn{
+		client: client,
+		cfg:    cfg,
+		url: url.URL{
+			Scheme: client.scheme,
+			Host:   cfg.Host,
+			Path:   cfg.NormalizedPath() + sessionID.String(),
+		},
+		ctx:            ctx,
+		cancel:         cancel,
+		downloadReader: downloadReader,
+		downloadWriter: downloadWriter,
+		uploadReader:   uploadReader,
+		uploadWriter:   uploadWriter,
+	}
+
+	go conn.initDownload()
+	go conn.uploadLoop()
+	return conn, nil
+}
+
+func (c *Conn) newRequest(method string, u *url.URL, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(c.ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range c.cfg.Headers {
+		req.Header[key] = values
+	}
+	if host := c.cfg.Headers.Get("Host"); host != "" {
+		req.Host = host
+	}
+	return req, nil
+}
+
+// initDownload copies the download to downloadWriter, downloadErr is set before
+// downloadWriter is closed, so Read sees it after io.EOF
+func (c *Conn) initDownload() {
+	defer func() {
+		_ = c.downloadWriter.Close()
+		if c.client.singleUse {
+			_ = c.client.Close()
+		}
+	}()
+
+	req, err := c.newRequest(http.MethodGet, &c.url, nil)
+	if err != nil {
+		c.downloadErr = err
+		return
+	}
+
+	resp, err := c.client.roundTripper.RoundTrip(req)
+	if err != nil {
+		c.downloadErr = err
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		c.downloadErr = fmt.Errorf("splithttp: unexpected download status %s", resp.Status)
+		return
+	}
+	if _, err = io.Copy(c.downloadWriter, resp.Body); err != nil && !errors.Is(err, io.ErrClosedPipe) {
+		c.downloadErr = err
+	}
+}
+
+func (c *Conn) uploadLoop() {
+	maxUploadSize := c.cfg.maxUploadSize()
+	// the buffers are reused by the uploads and limit the concurrent ones, they are allocated on demand
+	buffers := make(chan []byte, c.cfg.maxConcurrentUploads())
+	for i := 0; i < cap(buffers); i++ {
+		buffers <- nil
+	}
+	var seq uint64
+	for {
+		var buffer []byte
+		select {
+		case buffer = <-buffers:
+		case <-c.ctx.Done():
+			return
+		}
+		if buffer == nil {
+			buffer = make([]byte, maxUploadSize)
+		}
+		n, err := c.uploadReader.Read(buffer)
+		if err != nil {
+			return
+		}
+
+		u := c.url
+		u.Path += "/" + strconv.FormatUint(seq, 10)
+		seq++
+		go func(buffer []byte, n int) {
+			if err := c.upload(&u, buffer[:n]); err != nil {
+				// the following Write will return err, the buffer isn't reused since
+				// the transport may still be reading it
+				c.uploadErr.Store(err)
+				_ = c.uploadReader.Close()
+				buffers <- nil
+				return
+			}
+			buffers <- buffer
+		}(buffer, n)
+	}
+}
+
+func (c *Conn) upload(u *url.URL, data []byte) error {
+	req, err := c.newRequest(http.MethodPost, u, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.roundTripper.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("splithttp: unexpected upload status %s", resp.Status)
+	}
+	return nil
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	n, err := c.downloadReader.Read(b)
+	if err == io.EOF && c.downloadErr != nil {
+		return n, c.downloadErr
+	}
+	return n, err
+}
+
+func (c *Conn) Write(b []byte) (int, error) {
+	n, err := c.uploadWriter.Write(b)
+	if errors.Is(err, io.ErrClosedPipe) {
+		if uploadErr := c.uploadErr.Load(); uploadErr != nil {
+			return n, uploadErr
+		}
+	}
+	return n, err
+}
+
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() {
+		_ = c.uploadWriter.Close()
+		_ = c.downloadReader.Close()
+		c.cancel()
+	})
+	return nil
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	return &net.TCPAddr{}
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	if addr := c.client.remoteAddr.Load(); addr != nil {
+		return addr
+	}
+	return &net.TCPAddr{}
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error  { return c.downloadReader.SetReadDeadline(t) }
+func (c *Conn) SetWriteDeadline(t time.Time) error { return c.uploadWriter.SetWriteDeadline(t) }
+
+func (c *Conn) SetDeadline(t time.Time) error {
+	_ = c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
@@ -0,0 +1,317 @@
+package splithttp
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/metacubex/mihomo/log"
+)
+
+// sessionTimeout closes the session which received uploads but no download request
+const sessionTimeout = 30 * time.Second
+
+type Handler struct {
+	cfg      *Config
+	path     string
+	handle   func(conn net.Conn)
+	sessions map[string]*session
+	mutex    sync.Mutex
+}
+
+// NewServerHandler returns a http.Handler which calls handle for every new session
+func NewServerHandler(cfg *Config, handle func(conn net.Conn)) *Handler {
+	return &Handler{
+		cfg:      cfg,
+		path:     cfg.NormalizedPath(),
+		handle:   handle,
+		sessions: map[string]*session{},
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, h.path) {
+		http.NotFound(w, r)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, h.path), "/")
+	if parts[0] == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 1:
+		h.serveDownload(w, r, parts[0])
+	case r.Method == http.MethodPost && len(parts) == 2:
+		seq, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			http.Error(w, "invalid seq", http.StatusBadRequest)
+			return
+		}
+		h.serveUpload(w, r, parts[0], seq)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) serveDownload(w http.ResponseWriter, r *http.Request, sessionID string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	s := h.getOrCreateSession(sessionID)
+	if !s.startDownload() {
+		http.Error(w, "duplicated download", http.StatusConflict)
+		return
+	}
+	defer h.removeSession(sessionID)
+
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	conn := &serverConn{
+		session: s,
+		writer:  w,
+		flusher: flusher,
+		local:   localAddr(r),
+		remote:  remoteAddr(r),
+	}
+	go h.handle(conn)
+
+	select {
+	case <-s.done:
+	case <-r.Context().Done():
+		conn.Close()
+	}
+
+	// wait for the in-flight Write, the ResponseWriter can't be used after return
+	conn.writeMutex.Lock()
+	conn.writeMutex.Unlock()
+}
+
+func (h *Handler) serveUpload(w http.ResponseWriter, r *http.Request, sessionID string, seq uint64) {
+	maxUploadSize := h.cfg.maxUploadSize()
+	if r.ContentLength > int64(maxUploadSize) {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, int64(maxUploadSize)+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(data) > maxUploadSize {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	s := h.getOrCreateSession(sessionID)
+	if err = s.push(seq, data); err != nil {
+		log.Debugln("[SplitHTTP] session %s upload error: %v", sessionID, err)
+		h.removeSession(sessionID)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) getOrCreateSession(sessionID string) *session {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if s, ok := h.sessions[sessionID]; ok {
+		return s
+	}
+	s := newSession()
+	s.expire = time.AfterFunc(sessionTimeout, func() {
+		log.Debugln("[SplitHTTP] session %s timeout without download", sessionID)
+		h.removeSession(sessionID)
+	})
+	h.sessions[sessionID] = s
+	return s
+}
+
+func (h *Handler) removeSession(sessionID string) {
+	h.mutex.Lock()
+	s, ok := h.sessions[sessionID]
+	delete(h.sessions, sessionID)
+	h.mutex.Unlock()
+	if ok {
+		s.close()
+	}
+}
+
+// session reorders the uploads by seq into a stream
+type session struct {
+	mutex       sync.Mutex
+	cond        *sync.Cond
+	packets     map[uint64][]byte
+	next        uint64
+	current     []byte
+	closed      bool
+	downloading bool
+	expire      *time.Timer
+	done        chan struct{}
+}
+
+func newSession() *session {
+	s := &session{
+		packets: map[uint64][]byte{},
+		done:    make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mutex)
+	return s
+}
+
+func (s *session) startDownload() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.downloading || s.closed {
+		return false
+	}
+	s.downloading = true
+	s.expire.Stop()
+	return true
+}
+
+// push adds the upload seq, only the out-of-order uploads are limited, an in-order one
+// waits until Read has drained the data before it, so a slow reader slows down the uploads
+func (s *session) push(seq uint64, data []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for !s.closed && s.inOrder(seq) && (seq > s.next || len(s.current) > 0) {
+		s.cond.Wait()
+	}
+	if s.closed {
+		return ErrClosed
+	}
+	if seq < s.next {
+		return nil // duplicated
+	}
+	if seq > s.next && s.outOfOrder() >= DefaultMaxBufferedPosts {
+		return ErrTooManyPosts
+	}
+	s.packets[seq] = data
+	s.cond.Broadcast()
+	return nil
+}
+
+// inOrder reports whether all the uploads before seq have been received
+func (s *session) inOrder(seq uint64) bool {
+	for i := s.next; i < seq; i++ {
+		if _, ok := s.packets[i]; !ok {
+			return false
+		}
+	}
+	return seq >= s.next
+}
+
+func (s *session) outOfOrder() int {
+	n := 0
+	for seq := range s.packets {
+		if seq > s.next {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *session) Read(b []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for len(s.current) == 0 {
+		if s.closed {
+			return 0, io.EOF
+		}
+		if data, ok := s.packets[s.next]; ok {
+			delete(s.packets, s.next)
+			s.next++
+			s.current = data
+			continue
+		}
+		s.cond.Wait()
+	}
+	n := copy(b, s.current)
+	s.current = s.current[n:]
+	if len(s.current) == 0 {
+		// wake up the push of the next upload
+		s.cond.Broadcast()
+	}
+	return n, nil
+}
+
+func (s *session) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.expire.Stop()
+	close(s.done)
+	s.cond.Broadcast()
+}
+
+type serverConn struct {
+	session    *session
+	writer     io.Writer
+	flusher    http.Flusher
+	writeMutex sync.Mutex
+	local      net.Addr
+	remote     net.Addr
+}
+
+func (c *serverConn) Read(b []byte) (int, error) {
+	return c.session.Read(b)
+}
+
+func (c *serverConn) Write(b []byte) (int, error) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	select {
+	case <-c.session.done:
+		return 0, ErrClosed
+	default:
+	}
+	n, err := c.writer.Write(b)
+	if err != nil {
+		return n, err
+	}
+	c.flusher.Flush()
+	return n, nil
+}
+
+func (c *serverConn) Close() error {
+	c.session.close()
+	return nil
+}
+
+func (c *serverConn) LocalAddr() net.Addr                { return c.local }
+func (c *serverConn) RemoteAddr() net.Addr               { return c.remote }
+func (c *serverConn) SetDeadline(t time.Time) error      { return nil }
+func (c *serverConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *serverConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func localAddr(r *http.Request) net.Addr {
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		return addr
+	}
+	return &net.TCPAddr{}
+}
+
+func remoteAddr(r *http.Request) net.Addr {
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		return addr
+	}
+	return &net.TCPAddr{}
+}
@@ -0,0 +1,59 @@
+// Package splithttp implements the XHTTP (formerly SplitHTTP) transport of Xray-core.
+//
+// Every connection is a session identified by a random uuid. The downlink is
+// a single streaming GET to {path}{session}, the uplink is a sequence of POST
+// requests to {path}{session}/{seq}, which the server reorders by seq.
+package splithttp
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	DefaultMaxUploadSize        = 1000000
+	DefaultMaxConcurrentUploads = 10
+	// DefaultMaxBufferedPosts limits the out-of-order POSTs the server keeps per session
+	DefaultMaxBufferedPosts = 30
+)
+
+var (
+	ErrClosed         = errors.New("splithttp: connection closed")
+	ErrTooManyPosts   = errors.New("splithttp: too many buffered posts")
+	ErrSingleConnHTTP = errors.New("splithttp: only HTTP/2 can run on a single connection")
+)
+
+type Config struct {
+	Host                 string
+	Path                 string
+	Headers              http.Header
+	MaxUploadSize        int
+	MaxConcurrentUploads int
+}
+
+// NormalizedPath returns the path with a leading and a trailing slash
+func (c *Config) NormalizedPath() string {
+	path := c.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if !strings.HasSuffix(path, "/") {
+		path = path + "/"
+	}
+	return path
+}
+
+func (c *Config) maxUploadSize() int {
+	if c.MaxUploadSize > 0 {
+		return c.MaxUploadSize
+	}
+	return DefaultMaxUploadSize
+}
+
+func (c *Config) maxConcurrentUploads() int {
+	if c.MaxConcurrentUploads > 0 {
+		return c.MaxConcurrentUploads
+	}
+	return DefaultMaxConcurrentUploads
+}
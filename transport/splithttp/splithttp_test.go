@@ -0,0 +1,166 @@
+package splithttp
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func echoHandler(cfg *Config) http.Handler {
+	return NewServerHandler(cfg, func(conn net.Conn) {
+		defer conn.Close()
+		_, _ = io.Copy(conn, conn)
+	})
+}
+
+func testEcho(t *testing.T, client *Client, cfg *Config) {
+	conn, err := StreamConn(client, cfg)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// bigger than the upload size, so it is split into several out-of-order posts
+	payload := strings.Repeat("splithttp", 4096)
+	go func() {
+		for i := 0; i < len(payload); i += 1000 {
+			end := i + 1000
+			if end > len(payload) {
+				end = len(payload)
+			}
+			_, _ = conn.Write([]byte(payload[i:end]))
+		}
+	}()
+
+	buf := make([]byte, len(payload))
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, payload, string(buf))
+}
+
+func TestSplitHTTP_HTTP1(t *testing.T) {
+	cfg := &Config{Path: "/xhttp", MaxUploadSize: 4096, MaxConcurrentUploads: 4}
+	server := httptest.NewServer(echoHandler(cfg))
+	defer server.Close()
+
+	client := NewHTTP1Client(func(ctx context.Context) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "tcp", server.Listener.Addr().String())
+	})
+	defer client.Close()
+
+	testEcho(t, client, &Config{Host: "example.com", Path: "xhttp", MaxUploadSize: 4096, MaxConcurrentUploads: 4})
+}
+
+func TestSplitHTTP_HTTP2(t *testing.T) {
+	cfg := &Config{Path: "/xhttp/"}
+	server := httptest.NewUnstartedServer(echoHandler(cfg))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	client := NewHTTP2Client(func(ctx context.Context) (net.Conn, error) {
+		return (&tls.Dialer{Config: &tls.Config{
+			InsecureSkipVerify: true,
+			NextProtos:         []string{"h2"},
+		}}).DialContext(ctx, "tcp", server.Listener.Addr().String())
+	})
+	defer client.Close()
+
+	for i := 0; i < 3; i++ {
+		testEcho(t, client, &Config{Host: "example.com", Path: "/xhttp/", MaxUploadSize: 4096})
+	}
+}
+
+func TestSplitHTTP_BadRequest(t *testing.T) {
+	server := httptest.NewServer(echoHandler(&Config{Path: "/xhttp"}))
+	defer server.Close()
+
+	for _, path := range []string{"/other/session", "/xhttp/", "/xhttp/session/seq"} {
+		resp, err := http.Post(server.URL+path, "", strings.NewReader("data"))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.NotEqual(t, http.StatusOK, resp.StatusCode, path)
+	}
+}
+
+func TestSplitHTTP_Deadline(t *testing.T) {
+	cfg := &Config{Path: "/xhttp"}
+	server := httptest.NewServer(echoHandler(cfg))
+	defer server.Close()
+
+	client := NewHTTP1Client(func(ctx context.Context) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "tcp", server.Listener.Addr().String())
+	})
+	defer client.Close()
+
+	conn, err := StreamConn(client, &Config{Host: "example.com", Path: "/xhttp"})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = conn.SetReadDeadline(time.Now().Add(time.Hour))
+			_ = conn.SetWriteDeadline(time.Time{})
+		}()
+	}
+	wg.Wait()
+
+	require.NoError(t, conn.SetDeadline(time.Now().Add(10*time.Millisecond)))
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	// the deadline doesn't close the connection
+	require.NoError(t, conn.SetDeadline(time.Time{}))
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+}
+
+func TestSessionBackpressure(t *testing.T) {
+	s := newSession()
+	s.expire = time.NewTimer(time.Hour)
+	defer s.close()
+
+	// the in-order uploads wait for the slow reader instead of failing the session
+	pushed := make(chan error, 1)
+	go func() {
+		for seq := uint64(0); seq < DefaultMaxBufferedPosts*2; seq++ {
+			if err := s.push(seq, []byte{byte(seq)}); err != nil {
+				pushed <- err
+				return
+			}
+		}
+		pushed <- nil
+	}()
+	buf := make([]byte, 1)
+	for seq := 0; seq < DefaultMaxBufferedPosts*2; seq++ {
+		time.Sleep(time.Millisecond)
+		_, err := s.Read(buf)
+		require.NoError(t, err)
+		assert.Equal(t, byte(seq), buf[0])
+	}
+	assert.NoError(t, <-pushed)
+
+	// the out-of-order ones are still limited
+	next := uint64(DefaultMaxBufferedPosts * 2)
+	for i := uint64(1); i <= DefaultMaxBufferedPosts; i++ {
+		require.NoError(t, s.push(next+i, []byte{0}))
+	}
+	assert.ErrorIs(t, s.push(next+DefaultMaxBufferedPosts+1, []byte{0}), ErrTooManyPosts)
+	assert.NoError(t, s.push(next, []byte{0}))
+}
@@ -15,6 +15,7 @@ import (
 	N "github.com/metacubex/mihomo/common/net"
 	"github.com/metacubex/mihomo/common/pool"
 	"github.com/metacubex/mihomo/component/ca"
+	"github.com/metacubex/mihomo/component/ech"
 	tlsC "github.com/metacubex/mihomo/component/tls"
 	C "github.com/metacubex/mihomo/constant"
 	"github.com/metacubex/mihomo/transport/socks5"
@@ -51,7 +52,9 @@ type Option struct {
 	SkipCertVerify    bool
 	Fingerprint       string
 	ClientFingerprint string
+	Certificates      []tls.Certificate
 	Reality           *tlsC.RealityConfig
+	ECH               *ech.Config
 }
 
 type WebsocketOption struct {
@@ -78,6 +81,7 @@ func (t *Trojan) StreamConn(ctx context.Context, conn net.Conn) (net.Conn, error
 		MinVersion:         tls.VersionTLS12,
 		InsecureSkipVerify: t.option.SkipCertVerify,
 		ServerName:         t.option.ServerName,
+		Certificates:       t.option.Certificates,
 	}
 
 	var err error
@@ -86,6 +90,15 @@ func (t *Trojan) StreamConn(ctx context.Context, conn net.Conn) (net.Conn, error
 		return nil, err
 	}
 
+	if t.option.ECH != nil {
+		if t.option.Reality != nil {
+			return nil, errors.New("REALITY can't be used with ECH")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), C.DefaultTLSTimeout)
+		defer cancel()
+		return t.option.ECH.ClientHandshake(ctx, conn, tlsConfig)
+	}
+
 	if len(t.option.ClientFingerprint) != 0 {
 		if t.option.Reality == nil {
 			utlsConn, valid := vmess.GetUTLSConn(conn, t.option.ClientFingerprint, tlsConfig)
@@ -127,6 +140,7 @@ func (t *Trojan) StreamWebsocketConn(ctx context.Context, conn net.Conn, wsOptio
 		MinVersion:         tls.VersionTLS12,
 		InsecureSkipVerify: t.option.SkipCertVerify,
 		ServerName:         t.option.ServerName,
+		Certificates:       t.option.Certificates,
 	}
 
 	return vmess.StreamWebsocketConn(ctx, conn, &vmess.WebsocketConfig{
@@ -139,6 +153,7 @@ func (t *Trojan) StreamWebsocketConn(ctx context.Context, conn net.Conn, wsOptio
 		TLS:                      true,
 		TLSConfig:                tlsConfig,
 		ClientFingerprint:        t.option.ClientFingerprint,
+		ECHConfig:                t.option.ECH,
 	})
 }
 
@@ -1,11 +1,10 @@
 package common
 
 import (
-	"github.com/metacubex/mihomo/transport/tuic/congestion"
-	congestionv2 "github.com/metacubex/mihomo/transport/tuic/congestion_v2"
+	"github.com/metacubex/mihomo/log"
+	"github.com/metacubex/mihomo/transport/congestion"
 
 	"github.com/metacubex/quic-go"
-	c "github.com/metacubex/quic-go/congestion"
 )
 
 const (
@@ -14,44 +13,12 @@ const (
 )
 
 func SetCongestionController(quicConn quic.Connection, cc string, cwnd int) {
-	if cwnd == 0 {
-		cwnd = 32
-	}
-	switch cc {
-	case "cubic":
-		quicConn.SetCongestionControl(
-			congestion.NewCubicSender(
-				congestion.DefaultClock{},
-				congestion.GetInitialPacketSize(quicConn.RemoteAddr()),
-				false,
-			),
-		)
-	case "new_reno":
-		quicConn.SetCongestionControl(
-			congestion.NewCubicSender(
-				congestion.DefaultClock{},
-				congestion.GetInitialPacketSize(quicConn.RemoteAddr()),
-				true,
-			),
-		)
-	case "bbr_meta_v1":
-		quicConn.SetCongestionControl(
-			congestion.NewBBRSender(
-				congestion.DefaultClock{},
-				congestion.GetInitialPacketSize(quicConn.RemoteAddr()),
-				c.ByteCount(cwnd)*congestion.InitialMaxDatagramSize,
-				congestion.DefaultBBRMaxCongestionWindow*congestion.InitialMaxDatagramSize,
-			),
-		)
-	case "bbr_meta_v2":
-		fallthrough
-	case "bbr":
-		quicConn.SetCongestionControl(
-			congestionv2.NewBbrSender(
-				congestionv2.DefaultClock{},
-				congestionv2.GetInitialPacketSize(quicConn.RemoteAddr()),
-				c.ByteCount(cwnd),
-			),
-		)
+	SetCongestionControllerWithOptions(quicConn, cc, congestion.Options{CWND: cwnd})
+}
+
+// SetCongestionControllerWithOptions sets the congestion controller from the shared registry
+func SetCongestionControllerWithOptions(quicConn quic.Connection, cc string, options congestion.Options) {
+	if err := congestion.Set(quicConn, cc, options); err != nil {
+		log.Warnln("[QUIC] %s set congestion controller failed: %s", quicConn.RemoteAddr(), err)
 	}
 }
@@ -15,8 +15,10 @@ import (
 	atomic2 "github.com/metacubex/mihomo/common/atomic"
 	N "github.com/metacubex/mihomo/common/net"
 	"github.com/metacubex/mihomo/common/pool"
+	"github.com/metacubex/mihomo/component/ech"
 	C "github.com/metacubex/mihomo/constant"
 	"github.com/metacubex/mihomo/log"
+	"github.com/metacubex/mihomo/transport/congestion"
 	"github.com/metacubex/mihomo/transport/tuic/common"
 
 	"github.com/metacubex/quic-go"
@@ -26,6 +28,7 @@ import (
 
 type ClientOption struct {
 	TlsConfig             *tls.Config
+	EchConfig             *ech.Config
 	QuicConfig            *quic.Config
 	Token                 [32]byte
 	UdpRelayMode          common.UdpRelayMode
@@ -36,6 +39,8 @@ type ClientOption struct {
 	FastOpen              bool
 	MaxOpenStreams        int64
 	CWND                  int
+	BrutalRate            uint64 // sending rate of the brutal congestion controller
+	Tag                   string // the outbound name shown in the congestion stats
 }
 
 type clientImpl struct {
@@ -81,17 +86,31 @@ func (t *clientImpl) getQuicConn(ctx context.Context, dialer C.Dialer, dialFn co
 	if err != nil {
 		return nil, err
 	}
+	tlsConfig := t.TlsConfig
+	if t.EchConfig != nil {
+		tlsConfig = tlsConfig.Clone()
+		if err = t.EchConfig.ClientHandle(ctx, tlsConfig); err != nil {
+			return nil, err
+		}
+	}
 	var quicConn quic.Connection
 	if t.ReduceRtt {
-		quicConn, err = transport.DialEarly(ctx, addr, t.TlsConfig, t.QuicConfig)
+		quicConn, err = transport.DialEarly(ctx, addr, tlsConfig, t.QuicConfig)
 	} else {
-		quicConn, err = transport.Dial(ctx, addr, t.TlsConfig, t.QuicConfig)
+		quicConn, err = transport.Dial(ctx, addr, tlsConfig, t.QuicConfig)
 	}
 	if err != nil {
+		if t.EchConfig != nil {
+			t.EchConfig.HandleError(err)
+		}
 		return nil, err
 	}
 
-	common.SetCongestionController(quicConn, t.CongestionController, t.CWND)
+	common.SetCongestionControllerWithOptions(quicConn, t.CongestionController, congestion.Options{
+		CWND:       t.CWND,
+		BrutalRate: t.BrutalRate,
+		Tag:        t.Tag,
+	})
 
 	go func() {
 		_ = t.sendAuthentication(quicConn)
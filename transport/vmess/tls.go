@@ -7,6 +7,7 @@ import (
 	"net"
 
 	"github.com/metacubex/mihomo/component/ca"
+	"github.com/metacubex/mihomo/component/ech"
 	tlsC "github.com/metacubex/mihomo/component/tls"
 )
 
@@ -16,7 +17,9 @@ type TLSConfig struct {
 	FingerPrint       string
 	ClientFingerprint string
 	NextProtos        []string
+	Certificates      []tls.Certificate
 	Reality           *tlsC.RealityConfig
+	ECH               *ech.Config
 }
 
 func StreamTLSConn(ctx context.Context, conn net.Conn, cfg *TLSConfig) (net.Conn, error) {
@@ -24,6 +27,7 @@ func StreamTLSConn(ctx context.Context, conn net.Conn, cfg *TLSConfig) (net.Conn
 		ServerName:         cfg.Host,
 		InsecureSkipVerify: cfg.SkipCertVerify,
 		NextProtos:         cfg.NextProtos,
+		Certificates:       cfg.Certificates,
 	}
 
 	var err error
@@ -32,6 +36,13 @@ func StreamTLSConn(ctx context.Context, conn net.Conn, cfg *TLSConfig) (net.Conn
 		return nil, err
 	}
 
+	if cfg.ECH != nil {
+		if cfg.Reality != nil {
+			return nil, errors.New("REALITY can't be used with ECH")
+		}
+		return cfg.ECH.ClientHandshake(ctx, conn, tlsConfig)
+	}
+
 	if len(cfg.ClientFingerprint) != 0 {
 		if cfg.Reality == nil {
 			utlsConn, valid := GetUTLSConn(conn, cfg.ClientFingerprint, tlsConfig)
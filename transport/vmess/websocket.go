@@ -20,6 +20,7 @@ import (
 
 	"github.com/metacubex/mihomo/common/buf"
 	N "github.com/metacubex/mihomo/common/net"
+	"github.com/metacubex/mihomo/component/ech"
 	tlsC "github.com/metacubex/mihomo/component/tls"
 	"github.com/metacubex/mihomo/log"
 
@@ -58,6 +59,7 @@ type WebsocketConfig struct {
 	MaxEarlyData             int
 	EarlyDataHeaderName      string
 	ClientFingerprint        string
+	ECHConfig                *ech.Config
 	V2rayHttpUpgrade         bool
 	V2rayHttpUpgradeFastOpen bool
 }
@@ -353,7 +355,11 @@ func streamWebsocketConn(ctx context.Context, conn net.Conn, c *WebsocketConfig,
 			config.ServerName = uri.Host
 		}
 
-		if len(c.ClientFingerprint) != 0 {
+		if c.ECHConfig != nil {
+			if conn, err = c.ECHConfig.ClientHandshake(ctx, conn, config); err != nil {
+				return nil, err
+			}
+		} else if len(c.ClientFingerprint) != 0 {
 			if fingerprint, exists := tlsC.GetFingerprint(c.ClientFingerprint); exists {
 				utlsConn := tlsC.UClient(conn, config, fingerprint)
 				if err = utlsConn.BuildWebsocketHandshakeState(); err != nil {
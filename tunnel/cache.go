@@ -0,0 +1,154 @@
+package tunnel
+
+import (
+	"net/netip"
+	"sync/atomic"
+
+	atomic2 "github.com/metacubex/mihomo/common/atomic"
+	"github.com/metacubex/mihomo/common/lru"
+	C "github.com/metacubex/mihomo/constant"
+)
+
+var (
+	ruleCacheSize   atomic.Int64
+	ruleCache       = atomic2.NewTypedValue[*lru.LruCache[ruleCacheKey, *ruleCacheEntry]](nil)
+	ruleCacheHits   atomic.Uint64
+	ruleCacheMisses atomic.Uint64
+	ruleCacheBypass atomic.Uint64
+)
+
+// ruleCacheKey is the attributes of a flow the non-volatile rules depend on
+type ruleCacheKey struct {
+	specialRules string
+	network      C.NetWork
+	tp           C.Type
+	inName       string
+	inUser       string
+	inPort       uint16
+	dscp         uint8
+	srcIP        netip.Addr
+	host         string
+	sniffHost    string
+	sniffProto   string
+	dstIP        netip.Addr
+	dstPort      uint16
+	uid          uint32
+	process      string
+	processPath  string
+}
+
+func newRuleCacheKey(metadata *C.Metadata) ruleCacheKey {
+	return ruleCacheKey{
+		specialRules: metadata.SpecialRules,
+		network:      metadata.NetWork,
+		tp:           metadata.Type,
+		inName:       metadata.InName,
+		inUser:       metadata.InUser,
+		inPort:       metadata.InPort,
+		dscp:         metadata.DSCP,
+		srcIP:        metadata.SrcIP,
+		host:         metadata.Host,
+		sniffHost:    metadata.SniffHost,
+		sniffProto:   metadata.SniffProtocol,
+		dstIP:        metadata.DstIP,
+		dstPort:      metadata.DstPort,
+		uid:          metadata.Uid,
+		process:      metadata.Process,
+		processPath:  metadata.ProcessPath,
+	}
+}
+
+type ruleCacheEntry struct {
+	rule    int      // the index of the matched rule, -1 if no rule matches
+	adapter string   // the adapter returned by the matched rule
+	skipped []string // the adapters of the earlier matched rules skipped by PASS or UDP
+	version uint64   // the version of the rule providers
+}
+
+// RuleCacheStats is the statistics of the match-result cache since started
+type RuleCacheStats struct {
+	Size     int     `json:"size"`
+	Hits     uint64  `json:"hits"`
+	Misses   uint64  `json:"misses"`
+	Bypass   uint64  `json:"bypass"`
+	HitRatio float64 `json:"hitRatio"`
+}
+
+// SetRuleCacheSize sets the max entries of the match-result cache, 0 disables it
+func SetRuleCacheSize(size int) {
+	ruleCacheSize.Store(int64(size))
+	resetRuleCache()
+}
+
+// RuleCache returns the statistics of the match-result cache
+func RuleCache() RuleCacheStats {
+	stats := RuleCacheStats{
+		Size:   int(ruleCacheSize.Load()),
+		Hits:   ruleCacheHits.Load(),
+		Misses: ruleCacheMisses.Load(),
+		Bypass: ruleCacheBypass.Load(),
+	}
+	if total := stats.Hits + stats.Misses + stats.Bypass; total > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+// resetRuleCache drops the cached results, the rules and the proxies are replaced
+// with it under configMux so no match sees the new config with the old results
+func resetRuleCache() {
+	size := int(ruleCacheSize.Load())
+	if size <= 0 {
+		ruleCache.Store(nil)
+		return
+	}
+	ruleCache.Store(lru.New[ruleCacheKey, *ruleCacheEntry](lru.WithSize[ruleCacheKey, *ruleCacheEntry](size)))
+}
+
+// cachedMatch returns the cached result if it is still valid, the proxy groups may have
+// switched to the proxies of PASS or without UDP since cached, so these are checked again.
+// The results which needed a DNS resolution or a process lookup during the match aren't
+// cached, so a hit leaves metadata as the match would have.
+func cachedMatch(cache *lru.LruCache[ruleCacheKey, *ruleCacheEntry], key ruleCacheKey, version uint64, rules []C.Rule, metadata *C.Metadata) (C.Proxy, C.Rule, bool) {
+	entry, ok := cache.Get(key)
+	if !ok || entry.version != version || entry.rule >= len(rules) {
+		return nil, nil, false
+	}
+	for _, name := range entry.skipped {
+		if adapter, ok := proxies[name]; ok && acceptProxy(adapter, metadata) {
+			return nil, nil, false
+		}
+	}
+	if entry.rule < 0 {
+		return proxies["DIRECT"], nil, true
+	}
+	adapter, ok := proxies[entry.adapter]
+	if !ok || !acceptProxy(adapter, metadata) {
+		return nil, nil, false
+	}
+	return adapter, rules[entry.rule], true
+}
+
+// cacheable reports whether the result of the evaluated rules only depends on the cache key,
+// the process is not a part of the key if it is looked up on demand, and neither are the
+// IPs resolved for the rules, whose answers may change with their TTL
+func cacheable(evaluated []C.Rule, lazyProcess bool, resolvedByRules bool) bool {
+	if resolvedByRules {
+		return false
+	}
+	for _, rule := range evaluated {
+		if rule.IsVolatile() || (lazyProcess && rule.ShouldFindProcess()) {
+			return false
+		}
+	}
+	return true
+}
+
+func storeMatch(cache *lru.LruCache[ruleCacheKey, *ruleCacheEntry], key ruleCacheKey, entry *ruleCacheEntry, evaluated []C.Rule, lazyProcess bool, resolvedByRules bool) {
+	if !cacheable(evaluated, lazyProcess, resolvedByRules) {
+		ruleCacheBypass.Add(1)
+		return
+	}
+	ruleCacheMisses.Add(1)
+	cache.Set(key, entry)
+}
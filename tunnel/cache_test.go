@@ -0,0 +1,27 @@
+package tunnel
+
+import (
+	"net/netip"
+	"testing"
+
+	C "github.com/metacubex/mihomo/constant"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuleCacheKeySniffProtocol(t *testing.T) {
+	quic := &C.Metadata{
+		NetWork:       C.UDP,
+		Type:          C.TUN,
+		SrcIP:         netip.MustParseAddr("192.168.1.2"),
+		DstIP:         netip.MustParseAddr("203.0.113.1"),
+		DstPort:       443,
+		SniffProtocol: "quic",
+	}
+	plain := *quic
+	plain.SniffProtocol = ""
+
+	// EXPR,protocol == "quic" must not get the cached result of the other flow
+	assert.NotEqual(t, newRuleCacheKey(quic), newRuleCacheKey(&plain))
+	assert.Equal(t, newRuleCacheKey(quic), newRuleCacheKey(quic))
+}
@@ -7,40 +7,50 @@ import (
 	"time"
 
 	N "github.com/metacubex/mihomo/common/net"
+	"github.com/metacubex/mihomo/component/nat"
 	C "github.com/metacubex/mihomo/constant"
 	"github.com/metacubex/mihomo/log"
 )
 
-func handleUDPToRemote(packet C.UDPPacket, pc C.PacketConn, metadata *C.Metadata) error {
+func handleUDPToRemote(packet C.UDPPacket, entry *nat.Entry, metadata *C.Metadata) error {
 	addr := metadata.UDPAddr()
 	if addr == nil {
 		return errors.New("udp addr invalid")
 	}
 
+	pc := entry.PacketConn
 	if _, err := pc.WriteTo(packet.Data(), addr); err != nil {
 		return err
 	}
+	entry.Touch()
+	if entry.Capture != nil {
+		entry.Capture.WriteUDP(true, metadata.AddrPort(), packet.Data())
+	}
 	// reset timeout
-	_ = pc.SetReadDeadline(time.Now().Add(udpTimeout))
+	_ = pc.SetReadDeadline(time.Now().Add(entry.Timeout))
 
 	return nil
 }
 
-func handleUDPToLocal(writeBack C.WriteBack, pc N.EnhancePacketConn, key string, oAddrPort netip.AddrPort, fAddr netip.Addr) {
+func handleUDPToLocal(writeBack C.WriteBack, entry *nat.Entry, key string, oAddrPort netip.AddrPort, fAddr netip.Addr) {
+	pc := entry.PacketConn
 	defer func() {
 		_ = pc.Close()
-		closeAllLocalCoon(key)
-		natTable.Delete(key)
+		natTable.DeleteEntry(key, entry)
 	}()
 
 	for {
-		_ = pc.SetReadDeadline(time.Now().Add(udpTimeout))
+		_ = pc.SetReadDeadline(time.Now().Add(entry.Timeout))
 		data, put, from, err := pc.WaitReadFrom()
 		if err != nil {
 			return
 		}
+		entry.Touch()
 
 		fromUDPAddr, isUDPAddr := from.(*net.UDPAddr)
+		if entry.Capture != nil && isUDPAddr && fromUDPAddr != nil {
+			entry.Capture.WriteUDP(false, fromUDPAddr.AddrPort(), data)
+		}
 		if !isUDPAddr {
 			fromUDPAddr = net.UDPAddrFromAddrPort(oAddrPort) // oAddrPort was Unmapped
 			log.Warnln("server return a [%T](%s) which isn't a *net.UDPAddr, force replace to (%s), this may be caused by a wrongly implemented server", from, from, oAddrPort)
@@ -72,16 +82,6 @@ func handleUDPToLocal(writeBack C.WriteBack, pc N.EnhancePacketConn, key string,
 	}
 }
 
-func closeAllLocalCoon(lAddr string) {
-	natTable.RangeForLocalConn(lAddr, func(key string, value *net.UDPConn) bool {
-		conn := value
-
-		conn.Close()
-		log.Debugln("Closing TProxy local conn... lAddr=%s rAddr=%s", lAddr, key)
-		return true
-	})
-}
-
 func handleSocket(inbound, outbound net.Conn) {
 	N.Relay(inbound, outbound)
 }
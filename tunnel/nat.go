@@ -0,0 +1,59 @@
+package tunnel
+
+import (
+	"sort"
+	"time"
+
+	"github.com/metacubex/mihomo/component/nat"
+	"github.com/metacubex/mihomo/tunnel/statistic"
+)
+
+// UDPSession is an entry of the udp NAT table, the id is the same as the one in the connections
+type UDPSession struct {
+	*statistic.TrackerInfo
+	Key     string `json:"key"`
+	Source  string `json:"source"`
+	Mapping string `json:"mapping"`
+	Idle    int64  `json:"idle"`    // milliseconds
+	Timeout int64  `json:"timeout"` // milliseconds
+}
+
+// UDPSessions returns the udp sessions in the NAT table by the start time
+func UDPSessions() []UDPSession {
+	sessions := make([]UDPSession, 0)
+	natTable.Range(func(key string, e *nat.Entry) bool {
+		tracker, ok := e.PacketConn.(statistic.Tracker)
+		if !ok {
+			return true
+		}
+		sessions = append(sessions, UDPSession{
+			TrackerInfo: tracker.Info(),
+			Key:         key,
+			Source:      e.LocalAddr,
+			Mapping:     e.Mapping.String(),
+			Idle:        e.Idle().Milliseconds(),
+			Timeout:     e.Timeout.Milliseconds(),
+		})
+		return true
+	})
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Start.Before(sessions[j].Start)
+	})
+	return sessions
+}
+
+// CloseUDPSessions closes the udp sessions matching id, an empty id closes all of them,
+// it returns the number of the closed sessions
+func CloseUDPSessions(id string) (n int) {
+	natTable.Range(func(key string, e *nat.Entry) bool {
+		tracker, ok := e.PacketConn.(statistic.Tracker)
+		if ok && (id == "" || tracker.ID() == id) {
+			// handleUDPToLocal removes the entry after the read is interrupted
+			_ = e.PacketConn.SetReadDeadline(time.Now())
+			_ = tracker.Close()
+			n++
+		}
+		return true
+	})
+	return
+}
@@ -4,15 +4,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/netip"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
+	"github.com/metacubex/mihomo/common/atomic"
 	N "github.com/metacubex/mihomo/common/net"
+	"github.com/metacubex/mihomo/component/capture"
+	"github.com/metacubex/mihomo/component/dialer"
 	"github.com/metacubex/mihomo/component/loopback"
+	"github.com/metacubex/mihomo/component/mitm"
 	"github.com/metacubex/mihomo/component/nat"
 	P "github.com/metacubex/mihomo/component/process"
 	"github.com/metacubex/mihomo/component/resolver"
@@ -23,6 +30,8 @@ import (
 	"github.com/metacubex/mihomo/constant/provider"
 	icontext "github.com/metacubex/mihomo/context"
 	"github.com/metacubex/mihomo/log"
+	"github.com/metacubex/mihomo/rules/index"
+	RP "github.com/metacubex/mihomo/rules/provider"
 	"github.com/metacubex/mihomo/tunnel/statistic"
 )
 
@@ -32,6 +41,8 @@ var (
 	udpQueue       = make(chan C.PacketAdapter, 200)
 	natTable       = nat.New()
 	rules          []C.Rule
+	ruleIndex      = index.New(nil)
+	subRuleIndexes map[string]*index.Index
 	listeners      = make(map[string]C.InboundListener)
 	subRules       map[string][]C.Rule
 	proxies        = make(map[string]C.Proxy)
@@ -39,6 +50,7 @@ var (
 	ruleProviders  map[string]provider.RuleProvider
 	sniffingEnable = false
 	configMux      sync.RWMutex
+	parseHTTP      = atomic.NewTypedValue(parseHTTPState{})
 
 	// Outbound Rule
 	mode = Rule
@@ -72,6 +84,40 @@ func (t tunnel) NatTable() C.NatTable {
 	return natTable
 }
 
+func (t tunnel) ShouldParseHTTP() bool {
+	if mode != Rule {
+		return false
+	}
+	state := parseHTTP.Load()
+	if state.version != RP.Version() {
+		// a rule provider was updated, stored under configMux not to overwrite the
+		// state of newer rules
+		configMux.RLock()
+		state = newParseHTTPState(rules)
+		parseHTTP.Store(state)
+		configMux.RUnlock()
+	}
+	return state.parse
+}
+
+// parseHTTPState is whether any rule matches on the HTTP requests, for the rules
+// with the rule providers at version
+type parseHTTPState struct {
+	version uint64
+	parse   bool
+}
+
+func newParseHTTPState(rules []C.Rule) parseHTTPState {
+	state := parseHTTPState{version: RP.Version()}
+	for _, rule := range rules {
+		if rule.ShouldParseHTTP() {
+			state.parse = true
+			break
+		}
+	}
+	return state
+}
+
 func OnSuspend() {
 	status.Store(Suspend)
 }
@@ -140,10 +186,19 @@ func Listeners() map[string]C.InboundListener {
 
 // UpdateRules handle update rules
 func UpdateRules(newRules []C.Rule, newSubRule map[string][]C.Rule, rp map[string]provider.RuleProvider) {
+	newIndex := index.New(newRules)
+	newSubRuleIndexes := make(map[string]*index.Index, len(newSubRule))
+	for name, sr := range newSubRule {
+		newSubRuleIndexes[name] = index.New(sr)
+	}
 	configMux.Lock()
 	rules = newRules
+	ruleIndex = newIndex
 	ruleProviders = rp
 	subRules = newSubRule
+	subRuleIndexes = newSubRuleIndexes
+	parseHTTP.Store(newParseHTTPState(newRules))
+	resetRuleCache()
 	configMux.Unlock()
 }
 
@@ -181,6 +236,7 @@ func UpdateProxies(newProxies map[string]C.Proxy, newProviders map[string]provid
 	configMux.Lock()
 	proxies = newProxies
 	providers = newProviders
+	resetRuleCache()
 	configMux.Unlock()
 }
 
@@ -211,6 +267,7 @@ func SetMode(m TunnelMode) {
 // always find process info if legacyAlways = true or mode.Always() = true, may be increase many memory
 func SetFindProcessMode(mode P.FindProcessMode) {
 	findProcessMode = mode
+	resetRuleCache()
 }
 
 func isHandle(t C.Type) bool {
@@ -278,6 +335,15 @@ func preHandleMetadata(metadata *C.Metadata) error {
 	return nil
 }
 
+// Simulate returns the proxy and the rule a connection of metadata would use without
+// making the connection, the DNS lookups of the rules still go through the resolver
+func Simulate(metadata *C.Metadata) (C.Proxy, C.Rule, error) {
+	if err := preHandleMetadata(metadata); err != nil {
+		return nil, nil, err
+	}
+	return resolveMetadata(metadata)
+}
+
 func resolveMetadata(metadata *C.Metadata) (proxy C.Proxy, rule C.Rule, err error) {
 	if metadata.SpecialProxy != "" {
 		var exist bool
@@ -338,15 +404,24 @@ func handleUDPConn(packet C.PacketAdapter) {
 		metadata.DstIP = ip
 	}
 
-	key := packet.LocalAddr().String()
+	lAddr := packet.LocalAddr().String()
+	dst := metadata.DstIP.Unmap().String()
+	// the key of the address-dependent session, the endpoint-independent one is keyed by lAddr
+	adKey := lAddr + "|" + dst
 
+	// handle writes the packet to the session of the destination, the endpoint-independent
+	// session only takes the destinations whose rules allow it
 	handle := func() bool {
-		pc, proxy := natTable.Get(key)
-		if pc != nil {
-			if proxy != nil {
-				proxy.UpdateWriteBack(packet)
+		entry, ok := natTable.Load(adKey)
+		if !ok {
+			entry, ok = natTable.Load(lAddr)
+			ok = ok && entry.Allows(dst)
+		}
+		if ok {
+			if entry.WriteBackProxy != nil {
+				entry.WriteBackProxy.UpdateWriteBack(packet)
 			}
-			_ = handleUDPToRemote(packet, pc, metadata)
+			_ = handleUDPToRemote(packet, entry, metadata)
 			return true
 		}
 		return false
@@ -357,7 +432,9 @@ func handleUDPConn(packet C.PacketAdapter) {
 		return
 	}
 
-	cond, loaded := natTable.GetOrCreateLock(key)
+	// the rule of the destination is matched under the lock of adKey, the endpoint-independent
+	// session is then created under the lock of lAddr
+	cond, loaded := natTable.GetOrCreateLock(adKey)
 
 	go func() {
 		defer packet.Drop()
@@ -371,7 +448,7 @@ func handleUDPConn(packet C.PacketAdapter) {
 		}
 
 		defer func() {
-			natTable.DeleteLock(key)
+			natTable.DeleteLock(adKey)
 			cond.Broadcast()
 		}()
 
@@ -381,11 +458,57 @@ func handleUDPConn(packet C.PacketAdapter) {
 			return
 		}
 
+		key, mapping, timeout := lAddr, C.EndpointIndependent, udpTimeout
+		if rule != nil && rule.Options() != nil {
+			if rule.Options().UDPTimeout != 0 {
+				timeout = rule.Options().UDPTimeout
+			}
+			if rule.Options().UDPMapping == C.AddressDependent {
+				key, mapping = adKey, C.AddressDependent
+			}
+		}
+
+		route, last := routeOf(proxy, metadata)
+		if mapping == C.EndpointIndependent {
+			entry, ok := natTable.Load(lAddr)
+			if !ok {
+				eiCond, loaded := natTable.GetOrCreateLock(lAddr)
+				if loaded {
+					eiCond.L.Lock()
+					eiCond.Wait()
+					eiCond.L.Unlock()
+					if entry, ok = natTable.Load(lAddr); !ok {
+						return
+					}
+				} else {
+					defer func() {
+						natTable.DeleteLock(lAddr)
+						eiCond.Broadcast()
+					}()
+				}
+			}
+			if ok {
+				// reuse the session created for another destination of the client only if the
+				// destination goes the same way, otherwise it gets a session of its own
+				if entry.Route == route && entry.Timeout == timeout {
+					entry.Allow(dst)
+					handle()
+					return
+				}
+				if last.Type() == C.Reject || last.Type() == C.RejectDrop {
+					return
+				}
+				key, mapping = adKey, C.AddressDependent
+			}
+		}
+
 		ctx, cancel := context.WithTimeout(context.Background(), C.DefaultUDPTimeout)
 		defer cancel()
-		rawPc, err := retry(ctx, func(ctx context.Context) (C.PacketConn, error) {
+		ctx = withDialerContext(ctx, metadata, rule)
+		listenPacket := func(ctx context.Context) (C.PacketConn, error) {
 			return proxy.ListenPacketContext(ctx, metadata.Pure())
-		}, func(err error) {
+		}
+		onError := func(err error) {
 			if rule == nil {
 				log.Warnln(
 					"[UDP] dial %s %s --> %s error: %s",
@@ -397,9 +520,22 @@ func handleUDPConn(packet C.PacketAdapter) {
 			} else {
 				log.Warnln("[UDP] dial %s (match %s/%s) %s --> %s error: %s", proxy.Name(), rule.RuleType().String(), rule.Payload(), metadata.SourceDetail(), metadata.RemoteAddress(), err.Error())
 			}
-		})
+		}
+		rawPc, err := retry(ctx, retryPolicy(rule), listenPacket, onError)
 		if err != nil {
-			return
+			fallback := fallbackProxy(rule, proxy, metadata, err)
+			if fallback == nil {
+				return
+			}
+			log.Warnln("[UDP] %s --> %s fallback from %s to %s", metadata.SourceDetail(), metadata.RemoteAddress(), proxy.Name(), fallback.Name())
+			proxy = fallback
+			ctx, cancel := context.WithTimeout(context.Background(), C.DefaultUDPTimeout)
+			defer cancel()
+			ctx = withDialerContext(ctx, metadata, rule)
+			rawPc, err = retry(ctx, retryPolicy(rule), listenPacket, onError)
+			if err != nil {
+				return
+			}
 		}
 
 		pc := statistic.NewUDPTracker(rawPc, statistic.DefaultManager, metadata, rule, 0, 0, true)
@@ -427,9 +563,20 @@ func handleUDPConn(packet C.PacketAdapter) {
 
 		oAddrPort := metadata.AddrPort()
 		writeBackProxy := nat.NewWriteBackProxy(packet)
-		natTable.Set(key, pc, writeBackProxy)
+		entry := nat.NewEntry(lAddr, pc, writeBackProxy, timeout)
+		entry.Mapping = mapping
+		entry.Route = route
+		entry.Capture = capture.NewFlow(metadata, rule, rawPc.Chains())
+		entry.Allow(dst)
+		if actual, stored := natTable.Store(key, entry); !stored {
+			// the session has been created by another dial meanwhile
+			_ = pc.Close()
+			actual.Allow(dst)
+			handle()
+			return
+		}
 
-		go handleUDPToLocal(writeBackProxy, pc, key, oAddrPort, fAddr)
+		go handleUDPToLocal(writeBackProxy, entry, key, oAddrPort, fAddr)
 
 		handle()
 	}()
@@ -466,6 +613,9 @@ func handleTCPConn(connCtx C.ConnContext) {
 			// we now have a domain name
 			preHandleFailed = false
 		}
+		if metadata.HTTP == nil && Tunnel.ShouldParseHTTP() {
+			sniffer.Dispatcher.SniffHTTPRequest(conn, metadata)
+		}
 	}
 
 	// If both trials have failed, we can do nothing but give up
@@ -475,6 +625,26 @@ func handleTCPConn(connCtx C.ConnContext) {
 		return
 	}
 
+	if m := mitm.Default(); m != nil && !metadata.SkipMITM && m.Match(metadata.Host) {
+		_ = conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		b, _ := conn.Peek(1)
+		if len(b) == 1 && b[0] != 0x16 {
+			// long enough for the methods of the plain HTTP requests
+			b, _ = conn.Peek(8)
+		}
+		_ = conn.SetReadDeadline(time.Time{})
+		switch {
+		case len(b) > 0 && b[0] == 0x16: // TLS handshake record
+			log.Debugln("[MITM] %s --> %s intercepted", metadata.SourceDetail(), metadata.RemoteAddress())
+			m.Handle(conn, metadata, Tunnel)
+			return
+		case mitm.IsHTTPRequest(b):
+			log.Debugln("[MITM] %s --> %s intercepted as plain HTTP", metadata.SourceDetail(), metadata.RemoteAddress())
+			m.HandleHTTP(conn, metadata, Tunnel)
+			return
+		}
+	}
+
 	peekMutex := sync.Mutex{}
 	if !conn.Peeked() {
 		peekMutex.Lock()
@@ -508,7 +678,8 @@ func handleTCPConn(connCtx C.ConnContext) {
 
 	ctx, cancel := context.WithTimeout(context.Background(), C.DefaultTCPTimeout)
 	defer cancel()
-	remoteConn, err := retry(ctx, func(ctx context.Context) (remoteConn C.Conn, err error) {
+	ctx = withDialerContext(ctx, metadata, rule)
+	dialRemote := func(ctx context.Context) (remoteConn C.Conn, err error) {
 		remoteConn, err = proxy.DialContext(ctx, dialMetadata)
 		if err != nil {
 			return
@@ -538,7 +709,8 @@ func handleTCPConn(connCtx C.ConnContext) {
 			}
 		}
 		return
-	}, func(err error) {
+	}
+	onError := func(err error) {
 		if rule == nil {
 			log.Warnln(
 				"[TCP] dial %s %s --> %s error: %s",
@@ -550,9 +722,22 @@ func handleTCPConn(connCtx C.ConnContext) {
 		} else {
 			log.Warnln("[TCP] dial %s (match %s/%s) %s --> %s error: %s", proxy.Name(), rule.RuleType().String(), rule.Payload(), metadata.SourceDetail(), metadata.RemoteAddress(), err.Error())
 		}
-	})
+	}
+	remoteConn, err := retry(ctx, retryPolicy(rule), dialRemote, onError)
 	if err != nil {
-		return
+		fallback := fallbackProxy(rule, proxy, metadata, err)
+		if fallback == nil {
+			return
+		}
+		log.Warnln("[TCP] %s --> %s fallback from %s to %s", metadata.SourceDetail(), metadata.RemoteAddress(), proxy.Name(), fallback.Name())
+		proxy = fallback
+		ctx, cancel := context.WithTimeout(context.Background(), C.DefaultTCPTimeout)
+		defer cancel()
+		ctx = withDialerContext(ctx, metadata, rule)
+		remoteConn, err = retry(ctx, retryPolicy(rule), dialRemote, onError)
+		if err != nil {
+			return
+		}
 	}
 
 	remoteConn = statistic.NewTCPTracker(remoteConn, statistic.DefaultManager, metadata, rule, 0, int64(peekLen), true)
@@ -585,9 +770,32 @@ func handleTCPConn(connCtx C.ConnContext) {
 	peekMutex.Lock()
 	defer peekMutex.Unlock()
 	_ = conn.SetReadDeadline(time.Time{}) // reset
+	if flow := capture.NewFlow(metadata, rule, remoteConn.Chains()); flow != nil {
+		// the peeked payload has been written to remoteConn in handshake
+		flow.WriteTCP(true, peekBytes)
+		handleSocket(conn, capture.WrapConn(remoteConn, flow))
+		return
+	}
 	handleSocket(conn, remoteConn)
 }
 
+// withDialerContext saves the client and the options of the matched rule in ctx for the dialer
+func withDialerContext(ctx context.Context, metadata *C.Metadata, rule C.Rule) context.Context {
+	ctx = dialer.WithClientAddr(ctx, metadata.SrcIP)
+	ctx = dialer.WithInboundDSCP(ctx, metadata.DSCP)
+	if rule == nil || rule.Options() == nil {
+		return ctx
+	}
+	var options []dialer.Option
+	if dscp := rule.Options().DSCP; dscp != 0 {
+		options = append(options, dialer.WithDSCP(dscp))
+	}
+	if ttl := rule.Options().TTL; ttl != 0 {
+		options = append(options, dialer.WithTTL(ttl))
+	}
+	return dialer.WithContextOptions(ctx, options...)
+}
+
 func shouldResolveIP(rule C.Rule, metadata *C.Metadata) bool {
 	return rule.ShouldResolveIP() && metadata.Host != "" && !metadata.DstIP.IsValid()
 }
@@ -597,7 +805,7 @@ func match(metadata *C.Metadata) (C.Proxy, C.Rule, error) {
 	defer configMux.RUnlock()
 	var (
 		resolved             bool
-		attemptProcessLookup = metadata.Type != C.INNER
+		attemptProcessLookup = metadata.Type != C.INNER && !findProcessMode.Off()
 	)
 
 	if node, ok := resolver.DefaultHosts.Search(metadata.Host, false); ok {
@@ -605,8 +813,33 @@ func match(metadata *C.Metadata) (C.Proxy, C.Rule, error) {
 		resolved = true
 	}
 
-	for _, rule := range getRules(metadata) {
+	if attemptProcessLookup && findProcessMode.Always() {
+		// the process is a part of the cache key when it is always looked up
+		attemptProcessLookup = false
+		findProcess(metadata)
+	}
+
+	matchRules, idx := getRules(metadata)
+
+	cache := ruleCache.Load()
+	var (
+		key     ruleCacheKey
+		version uint64
+	)
+	if cache != nil {
+		key = newRuleCacheKey(metadata)
+		version = RP.Version()
+		if adapter, rule, ok := cachedMatch(cache, key, version, matchRules, metadata); ok {
+			ruleCacheHits.Add(1)
+			return adapter, rule, nil
+		}
+	}
+	lazyProcess := attemptProcessLookup
+	resolvedByRules := false
+
+	prepare := func(rule C.Rule) {
 		if !resolved && shouldResolveIP(rule, metadata) {
+			resolvedByRules = true
 			func() {
 				ctx, cancel := context.WithTimeout(context.Background(), resolver.DefaultDNSTimeout)
 				defer cancel()
@@ -621,67 +854,94 @@ func match(metadata *C.Metadata) (C.Proxy, C.Rule, error) {
 			}()
 		}
 
-		if attemptProcessLookup && !findProcessMode.Off() && (findProcessMode.Always() || rule.ShouldFindProcess()) {
+		if attemptProcessLookup && rule.ShouldFindProcess() {
 			attemptProcessLookup = false
-			if !features.CMFA {
-				// normal check for process
-				uid, path, err := P.FindProcessName(metadata.NetWork.String(), metadata.SrcIP, int(metadata.SrcPort))
-				if err != nil {
-					log.Debugln("[Process] find process %s error: %v", metadata.String(), err)
-				} else {
-					metadata.Process = filepath.Base(path)
-					metadata.ProcessPath = path
-					metadata.Uid = uid
-				}
-			} else {
-				// check package names
-				pkg, err := P.FindPackageName(metadata)
-				if err != nil {
-					log.Debugln("[Process] find process %s error: %v", metadata.String(), err)
-				} else {
-					metadata.Process = pkg
-				}
-			}
+			findProcess(metadata)
 		}
+	}
 
-		if matched, ada := rule.Match(metadata); matched {
-			adapter, ok := proxies[ada]
-			if !ok {
-				continue
-			}
-
-			// parse multi-layer nesting
-			passed := false
-			for adapter := adapter; adapter != nil; adapter = adapter.Unwrap(metadata, false) {
-				if adapter.Type() == C.Pass {
-					passed = true
-					break
-				}
-			}
-			if passed {
-				log.Debugln("%s match Pass rule", adapter.Name())
-				continue
-			}
+	var skipped []string
+	for i, ada := idx.Next(metadata, 0, prepare); i >= 0; i, ada = idx.Next(metadata, i+1, prepare) {
+		adapter, ok := proxies[ada]
+		if !ok {
+			continue
+		}
 
-			if metadata.NetWork == C.UDP && !adapter.SupportUDP() {
-				log.Debugln("%s UDP is not supported", adapter.Name())
-				continue
-			}
+		if !acceptProxy(adapter, metadata) {
+			skipped = append(skipped, ada)
+			continue
+		}
 
-			return adapter, rule, nil
+		if cache != nil {
+			storeMatch(cache, key, &ruleCacheEntry{rule: i, adapter: ada, skipped: skipped, version: version}, matchRules[:i+1], lazyProcess, resolvedByRules)
 		}
+		return adapter, matchRules[i], nil
 	}
 
+	if cache != nil {
+		storeMatch(cache, key, &ruleCacheEntry{rule: -1, skipped: skipped, version: version}, matchRules, lazyProcess, resolvedByRules)
+	}
 	return proxies["DIRECT"], nil, nil
 }
 
-func getRules(metadata *C.Metadata) []C.Rule {
+// routeOf returns the names of the proxy and of the proxies it selects for metadata,
+// e.g. "Proxy/HK", and the last one of them
+func routeOf(proxy C.Proxy, metadata *C.Metadata) (string, C.Proxy) {
+	names := []string{proxy.Name()}
+	for next := proxy.Unwrap(metadata, false); next != nil; next = next.Unwrap(metadata, false) {
+		proxy = next
+		names = append(names, proxy.Name())
+	}
+	return strings.Join(names, "/"), proxy
+}
+
+// acceptProxy reports whether the matched adapter can handle metadata,
+// otherwise the next matching rule is tried
+func acceptProxy(adapter C.Proxy, metadata *C.Metadata) bool {
+	// parse multi-layer nesting
+	for adapter := adapter; adapter != nil; adapter = adapter.Unwrap(metadata, false) {
+		if adapter.Type() == C.Pass {
+			log.Debugln("%s match Pass rule", adapter.Name())
+			return false
+		}
+	}
+
+	if metadata.NetWork == C.UDP && !adapter.SupportUDP() {
+		log.Debugln("%s UDP is not supported", adapter.Name())
+		return false
+	}
+	return true
+}
+
+func findProcess(metadata *C.Metadata) {
+	if !features.CMFA {
+		// normal check for process
+		uid, path, err := P.FindProcessName(metadata.NetWork.String(), metadata.SrcIP, int(metadata.SrcPort))
+		if err != nil {
+			log.Debugln("[Process] find process %s error: %v", metadata.String(), err)
+		} else {
+			metadata.Process = filepath.Base(path)
+			metadata.ProcessPath = path
+			metadata.Uid = uid
+		}
+	} else {
+		// check package names
+		pkg, err := P.FindPackageName(metadata)
+		if err != nil {
+			log.Debugln("[Process] find process %s error: %v", metadata.String(), err)
+		} else {
+			metadata.Process = pkg
+		}
+	}
+}
+
+func getRules(metadata *C.Metadata) ([]C.Rule, *index.Index) {
 	if sr, ok := subRules[metadata.SpecialRules]; ok {
 		log.Debugln("[Rule] use %s rules", metadata.SpecialRules)
-		return sr
+		return sr, subRuleIndexes[metadata.SpecialRules]
 	} else {
 		log.Debugln("[Rule] use default rules")
-		return rules
+		return rules, ruleIndex
 	}
 }
 
@@ -701,15 +961,15 @@ func shouldStopRetry(err error) bool {
 	return false
 }
 
-func retry[T any](ctx context.Context, ft func(context.Context) (T, error), fe func(err error)) (t T, err error) {
-	s := slowdown.New()
-	for i := 0; i < 10; i++ {
+func retry[T any](ctx context.Context, policy C.RetryPolicy, ft func(context.Context) (T, error), fe func(err error)) (t T, err error) {
+	s := slowdown.NewWithBackoff(policy.BackoffMin, policy.BackoffMax)
+	for i := 0; i < policy.Attempts; i++ {
 		t, err = ft(ctx)
 		if err != nil {
 			if fe != nil {
 				fe(err)
 			}
-			if shouldStopRetry(err) {
+			if shouldStopRetry(err) || !shouldRetryOn(policy.RetryOn, err) || i == policy.Attempts-1 {
 				return
 			}
 			if s.Wait(ctx) == nil {
@@ -723,3 +983,53 @@ func retry[T any](ctx context.Context, ft func(context.Context) (T, error), fe f
 	}
 	return
 }
+
+// retryPolicy returns the retry policy set by the params of rule
+func retryPolicy(rule C.Rule) C.RetryPolicy {
+	if rule != nil && rule.Options() != nil && rule.Options().Retry != nil {
+		return *rule.Options().Retry
+	}
+	return C.DefaultRetryPolicy
+}
+
+// shouldRetryOn classifies err by the errors it wraps, the errors of the outbounds wrap
+// the ones of the dialers
+func shouldRetryOn(retryOn C.RetryOn, err error) bool {
+	if retryOn == 0 {
+		return true
+	}
+	var netErr net.Error
+	if retryOn&C.RetryOnTimeout != 0 && (errors.As(err, &netErr) && netErr.Timeout() ||
+		errors.Is(err, context.DeadlineExceeded) || errors.Is(err, syscall.ETIMEDOUT)) {
+		return true
+	}
+	if retryOn&C.RetryOnRefused != 0 && errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	if retryOn&C.RetryOnReset != 0 && (errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)) {
+		return true
+	}
+	if retryOn&C.RetryOnUnreachable != 0 && (errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETUNREACH)) {
+		return true
+	}
+	return false
+}
+
+// fallbackProxy returns the fallback proxy of rule to try after proxy failed with err, or nil
+func fallbackProxy(rule C.Rule, proxy C.Proxy, metadata *C.Metadata, err error) C.Proxy {
+	if rule == nil || rule.Options() == nil || rule.Options().Fallback == "" || shouldStopRetry(err) {
+		return nil
+	}
+	configMux.RLock()
+	fallback, ok := proxies[rule.Options().Fallback]
+	configMux.RUnlock()
+	if !ok || fallback.Name() == proxy.Name() {
+		return nil
+	}
+	if metadata.NetWork == C.UDP && !fallback.SupportUDP() {
+		log.Debugln("%s UDP is not supported", fallback.Name())
+		return nil
+	}
+	return fallback
+}